@@ -6,7 +6,6 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,34 +14,54 @@ import (
 )
 
 var (
-	sessionMu       sync.Mutex
-	sessionSnapshot string
+	sessionMu      sync.Mutex
+	currentSession *session
 )
 
 // BeginSession sets a shared backup snapshot for subsequent Create calls.
+// meta is recorded in the snapshot's snapshot.json once the first target is backed up.
 // The returned function restores the previous session snapshot.
-func BeginSession() func() {
+func BeginSession(meta Metadata) func() {
 	sessionMu.Lock()
-	prev := sessionSnapshot
-	sessionSnapshot = newSnapshotName()
+	prev := currentSession
+	currentSession = newSession(meta)
 	sessionMu.Unlock()
 
 	return func() {
 		sessionMu.Lock()
-		sessionSnapshot = prev
+		currentSession = prev
 		sessionMu.Unlock()
 	}
 }
 
+// SessionName returns the snapshot name used by the active session, or "" if
+// no session is active. The snapshot directory exists only once a target has
+// been backed up.
+func SessionName() string {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if currentSession == nil {
+		return ""
+	}
+	return currentSession.name
+}
+
 // Create backs up a file or directory to the backup directory.
 // Returns the path where the backup was stored.
 func Create(targetPath string) (string, error) {
+	return CreateFor(targetPath, "")
+}
+
+// CreateFor backs up targetPath like Create and records source (the manifest
+// entry that manages the target) in the snapshot metadata.
+func CreateFor(targetPath, source string) (string, error) {
 	info, err := os.Lstat(targetPath)
 	if err != nil {
 		return "", fmt.Errorf("stat %q: %w", targetPath, err)
 	}
 
-	backupBase := filepath.Join(platform.BackupDir(), currentSnapshotName())
+	sess := activeSession()
+	backupBase := filepath.Join(platform.BackupDir(), sess.name)
 
 	backupPath, err := buildBackupPath(backupBase, targetPath)
 	if err != nil {
@@ -53,7 +72,14 @@ func Create(targetPath string) (string, error) {
 		return "", fmt.Errorf("creating backup dir: %w", err)
 	}
 
-	if info.Mode()&os.ModeSymlink != 0 {
+	entry := Entry{
+		Target: absolutePath(targetPath),
+		Source: source,
+		Mode:   fmt.Sprintf("%#o", info.Mode().Perm()),
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
 		// Backup symlink: read link target and recreate
 		linkTarget, readErr := os.Readlink(targetPath)
 		if readErr != nil {
@@ -62,30 +88,51 @@ func Create(targetPath string) (string, error) {
 		if err := os.Symlink(linkTarget, backupPath); err != nil {
 			return "", fmt.Errorf("creating backup symlink: %w", err)
 		}
-		return backupPath, nil
-	}
-
-	if info.IsDir() {
+		entry.Kind = "symlink"
+		entry.LinkDest = linkTarget
+	case info.IsDir():
 		if err := copyDir(targetPath, backupPath); err != nil {
 			return "", fmt.Errorf("backing up dir %q: %w", targetPath, err)
 		}
-		return backupPath, nil
+		entry.Kind = "dir"
+	default:
+		if err := copyFile(targetPath, backupPath, info.Mode()); err != nil {
+			return "", fmt.Errorf("backing up file %q: %w", targetPath, err)
+		}
+		sum, sumErr := fileSHA256(backupPath)
+		if sumErr != nil {
+			return "", fmt.Errorf("hashing backup of %q: %w", targetPath, sumErr)
+		}
+		entry.Kind = "file"
+		entry.Size = info.Size()
+		entry.SHA256 = sum
 	}
 
-	if err := copyFile(targetPath, backupPath, info.Mode()); err != nil {
-		return "", fmt.Errorf("backing up file %q: %w", targetPath, err)
+	entry.BackupPath = backupPath
+	if err := sess.record(backupBase, entry); err != nil {
+		return "", fmt.Errorf("writing snapshot metadata: %w", err)
 	}
 
 	return backupPath, nil
 }
 
-func currentSnapshotName() string {
+// activeSession returns the session started by BeginSession, or a one-off
+// session with its own snapshot when none is active.
+func activeSession() *session {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
-	if sessionSnapshot != "" {
-		return sessionSnapshot
+	if currentSession != nil {
+		return currentSession
 	}
-	return newSnapshotName()
+	return newSession(Metadata{})
+}
+
+func absolutePath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	return abs
 }
 
 func newSnapshotName() string {
@@ -150,41 +197,11 @@ func Rotate(keep int) (RotationResult, error) {
 		keep = 1
 	}
 
-	base := platform.BackupDir()
-	entries, err := os.ReadDir(base)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return RotationResult{}, nil
-		}
-		return RotationResult{}, fmt.Errorf("reading backup dir %q: %w", base, err)
-	}
-
-	snapshots := make([]string, 0, len(entries))
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		snapshots = append(snapshots, entry.Name())
-	}
-
-	sort.Sort(sort.Reverse(sort.StringSlice(snapshots)))
-	if len(snapshots) <= keep {
-		return RotationResult{Kept: len(snapshots), Removed: 0}, nil
-	}
-
-	toRemove := snapshots[keep:]
-	removed := 0
-	for _, snap := range toRemove {
-		if err := os.RemoveAll(filepath.Join(base, snap)); err != nil {
-			return RotationResult{Kept: keep, Removed: removed}, fmt.Errorf("removing old backup %q: %w", snap, err)
-		}
-		removed++
-	}
-
+	result, err := Prune(PruneOptions{Keep: keep})
 	return RotationResult{
-		Kept:    keep,
-		Removed: removed,
-	}, nil
+		Kept:    len(result.Kept),
+		Removed: len(result.Removed),
+	}, err
 }
 
 func copyFile(src, dst string, perm fs.FileMode) (err error) {
@@ -177,7 +177,7 @@ func TestCreateSessionGroupsBackupsIntoSingleSnapshot(t *testing.T) {
 		t.Fatalf("write srcB: %v", err)
 	}
 
-	endSession := BeginSession()
+	endSession := BeginSession(Metadata{})
 	defer endSession()
 
 	pathA, err := Create(srcA)
@@ -228,7 +228,7 @@ func TestCreateSessionStoresRepeatedTargetAsUniquePaths(t *testing.T) {
 		t.Fatalf("write src #1: %v", err)
 	}
 
-	endSession := BeginSession()
+	endSession := BeginSession(Metadata{})
 	defer endSession()
 
 	backupOne, err := Create(src)
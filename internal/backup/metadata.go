@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/version"
+)
+
+// MetadataFile is the name of the per-snapshot metadata manifest.
+const MetadataFile = "snapshot.json"
+
+// Metadata describes what produced a backup snapshot.
+type Metadata struct {
+	DotctlVersion string `json:"dotctl_version,omitempty"`
+	Reason        string `json:"reason,omitempty"` // e.g. "sync", "restore"
+	Repo          string `json:"repo,omitempty"`
+	Commit        string `json:"commit,omitempty"`
+	Profile       string `json:"profile,omitempty"`
+	Hostname      string `json:"hostname,omitempty"`
+}
+
+// snapshotManifest is the on-disk layout of snapshot.json.
+// Entry backup paths are stored relative to the snapshot directory.
+type snapshotManifest struct {
+	Metadata
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+type session struct {
+	name      string
+	createdAt time.Time
+	meta      Metadata
+	entries   []Entry
+	copies    map[string]int
+}
+
+func newSession(meta Metadata) *session {
+	now := time.Now()
+	if meta.DotctlVersion == "" {
+		meta.DotctlVersion = version.Version
+	}
+	if meta.Hostname == "" {
+		meta.Hostname, _ = os.Hostname()
+	}
+	return &session{
+		name:      now.Format(snapshotNameLayout),
+		createdAt: now,
+		meta:      meta,
+		copies:    map[string]int{},
+	}
+}
+
+// record appends entry to the session and rewrites snapshot.json.
+func (s *session) record(snapPath string, entry Entry) error {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	entry.Copy = s.copies[entry.Target]
+	s.copies[entry.Target]++
+
+	rel, err := filepath.Rel(snapPath, entry.BackupPath)
+	if err != nil {
+		return err
+	}
+	entry.BackupPath = filepath.ToSlash(rel)
+	s.entries = append(s.entries, entry)
+
+	return writeSnapshotManifest(snapPath, snapshotManifest{
+		Metadata:  s.meta,
+		CreatedAt: s.createdAt,
+		Entries:   s.entries,
+	})
+}
+
+func writeSnapshotManifest(snapPath string, m snapshotManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(snapPath, "."+MetadataFile+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filepath.Join(snapPath, MetadataFile))
+}
+
+// readSnapshotManifest loads snapshot.json from snapPath.
+// It returns (nil, nil) for snapshots created before metadata was recorded.
+func readSnapshotManifest(snapPath string) (*snapshotManifest, error) {
+	data, err := os.ReadFile(filepath.Join(snapPath, MetadataFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", MetadataFile, err)
+	}
+
+	var m snapshotManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s in %q: %w", MetadataFile, snapPath, err)
+	}
+	for i := range m.Entries {
+		m.Entries[i].BackupPath = filepath.Join(snapPath, filepath.FromSlash(m.Entries[i].BackupPath))
+	}
+	return &m, nil
+}
+
+func fileSHA256(path string) (sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
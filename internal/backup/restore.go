@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Restore replaces target with the backup stored at backupPath.
+// Files, directories and symlinks are restored as they were backed up.
+func Restore(backupPath, target string) error {
+	if err := os.RemoveAll(target); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing target before restore: %w", err)
+	}
+
+	info, err := os.Lstat(backupPath)
+	if err != nil {
+		return fmt.Errorf("stat backup %q: %w", backupPath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("creating target parent dir: %w", err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, readErr := os.Readlink(backupPath)
+		if readErr != nil {
+			return fmt.Errorf("reading backup symlink: %w", readErr)
+		}
+		if err := os.Symlink(dest, target); err != nil {
+			return fmt.Errorf("restoring symlink: %w", err)
+		}
+		return nil
+	}
+
+	if info.IsDir() {
+		if err := copyDir(backupPath, target); err != nil {
+			return fmt.Errorf("restoring directory: %w", err)
+		}
+		return nil
+	}
+
+	if err := copyFile(backupPath, target, info.Mode()); err != nil {
+		return fmt.Errorf("restoring file: %w", err)
+	}
+	return nil
+}
+
+// RestoreOptions controls RestoreSnapshot.
+type RestoreOptions struct {
+	// Paths limits the restore to these targets (or anything below them).
+	// Empty restores every entry in the snapshot.
+	Paths  []string
+	DryRun bool
+	// BackupCurrent backs up the current state of each target before it is
+	// overwritten, so a restore can itself be undone.
+	BackupCurrent bool
+}
+
+// RestoreResult describes the outcome for one restored target.
+type RestoreResult struct {
+	Target     string `json:"target"`
+	BackupPath string `json:"backup_path"`
+	Status     string `json:"status"` // "restored", "would_restore", "error"
+	SavedPath  string `json:"saved_path,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RestoreSnapshot restores entries of the named snapshot to their original targets.
+// When a target was backed up more than once in the same session, the first
+// copy (the state before the session started) is used.
+func RestoreSnapshot(name string, opts RestoreOptions) ([]RestoreResult, error) {
+	snap, err := Show(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := selectRestoreEntries(snap.Entries, opts.Paths)
+	if len(entries) == 0 {
+		if len(opts.Paths) > 0 {
+			return nil, fmt.Errorf("no entries in snapshot %s match %s", name, strings.Join(opts.Paths, ", "))
+		}
+		return []RestoreResult{}, nil
+	}
+
+	results := make([]RestoreResult, 0, len(entries))
+	failed := 0
+	for _, entry := range entries {
+		result := RestoreResult{Target: entry.Target, BackupPath: entry.BackupPath}
+		if opts.DryRun {
+			result.Status = "would_restore"
+			results = append(results, result)
+			continue
+		}
+
+		if err := verifyEntry(entry); err != nil {
+			failed++
+			result.Status = "error"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if opts.BackupCurrent {
+			if _, statErr := os.Lstat(entry.Target); statErr == nil {
+				saved, saveErr := CreateFor(entry.Target, entry.Source)
+				if saveErr != nil {
+					failed++
+					result.Status = "error"
+					result.Error = saveErr.Error()
+					results = append(results, result)
+					continue
+				}
+				result.SavedPath = saved
+			}
+		}
+
+		if err := Restore(entry.BackupPath, entry.Target); err != nil {
+			failed++
+			result.Status = "error"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Status = "restored"
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("restoring snapshot %s failed for %d target(s)", name, failed)
+	}
+	return results, nil
+}
+
+func selectRestoreEntries(entries []Entry, paths []string) []Entry {
+	seen := make(map[string]bool, len(entries))
+	selected := make([]Entry, 0, len(entries))
+
+	// Entries are sorted by target then copy index, so the first one seen
+	// for a target is the pre-session state.
+	for _, entry := range entries {
+		if seen[entry.Target] {
+			continue
+		}
+		if len(paths) > 0 && !matchesAnyPath(entry.Target, paths) {
+			continue
+		}
+		seen[entry.Target] = true
+		selected = append(selected, entry)
+	}
+	return selected
+}
+
+func matchesAnyPath(target string, paths []string) bool {
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if target == p || strings.HasPrefix(target, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyEntry checks a file backup against the checksum recorded in snapshot.json.
+func verifyEntry(entry Entry) error {
+	if entry.Kind != "file" || entry.SHA256 == "" {
+		return nil
+	}
+	sum, err := fileSHA256(entry.BackupPath)
+	if err != nil {
+		return fmt.Errorf("reading backup %q: %w", entry.BackupPath, err)
+	}
+	if sum != entry.SHA256 {
+		return fmt.Errorf("backup %q does not match recorded sha256 (snapshot may be corrupted)", entry.BackupPath)
+	}
+	return nil
+}
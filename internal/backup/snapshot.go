@@ -0,0 +1,283 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/platform"
+)
+
+const snapshotNameLayout = "20060102-150405.000000"
+
+var duplicateSuffix = regexp.MustCompile(`~(\d+)$`)
+
+// ErrSnapshotNotFound indicates the requested snapshot does not exist.
+var ErrSnapshotNotFound = errors.New("backup snapshot not found")
+
+// Snapshot describes one backup session directory.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Metadata  *Metadata `json:"metadata,omitempty"` // nil for snapshots without snapshot.json
+	Entries   []Entry   `json:"entries,omitempty"`
+}
+
+// Entry describes one backed-up target inside a snapshot.
+type Entry struct {
+	Target     string `json:"target"`
+	BackupPath string `json:"backup_path"`
+	Source     string `json:"source,omitempty"` // manifest source that manages the target
+	Kind       string `json:"kind"`             // "file", "dir", "symlink"
+	Mode       string `json:"mode,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	LinkDest   string `json:"link_dest,omitempty"`
+
+	// Copy is the index of repeated backups of the same target within one
+	// session (0 for the first backup, which holds the pre-session state).
+	Copy int `json:"copy,omitempty"`
+}
+
+// List returns all snapshots under the backup directory, newest first.
+// Entries are not populated; use Show for details.
+func List() ([]Snapshot, error) {
+	base := platform.BackupDir()
+	dirEntries, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Snapshot{}, nil
+		}
+		return nil, fmt.Errorf("reading backup dir %q: %w", base, err)
+	}
+
+	snapshots := make([]Snapshot, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+		snap := Snapshot{
+			Name:      entry.Name(),
+			Path:      filepath.Join(base, entry.Name()),
+			CreatedAt: snapshotTime(entry),
+		}
+		if m, readErr := readSnapshotManifest(snap.Path); readErr == nil && m != nil {
+			meta := m.Metadata
+			snap.Metadata = &meta
+			if !m.CreatedAt.IsZero() {
+				snap.CreatedAt = m.CreatedAt
+			}
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name > snapshots[j].Name
+	})
+	return snapshots, nil
+}
+
+// Show returns a snapshot with its backed-up entries.
+func Show(name string) (Snapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return Snapshot{}, fmt.Errorf("invalid snapshot name %q", name)
+	}
+
+	snapPath := filepath.Join(platform.BackupDir(), name)
+	info, err := os.Stat(snapPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Snapshot{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		return Snapshot{}, fmt.Errorf("reading snapshot %q: %w", name, err)
+	}
+	if !info.IsDir() {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+
+	snap := Snapshot{
+		Name:      name,
+		Path:      snapPath,
+		CreatedAt: snapshotTime(fs.FileInfoToDirEntry(info)),
+	}
+
+	m, err := readSnapshotManifest(snapPath)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if m != nil {
+		meta := m.Metadata
+		snap.Metadata = &meta
+		if !m.CreatedAt.IsZero() {
+			snap.CreatedAt = m.CreatedAt
+		}
+		snap.Entries = m.Entries
+		sortEntries(snap.Entries)
+		return snap, nil
+	}
+
+	entries, err := legacySnapshotEntries(snapPath)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap.Entries = entries
+	return snap, nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Target != entries[j].Target {
+			return entries[i].Target < entries[j].Target
+		}
+		return entries[i].Copy < entries[j].Copy
+	})
+}
+
+// legacySnapshotEntries walks the targets/ tree of a snapshot without
+// snapshot.json and maps each leaf back to the absolute target path it was
+// copied from. Backed-up directories are reported file by file.
+func legacySnapshotEntries(snapPath string) ([]Entry, error) {
+	root := filepath.Join(snapPath, "targets")
+	entries := make([]Entry, 0)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == root && os.IsNotExist(walkErr) {
+				return filepath.SkipDir
+			}
+			return walkErr
+		}
+		if path == root {
+			return nil
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		entry := Entry{BackupPath: path}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Kind = "symlink"
+			entry.LinkDest, _ = os.Readlink(path)
+		case info.IsDir():
+			children, readErr := os.ReadDir(path)
+			if readErr != nil {
+				return readErr
+			}
+			if len(children) > 0 {
+				return nil
+			}
+			entry.Kind = "dir"
+		default:
+			entry.Kind = "file"
+			entry.Size = info.Size()
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry.Target, entry.Copy = targetFromRelative(rel)
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot entries in %q: %w", snapPath, err)
+	}
+
+	sortEntries(entries)
+	return entries, nil
+}
+
+// targetFromRelative reverses targetRelativePath. Any "~N" suffix added by
+// uniqueBackupPath on a path component is stripped and reported as the copy index.
+func targetFromRelative(rel string) (string, int) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	copyIndex := 0
+	for i, part := range parts {
+		if m := duplicateSuffix.FindStringSubmatch(part); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			if n > copyIndex {
+				copyIndex = n
+			}
+			parts[i] = strings.TrimSuffix(part, m[0])
+		}
+	}
+	return string(filepath.Separator) + filepath.Join(parts...), copyIndex
+}
+
+func snapshotTime(entry fs.DirEntry) time.Time {
+	if t, err := time.ParseInLocation(snapshotNameLayout, entry.Name(), time.Local); err == nil {
+		return t
+	}
+	if info, err := entry.Info(); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// PruneOptions controls which snapshots Prune removes.
+// A snapshot is removed only when it matches every configured criterion.
+type PruneOptions struct {
+	Keep      int           // keep at least the newest Keep snapshots (0 = no limit)
+	OlderThan time.Duration // only remove snapshots older than this (0 = any age)
+	DryRun    bool
+	Now       time.Time // reference time for OlderThan (zero = time.Now())
+}
+
+// PruneResult summarizes a prune run.
+type PruneResult struct {
+	Kept    []string `json:"kept"`
+	Removed []string `json:"removed"`
+}
+
+// Prune removes snapshots according to opts.
+func Prune(opts PruneOptions) (PruneResult, error) {
+	if opts.Keep <= 0 && opts.OlderThan <= 0 {
+		return PruneResult{}, errors.New("prune requires keep or older-than")
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	snapshots, err := List()
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	result := PruneResult{Kept: []string{}, Removed: []string{}}
+	for i, snap := range snapshots {
+		remove := true
+		if opts.Keep > 0 && i < opts.Keep {
+			remove = false
+		}
+		if opts.OlderThan > 0 && now.Sub(snap.CreatedAt) <= opts.OlderThan {
+			remove = false
+		}
+
+		if !remove {
+			result.Kept = append(result.Kept, snap.Name)
+			continue
+		}
+		if !opts.DryRun {
+			if err := os.RemoveAll(snap.Path); err != nil {
+				return result, fmt.Errorf("removing old backup %q: %w", snap.Name, err)
+			}
+		}
+		result.Removed = append(result.Removed, snap.Name)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,253 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShowListsBackedUpTargets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	file := filepath.Join(dir, "home", ".zshrc")
+	link := filepath.Join(dir, "home", ".vimrc")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatalf("mkdir home: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("one"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Symlink("/tmp/elsewhere", link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	endSession := BeginSession(Metadata{})
+	defer endSession()
+
+	if _, err := Create(file); err != nil {
+		t.Fatalf("Create file #1: %v", err)
+	}
+	if _, err := Create(link); err != nil {
+		t.Fatalf("Create link: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("two"), 0o644); err != nil {
+		t.Fatalf("rewrite file: %v", err)
+	}
+	if _, err := Create(file); err != nil {
+		t.Fatalf("Create file #2: %v", err)
+	}
+
+	snapshots, err := List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("snapshots = %d, want 1", len(snapshots))
+	}
+
+	snap, err := Show(snapshots[0].Name)
+	if err != nil {
+		t.Fatalf("Show: %v", err)
+	}
+	if len(snap.Entries) != 3 {
+		t.Fatalf("entries = %+v, want 3", snap.Entries)
+	}
+
+	byKey := map[string]Entry{}
+	for _, e := range snap.Entries {
+		byKey[e.Target+"#"+string(rune('0'+e.Copy))] = e
+	}
+	if e, ok := byKey[link+"#0"]; !ok || e.Kind != "symlink" || e.LinkDest != "/tmp/elsewhere" {
+		t.Fatalf("symlink entry = %+v", e)
+	}
+	if e, ok := byKey[file+"#0"]; !ok || e.Kind != "file" {
+		t.Fatalf("file entry = %+v", e)
+	}
+	if _, ok := byKey[file+"#1"]; !ok {
+		t.Fatalf("missing repeated backup entry in %+v", snap.Entries)
+	}
+}
+
+func TestShowRejectsInvalidName(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(t.TempDir(), "config"))
+
+	if _, err := Show("../etc"); err == nil {
+		t.Fatal("expected error for path-like snapshot name")
+	}
+	if _, err := Show("20260101-000000.000000"); err == nil {
+		t.Fatal("expected error for missing snapshot")
+	}
+}
+
+func TestRestoreSnapshotUsesPreSessionCopy(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	target := filepath.Join(dir, "home", ".gitconfig")
+	other := filepath.Join(dir, "home", ".tmux.conf")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("mkdir home: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("original"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	if err := os.WriteFile(other, []byte("other-original"), 0o644); err != nil {
+		t.Fatalf("write other: %v", err)
+	}
+
+	endSession := BeginSession(Metadata{})
+	for _, p := range []string{target, other} {
+		if _, err := Create(p); err != nil {
+			t.Fatalf("Create %s: %v", p, err)
+		}
+	}
+	if err := os.WriteFile(target, []byte("intermediate"), 0o644); err != nil {
+		t.Fatalf("write intermediate: %v", err)
+	}
+	if _, err := Create(target); err != nil {
+		t.Fatalf("Create intermediate: %v", err)
+	}
+	endSession()
+
+	if err := os.WriteFile(target, []byte("broken"), 0o644); err != nil {
+		t.Fatalf("write broken: %v", err)
+	}
+	if err := os.WriteFile(other, []byte("other-broken"), 0o644); err != nil {
+		t.Fatalf("write other broken: %v", err)
+	}
+
+	snapshots, err := List()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("List = %v, %v", snapshots, err)
+	}
+
+	results, err := RestoreSnapshot(snapshots[0].Name, RestoreOptions{Paths: []string{target}})
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "restored" {
+		t.Fatalf("results = %+v, want one restored entry", results)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	if string(data) != "original" {
+		t.Fatalf("target content = %q, want %q", string(data), "original")
+	}
+
+	data, err = os.ReadFile(other)
+	if err != nil {
+		t.Fatalf("read other: %v", err)
+	}
+	if string(data) != "other-broken" {
+		t.Fatalf("other content = %q, should not be restored", string(data))
+	}
+}
+
+func TestPruneKeepAndOlderThan(t *testing.T) {
+	dir := t.TempDir()
+	configHome := filepath.Join(dir, "config")
+	backupsDir := filepath.Join(configHome, "dotctl", "backups")
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	names := []string{
+		now.AddDate(0, 0, -60).Format(snapshotNameLayout),
+		now.AddDate(0, 0, -45).Format(snapshotNameLayout),
+		now.AddDate(0, 0, -40).Format(snapshotNameLayout),
+		now.AddDate(0, 0, -1).Format(snapshotNameLayout),
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(backupsDir, name), 0o755); err != nil {
+			t.Fatalf("mkdir snapshot: %v", err)
+		}
+	}
+
+	plan, err := Prune(PruneOptions{Keep: 2, OlderThan: 30 * 24 * time.Hour, DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("Prune dry run: %v", err)
+	}
+	if len(plan.Removed) != 2 || len(plan.Kept) != 2 {
+		t.Fatalf("plan = %+v, want 2 removed and 2 kept", plan)
+	}
+	if entries, _ := os.ReadDir(backupsDir); len(entries) != 4 {
+		t.Fatalf("dry run removed snapshots: %d left", len(entries))
+	}
+
+	result, err := Prune(PruneOptions{OlderThan: 30 * 24 * time.Hour, Now: now})
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if len(result.Removed) != 3 {
+		t.Fatalf("removed = %v, want 3 snapshots older than 30d", result.Removed)
+	}
+	entries, err := os.ReadDir(backupsDir)
+	if err != nil {
+		t.Fatalf("read backups dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != names[3] {
+		t.Fatalf("remaining = %v, want only %s", entries, names[3])
+	}
+}
+
+func TestSessionWritesSnapshotMetadata(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	target := filepath.Join(dir, "home", ".ssh", "config")
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatalf("mkdir target dir: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("Host *\n"), 0o600); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	endSession := BeginSession(Metadata{Reason: "sync", Repo: "default", Commit: "abc1234", Profile: "laptop"})
+	backupPath, err := CreateFor(target, "configs/ssh/config")
+	endSession()
+	if err != nil {
+		t.Fatalf("CreateFor: %v", err)
+	}
+
+	snapshots, err := List()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("List = %v, %v", snapshots, err)
+	}
+	if _, err := os.Stat(filepath.Join(snapshots[0].Path, MetadataFile)); err != nil {
+		t.Fatalf("expected %s in snapshot: %v", MetadataFile, err)
+	}
+
+	snap, err := Show(snapshots[0].Name)
+	if err != nil {
+		t.Fatalf("Show: %v", err)
+	}
+	if snap.Metadata == nil {
+		t.Fatal("expected snapshot metadata")
+	}
+	if snap.Metadata.Profile != "laptop" || snap.Metadata.Commit != "abc1234" || snap.Metadata.DotctlVersion == "" {
+		t.Fatalf("metadata = %+v", *snap.Metadata)
+	}
+	if len(snap.Entries) != 1 {
+		t.Fatalf("entries = %+v, want 1", snap.Entries)
+	}
+	entry := snap.Entries[0]
+	if entry.Target != target || entry.Source != "configs/ssh/config" || entry.BackupPath != backupPath {
+		t.Fatalf("entry = %+v", entry)
+	}
+	if entry.Mode != "0600" || entry.Kind != "file" || len(entry.SHA256) != 64 {
+		t.Fatalf("entry metadata = %+v", entry)
+	}
+
+	// Restore refuses a backup whose content no longer matches the recorded checksum.
+	if err := os.WriteFile(backupPath, []byte("tampered"), 0o600); err != nil {
+		t.Fatalf("tamper backup: %v", err)
+	}
+	results, err := RestoreSnapshot(snap.Name, RestoreOptions{})
+	if err == nil {
+		t.Fatalf("expected checksum error, got results %+v", results)
+	}
+}
@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/backup"
+	"github.com/felipe-veas/dotctl/internal/lock"
+	"github.com/felipe-veas/dotctl/internal/logging"
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/platform"
+	"github.com/spf13/cobra"
+)
+
+func newBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Inspect, restore and prune backup snapshots",
+	}
+
+	cmd.AddCommand(
+		newBackupListCmd(),
+		newBackupShowCmd(),
+		newBackupRestoreCmd(),
+		newBackupPruneCmd(),
+	)
+
+	return cmd
+}
+
+func newBackupListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List backup snapshots (newest first)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := output.New(flagJSON)
+
+			snapshots, err := backup.List()
+			if err != nil {
+				return err
+			}
+
+			if out.IsJSON() {
+				return out.JSON(map[string]any{
+					"backup_dir": platform.BackupDir(),
+					"snapshots":  snapshots,
+				})
+			}
+
+			out.Field("Backup dir", platform.BackupDir())
+			if len(snapshots) == 0 {
+				out.Info("No backup snapshots found.")
+				return nil
+			}
+			for _, snap := range snapshots {
+				line := fmt.Sprintf("  %s  (%s)", snap.Name, formatSnapshotAge(snap.CreatedAt))
+				if meta := snap.Metadata; meta != nil && meta.Reason != "" {
+					line += " " + meta.Reason
+					if meta.Profile != "" {
+						line += " profile=" + meta.Profile
+					}
+					if meta.Commit != "" {
+						line += " commit=" + meta.Commit
+					}
+				}
+				out.Info("%s", line)
+			}
+			return nil
+		},
+	}
+}
+
+func newBackupShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <snapshot>",
+		Short: "Show the targets stored in a backup snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := output.New(flagJSON)
+
+			name, err := resolveSnapshotName(args[0])
+			if err != nil {
+				return err
+			}
+			snap, err := backup.Show(name)
+			if err != nil {
+				return err
+			}
+
+			if out.IsJSON() {
+				return out.JSON(snap)
+			}
+
+			out.Field("Snapshot", snap.Name)
+			out.Field("Created", snap.CreatedAt.Format("2006-01-02 15:04:05"))
+			out.Field("Path", snap.Path)
+			if meta := snap.Metadata; meta != nil {
+				if meta.Reason != "" {
+					out.Field("Reason", meta.Reason)
+				}
+				if meta.Repo != "" {
+					out.Field("Repo", meta.Repo)
+				}
+				if meta.Commit != "" {
+					out.Field("Commit", meta.Commit)
+				}
+				if meta.Profile != "" {
+					out.Field("Profile", meta.Profile)
+				}
+				if meta.Hostname != "" {
+					out.Field("Hostname", meta.Hostname)
+				}
+				if meta.DotctlVersion != "" {
+					out.Field("Version", meta.DotctlVersion)
+				}
+			}
+			if len(snap.Entries) == 0 {
+				out.Info("No backed-up targets in this snapshot.")
+				return nil
+			}
+
+			out.Header(fmt.Sprintf("Targets (%d):", len(snap.Entries)))
+			for _, entry := range snap.Entries {
+				label := entry.Target
+				if entry.Copy > 0 {
+					label = fmt.Sprintf("%s (copy %d)", label, entry.Copy)
+				}
+				if entry.Source != "" {
+					label = fmt.Sprintf("%s [%s]", label, entry.Source)
+				}
+				switch entry.Kind {
+				case "symlink":
+					out.Info("  %s → %s (symlink)", label, entry.LinkDest)
+				case "file":
+					out.Info("  %s (%d bytes)", label, entry.Size)
+				default:
+					out.Info("  %s (%s)", label, entry.Kind)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newBackupRestoreCmd() *cobra.Command {
+	var paths []string
+
+	cmd := &cobra.Command{
+		Use:   "restore <snapshot>",
+		Short: "Restore targets from a backup snapshot",
+		Long: "Restores backed-up targets to their original locations. " +
+			"Current files are backed up into a new snapshot before being replaced.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			out := output.New(flagJSON)
+
+			name, err := resolveSnapshotName(args[0])
+			if err != nil {
+				return err
+			}
+
+			targets := make([]string, 0, len(paths))
+			for _, p := range paths {
+				resolved, resolveErr := resolveRestorePath(p)
+				if resolveErr != nil {
+					return resolveErr
+				}
+				targets = append(targets, resolved)
+			}
+
+			if !flagDryRun && !flagForce {
+				if out.IsJSON() {
+					return fmt.Errorf("--json requires --force for backup restore (confirmation is interactive)")
+				}
+				question := fmt.Sprintf("Restore snapshot %s over current files? [y/N]: ", name)
+				confirmed, promptErr := promptYesNo(os.Stdin, os.Stdout, question)
+				if promptErr != nil {
+					return promptErr
+				}
+				if !confirmed {
+					out.Info("Restore canceled")
+					return nil
+				}
+			}
+
+			if !flagDryRun {
+				syncLock, lockErr := lock.Acquire(lock.DefaultSyncLockPath())
+				if lockErr != nil {
+					return lockErr
+				}
+				defer func() {
+					if releaseErr := syncLock.Release(); releaseErr != nil && err == nil {
+						err = fmt.Errorf("releasing sync lock: %w", releaseErr)
+					}
+				}()
+
+				endBackupSession := backup.BeginSession(backup.Metadata{Reason: "restore"})
+				defer endBackupSession()
+			}
+
+			results, restoreErr := backup.RestoreSnapshot(name, backup.RestoreOptions{
+				Paths:         targets,
+				DryRun:        flagDryRun,
+				BackupCurrent: true,
+			})
+			logging.Info("backup restore", "snapshot", name, "paths", targets, "dry_run", flagDryRun, "results", len(results), "error", restoreErr)
+
+			if out.IsJSON() {
+				if jsonErr := out.JSON(map[string]any{
+					"snapshot": name,
+					"dry_run":  flagDryRun,
+					"results":  results,
+				}); jsonErr != nil {
+					return jsonErr
+				}
+				return restoreErr
+			}
+
+			restored := 0
+			for _, r := range results {
+				switch r.Status {
+				case "restored":
+					restored++
+					if r.SavedPath != "" {
+						out.Success("%s restored (previous state saved to %s)", r.Target, r.SavedPath)
+					} else {
+						out.Success("%s restored", r.Target)
+					}
+				case "would_restore":
+					out.Info("  Would restore: %s", r.Target)
+				case "error":
+					out.Error("%s: %s", r.Target, r.Error)
+				}
+			}
+			if restoreErr != nil {
+				return restoreErr
+			}
+
+			if flagDryRun {
+				out.Info("Dry run complete: %d target(s) would be restored.", len(results))
+				return nil
+			}
+			out.Success("Restored %d target(s) from %s.", restored, name)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&paths, "path", nil, "restore only this target path (repeatable)")
+
+	return cmd
+}
+
+func newBackupPruneCmd() *cobra.Command {
+	var keep int
+	var olderThan string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old backup snapshots",
+		Long: "Removes backup snapshots. With both --keep and --older-than, a snapshot " +
+			"is removed only if it is outside the newest N and older than the given age.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			out := output.New(flagJSON)
+
+			var age time.Duration
+			if strings.TrimSpace(olderThan) != "" {
+				parsed, err := parseAge(olderThan)
+				if err != nil {
+					return err
+				}
+				age = parsed
+			}
+			if keep <= 0 && age <= 0 {
+				return fmt.Errorf("prune requires --keep or --older-than")
+			}
+
+			opts := backup.PruneOptions{Keep: keep, OlderThan: age, DryRun: true}
+			plan, err := backup.Prune(opts)
+			if err != nil {
+				return err
+			}
+
+			if !flagDryRun && len(plan.Removed) > 0 && !flagForce {
+				if out.IsJSON() {
+					return fmt.Errorf("--json requires --force for backup prune (confirmation is interactive)")
+				}
+				question := fmt.Sprintf("Remove %d backup snapshot(s)? [y/N]: ", len(plan.Removed))
+				confirmed, promptErr := promptYesNo(os.Stdin, os.Stdout, question)
+				if promptErr != nil {
+					return promptErr
+				}
+				if !confirmed {
+					out.Info("Prune canceled")
+					return nil
+				}
+			}
+
+			result := plan
+			if !flagDryRun {
+				// A running sync may be writing into the current snapshot.
+				syncLock, lockErr := lock.Acquire(lock.DefaultSyncLockPath())
+				if lockErr != nil {
+					return lockErr
+				}
+				defer func() {
+					if releaseErr := syncLock.Release(); releaseErr != nil && err == nil {
+						err = fmt.Errorf("releasing sync lock: %w", releaseErr)
+					}
+				}()
+
+				opts.DryRun = false
+				result, err = backup.Prune(opts)
+				if err != nil {
+					return err
+				}
+				logging.Info("backup prune", "kept", len(result.Kept), "removed", len(result.Removed))
+			}
+
+			if out.IsJSON() {
+				return out.JSON(map[string]any{
+					"dry_run": flagDryRun,
+					"kept":    result.Kept,
+					"removed": result.Removed,
+				})
+			}
+
+			for _, name := range result.Removed {
+				if flagDryRun {
+					out.Info("  Would remove: %s", name)
+				} else {
+					out.Info("  Removed: %s", name)
+				}
+			}
+			if flagDryRun {
+				out.Info("Dry run complete: %d would be removed, %d kept.", len(result.Removed), len(result.Kept))
+				return nil
+			}
+			out.Success("Pruned %d snapshot(s), kept %d.", len(result.Removed), len(result.Kept))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&keep, "keep", 0, "always keep the newest N snapshots")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "only remove snapshots older than this age (e.g. 30d, 2w, 12h)")
+
+	return cmd
+}
+
+// resolveSnapshotName maps the "latest" alias to the newest snapshot.
+func resolveSnapshotName(name string) (string, error) {
+	if strings.TrimSpace(name) != "latest" {
+		return strings.TrimSpace(name), nil
+	}
+
+	snapshots, err := backup.List()
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", fmt.Errorf("%w: no snapshots in %s", backup.ErrSnapshotNotFound, platform.BackupDir())
+	}
+	return snapshots[0].Name, nil
+}
+
+func resolveRestorePath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", errors.New("--path cannot be empty")
+	}
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("detecting home directory: %w", err)
+		}
+		p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("resolving path %q: %w", p, err)
+	}
+	return abs, nil
+}
+
+// parseAge parses durations like "30d", "2w" or any value accepted by time.ParseDuration.
+func parseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q (use e.g. 30d, 2w, 12h)", value)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 30d, 2w, 12h)", value)
+	}
+	return d, nil
+}
+
+func formatSnapshotAge(created time.Time) string {
+	if created.IsZero() {
+		return "unknown time"
+	}
+	age := time.Since(created).Round(time.Minute)
+	switch {
+	case age < time.Minute:
+		return created.Format("2006-01-02 15:04:05") + ", just now"
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%s, %s ago", created.Format("2006-01-02 15:04:05"), age)
+	default:
+		return fmt.Sprintf("%s, %dd ago", created.Format("2006-01-02 15:04:05"), int(age.Hours()/24))
+	}
+}
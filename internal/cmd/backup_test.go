@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAge(tt.input)
+		if err != nil {
+			t.Errorf("parseAge(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAge(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "d", "-3d", "soon"} {
+		if _, err := parseAge(bad); err == nil {
+			t.Errorf("parseAge(%q) expected error", bad)
+		}
+	}
+}
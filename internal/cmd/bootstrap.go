@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/felipe-veas/dotctl/internal/hookledger"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 	"github.com/felipe-veas/dotctl/internal/output"
 	"github.com/spf13/cobra"
@@ -14,15 +17,27 @@ type bootstrapResultJSON struct {
 }
 
 func newBootstrapCmd() *cobra.Command {
-	return &cobra.Command{
+	var reset []string
+
+	cmd := &cobra.Command{
 		Use:   "bootstrap",
 		Short: "Run bootstrap hooks from manifest.yaml",
-		Args:  cobra.NoArgs,
-		RunE:  runBootstrap,
+		Long: `Run bootstrap hooks from manifest.yaml.
+
+Hooks with run: once or run: onchange are skipped when they already ran
+(against unchanged content). Use --reset with a hook's command or
+description to forget its recorded run and force it to run again.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBootstrap(cmd, reset)
+		},
 	}
+
+	cmd.Flags().StringArrayVar(&reset, "reset", nil, "forget the recorded run of a hook (command or description) so it runs again")
+	return cmd
 }
 
-func runBootstrap(cmd *cobra.Command, args []string) error {
+func runBootstrap(cmd *cobra.Command, reset []string) error {
 	out := output.New(flagJSON)
 
 	cfg, _, err := resolveConfig()
@@ -36,7 +51,18 @@ func runBootstrap(cmd *cobra.Command, args []string) error {
 	}
 
 	bootstrapHooks := manifest.ResolveHooks(state.Manifest.Hooks.Bootstrap, state.Context)
-	results, hookErr := runHooks(out, "bootstrap", bootstrapHooks, cfg.Repo.Path, flagDryRun)
+	ctx, stop := signalContext(cmd)
+	defer stop()
+
+	env, err := newHookEnv(cfg, state.Context)
+	if err != nil {
+		return err
+	}
+	if err := resetHookRuns(out, env.Ledger, reset, flagDryRun); err != nil {
+		return err
+	}
+
+	results, hookErr := runHooks(ctx, out, "bootstrap", bootstrapHooks, env, flagDryRun)
 	response := bootstrapResultJSON{
 		Profile: cfg.Profile,
 		OS:      state.Context.OS,
@@ -68,3 +94,26 @@ func runBootstrap(cmd *cobra.Command, args []string) error {
 	out.Success("Bootstrap complete (%d hook(s)).", len(bootstrapHooks))
 	return nil
 }
+
+// resetHookRuns removes ledger entries for the named hooks. In dry-run mode
+// the ledger is only changed in memory so the report shows them running.
+func resetHookRuns(out *output.Printer, ledger *hookledger.Ledger, names []string, dryRun bool) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	for _, name := range names {
+		removed := ledger.Reset(name)
+		if removed == 0 {
+			return fmt.Errorf("no recorded run for hook %q (match its command or description)", name)
+		}
+		if !out.IsJSON() {
+			out.Info("Reset recorded run for hook %q.", name)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+	return ledger.Save()
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/config"
+	"github.com/felipe-veas/dotctl/internal/gitops"
+)
+
+// checkoutRepoBranch switches the repo to its configured branch, if any.
+// fetch updates origin first, which a fresh clone does not need.
+func checkoutRepoBranch(ctx context.Context, repo config.RepoConfig, fetch bool) error {
+	if repo.Branch == "" {
+		return nil
+	}
+	if err := repo.ValidateBranch(); err != nil {
+		return err
+	}
+	if fetch {
+		if err := gitops.Fetch(ctx, repo.Path); err != nil {
+			return err
+		}
+	}
+	return gitops.CheckoutBranch(ctx, repo.Path, repo.Branch, repo.Overlay)
+}
+
+// pullRepo pulls the repo's branch with rebase. A configured branch is
+// checked out first and is only pulled once origin has it; an overlay branch
+// is then rebased onto origin/<overlay>.
+func pullRepo(ctx context.Context, repo config.RepoConfig) (string, error) {
+	if repo.Branch == "" {
+		return gitops.PullRebaseContext(ctx, repo.Path)
+	}
+
+	if err := checkoutRepoBranch(ctx, repo, true); err != nil {
+		return "", err
+	}
+	var outputs []string
+	onRemote, err := gitops.RemoteBranchExists(ctx, repo.Path, repo.Branch)
+	if err != nil {
+		return "", err
+	}
+	if onRemote {
+		out, err := gitops.PullRebaseContext(ctx, repo.Path)
+		if err != nil {
+			return "", err
+		}
+		outputs = append(outputs, out)
+	}
+	if repo.Overlay != "" {
+		out, err := gitops.RebaseOnto(ctx, repo.Path, repo.Overlay)
+		if err != nil {
+			return "", err
+		}
+		outputs = append(outputs, out)
+	}
+	return strings.TrimSpace(strings.Join(outputs, "\n")), nil
+}
+
+// pushRepo commits and pushes local changes; an overlay branch, rewritten by
+// pullRepo, is pushed with --force-with-lease.
+func pushRepo(ctx context.Context, repo config.RepoConfig, message, profile string, now time.Time) (gitops.PushResult, error) {
+	if repo.Overlay != "" {
+		return gitops.PushOverlayContext(ctx, repo.Path, message, profile, now)
+	}
+	return gitops.PushContext(ctx, repo.Path, message, profile, now)
+}
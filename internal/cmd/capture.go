@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/logging"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+type captureResultJSON struct {
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+	Status    string `json:"status"` // captured, would_capture, declined, skipped, error
+	Encrypted bool   `json:"encrypted,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// captureOptions control how diverged targets are captured.
+type captureOptions struct {
+	Filter []string // targets (or sources) to consider; empty = all
+	DryRun bool
+	Force  bool // capture entries with policy "ask" without prompting
+	// Confirm asks whether to capture one entry; nil means non-interactive.
+	Confirm func(entry diffEntry) (bool, error)
+}
+
+func newCaptureCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "capture [target...]",
+		Short: "Copy local edits of copy-mode targets back into the repo",
+		Long: `Detect copy-mode targets whose content diverged from the repo source and
+copy them back into the repository, so the next sync does not overwrite them.
+
+Each diverged entry is shown with its diff and confirmed interactively unless
+--force is set or the entry has capture: always. Entries with capture: never
+and template entries are never captured. Sources of decrypt entries are
+re-encrypted with the repo's age recipient.`,
+		RunE: runCapture,
+	}
+}
+
+func runCapture(cmd *cobra.Command, args []string) error {
+	out := output.New(flagJSON)
+
+	cfg, _, err := resolveConfig()
+	if err != nil {
+		return err
+	}
+	state, err := resolveManifestState(cfg)
+	if err != nil {
+		return err
+	}
+
+	opts := captureOptions{Filter: args, DryRun: flagDryRun, Force: flagForce}
+	if !out.IsJSON() {
+		opts.Confirm = terminalCaptureConfirm(out, os.Stdin, os.Stdout)
+	}
+
+	results, err := captureTargets(cfg.Repo.Path, state.Actions, opts)
+	if err != nil {
+		return err
+	}
+
+	if out.IsJSON() {
+		if err := out.JSON(map[string]any{"dry_run": flagDryRun, "captured": results}); err != nil {
+			return err
+		}
+		return captureError(results)
+	}
+
+	if len(results) == 0 {
+		out.Success("No copy-mode targets diverged from the repo.")
+		return nil
+	}
+	reportCapture(out, results)
+	return captureError(results)
+}
+
+// captureTargets copies diverged copy-mode targets back into their repo
+// sources, following each entry's capture policy. Divergence is detected
+// with diffCopy, the same comparison `dotctl diff` uses.
+func captureTargets(repoPath string, actions []manifest.Action, opts captureOptions) ([]captureResultJSON, error) {
+	filter, err := captureFilter(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []captureResultJSON
+	matched := make(map[string]bool)
+	for _, action := range actions {
+		if len(filter) > 0 && !filter[action.Target] && !filter[action.Source] {
+			continue
+		}
+		matched[action.Target], matched[action.Source] = true, true
+		if action.Mode != "copy" {
+			if len(filter) > 0 {
+				results = append(results, captureResultJSON{Source: action.Source, Target: action.Target, Status: "skipped", Reason: "not a copy-mode entry"})
+			}
+			continue
+		}
+
+		sourcePath := filepath.Join(repoPath, action.Source)
+		entry := diffCopy(diffEntry{Source: action.Source, Target: action.Target, Mode: action.Mode, Decrypt: action.Decrypt, Template: action.Template, Status: "ok"}, action, sourcePath, true)
+		if entry.Status != "changed" {
+			if entry.Status == "error" {
+				results = append(results, captureResultJSON{Source: action.Source, Target: action.Target, Status: "error", Reason: entry.Reason})
+			}
+			continue
+		}
+
+		res := captureResultJSON{Source: action.Source, Target: action.Target, Encrypted: action.Decrypt, Diff: entry.Diff}
+		switch {
+		case action.Capture == manifest.CaptureNever:
+			res.Status, res.Reason = "skipped", "capture: never"
+		case action.Template:
+			res.Status, res.Reason = "skipped", "template entries are rendered and cannot be captured"
+		case opts.DryRun:
+			res.Status = "would_capture"
+		case action.Capture == manifest.CaptureAlways || opts.Force:
+			res = applyCapture(repoPath, action, sourcePath, res)
+		case opts.Confirm == nil:
+			res.Status, res.Reason = "skipped", "confirmation required (use --force or capture: always)"
+		default:
+			ok, confirmErr := opts.Confirm(entry)
+			if confirmErr != nil {
+				return results, confirmErr
+			}
+			if !ok {
+				res.Status = "declined"
+			} else {
+				res = applyCapture(repoPath, action, sourcePath, res)
+			}
+		}
+		results = append(results, res)
+	}
+
+	for _, f := range opts.Filter {
+		key, _ := captureFilterKey(f)
+		if !matched[key] {
+			return results, fmt.Errorf("%s is not a managed target or source for this profile", f)
+		}
+	}
+	return results, nil
+}
+
+func applyCapture(repoPath string, action manifest.Action, sourcePath string, res captureResultJSON) captureResultJSON {
+	var err error
+	if action.Decrypt {
+		err = captureEncrypted(repoPath, action.Target, sourcePath)
+	} else {
+		err = captureCopy(action.Target, sourcePath)
+	}
+	if err != nil {
+		res.Status, res.Reason = "error", err.Error()
+		logging.Error("capture failed", "target", action.Target, "source", action.Source, "error", err)
+		return res
+	}
+	res.Status = "captured"
+	logging.Info("captured target into repo", "target", action.Target, "source", action.Source, "encrypted", action.Decrypt)
+	return res
+}
+
+// captureCopy replaces the repo source with the target. Directories are
+// copied next to the source first and swapped in, so a failed copy leaves
+// the source intact.
+func captureCopy(target, sourcePath string) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("reading target: %w", err)
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return fmt.Errorf("reading target: %w", err)
+		}
+		return writeSourceAtomic(sourcePath, data)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(sourcePath), "."+filepath.Base(sourcePath)+".capture-*")
+	if err != nil {
+		return fmt.Errorf("staging capture: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	copied := filepath.Join(staging, "src")
+	if err := copyDir(target, copied); err != nil {
+		return fmt.Errorf("copying %s into repo: %w", target, err)
+	}
+	old := filepath.Join(staging, "old")
+	if err := os.Rename(sourcePath, old); err != nil {
+		return fmt.Errorf("replacing source: %w", err)
+	}
+	if err := os.Rename(copied, sourcePath); err != nil {
+		_ = os.Rename(old, sourcePath)
+		return fmt.Errorf("replacing source: %w", err)
+	}
+	return nil
+}
+
+// captureEncrypted re-encrypts the plaintext target for the repo recipients,
+// keeping a value-encrypted source value-encrypted. Sources encrypted by
+// sops for other key types keep their own metadata and must be edited with
+// sops.
+func captureEncrypted(repoPath, target, sourcePath string) error {
+	current, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return fmt.Errorf("reading source: %w", err)
+	}
+	structured := secrets.IsStructuredCiphertext(sourcePath, current)
+	if !structured && !secrets.IsAgeCiphertext(current) {
+		return fmt.Errorf("only age-encrypted sources can be captured; edit %s with sops instead", sourcePath)
+	}
+
+	recipients, err := secrets.FindRecipients(repoPath)
+	if err != nil {
+		return err
+	}
+	plaintext, err := os.ReadFile(target)
+	if err != nil {
+		return fmt.Errorf("reading target: %w", err)
+	}
+	var ciphertext []byte
+	if structured {
+		format, _ := secrets.StructuredFormatOf(sourcePath)
+		ciphertext, err = secrets.EncryptStructured(plaintext, format, recipients...)
+	} else {
+		ciphertext, err = secrets.EncryptBytes(plaintext, recipients...)
+	}
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %w", target, err)
+	}
+	return writeSourceAtomic(sourcePath, ciphertext)
+}
+
+// writeSourceAtomic replaces a repo file, keeping its permissions.
+func writeSourceAtomic(path string, data []byte) error {
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".capture-*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// captureFilter maps command-line arguments to the targets and sources they
+// name. Targets may use ~; sources are repo-relative.
+func captureFilter(args []string) (map[string]bool, error) {
+	filter := make(map[string]bool, len(args))
+	for _, arg := range args {
+		key, err := captureFilterKey(arg)
+		if err != nil {
+			return nil, err
+		}
+		filter[key] = true
+	}
+	return filter, nil
+}
+
+func captureFilterKey(arg string) (string, error) {
+	if arg == "~" || strings.HasPrefix(arg, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("resolving home directory: %w", err)
+		}
+		return filepath.Join(home, arg[1:]), nil
+	}
+	if filepath.IsAbs(arg) {
+		return filepath.Clean(arg), nil
+	}
+	return filepath.ToSlash(filepath.Clean(arg)), nil
+}
+
+func terminalCaptureConfirm(out *output.Printer, in io.Reader, w io.Writer) func(diffEntry) (bool, error) {
+	reader := bufio.NewReader(in)
+	return func(entry diffEntry) (bool, error) {
+		out.Warn("%s → %s (%s)", entry.Source, entry.Target, entry.Reason)
+		if d := strings.TrimSpace(entry.Diff); d != "" {
+			out.Info("%s", d)
+		}
+		return promptYesNo(reader, w, fmt.Sprintf("Capture %s into %s? [y/N]: ", entry.Target, entry.Source))
+	}
+}
+
+func reportCapture(out *output.Printer, results []captureResultJSON) {
+	for _, r := range results {
+		switch r.Status {
+		case "captured":
+			if r.Encrypted {
+				out.Success("%s → %s (captured and re-encrypted)", r.Target, r.Source)
+			} else {
+				out.Success("%s → %s (captured)", r.Target, r.Source)
+			}
+		case "would_capture":
+			out.Info("  Would capture: %s → %s", r.Target, r.Source)
+		case "declined":
+			out.Info("Not captured: %s", r.Target)
+		case "skipped":
+			out.Info("Skipped capture: %s (%s)", r.Target, r.Reason)
+		case "error":
+			out.Error("%s → %s: %s", r.Target, r.Source, r.Reason)
+		}
+	}
+}
+
+// countCaptured returns how many sources a capture run rewrote.
+func countCaptured(results []captureResultJSON) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == "captured" {
+			n++
+		}
+	}
+	return n
+}
+
+func captureError(results []captureResultJSON) error {
+	failed := 0
+	for _, r := range results {
+		if r.Status == "error" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d target(s) could not be captured", failed)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/secrets"
+)
+
+func writeCaptureFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func readCaptureFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(data)
+}
+
+func TestCaptureTargetsPolicies(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+
+	actions := make([]manifest.Action, 0)
+	for _, name := range []string{"ask", "always", "never", "same", "template"} {
+		source := "configs/" + name + ".json"
+		target := filepath.Join(home, name+".json")
+		writeCaptureFile(t, filepath.Join(repo, source), "repo\n")
+		if name == "same" {
+			writeCaptureFile(t, target, "repo\n")
+		} else {
+			writeCaptureFile(t, target, "local "+name+"\n")
+		}
+
+		action := manifest.Action{Source: source, Target: target, Mode: "copy", Capture: manifest.CaptureAsk}
+		switch name {
+		case "always":
+			action.Capture = manifest.CaptureAlways
+		case "never":
+			action.Capture = manifest.CaptureNever
+		case "template":
+			action.Template = true
+		}
+		actions = append(actions, action)
+	}
+	// Symlink entries are never capture candidates.
+	actions = append(actions, manifest.Action{Source: "configs/link", Target: filepath.Join(home, "link"), Mode: "symlink"})
+
+	results, err := captureTargets(repo, actions, captureOptions{})
+	if err != nil {
+		t.Fatalf("captureTargets: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, r := range results {
+		got[filepath.Base(r.Target)] = r.Status
+	}
+	want := map[string]string{
+		"ask.json":      "skipped", // no confirmation available
+		"always.json":   "captured",
+		"never.json":    "skipped",
+		"template.json": "skipped",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("results = %+v, want %v", results, want)
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Fatalf("%s status = %q, want %q (results %+v)", name, got[name], status, results)
+		}
+	}
+
+	if content := readCaptureFile(t, filepath.Join(repo, "configs/always.json")); content != "local always\n" {
+		t.Fatalf("always source = %q, want captured content", content)
+	}
+	if content := readCaptureFile(t, filepath.Join(repo, "configs/ask.json")); content != "repo\n" {
+		t.Fatalf("ask source = %q, want unchanged", content)
+	}
+}
+
+func TestCaptureTargetsConfirmAndFilter(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+
+	a := manifest.Action{Source: "a.conf", Target: filepath.Join(home, "a.conf"), Mode: "copy", Capture: manifest.CaptureAsk}
+	b := manifest.Action{Source: "b.conf", Target: filepath.Join(home, "b.conf"), Mode: "copy", Capture: manifest.CaptureAsk}
+	for _, act := range []manifest.Action{a, b} {
+		writeCaptureFile(t, filepath.Join(repo, act.Source), "repo\n")
+		writeCaptureFile(t, act.Target, "local\n")
+	}
+
+	var asked []string
+	opts := captureOptions{
+		Filter: []string{a.Target, "b.conf"},
+		Confirm: func(entry diffEntry) (bool, error) {
+			asked = append(asked, entry.Source)
+			return entry.Source == "a.conf", nil
+		},
+	}
+	results, err := captureTargets(repo, []manifest.Action{a, b}, opts)
+	if err != nil {
+		t.Fatalf("captureTargets: %v", err)
+	}
+	if len(asked) != 2 || results[0].Status != "captured" || results[1].Status != "declined" {
+		t.Fatalf("asked = %v, results = %+v", asked, results)
+	}
+	if !strings.Contains(results[0].Diff, "+local") {
+		t.Fatalf("diff = %q, want the local change", results[0].Diff)
+	}
+
+	if _, err := captureTargets(repo, []manifest.Action{a, b}, captureOptions{Filter: []string{"nope.conf"}}); err == nil {
+		t.Fatal("expected error for unmanaged filter")
+	}
+
+	dry, err := captureTargets(repo, []manifest.Action{b}, captureOptions{DryRun: true, Force: true})
+	if err != nil {
+		t.Fatalf("dry-run captureTargets: %v", err)
+	}
+	if dry[0].Status != "would_capture" || readCaptureFile(t, filepath.Join(repo, "b.conf")) != "repo\n" {
+		t.Fatalf("dry-run results = %+v, source should be unchanged", dry)
+	}
+}
+
+func TestCaptureDirectory(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+
+	writeCaptureFile(t, filepath.Join(repo, "app", "settings.json"), "{}\n")
+	writeCaptureFile(t, filepath.Join(repo, "app", "stale.json"), "old\n")
+	writeCaptureFile(t, filepath.Join(home, "app", "settings.json"), "{\"theme\":\"dark\"}\n")
+	writeCaptureFile(t, filepath.Join(home, "app", "keys.json"), "[]\n")
+
+	action := manifest.Action{Source: "app", Target: filepath.Join(home, "app"), Mode: "copy", Capture: manifest.CaptureAsk}
+	results, err := captureTargets(repo, []manifest.Action{action}, captureOptions{Force: true})
+	if err != nil {
+		t.Fatalf("captureTargets: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "captured" {
+		t.Fatalf("results = %+v, want captured", results)
+	}
+
+	if got := readCaptureFile(t, filepath.Join(repo, "app", "settings.json")); got != "{\"theme\":\"dark\"}\n" {
+		t.Fatalf("settings = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "app", "keys.json")); err != nil {
+		t.Fatalf("new file not captured: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "app", "stale.json")); !os.IsNotExist(err) {
+		t.Fatalf("file removed locally should be removed from source, stat err = %v", err)
+	}
+	entries, _ := os.ReadDir(repo)
+	if len(entries) != 1 {
+		t.Fatalf("staging directory left behind: %v", entries)
+	}
+}
+
+func TestCaptureEncryptedReencrypts(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+
+	id, err := secrets.GenerateIdentity(filepath.Join(t.TempDir(), "identity.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	if err := secrets.WriteRecipientFile(repo, id.PublicKey); err != nil {
+		t.Fatalf("WriteRecipientFile: %v", err)
+	}
+
+	source := filepath.Join(repo, "env", ".env.enc")
+	ciphertext, err := secrets.EncryptBytes([]byte("TOKEN=old\n"), id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptBytes: %v", err)
+	}
+	writeCaptureFile(t, source, string(ciphertext))
+	target := filepath.Join(home, ".env")
+	writeCaptureFile(t, target, "TOKEN=new\n")
+
+	if err := captureEncrypted(repo, target, source); err != nil {
+		t.Fatalf("captureEncrypted: %v", err)
+	}
+
+	plaintext, err := secrets.DecryptFileWithIdentity(source, id)
+	if err != nil {
+		t.Fatalf("DecryptFileWithIdentity: %v", err)
+	}
+	if string(plaintext) != "TOKEN=new\n" {
+		t.Fatalf("decrypted source = %q, want TOKEN=new", plaintext)
+	}
+
+	sops := filepath.Join(repo, "sops.enc.yaml")
+	writeCaptureFile(t, sops, "token: ENC[AES256_GCM,data:abc]\nsops:\n  version: 3.8.1\n")
+	if err := captureEncrypted(repo, target, sops); err == nil || !strings.Contains(err.Error(), "sops") {
+		t.Fatalf("err = %v, want sops sources rejected", err)
+	}
+
+	// A value-encrypted source stays value-encrypted.
+	structured := filepath.Join(repo, "env", "app.enc.env")
+	ciphertext, err = secrets.EncryptStructured([]byte("TOKEN=old\n"), secrets.FormatDotenv, id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+	writeCaptureFile(t, structured, string(ciphertext))
+	if err := captureEncrypted(repo, target, structured); err != nil {
+		t.Fatalf("captureEncrypted structured: %v", err)
+	}
+	data, _ := os.ReadFile(structured)
+	if !strings.HasPrefix(string(data), "TOKEN=ENC[AES256_GCM,") {
+		t.Fatalf("structured source after capture:\n%s", data)
+	}
+	if plaintext, err := secrets.DecryptFileWithIdentity(structured, id); err != nil || string(plaintext) != "TOKEN=new\n" {
+		t.Fatalf("decrypted structured source = %q, %v", plaintext, err)
+	}
+}
@@ -168,6 +168,103 @@ func TestCLISyncIntegration(t *testing.T) {
 	}
 }
 
+func TestCLISyncOverlayBranchIntegration(t *testing.T) {
+	requireGit(t)
+	env := setupCLIIntegration(t, false)
+	base := gitCmd(t, env.remotePath, "symbolic-ref", "--short", "HEAD")
+
+	if _, err := executeCLI(t,
+		"init",
+		"--repo", env.remotePath,
+		"--profile", "devserver",
+		"--path", env.clonePath,
+		"--config", env.configPath,
+		"--branch", "laptop",
+		"--overlay", base,
+	); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	gitCmd(t, env.clonePath, "config", "user.name", "integration-user")
+	gitCmd(t, env.clonePath, "config", "user.email", "integration-user@example.com")
+	gitCmd(t, env.clonePath, "config", "commit.gpgsign", "false")
+
+	// First sync publishes the host branch.
+	if _, err := executeCLI(t, "sync", "--config", env.configPath); err != nil {
+		t.Fatalf("first sync failed: %v", err)
+	}
+
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", env.remotePath, writer)
+	updated := "# shared update\n"
+	if err := os.WriteFile(filepath.Join(writer, "configs", "zsh", ".zshrc"), []byte(updated), 0o644); err != nil {
+		t.Fatalf("write shared update: %v", err)
+	}
+	gitCmd(t, writer, "add", "configs/zsh/.zshrc")
+	gitCmd(t, writer, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "shared update")
+	gitCmd(t, writer, "push", "origin", "HEAD")
+
+	// The second sync rebases the host branch onto the shared one.
+	if _, err := executeCLI(t, "sync", "--config", env.configPath); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if got := gitCmd(t, env.remotePath, "show", "laptop:configs/zsh/.zshrc"); got != strings.TrimSpace(updated) {
+		t.Fatalf("remote laptop .zshrc = %q, want the shared update", got)
+	}
+
+	raw, err := executeCLI(t, "status", "--json", "--config", env.configPath)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	var status struct {
+		Repo struct {
+			Branch   string `json:"branch"`
+			Upstream string `json:"upstream"`
+			Ahead    int    `json:"ahead"`
+			Behind   int    `json:"behind"`
+		} `json:"repo"`
+	}
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		t.Fatalf("parse status json: %v", err)
+	}
+	if status.Repo.Branch != "laptop" || status.Repo.Upstream != "origin/laptop" || status.Repo.Ahead != 0 || status.Repo.Behind != 0 {
+		t.Fatalf("status repo = %+v, want laptop in sync with origin/laptop", status.Repo)
+	}
+}
+
+func TestCLIStatusFetchIntegration(t *testing.T) {
+	requireGit(t)
+	env := setupCLIIntegration(t, false)
+	initForIntegration(t, env)
+
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", env.remotePath, writer)
+	if err := os.WriteFile(filepath.Join(writer, "configs", "zsh", ".zshrc"), []byte("# remote\n"), 0o644); err != nil {
+		t.Fatalf("write remote update: %v", err)
+	}
+	gitCmd(t, writer, "add", "configs/zsh/.zshrc")
+	gitCmd(t, writer, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "remote update")
+	gitCmd(t, writer, "push", "origin", "HEAD")
+
+	raw, err := executeCLI(t, "status", "--json", "--fetch", "--config", env.configPath)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	var status struct {
+		Repo struct {
+			Behind           int    `json:"behind"`
+			Untracked        int    `json:"untracked"`
+			LastFetch        string `json:"last_fetch"`
+			RebaseInProgress bool   `json:"rebase_in_progress"`
+		} `json:"repo"`
+	}
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		t.Fatalf("parse status json: %v", err)
+	}
+	if status.Repo.Behind != 1 || status.Repo.LastFetch == "" || status.Repo.RebaseInProgress {
+		t.Fatalf("status repo = %+v, want 1 behind after a fetch", status.Repo)
+	}
+}
+
 func TestCLIBootstrapIntegration(t *testing.T) {
 	requireGit(t)
 	env := setupCLIIntegration(t, false)
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/felipe-veas/dotctl/internal/deploystate"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/logging"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+)
+
+// maxBaseSize bounds the deployed content kept as a merge base per target.
+const maxBaseSize = 1 << 20
+
+// errCopyConflict is reported for copy-mode targets changed both in the repo
+// and locally since the last sync.
+var errCopyConflict = errors.New("changed in the repo and locally since the last sync (run dotctl resolve, or sync --force to overwrite; a backup is kept)")
+
+// checkCopyConflicts classifies copy-mode actions against what dotctl last
+// deployed. Conflicting entries are held back (unless force) and returned as
+// "conflict" results; every other action is returned for applying.
+func checkCopyConflicts(out *output.Printer, repoPath string, actions []manifest.Action, deployed *deploystate.State, force bool) ([]manifest.Action, []linker.Result) {
+	apply := make([]manifest.Action, 0, len(actions))
+	var blocked []linker.Result
+
+	for _, action := range actions {
+		base, key := recordedHash(deployed, action)
+		if action.Mode != "copy" || base == "" {
+			apply = append(apply, action)
+			continue
+		}
+
+		state, err := linker.ClassifyCopy(action, repoPath, base, key)
+		if err != nil {
+			// Let the linker report unreadable sources or targets.
+			logging.Debug("conflict check failed", "target", action.Target, "error", err)
+			apply = append(apply, action)
+			continue
+		}
+
+		switch state.Class {
+		case linker.CopyConflict:
+			if force {
+				logging.Warn("overwriting conflicting target", "target", action.Target)
+				if !out.IsJSON() {
+					out.Warn("%s: local and repo changes conflict, overwriting (--force, backup kept)", action.Target)
+				}
+				apply = append(apply, action)
+				continue
+			}
+			logging.Warn("copy conflict", "target", action.Target, "source", action.Source)
+			blocked = append(blocked, linker.Result{Action: action, Status: "conflict", Error: errCopyConflict})
+			continue
+		case linker.CopyLocalChanged:
+			if !out.IsJSON() {
+				out.Warn("%s was edited locally; the repo version will replace it (backup kept). Run `dotctl capture` first to keep the edit.", action.Target)
+			}
+		}
+		apply = append(apply, action)
+	}
+	return apply, blocked
+}
+
+// recordedHash returns the hash recorded for a copy-mode target and the key
+// its local and repo hashes are sealed with for comparison. Decrypted targets
+// recorded with a plain hash by older versions count as untracked.
+func recordedHash(deployed *deploystate.State, action manifest.Action) (string, []byte) {
+	base := deployed.Hash(action.Target)
+	if base == "" || action.Mode != "copy" || !action.Decrypt {
+		return base, nil
+	}
+	if !linker.IsSealed(base) {
+		return "", nil
+	}
+	key, err := deployed.Key()
+	if err != nil {
+		logging.Warn("reading deploy state key failed", "error", err)
+		return "", nil
+	}
+	return base, key
+}
+
+// recordDeployed stores the hash of every copy-mode target written by the
+// sync. Content is kept as a merge base for small plain files; decrypted
+// secrets are recorded by a keyed hash only.
+func recordDeployed(deployed *deploystate.State, repoPath string, results []linker.Result) {
+	changed := false
+	for _, r := range results {
+		if r.Action.Mode != "copy" || (r.Status != "copied" && r.Status != "backed_up") {
+			continue
+		}
+
+		hash, err := linker.ContentHash(r.Action.Target)
+		if err != nil {
+			logging.Warn("hashing deployed target failed", "target", r.Action.Target, "error", err)
+			continue
+		}
+
+		var base []byte
+		if r.Action.Decrypt {
+			key, keyErr := deployed.Key()
+			if keyErr != nil {
+				logging.Warn("reading deploy state key failed", "error", keyErr)
+				continue
+			}
+			hash = linker.SealHash(key, hash)
+		} else {
+			if info, statErr := os.Stat(r.Action.Target); statErr == nil && info.Mode().IsRegular() && info.Size() <= maxBaseSize {
+				base, _ = os.ReadFile(r.Action.Target)
+			}
+		}
+		if err := deployed.Record(r.Action.Target, r.Action.Source, hash, base); err != nil {
+			logging.Warn("recording deployed target failed", "target", r.Action.Target, "error", err)
+			continue
+		}
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+	if err := deployed.Save(); err != nil {
+		logging.Warn("saving deploy state failed", "path", deploystate.Path(), "error", err)
+	}
+}
+
+// classifyDiffEntry refines a copy-mode diff entry with the three-way view:
+// which side changed since the last sync, and with details the changes of
+// each side against the deployed base.
+func classifyDiffEntry(entry diffEntry, action manifest.Action, repoPath string, deployed *deploystate.State, showDetails bool) diffEntry {
+	base, key := recordedHash(deployed, action)
+	if action.Mode != "copy" || base == "" || (entry.Status != "changed" && entry.Status != "ok") {
+		return entry
+	}
+
+	state, err := linker.ClassifyCopy(action, repoPath, base, key)
+	if err != nil {
+		return entry
+	}
+	entry.Change = state.Class
+
+	switch state.Class {
+	case linker.CopyRepoChanged:
+		entry.Reason = "changed in repo since last sync"
+	case linker.CopyLocalChanged:
+		entry.Reason = "edited locally since last sync"
+	case linker.CopyConflict:
+		entry.Status = "conflict"
+		entry.Reason = "changed in repo and locally since last sync"
+		if showDetails {
+			entry.Diff = threeWayDiff(action, repoPath, deployed)
+		}
+	}
+	return entry
+}
+
+func threeWayDiff(action manifest.Action, repoPath string, deployed *deploystate.State) string {
+	base, err := deployed.Base(action.Target)
+	if err != nil {
+		return ""
+	}
+	repoData, err := linker.DeployedContent(action, filepath.Join(repoPath, action.Source))
+	if err != nil {
+		return ""
+	}
+	localData, err := os.ReadFile(action.Target)
+	if err != nil {
+		return ""
+	}
+
+	repoDiff, _ := unifiedDiff(base, repoData, "base (last sync)", "repo: "+action.Source)
+	localDiff, _ := unifiedDiff(base, localData, "base (last sync)", "local: "+action.Target)
+	return fmt.Sprintf("%s\n%s", repoDiff, localDiff)
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/decrypt"
+	"github.com/felipe-veas/dotctl/internal/deploystate"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/secrets"
+)
+
+// deployCopy writes content to both source and target and records it as deployed.
+func deployCopy(t *testing.T, repo string, deployed *deploystate.State, action manifest.Action, content string) {
+	t.Helper()
+	writeCaptureFile(t, filepath.Join(repo, action.Source), content)
+	writeCaptureFile(t, action.Target, content)
+	recordDeployed(deployed, repo, []linker.Result{{Action: action, Status: "copied"}})
+}
+
+func TestCheckCopyConflicts(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+	deployed, err := deploystate.Load(filepath.Join(t.TempDir(), "deployed.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	conflict := manifest.Action{Source: "conflict.conf", Target: filepath.Join(home, "conflict.conf"), Mode: "copy"}
+	repoOnly := manifest.Action{Source: "repo.conf", Target: filepath.Join(home, "repo.conf"), Mode: "copy"}
+	link := manifest.Action{Source: "link.conf", Target: filepath.Join(home, "link.conf"), Mode: "symlink"}
+
+	deployCopy(t, repo, deployed, conflict, "base\n")
+	deployCopy(t, repo, deployed, repoOnly, "base\n")
+	writeCaptureFile(t, filepath.Join(repo, "conflict.conf"), "repo\n")
+	writeCaptureFile(t, conflict.Target, "local\n")
+	writeCaptureFile(t, filepath.Join(repo, "repo.conf"), "repo\n")
+
+	actions := []manifest.Action{conflict, repoOnly, link}
+	apply, blocked := checkCopyConflicts(output.New(true), repo, actions, deployed, false)
+	if len(apply) != 2 || apply[0].Source != "repo.conf" || apply[1].Source != "link.conf" {
+		t.Fatalf("apply = %+v, want repo.conf and link.conf", apply)
+	}
+	if len(blocked) != 1 || blocked[0].Status != "conflict" || blocked[0].Action.Source != "conflict.conf" {
+		t.Fatalf("blocked = %+v, want conflict.conf", blocked)
+	}
+
+	forced, blocked := checkCopyConflicts(output.New(true), repo, actions, deployed, true)
+	if len(forced) != 3 || len(blocked) != 0 {
+		t.Fatalf("forced apply = %d actions, blocked = %+v", len(forced), blocked)
+	}
+
+	entry := diffAction(conflict, filepath.Join(repo, conflict.Source), true)
+	entry = classifyDiffEntry(entry, conflict, repo, deployed, true)
+	if entry.Status != "conflict" || entry.Change != linker.CopyConflict {
+		t.Fatalf("diff entry = %+v, want conflict", entry)
+	}
+	for _, want := range []string{"--- base (last sync)", "+repo", "+local"} {
+		if !strings.Contains(entry.Diff, want) {
+			t.Fatalf("three-way diff missing %q:\n%s", want, entry.Diff)
+		}
+	}
+}
+
+func TestRecordDeployedSealsDecryptedHash(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	decrypt.Forget()
+	t.Cleanup(decrypt.Forget)
+
+	id, err := secrets.GenerateIdentity(secrets.DefaultIdentityPath())
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	repo := t.TempDir()
+	plaintext := "token: hunter2\n"
+	ciphertext, err := secrets.EncryptStructured([]byte(plaintext), secrets.FormatYAML, id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+	writeCaptureFile(t, filepath.Join(repo, "app.enc.yaml"), string(ciphertext))
+
+	action := manifest.Action{
+		Source:      "app.enc.yaml",
+		Target:      filepath.Join(t.TempDir(), "app.yaml"),
+		Mode:        "copy",
+		Decrypt:     true,
+		DecryptWith: decrypt.ModeAuto,
+	}
+	writeCaptureFile(t, action.Target, plaintext)
+
+	statePath := filepath.Join(t.TempDir(), "deployed.json")
+	deployed, err := deploystate.Load(statePath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	recordDeployed(deployed, repo, []linker.Result{{Action: action, Status: "copied"}})
+
+	plainHash, err := linker.ContentHash(action.Target)
+	if err != nil {
+		t.Fatalf("ContentHash: %v", err)
+	}
+	recorded := deployed.Hash(action.Target)
+	if !linker.IsSealed(recorded) || recorded == plainHash {
+		t.Fatalf("recorded hash = %q, want a keyed hash", recorded)
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if strings.Contains(string(data), plainHash) {
+		t.Fatalf("deploy state contains the plaintext hash:\n%s", data)
+	}
+	info, err := os.Stat(statePath)
+	if err != nil {
+		t.Fatalf("stat state: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("deploy state mode = %04o, want 0600", info.Mode().Perm())
+	}
+
+	base, key := recordedHash(deployed, action)
+	state, err := linker.ClassifyCopy(action, repo, base, key)
+	if err != nil || state.Class != linker.CopyUnchanged {
+		t.Fatalf("class = %q, %v, want %q", state.Class, err, linker.CopyUnchanged)
+	}
+	writeCaptureFile(t, action.Target, "token: local\n")
+	state, err = linker.ClassifyCopy(action, repo, base, key)
+	if err != nil || state.Class != linker.CopyLocalChanged {
+		t.Fatalf("class = %q, %v, want %q", state.Class, err, linker.CopyLocalChanged)
+	}
+}
@@ -1,29 +1,68 @@
 package cmd
 
 import (
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/felipe-veas/dotctl/internal/decrypt"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 )
 
-func countDecryptActions(actions []manifest.Action) int {
-	count := 0
+// decryptBackend is the decryption tool chosen for one decrypt entry.
+type decryptBackend struct {
+	Source string
+	Mode   string // "auto", "age" or "sops"
+	Tool   decrypt.Tool
+	Err    error
+}
+
+// resolveDecryptBackends returns the backend each decrypt action will use,
+// and the first error for an action whose backend is unavailable.
+func resolveDecryptBackends(repoRoot string, actions []manifest.Action) ([]decryptBackend, error) {
+	var backends []decryptBackend
+	var firstErr error
 	for _, action := range actions {
-		if action.Decrypt {
-			count++
+		if !action.Decrypt {
+			continue
+		}
+		b := decryptBackend{Source: action.Source, Mode: action.DecryptWith}
+		if b.Mode == "" {
+			b.Mode = decrypt.ModeAuto
 		}
+		b.Tool, b.Err = decrypt.Backend(filepath.Join(repoRoot, action.Source), b.Mode)
+		if b.Err != nil && firstErr == nil {
+			firstErr = b.Err
+		}
+		backends = append(backends, b)
 	}
-	return count
+	return backends, firstErr
 }
 
-func detectDecryptToolForActions(actions []manifest.Action) (decrypt.Tool, int, error) {
-	count := countDecryptActions(actions)
-	if count == 0 {
-		return "", 0, nil
+// decryptToolSummary lists the distinct tools used by backends, e.g.
+// "builtin, sops".
+func decryptToolSummary(backends []decryptBackend) string {
+	seen := map[string]bool{}
+	var tools []string
+	for _, b := range backends {
+		if b.Tool == "" || seen[string(b.Tool)] {
+			continue
+		}
+		seen[string(b.Tool)] = true
+		tools = append(tools, string(b.Tool))
 	}
+	sort.Strings(tools)
+	return strings.Join(tools, ", ")
+}
 
-	tool, err := decrypt.DetectTool()
-	if err != nil {
-		return "", count, err
+// decryptToolLabel describes a tool for doctor output.
+func decryptToolLabel(tool decrypt.Tool) string {
+	switch tool {
+	case decrypt.ToolBuiltin:
+		return "built-in age (dotctl identity)"
+	case decrypt.ToolAGE:
+		return "age binary"
+	default:
+		return string(tool)
 	}
-	return tool, count, nil
 }
@@ -13,19 +13,27 @@ import (
 	"strings"
 
 	"github.com/felipe-veas/dotctl/internal/decrypt"
+	"github.com/felipe-veas/dotctl/internal/deploystate"
+	"github.com/felipe-veas/dotctl/internal/linker"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/secrets"
 	"github.com/spf13/cobra"
 )
 
 type diffEntry struct {
-	Source  string `json:"source"`
-	Target  string `json:"target"`
-	Mode    string `json:"mode"`
-	Decrypt bool   `json:"decrypt,omitempty"`
-	Status  string `json:"status"` // ok, changed, missing, drift, error
-	Reason  string `json:"reason,omitempty"`
-	Diff    string `json:"diff,omitempty"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Mode     string `json:"mode"`
+	Decrypt  bool   `json:"decrypt,omitempty"`
+	Template bool   `json:"template,omitempty"`
+	Status   string `json:"status"`           // ok, changed, conflict, missing, drift, perm_drift, error
+	Change   string `json:"change,omitempty"` // copy mode three-way class: repo_changed, local_changed, conflict, ...
+	Reason   string `json:"reason,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+
+	// Values lists the keys that differ in a structured (sops layout) file.
+	Values []secrets.StructuredChange `json:"values,omitempty"`
 }
 
 type diffResult struct {
@@ -34,12 +42,14 @@ type diffResult struct {
 	RepoPath string      `json:"repo_path"`
 	Entries  []diffEntry `json:"entries"`
 	Summary  struct {
-		Total   int `json:"total"`
-		OK      int `json:"ok"`
-		Changed int `json:"changed"`
-		Missing int `json:"missing"`
-		Drift   int `json:"drift"`
-		Errors  int `json:"errors"`
+		Total     int `json:"total"`
+		OK        int `json:"ok"`
+		Changed   int `json:"changed"`
+		Conflicts int `json:"conflicts"`
+		Missing   int `json:"missing"`
+		Drift     int `json:"drift"`
+		PermDrift int `json:"perm_drift"`
+		Errors    int `json:"errors"`
 	} `json:"summary"`
 }
 
@@ -71,7 +81,7 @@ func runDiff(showDetails bool) error {
 		return err
 	}
 
-	if _, decryptCount, decryptErr := detectDecryptToolForActions(state.Actions); decryptCount > 0 && decryptErr != nil {
+	if _, decryptErr := resolveDecryptBackends(cfg.Repo.Path, state.Actions); decryptErr != nil {
 		return decryptErr
 	}
 
@@ -82,9 +92,15 @@ func runDiff(showDetails bool) error {
 		Entries:  make([]diffEntry, 0, len(state.Actions)),
 	}
 
+	deployed, err := deploystate.Load(deploystate.Path())
+	if err != nil {
+		return err
+	}
+
 	for _, action := range state.Actions {
 		sourcePath := filepath.Join(cfg.Repo.Path, action.Source)
 		entry := diffAction(action, sourcePath, showDetails)
+		entry = classifyDiffEntry(entry, action, cfg.Repo.Path, deployed, showDetails)
 		result.Entries = append(result.Entries, entry)
 
 		switch entry.Status {
@@ -92,10 +108,14 @@ func runDiff(showDetails bool) error {
 			result.Summary.OK++
 		case "changed":
 			result.Summary.Changed++
+		case "conflict":
+			result.Summary.Conflicts++
 		case "missing":
 			result.Summary.Missing++
 		case "drift":
 			result.Summary.Drift++
+		case "perm_drift":
+			result.Summary.PermDrift++
 		default:
 			result.Summary.Errors++
 		}
@@ -118,10 +138,14 @@ func runDiff(showDetails bool) error {
 			continue
 		case "changed":
 			out.Warn("%s → %s (%s)", entry.Source, entry.Target, entry.Reason)
+		case "conflict":
+			out.Error("%s → %s (conflict: %s)", entry.Source, entry.Target, entry.Reason)
 		case "missing":
 			out.Warn("%s → %s (missing: %s)", entry.Source, entry.Target, entry.Reason)
 		case "drift":
 			out.Warn("%s → %s (drift: %s)", entry.Source, entry.Target, entry.Reason)
+		case "perm_drift":
+			out.Warn("%s → %s (permissions: %s)", entry.Source, entry.Target, entry.Reason)
 		case "error":
 			out.Error("%s → %s: %s", entry.Source, entry.Target, entry.Reason)
 		}
@@ -131,17 +155,20 @@ func runDiff(showDetails bool) error {
 		}
 	}
 
-	if result.Summary.Changed == 0 && result.Summary.Missing == 0 && result.Summary.Drift == 0 && result.Summary.Errors == 0 {
+	if result.Summary.Changed == 0 && result.Summary.Conflicts == 0 && result.Summary.Missing == 0 && result.Summary.Drift == 0 &&
+		result.Summary.PermDrift == 0 && result.Summary.Errors == 0 {
 		out.Success("No differences found (%d/%d entries match).", result.Summary.OK, result.Summary.Total)
 		return nil
 	}
 
 	out.Info("")
-	out.Info("Summary: %d ok, %d changed, %d missing, %d drift, %d errors",
+	out.Info("Summary: %d ok, %d changed, %d conflicts, %d missing, %d drift, %d permission drift, %d errors",
 		result.Summary.OK,
 		result.Summary.Changed,
+		result.Summary.Conflicts,
 		result.Summary.Missing,
 		result.Summary.Drift,
+		result.Summary.PermDrift,
 		result.Summary.Errors,
 	)
 	return nil
@@ -149,11 +176,12 @@ func runDiff(showDetails bool) error {
 
 func diffAction(action manifest.Action, sourcePath string, showDetails bool) diffEntry {
 	entry := diffEntry{
-		Source:  action.Source,
-		Target:  action.Target,
-		Mode:    action.Mode,
-		Decrypt: action.Decrypt,
-		Status:  "ok",
+		Source:   action.Source,
+		Target:   action.Target,
+		Mode:     action.Mode,
+		Decrypt:  action.Decrypt,
+		Template: action.Template,
+		Status:   "ok",
 	}
 
 	if _, err := os.Stat(sourcePath); err != nil {
@@ -169,14 +197,22 @@ func diffAction(action manifest.Action, sourcePath string, showDetails bool) dif
 
 	switch action.Mode {
 	case "symlink":
-		return diffSymlink(entry, sourcePath)
+		entry = diffSymlink(entry, sourcePath)
 	case "copy":
-		return diffCopy(entry, action, sourcePath, showDetails)
+		entry = diffCopy(entry, action, sourcePath, showDetails)
 	default:
 		entry.Status = "error"
 		entry.Reason = fmt.Sprintf("unsupported mode %q", action.Mode)
 		return entry
 	}
+
+	if entry.Status == "ok" {
+		if drift := linker.PermissionDrift(action); drift != "" {
+			entry.Status = "perm_drift"
+			entry.Reason = drift
+		}
+	}
+	return entry
 }
 
 func diffSymlink(entry diffEntry, sourcePath string) diffEntry {
@@ -259,6 +295,11 @@ func diffCopy(entry diffEntry, action manifest.Action, sourcePath string, showDe
 	if bytes.Equal(sourceData, targetData) {
 		return entry
 	}
+	if format, ok := secrets.StructuredFormatOf(sourcePath); ok {
+		if structuredEntry, ok := diffStructuredValues(entry, action, format, sourcePath, sourceData, targetData, sourceLabel, showDetails); ok {
+			return structuredEntry
+		}
+	}
 
 	entry.Status = "changed"
 	entry.Reason = "content differs"
@@ -270,6 +311,58 @@ func diffCopy(entry diffEntry, action manifest.Action, sourcePath string, showDe
 	return entry
 }
 
+// diffStructuredValues compares a value-encrypted YAML/JSON/dotenv/INI entry
+// key by key. Sides still encrypted are decrypted first, so fresh nonces and
+// metadata alone are not differences. ok is false when the entry involves no
+// value-encrypted file or a side cannot be decrypted.
+func diffStructuredValues(entry diffEntry, action manifest.Action, format secrets.StructuredFormat, sourcePath string, sourceData, targetData []byte, sourceLabel string, showDetails bool) (diffEntry, bool) {
+	sourceEncrypted := secrets.IsStructuredCiphertext(sourcePath, sourceData)
+	targetEncrypted := secrets.IsStructuredCiphertext(entry.Target, targetData)
+	if !action.Decrypt && !sourceEncrypted && !targetEncrypted {
+		return entry, false
+	}
+
+	var err error
+	targetLabel := entry.Target
+	if sourceEncrypted {
+		if sourceData, _, err = decrypt.DecryptFile(sourcePath, decrypt.ModeAge); err != nil {
+			return entry, false
+		}
+		sourceLabel += " (decrypted)"
+	}
+	if targetEncrypted {
+		if targetData, _, err = decrypt.DecryptFile(entry.Target, decrypt.ModeAge); err != nil {
+			return entry, false
+		}
+		targetLabel += " (decrypted)"
+	}
+	if bytes.Equal(sourceData, targetData) {
+		return entry, true
+	}
+
+	changes, err := secrets.DiffStructured(sourceData, targetData, format)
+	if err != nil {
+		return entry, false
+	}
+	entry.Status = "changed"
+	entry.Values = changes
+	if len(changes) == 0 {
+		entry.Reason = "formatting differs (values match)"
+	} else {
+		keys := make([]string, 0, len(changes))
+		for _, c := range changes {
+			keys = append(keys, fmt.Sprintf("%s (%s)", c.Key, c.Kind))
+		}
+		entry.Reason = fmt.Sprintf("%d value(s) differ: %s", len(changes), previewItems(keys, 5))
+	}
+	if showDetails {
+		if d, diffErr := unifiedDiff(sourceData, targetData, sourceLabel, targetLabel); diffErr == nil {
+			entry.Diff = d
+		}
+	}
+	return entry, true
+}
+
 func diffCopyDirectory(entry diffEntry, sourceDir string) diffEntry {
 	targetInfo, err := os.Stat(entry.Target)
 	if err != nil {
@@ -325,19 +418,19 @@ func diffCopyDirectory(entry diffEntry, sourceDir string) diffEntry {
 }
 
 func readDiffSource(action manifest.Action, sourcePath string) ([]byte, string, error) {
-	if action.Decrypt {
-		data, _, err := decrypt.DecryptFile(sourcePath)
-		if err != nil {
-			return nil, "", fmt.Errorf("decrypting source: %w", err)
-		}
-		return data, sourcePath + " (decrypted)", nil
+	data, err := linker.DeployedContent(action, sourcePath)
+	if err != nil {
+		return nil, "", err
 	}
 
-	data, err := os.ReadFile(sourcePath)
-	if err != nil {
-		return nil, "", fmt.Errorf("reading source file: %w", err)
+	label := sourcePath
+	if action.Decrypt {
+		label += " (decrypted)"
+	}
+	if action.Template {
+		label += " (rendered)"
 	}
-	return data, sourcePath, nil
+	return data, label, nil
 }
 
 func directoryDigest(root string) (map[string]string, error) {
@@ -3,9 +3,12 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/felipe-veas/dotctl/internal/decrypt"
 	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/secrets"
 )
 
 func TestDiffSymlinkDrift(t *testing.T) {
@@ -66,3 +69,130 @@ func TestDiffCopyChanged(t *testing.T) {
 		t.Fatalf("status = %q, want changed", entry.Status)
 	}
 }
+
+func TestDiffCopyTemplateComparesRenderedOutput(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "repo", "gitconfig")
+	target := filepath.Join(dir, "home", ".gitconfig")
+
+	if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+		t.Fatalf("mkdir source dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("mkdir target dir: %v", err)
+	}
+	if err := os.WriteFile(source, []byte("profile={{ .profile }}\n"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("profile=laptop\n"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	action := manifest.Action{
+		Source:   "gitconfig",
+		Target:   target,
+		Mode:     "copy",
+		Template: true,
+		Vars:     map[string]string{"profile": "laptop"},
+	}
+	entry := diffAction(action, source, false)
+	if entry.Status != "ok" {
+		t.Fatalf("status = %q, want ok (reason: %s)", entry.Status, entry.Reason)
+	}
+
+	action.Vars = map[string]string{"profile": "server"}
+	entry = diffAction(action, source, false)
+	if entry.Status != "changed" {
+		t.Fatalf("status = %q, want changed", entry.Status)
+	}
+}
+
+func TestDiffCopyPermissionDrift(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "repo", "config")
+	target := filepath.Join(dir, "home", ".ssh", "config")
+
+	if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+		t.Fatalf("mkdir source dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatalf("mkdir target dir: %v", err)
+	}
+	if err := os.WriteFile(source, []byte("Host *\n"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("Host *\n"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	action := manifest.Action{
+		Source: "config",
+		Target: target,
+		Mode:   "copy",
+		Perm:   0o600,
+	}
+	entry := diffAction(action, source, false)
+	if entry.Status != "perm_drift" {
+		t.Fatalf("status = %q, want perm_drift", entry.Status)
+	}
+	if entry.Reason != "mode 0644, want 0600" {
+		t.Fatalf("reason = %q", entry.Reason)
+	}
+}
+
+func TestDiffCopyStructuredComparesValues(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	decrypt.Forget()
+	t.Cleanup(decrypt.Forget)
+
+	id, err := secrets.GenerateIdentity(secrets.DefaultIdentityPath())
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "repo", "app.enc.yaml")
+	target := filepath.Join(dir, "home", "app.yaml")
+	if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+		t.Fatalf("mkdir source dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("mkdir target dir: %v", err)
+	}
+
+	writeEncrypted := func(path, plaintext string) {
+		t.Helper()
+		ciphertext, err := secrets.EncryptStructured([]byte(plaintext), secrets.FormatYAML, id.PublicKey)
+		if err != nil {
+			t.Fatalf("EncryptStructured: %v", err)
+		}
+		if err := os.WriteFile(path, ciphertext, 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	// Both sides encrypted with the same values but different nonces.
+	writeEncrypted(source, "db:\n  user: admin\n  password: one\n")
+	writeEncrypted(target, "db:\n  user: admin\n  password: one\n")
+	action := manifest.Action{Source: "app.enc.yaml", Target: target, Mode: "copy"}
+	if entry := diffAction(action, source, false); entry.Status != "ok" {
+		t.Fatalf("status = %q (%s), want ok for equal values", entry.Status, entry.Reason)
+	}
+
+	// A decrypted target compared against the encrypted source.
+	if err := os.WriteFile(target, []byte("db:\n  user: admin\n  password: two\n"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	action.Decrypt = true
+	action.DecryptWith = decrypt.ModeAuto
+	entry := diffAction(action, source, true)
+	if entry.Status != "changed" || len(entry.Values) != 1 || entry.Values[0].Key != "db.password" {
+		t.Fatalf("entry = %+v, want db.password changed", entry)
+	}
+	if !strings.Contains(entry.Reason, "db.password (changed)") || !strings.Contains(entry.Diff, "+  password: two") {
+		t.Fatalf("reason = %q, diff = %q", entry.Reason, entry.Diff)
+	}
+	if strings.Contains(entry.Diff, "ENC[") {
+		t.Fatalf("diff shows ciphertext:\n%s", entry.Diff)
+	}
+}
@@ -200,19 +200,19 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 	}
 
 	if manifestErr == nil {
-		decryptTool, decryptCount, decryptErr := detectDecryptToolForActions(state.Actions)
-		if decryptCount > 0 {
-			if decryptErr != nil {
-				addCheck("decrypt", false, decryptErr.Error())
+		backends, _ := resolveDecryptBackends(cfg.Repo.Path, state.Actions)
+		for _, b := range backends {
+			if b.Err != nil {
+				addCheck("decrypt", false, fmt.Sprintf("%s: %v", b.Source, b.Err))
 				if !out.IsJSON() {
-					out.Error("decrypt: %v", decryptErr)
-				}
-			} else {
-				detail := fmt.Sprintf("decrypt ready (%d entries, tool: %s)", decryptCount, decryptTool)
-				addCheck("decrypt", true, detail)
-				if !out.IsJSON() {
-					out.Success("%s", detail)
+					out.Error("decrypt %s: %v", b.Source, b.Err)
 				}
+				continue
+			}
+			detail := fmt.Sprintf("decrypt %s: %s (decrypt: %s)", b.Source, decryptToolLabel(b.Tool), b.Mode)
+			addCheck("decrypt", true, detail)
+			if !out.IsJSON() {
+				out.Success("%s", detail)
 			}
 		}
 	}
@@ -231,6 +231,9 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 		} else {
 			if secretsStatus.Identity != nil {
 				detail := fmt.Sprintf("identity: %s", secretsStatus.Identity.PrivatePath)
+				if secretsStatus.Identity.Encrypted {
+					detail += " (passphrase-protected)"
+				}
 				addCheck("secrets_identity", true, detail)
 				if !out.IsJSON() {
 					out.Success("%s", detail)
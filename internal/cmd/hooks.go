@@ -1,30 +1,100 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/felipe-veas/dotctl/internal/config"
+	"github.com/felipe-veas/dotctl/internal/hookledger"
+	"github.com/felipe-veas/dotctl/internal/linker"
 	"github.com/felipe-veas/dotctl/internal/logging"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/profile"
 )
 
+// hookCancelGrace is how long a hook gets to exit after SIGTERM before it is killed.
+const hookCancelGrace = 5 * time.Second
+
 type hookResultJSON struct {
-	Phase       string `json:"phase"`
-	Command     string `json:"command"`
-	Description string `json:"description,omitempty"`
-	Status      string `json:"status"`
-	Output      string `json:"output,omitempty"`
-	Error       string `json:"error,omitempty"`
+	Phase       string   `json:"phase"`
+	Command     string   `json:"command"`
+	Description string   `json:"description,omitempty"`
+	Status      string   `json:"status"` // ok, error, warning, ignored, skipped, cancelled, would_run
+	OnFailure   string   `json:"on_failure,omitempty"`
+	DurationMS  int64    `json:"duration_ms"`
+	ExitCode    *int     `json:"exit_code,omitempty"`
+	TimedOut    bool     `json:"timed_out,omitempty"`
+	Reason      string   `json:"reason,omitempty"`  // why a run: once/onchange hook was skipped
+	Targets     []string `json:"targets,omitempty"` // changed targets that triggered an on_change command
+	Output      string   `json:"output,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// hookEnv is the sync context exposed to hooks.
+type hookEnv struct {
+	RepoPath string
+	Context  profile.Context
+	// ChangedTargets, when non-nil, is written to a temporary file whose path
+	// is exported as DOTCTL_CHANGED_TARGETS (one target per line).
+	ChangedTargets []string
+	// Ledger tracks run: once/onchange hooks; nil runs every hook.
+	Ledger *hookledger.Ledger
+}
+
+func newHookEnv(cfg *config.Config, ctx profile.Context) (hookEnv, error) {
+	ledger, err := hookledger.Load(hookledger.Path(cfg.Repo.Name, cfg.Repo.Path, cfg.Profile))
+	if err != nil {
+		return hookEnv{}, err
+	}
+	return hookEnv{RepoPath: cfg.Repo.Path, Context: ctx, Ledger: ledger}, nil
+}
+
+// changedTargets lists the targets a sync actually modified.
+func changedTargets(results []linker.Result) []string {
+	targets := make([]string, 0, len(results))
+	for _, r := range results {
+		switch r.Status {
+		case "created", "copied", "backed_up":
+			targets = append(targets, r.Action.Target)
+		}
+	}
+	return targets
 }
 
-func runHooks(out *output.Printer, phase string, hooks []manifest.Hook, repoPath string, dryRun bool) ([]hookResultJSON, error) {
+func (e hookEnv) environ(phase string) []string {
+	return append(os.Environ(),
+		"DOTCTL_HOOK_PHASE="+phase,
+		"DOTCTL_HOOK_REPO="+e.RepoPath,
+		"DOTCTL_PROFILE="+e.Context.Profile,
+		"DOTCTL_OS="+e.Context.OS,
+		"DOTCTL_ARCH="+e.Context.Arch,
+		"DOTCTL_HOSTNAME="+e.Context.Hostname,
+	)
+}
+
+func runHooks(ctx context.Context, out *output.Printer, phase string, hooks []manifest.Hook, env hookEnv, dryRun bool) ([]hookResultJSON, error) {
 	if len(hooks) == 0 {
 		return nil, nil
 	}
 
+	baseEnv := env.environ(phase)
+	if env.ChangedTargets != nil && !dryRun {
+		path, cleanup, err := writeChangedTargets(env.ChangedTargets)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		baseEnv = append(baseEnv, "DOTCTL_CHANGED_TARGETS="+path)
+	}
+
 	results := make([]hookResultJSON, 0, len(hooks))
 	for _, hook := range hooks {
 		result := hookResultJSON{
@@ -32,8 +102,30 @@ func runHooks(out *output.Printer, phase string, hooks []manifest.Hook, repoPath
 			Command:     hook.Command,
 			Description: hook.Description,
 		}
+		if policy := hook.FailurePolicy(); policy != manifest.OnFailureAbort {
+			result.OnFailure = policy
+		}
 		logging.Debug("hook start", "phase", phase, "command", hook.Command, "dry_run", dryRun)
 
+		var fingerprint string
+		if hook.RunPolicy() != manifest.RunAlways && env.Ledger != nil {
+			fp, err := hookledger.Fingerprint(hook, env.RepoPath, hook.WorkDir(env.RepoPath, env.Context.Home))
+			if err != nil {
+				return results, fmt.Errorf("%s hook %s: %w", phase, hook.Command, err)
+			}
+			fingerprint = fp
+			if run, reason := env.Ledger.ShouldRun(phase, hook, fp); !run {
+				result.Status = "skipped"
+				result.Reason = reason
+				if !out.IsJSON() {
+					out.Info("Skipped %s hook: %s (%s)", phase, hook.Command, reason)
+				}
+				results = append(results, result)
+				logging.Debug("hook skipped", "phase", phase, "command", hook.Command, "reason", reason)
+				continue
+			}
+		}
+
 		if dryRun {
 			result.Status = "would_run"
 			if !out.IsJSON() {
@@ -47,28 +139,129 @@ func runHooks(out *output.Printer, phase string, hooks []manifest.Hook, repoPath
 			out.Info("→ %s", hook.Command)
 		}
 
-		cmd := exec.Command("/bin/sh", "-c", hook.Command)
-		cmd.Dir = repoPath
-		cmd.Env = append(os.Environ(),
-			"DOTCTL_HOOK_PHASE="+phase,
-			"DOTCTL_HOOK_REPO="+repoPath,
-		)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return results, fmt.Errorf("%s hooks cancelled: %w", phase, ctxErr)
+		}
 
-		combined, err := cmd.CombinedOutput()
+		combined, exitCode, timedOut, elapsed, err := runHook(ctx, hook, env, baseEnv)
 		trimmed := strings.TrimSpace(string(combined))
 		result.Output = trimmed
-		if err != nil {
+		result.DurationMS = elapsed.Milliseconds()
+		result.ExitCode = exitCode
+		result.TimedOut = timedOut
+		if err == nil {
+			result.Status = "ok"
+			results = append(results, result)
+			logging.Info("hook complete", "phase", phase, "command", hook.Command, "duration", elapsed)
+			if fingerprint != "" {
+				if err := env.Ledger.Record(phase, hook, fingerprint); err != nil {
+					logging.Warn("recording hook run failed", "command", hook.Command, "error", err)
+				}
+			}
+			continue
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			result.Status = "cancelled"
+			result.Error = ctxErr.Error()
+			results = append(results, result)
+			logging.Warn("hook cancelled", "phase", phase, "command", hook.Command)
+			return results, fmt.Errorf("%s hook cancelled (%s): %w", phase, hook.Command, ctxErr)
+		}
+
+		result.Error = err.Error()
+		switch hook.FailurePolicy() {
+		case manifest.OnFailureIgnore:
+			result.Status = "ignored"
+			results = append(results, result)
+			logging.Debug("hook failed, ignored", "phase", phase, "command", hook.Command, "error", err)
+		case manifest.OnFailureWarn:
+			result.Status = "warning"
+			results = append(results, result)
+			logging.Warn("hook failed, continuing", "phase", phase, "command", hook.Command, "error", err, "output", trimmed)
+			if !out.IsJSON() {
+				out.Warn("%s hook failed (%s): %v", phase, hook.Command, err)
+			}
+		default:
 			result.Status = "error"
-			result.Error = err.Error()
 			results = append(results, result)
 			logging.Error("hook failed", "phase", phase, "command", hook.Command, "error", err, "output", trimmed)
 			return results, fmt.Errorf("%s hook failed (%s): %w", phase, hook.Command, err)
 		}
-
-		result.Status = "ok"
-		results = append(results, result)
-		logging.Info("hook complete", "phase", phase, "command", hook.Command)
 	}
 
 	return results, nil
 }
+
+// runHook executes one hook with its timeout, shell, working directory and
+// environment. exitCode is nil when the process did not run to completion.
+func runHook(ctx context.Context, hook manifest.Hook, env hookEnv, baseEnv []string) (combined []byte, exitCode *int, timedOut bool, elapsed time.Duration, err error) {
+	hookCtx := ctx
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(ctx, time.Duration(hook.Timeout))
+		defer cancel()
+	}
+
+	args := hook.ShellArgs()
+	cmd := exec.CommandContext(hookCtx, args[0], args[1:]...)
+	cmd.Dir = hook.WorkDir(env.RepoPath, env.Context.Home)
+	cmd.Env = append(append([]string{}, baseEnv...), hookEnvVars(hook.Env)...)
+	// Run the hook in its own process group so cancellation reaches the
+	// commands started by the shell, not just the shell itself.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM) }
+	cmd.WaitDelay = hookCancelGrace
+
+	start := time.Now()
+	combined, err = cmd.CombinedOutput()
+	elapsed = time.Since(start)
+
+	if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() >= 0 {
+		code := cmd.ProcessState.ExitCode()
+		exitCode = &code
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		timedOut = true
+		err = fmt.Errorf("timed out after %s", hook.Timeout)
+	}
+	return combined, exitCode, timedOut, elapsed, err
+}
+
+// hookEnvVars formats a hook's env map in a stable order.
+func hookEnvVars(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+os.ExpandEnv(vars[name]))
+	}
+	return env
+}
+
+func writeChangedTargets(targets []string) (string, func(), error) {
+	f, err := os.CreateTemp("", "dotctl-changed-targets-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("writing changed targets file: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+
+	var content string
+	if len(targets) > 0 {
+		content = strings.Join(targets, "\n") + "\n"
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("writing changed targets file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("writing changed targets file: %w", err)
+	}
+	return f.Name(), cleanup, nil
+}
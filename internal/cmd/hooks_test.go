@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/felipe-veas/dotctl/internal/hookledger"
+	"github.com/felipe-veas/dotctl/internal/linker"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/profile"
 )
 
 func TestRunHooksDryRun(t *testing.T) {
@@ -14,7 +22,7 @@ func TestRunHooksDryRun(t *testing.T) {
 		{Command: "echo second"},
 	}
 
-	results, err := runHooks(output.New(true), "bootstrap", hooks, t.TempDir(), true)
+	results, err := runHooks(context.Background(), output.New(true), "bootstrap", hooks, hookEnv{RepoPath: t.TempDir()}, true)
 	if err != nil {
 		t.Fatalf("runHooks dry-run returned error: %v", err)
 	}
@@ -33,7 +41,7 @@ func TestRunHooksExecutesCommand(t *testing.T) {
 		{Command: "printf 'hello-hook'"},
 	}
 
-	results, err := runHooks(output.New(true), "post_sync", hooks, t.TempDir(), false)
+	results, err := runHooks(context.Background(), output.New(true), "post_sync", hooks, hookEnv{RepoPath: t.TempDir()}, false)
 	if err != nil {
 		t.Fatalf("runHooks returned error: %v", err)
 	}
@@ -55,7 +63,7 @@ func TestRunHooksStopsOnError(t *testing.T) {
 		{Command: "printf 'should-not-run'"},
 	}
 
-	results, err := runHooks(output.New(true), "bootstrap", hooks, t.TempDir(), false)
+	results, err := runHooks(context.Background(), output.New(true), "bootstrap", hooks, hookEnv{RepoPath: t.TempDir()}, false)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -69,3 +77,149 @@ func TestRunHooksStopsOnError(t *testing.T) {
 		t.Fatalf("error hook status = %q, want error", results[1].Status)
 	}
 }
+
+func TestRunHooksCancelKillsHook(t *testing.T) {
+	hooks := []manifest.Hook{
+		{Command: "sleep 30"},
+		{Command: "printf 'should-not-run'"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results, err := runHooks(ctx, output.New(true), "post_sync", hooks, hookEnv{RepoPath: t.TempDir()}, false)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("hook was not killed on cancel (took %s)", elapsed)
+	}
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context error", err)
+	}
+	if len(results) != 1 || results[0].Status != "cancelled" {
+		t.Fatalf("results = %+v, want one cancelled hook", results)
+	}
+}
+
+func TestRunHooksTimeout(t *testing.T) {
+	hooks := []manifest.Hook{
+		{Command: "sleep 30", Timeout: manifest.Duration(200 * time.Millisecond)},
+	}
+
+	start := time.Now()
+	results, err := runHooks(context.Background(), output.New(true), "post_sync", hooks, hookEnv{RepoPath: t.TempDir()}, false)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("hook was not killed on timeout (took %s)", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Fatalf("err = %v, want timeout error", err)
+	}
+	if len(results) != 1 || results[0].Status != "error" || !results[0].TimedOut {
+		t.Fatalf("results = %+v, want one timed out hook", results)
+	}
+}
+
+func TestRunHooksFailurePolicies(t *testing.T) {
+	hooks := []manifest.Hook{
+		{Command: "exit 3", OnFailure: manifest.OnFailureWarn},
+		{Command: "exit 4", OnFailure: manifest.OnFailureIgnore},
+		{Command: "printf 'still-ran'"},
+	}
+
+	results, err := runHooks(context.Background(), output.New(true), "post_sync", hooks, hookEnv{RepoPath: t.TempDir()}, false)
+	if err != nil {
+		t.Fatalf("runHooks returned error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("result count = %d, want 3", len(results))
+	}
+
+	wantStatus := []string{"warning", "ignored", "ok"}
+	wantExit := []int{3, 4, 0}
+	for i, r := range results {
+		if r.Status != wantStatus[i] {
+			t.Fatalf("results[%d].Status = %q, want %q", i, r.Status, wantStatus[i])
+		}
+		if r.ExitCode == nil || *r.ExitCode != wantExit[i] {
+			t.Fatalf("results[%d].ExitCode = %v, want %d", i, r.ExitCode, wantExit[i])
+		}
+	}
+	if results[0].OnFailure != "warn" || results[2].OnFailure != "" {
+		t.Fatalf("on_failure = %q/%q, want warn/empty", results[0].OnFailure, results[2].OnFailure)
+	}
+}
+
+func TestRunHooksEnvironment(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, "scripts"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	t.Setenv("DOTCTL_TEST_BASE", "base")
+
+	hooks := []manifest.Hook{{
+		Command: `printf '%s|%s|%s|%s|%s|' "$DOTCTL_PROFILE" "$DOTCTL_OS" "$DOTCTL_HOSTNAME" "$GREETING" "$(basename "$PWD")"; cat "$DOTCTL_CHANGED_TARGETS"`,
+		Env:     map[string]string{"GREETING": "hi-$DOTCTL_TEST_BASE"},
+		Cwd:     "scripts",
+		Shell:   "/bin/sh -e",
+	}}
+	env := hookEnv{
+		RepoPath:       repo,
+		Context:        profile.Context{OS: "linux", Hostname: "box", Profile: "work"},
+		ChangedTargets: []string{"/home/u/.zshrc", "/home/u/.gitconfig"},
+	}
+
+	results, err := runHooks(context.Background(), output.New(true), "post_sync", hooks, env, false)
+	if err != nil {
+		t.Fatalf("runHooks returned error: %v", err)
+	}
+	want := "work|linux|box|hi-base|scripts|/home/u/.zshrc\n/home/u/.gitconfig"
+	if results[0].Output != want {
+		t.Fatalf("output = %q, want %q", results[0].Output, want)
+	}
+}
+
+func TestChangedTargets(t *testing.T) {
+	results := []linker.Result{
+		{Action: manifest.Action{Target: "/a"}, Status: "created"},
+		{Action: manifest.Action{Target: "/b"}, Status: "already_linked"},
+		{Action: manifest.Action{Target: "/c"}, Status: "copied"},
+		{Action: manifest.Action{Target: "/d"}, Status: "backed_up"},
+		{Action: manifest.Action{Target: "/e"}, Status: "error"},
+	}
+
+	got := strings.Join(changedTargets(results), ",")
+	if got != "/a,/c,/d" {
+		t.Fatalf("changedTargets = %q, want /a,/c,/d", got)
+	}
+}
+
+func TestRunHooksSkipsRecordedRunOnceHooks(t *testing.T) {
+	repo := t.TempDir()
+	ledger, err := hookledger.Load(filepath.Join(t.TempDir(), "ledger.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	env := hookEnv{RepoPath: repo, Ledger: ledger}
+	hooks := []manifest.Hook{
+		{Command: "printf once", Run: manifest.RunOnce},
+		{Command: "printf always"},
+	}
+
+	first, err := runHooks(context.Background(), output.New(true), "bootstrap", hooks, env, false)
+	if err != nil {
+		t.Fatalf("first runHooks: %v", err)
+	}
+	if first[0].Status != "ok" || first[1].Status != "ok" {
+		t.Fatalf("first run = %+v, want both ok", first)
+	}
+
+	second, err := runHooks(context.Background(), output.New(true), "bootstrap", hooks, env, false)
+	if err != nil {
+		t.Fatalf("second runHooks: %v", err)
+	}
+	if second[0].Status != "skipped" || second[0].Reason == "" {
+		t.Fatalf("once hook = %+v, want skipped with reason", second[0])
+	}
+	if second[1].Status != "ok" {
+		t.Fatalf("always hook status = %q, want ok", second[1].Status)
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime"
@@ -11,6 +12,7 @@ import (
 	"github.com/felipe-veas/dotctl/internal/gitops"
 	"github.com/felipe-veas/dotctl/internal/logging"
 	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +20,8 @@ func newInitCmd() *cobra.Command {
 	var repoURL string
 	var repoPath string
 	var repoName string
+	var branch string
+	var overlay string
 
 	cmd := &cobra.Command{
 		Use:   "init",
@@ -75,6 +79,16 @@ func newInitCmd() *cobra.Command {
 			if existsByName && !flagForce {
 				return fmt.Errorf("repo %q already configured; use --force to update it", repoName)
 			}
+			repo := config.RepoConfig{
+				Name:    repoName,
+				URL:     repoURL,
+				Path:    repoPath,
+				Branch:  strings.TrimSpace(branch),
+				Overlay: strings.TrimSpace(overlay),
+			}
+			if err := repo.ValidateBranch(); err != nil {
+				return err
+			}
 
 			authMethod := "ssh"
 			authUser := ""
@@ -98,6 +112,9 @@ func newInitCmd() *cobra.Command {
 			if err := gitops.Clone(repoURL, repoPath); err != nil {
 				return err
 			}
+			if err := checkoutRepoBranch(context.Background(), repo, repoAlreadyCloned); err != nil {
+				return err
+			}
 			gitignoreUpdate, err := ensureDefaultGitignorePatterns(repoPath, defaultInitGitignorePatterns)
 			if err != nil {
 				return err
@@ -113,11 +130,7 @@ func newInitCmd() *cobra.Command {
 				}
 			}
 
-			_, err = cfg.UpsertRepo(config.RepoConfig{
-				Name: repoName,
-				URL:  repoURL,
-				Path: repoPath,
-			})
+			_, err = cfg.UpsertRepo(repo)
 			if err != nil {
 				return err
 			}
@@ -156,6 +169,8 @@ func newInitCmd() *cobra.Command {
 	cmd.Flags().StringVar(&repoURL, "repo", "", "GitHub repo URL (HTTPS or SSH)")
 	cmd.Flags().StringVar(&repoPath, "path", "", "local path to clone repo (default: ~/.config/dotctl/repo)")
 	cmd.Flags().StringVar(&repoName, "name", config.DefaultRepoName, "repo name for multi-repo configs")
+	cmd.Flags().StringVar(&branch, "branch", "", "branch this machine syncs (created from --overlay or the default branch if missing)")
+	cmd.Flags().StringVar(&overlay, "overlay", "", "shared branch to rebase --branch onto on every sync (e.g. main)")
 
 	return cmd
 }
@@ -191,7 +206,13 @@ func resolveConfig() (*config.Config, string, error) {
 	}
 	cfg.Repo = activeRepo
 
-	verbosef("config: path=%s repo_name=%s repo=%s profile=%s", cfgPath, cfg.Repo.Name, cfg.Repo.Path, cfg.Profile)
+	if err := gitops.SetBackend(cfg.GitBackend); err != nil {
+		return nil, cfgPath, fmt.Errorf("config git_backend: %w", err)
+	}
+	secrets.SetSSHKeys(cfg.Secrets.SSHKeys)
+	secrets.SetPassphraseCommand(cfg.Secrets.PassphraseCommand)
+
+	verbosef("config: path=%s repo_name=%s repo=%s profile=%s git_backend=%s", cfgPath, cfg.Repo.Name, cfg.Repo.Path, cfg.Profile, gitops.CurrentBackend().Name())
 	logging.Debug(
 		"resolved config",
 		"path", cfgPath,
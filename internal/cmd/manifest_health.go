@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/felipe-veas/dotctl/internal/config"
+	"github.com/felipe-veas/dotctl/internal/linker"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 	"github.com/felipe-veas/dotctl/internal/profile"
 	"github.com/felipe-veas/dotctl/pkg/types"
@@ -74,9 +75,7 @@ func symlinkStatus(actions []manifest.Action, repoRoot string) types.SymlinkStat
 				status.Details = append(status.Details, detail)
 				continue
 			}
-			status.OK++
-			detail.Status = "ok"
-			status.Details = append(status.Details, detail)
+			status.Details = append(status.Details, permissionDetail(&status, action, detail))
 		default:
 			info, err := os.Lstat(action.Target)
 			if err != nil {
@@ -114,11 +113,23 @@ func symlinkStatus(actions []manifest.Action, repoRoot string) types.SymlinkStat
 				continue
 			}
 
-			status.OK++
-			detail.Status = "ok"
-			status.Details = append(status.Details, detail)
+			status.Details = append(status.Details, permissionDetail(&status, action, detail))
 		}
 	}
 
 	return status
 }
+
+// permissionDetail marks an otherwise healthy entry as ok or perm_drift
+// depending on its declared perm/dir_perm. Permission drift counts as drift.
+func permissionDetail(status *types.SymlinkStatus, action manifest.Action, detail types.SymlinkDetail) types.SymlinkDetail {
+	if drift := linker.PermissionDrift(action); drift != "" {
+		status.Drift++
+		detail.Status = "perm_drift"
+		detail.Error = drift
+		return detail
+	}
+	status.OK++
+	detail.Status = "ok"
+	return detail
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+)
+
+// onChangeCommand is a file entry's on_change command together with the
+// changed targets that triggered it.
+type onChangeCommand struct {
+	Command string
+	Targets []string
+}
+
+// collectOnChange returns the on_change commands for entries whose target
+// changed (or would change in dry-run), in manifest order. A command shared
+// by several entries runs once with all of their targets.
+func collectOnChange(results []linker.Result, dryRun bool) []onChangeCommand {
+	var commands []onChangeCommand
+	index := make(map[string]int)
+	for _, r := range results {
+		if len(r.Action.OnChange) == 0 || !targetChanged(r.Status, dryRun) {
+			continue
+		}
+		for _, command := range r.Action.OnChange {
+			i, ok := index[command]
+			if !ok {
+				i = len(commands)
+				index[command] = i
+				commands = append(commands, onChangeCommand{Command: command})
+			}
+			commands[i].Targets = append(commands[i].Targets, r.Action.Target)
+		}
+	}
+	return commands
+}
+
+func targetChanged(status string, dryRun bool) bool {
+	if dryRun {
+		switch status {
+		case "would_create", "would_copy", "would_backup_and_link", "would_backup_and_copy":
+			return true
+		}
+		return false
+	}
+	switch status {
+	case "created", "copied", "backed_up":
+		return true
+	}
+	return false
+}
+
+// runOnChangeHooks runs the on_change commands of changed entries. A failing
+// command is reported as a warning and does not stop the sync; only
+// cancellation returns an error.
+func runOnChangeHooks(ctx context.Context, out *output.Printer, env hookEnv, results []linker.Result, dryRun bool) ([]hookResultJSON, error) {
+	commands := collectOnChange(results, dryRun)
+	if len(commands) == 0 {
+		return nil, nil
+	}
+
+	var hookResults []hookResultJSON
+	for _, c := range commands {
+		hook := manifest.Hook{Command: c.Command, OnFailure: manifest.OnFailureWarn}
+		commandEnv := env
+		commandEnv.ChangedTargets = c.Targets
+		commandEnv.Ledger = nil
+
+		res, err := runHooks(ctx, out, "on_change", []manifest.Hook{hook}, commandEnv, dryRun)
+		for i := range res {
+			res[i].Targets = c.Targets
+		}
+		hookResults = append(hookResults, res...)
+		if err != nil {
+			return hookResults, err
+		}
+	}
+	return hookResults, nil
+}
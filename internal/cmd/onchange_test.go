@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+)
+
+func TestCollectOnChange(t *testing.T) {
+	reload := []string{"systemctl --user daemon-reload"}
+	results := []linker.Result{
+		{Action: manifest.Action{Target: "/u/.tmux.conf", OnChange: []string{"tmux source-file ~/.tmux.conf"}}, Status: "already_linked"},
+		{Action: manifest.Action{Target: "/u/a.service", OnChange: reload}, Status: "copied"},
+		{Action: manifest.Action{Target: "/u/b.service", OnChange: reload}, Status: "backed_up"},
+		{Action: manifest.Action{Target: "/u/.zshrc"}, Status: "created"},
+		{Action: manifest.Action{Target: "/u/c.service", OnChange: reload}, Status: "error"},
+	}
+
+	got := collectOnChange(results, false)
+	if len(got) != 1 {
+		t.Fatalf("commands = %+v, want only daemon-reload", got)
+	}
+	if got[0].Command != reload[0] || len(got[0].Targets) != 2 {
+		t.Fatalf("command = %+v, want daemon-reload for two targets", got[0])
+	}
+
+	dry := collectOnChange([]linker.Result{
+		{Action: manifest.Action{Target: "/u/.tmux.conf", OnChange: []string{"tmux source-file ~/.tmux.conf"}}, Status: "would_backup_and_link"},
+	}, true)
+	if len(dry) != 1 {
+		t.Fatalf("dry-run commands = %+v, want one", dry)
+	}
+}
+
+func TestRunOnChangeHooksWarnsOnFailure(t *testing.T) {
+	results := []linker.Result{
+		{Action: manifest.Action{Target: "/u/.tmux.conf", OnChange: []string{"exit 1", `cat "$DOTCTL_CHANGED_TARGETS"`}}, Status: "created"},
+	}
+
+	hookResults, err := runOnChangeHooks(context.Background(), output.New(true), hookEnv{RepoPath: t.TempDir()}, results, false)
+	if err != nil {
+		t.Fatalf("runOnChangeHooks returned error: %v", err)
+	}
+	if len(hookResults) != 2 {
+		t.Fatalf("results = %+v, want two", hookResults)
+	}
+	if hookResults[0].Status != "warning" || hookResults[0].Phase != "on_change" {
+		t.Fatalf("failing command = %+v, want on_change warning", hookResults[0])
+	}
+	if hookResults[1].Status != "ok" || hookResults[1].Output != "/u/.tmux.conf" {
+		t.Fatalf("second command = %+v, want ok listing the target", hookResults[1])
+	}
+	if len(hookResults[1].Targets) != 1 || hookResults[1].Targets[0] != "/u/.tmux.conf" {
+		t.Fatalf("targets = %v", hookResults[1].Targets)
+	}
+}
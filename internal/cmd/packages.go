@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/packages"
+	"github.com/spf13/cobra"
+)
+
+// packageRegistry returns the package managers; tests replace it with fakes.
+var packageRegistry = packages.DefaultRegistry
+
+type packagesResultJSON struct {
+	Profile string                   `json:"profile"`
+	OS      string                   `json:"os"`
+	DryRun  bool                     `json:"dry_run,omitempty"`
+	Plan    packages.Plan            `json:"plan"`
+	Install []packages.InstallResult `json:"install,omitempty"`
+}
+
+func newPackagesCmd() *cobra.Command {
+	var manager string
+
+	cmd := &cobra.Command{
+		Use:   "packages",
+		Short: "Plan and install packages declared in manifest.yaml",
+	}
+	cmd.PersistentFlags().StringVar(&manager, "manager", "", "only consider packages for this manager (brew, apt, dnf, pacman, cargo, go, npm)")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "plan",
+			Short: "Show the install commands needed for missing packages",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runPackagesPlan(cmd, manager)
+			},
+		},
+		&cobra.Command{
+			Use:   "diff",
+			Short: "Show installed and missing packages",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runPackagesDiff(cmd, manager)
+			},
+		},
+		&cobra.Command{
+			Use:   "install",
+			Short: "Install missing packages",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runPackagesInstall(cmd, manager)
+			},
+		},
+	)
+
+	return cmd
+}
+
+func buildPackagePlan(ctx context.Context, manager string) (packagesResultJSON, packages.Registry, error) {
+	cfg, _, err := resolveConfig()
+	if err != nil {
+		return packagesResultJSON{}, nil, err
+	}
+	state, err := resolveManifestState(cfg)
+	if err != nil {
+		return packagesResultJSON{}, nil, err
+	}
+
+	registry := packageRegistry()
+	if manager != "" {
+		if _, ok := registry[manager]; !ok {
+			return packagesResultJSON{}, nil, fmt.Errorf("unknown package manager %q", manager)
+		}
+	}
+
+	plan, err := packages.BuildPlan(ctx, state.Manifest.Packages, state.Context, registry, manager)
+	if err != nil {
+		return packagesResultJSON{}, nil, err
+	}
+	return packagesResultJSON{Profile: cfg.Profile, OS: state.Context.OS, Plan: plan}, registry, nil
+}
+
+func runPackagesPlan(cmd *cobra.Command, manager string) error {
+	out := output.New(flagJSON)
+
+	res, _, err := buildPackagePlan(cmd.Context(), manager)
+	if err != nil {
+		return err
+	}
+	if out.IsJSON() {
+		return out.JSON(res)
+	}
+
+	out.Header(fmt.Sprintf("Package plan (profile: %s, os: %s):", res.Profile, res.OS))
+	for _, mp := range res.Plan.Managers {
+		switch {
+		case mp.Error != "":
+			out.Warn("%s: %s (%d package(s) not checked)", mp.Manager, mp.Error, len(mp.Missing))
+		case len(mp.Missing) == 0:
+			out.Success("%s: nothing to install (%d installed)", mp.Manager, len(mp.Installed))
+		default:
+			out.Info("  %s install %s", mp.Manager, strings.Join(mp.Missing, " "))
+		}
+	}
+	reportSkippedPackageSets(out, res.Plan)
+	if len(res.Plan.Managers) == 0 {
+		out.Info("No packages declared for profile %q on %s.", res.Profile, res.OS)
+	}
+	return nil
+}
+
+func runPackagesDiff(cmd *cobra.Command, manager string) error {
+	out := output.New(flagJSON)
+
+	res, _, err := buildPackagePlan(cmd.Context(), manager)
+	if err != nil {
+		return err
+	}
+	if out.IsJSON() {
+		return out.JSON(res)
+	}
+
+	for _, mp := range res.Plan.Managers {
+		out.Header(mp.Manager + ":")
+		for _, pkg := range mp.Installed {
+			out.Success("%s", pkg)
+		}
+		for _, pkg := range mp.Missing {
+			if mp.Error != "" {
+				out.Warn("%s (unknown: %s)", pkg, mp.Error)
+			} else {
+				out.Error("%s (missing)", pkg)
+			}
+		}
+	}
+	reportSkippedPackageSets(out, res.Plan)
+
+	out.Info("")
+	out.Info("%d package(s) missing", res.Plan.MissingCount())
+	return nil
+}
+
+func runPackagesInstall(cmd *cobra.Command, manager string) error {
+	out := output.New(flagJSON)
+
+	ctx, stop := signalContext(cmd)
+	defer stop()
+
+	res, registry, err := buildPackagePlan(ctx, manager)
+	if err != nil {
+		return err
+	}
+	res.DryRun = flagDryRun
+
+	if res.Plan.MissingCount() == 0 {
+		if out.IsJSON() {
+			return out.JSON(res)
+		}
+		out.Success("All declared packages are installed.")
+		return nil
+	}
+
+	if !flagDryRun && !flagForce {
+		if out.IsJSON() {
+			return fmt.Errorf("--json requires --force for packages install (confirmation is interactive)")
+		}
+		for _, mp := range res.Plan.Managers {
+			if len(mp.Missing) > 0 {
+				out.Info("  %s: %s", mp.Manager, strings.Join(mp.Missing, " "))
+			}
+		}
+		confirmed, err := promptYesNo(os.Stdin, os.Stdout, fmt.Sprintf("Install %d package(s)? [y/N]: ", res.Plan.MissingCount()))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			out.Info("Install canceled")
+			return nil
+		}
+	}
+
+	// Keep stdout valid JSON; installer output goes to stderr instead.
+	var installOutput io.Writer = os.Stdout
+	if out.IsJSON() {
+		installOutput = os.Stderr
+	}
+
+	results, installErr := packages.Install(ctx, res.Plan, registry, flagDryRun, installOutput)
+	res.Install = results
+	if out.IsJSON() {
+		if err := out.JSON(res); err != nil {
+			return err
+		}
+		return installErr
+	}
+
+	for _, r := range results {
+		switch r.Status {
+		case "installed":
+			out.Success("%s: installed %s", r.Manager, strings.Join(r.Packages, " "))
+		case "would_install":
+			out.Info("  Would install with %s: %s", r.Manager, strings.Join(r.Packages, " "))
+		case "error":
+			out.Error("%s: %s", r.Manager, r.Error)
+		}
+	}
+	return installErr
+}
+
+func reportSkippedPackageSets(out *output.Printer, plan packages.Plan) {
+	for _, s := range plan.Skipped {
+		out.Info("Skipped: %s %s (%s)", s.Manager, strings.Join(s.Names, " "), s.Reason)
+	}
+}
@@ -1,7 +1,8 @@
 package cmd
 
 import (
-	"github.com/felipe-veas/dotctl/internal/gitops"
+	"context"
+
 	"github.com/felipe-veas/dotctl/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -34,7 +35,7 @@ func runPull(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	pullOutput, err := gitops.PullRebase(cfg.Repo.Path)
+	pullOutput, err := pullRepo(context.Background(), cfg.Repo)
 	if err != nil {
 		return err
 	}
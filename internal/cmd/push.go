@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -72,7 +73,7 @@ func runPush(message string) error {
 		}
 	}
 
-	res, err := gitops.Push(cfg.Repo.Path, message, cfg.Profile, time.Now())
+	res, err := pushRepo(context.Background(), cfg.Repo, message, cfg.Profile, time.Now())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/felipe-veas/dotctl/internal/backup"
+	"github.com/felipe-veas/dotctl/internal/journal"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/lock"
+	"github.com/felipe-veas/dotctl/internal/logging"
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+func newRecoverCmd() *cobra.Command {
+	var rollback, resume bool
+
+	cmd := &cobra.Command{
+		Use:   "recover",
+		Short: "Roll back or resume a sync that was interrupted",
+		Long: "Inspects the sync journal left behind by an interrupted sync. " +
+			"--rollback restores every target touched by that sync; " +
+			"--resume applies the actions that had not completed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if rollback && resume {
+				return errors.New("--rollback and --resume are mutually exclusive")
+			}
+			out := output.New(flagJSON)
+
+			syncLock, err := lock.Acquire(lock.DefaultSyncLockPath())
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if releaseErr := syncLock.Release(); releaseErr != nil && err == nil {
+					err = fmt.Errorf("releasing sync lock: %w", releaseErr)
+				}
+			}()
+
+			j, err := journal.Load(journal.Path())
+			if errors.Is(err, journal.ErrNoJournal) {
+				if out.IsJSON() {
+					return out.JSON(map[string]any{"journal": nil})
+				}
+				out.Success("No interrupted sync found.")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case rollback:
+				return recoverRollback(out, j)
+			case resume:
+				ctx, stop := signalContext(cmd)
+				defer stop()
+				return recoverResume(ctx, out, j)
+			default:
+				if out.IsJSON() {
+					return out.JSON(map[string]any{"journal": j.State, "path": j.Path()})
+				}
+				printJournal(out, j)
+				out.Info("")
+				out.Info("Run `dotctl recover --rollback` to undo it or `dotctl recover --resume` to finish applying it.")
+				return nil
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&rollback, "rollback", false, "restore targets touched by the interrupted sync")
+	cmd.Flags().BoolVar(&resume, "resume", false, "apply the actions the interrupted sync did not finish")
+
+	return cmd
+}
+
+// checkUnfinishedSync refuses to start a sync while a journal from an
+// interrupted one exists. Dry runs only warn. Callers must hold the sync lock.
+func checkUnfinishedSync(out *output.Printer, dryRun bool) error {
+	j, err := journal.Load(journal.Path())
+	if errors.Is(err, journal.ErrNoJournal) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logging.Warn("unfinished sync journal found", "path", j.Path(), "started_at", j.State.StartedAt, "phase", j.State.Phase)
+	if dryRun {
+		out.Warn("An interrupted sync from %s was found; run `dotctl recover` before syncing.", j.State.StartedAt.Local().Format("2006-01-02 15:04:05"))
+		return nil
+	}
+	return fmt.Errorf(
+		"an interrupted sync from %s was found (journal: %s); run `dotctl recover --rollback` or `dotctl recover --resume` first",
+		j.State.StartedAt.Local().Format("2006-01-02 15:04:05"), j.Path(),
+	)
+}
+
+func printJournal(out *output.Printer, j *journal.Journal) {
+	out.Header("Interrupted sync")
+	out.Field("Started", j.State.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	if j.State.Repo != "" {
+		out.Field("Repo", j.State.Repo)
+	}
+	out.Field("Repo path", j.State.RepoPath)
+	if j.State.Profile != "" {
+		out.Field("Profile", j.State.Profile)
+	}
+	out.Field("Phase", j.State.Phase)
+	if j.State.Snapshot != "" {
+		out.Field("Backup snapshot", j.State.Snapshot)
+	}
+	for _, e := range j.State.Entries {
+		out.Info("  %-16s %s → %s", e.Status, e.Action.Source, e.Action.Target)
+	}
+}
+
+func recoverRollback(out *output.Printer, j *journal.Journal) error {
+	if !flagDryRun && !flagForce {
+		if out.IsJSON() {
+			return fmt.Errorf("--json requires --force for recover --rollback (confirmation is interactive)")
+		}
+		printJournal(out, j)
+		confirmed, err := promptYesNo(os.Stdin, os.Stdout, "Roll back the targets changed by this sync? [y/N]: ")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			out.Info("Recover canceled")
+			return nil
+		}
+	}
+
+	results := j.RollbackResults()
+	if flagDryRun {
+		if out.IsJSON() {
+			return out.JSON(map[string]any{"dry_run": true, "rollback": syncResult(syncResultInput{Results: results, DryRun: true}).Applied})
+		}
+		for _, r := range results {
+			switch r.Status {
+			case "created", "copied":
+				out.Info("  Would remove: %s", r.Action.Target)
+			case "backed_up":
+				out.Info("  Would restore: %s from %s", r.Action.Target, r.BackupPath)
+			case "error":
+				if r.BackupPath != "" {
+					out.Info("  Would restore: %s from %s", r.Action.Target, r.BackupPath)
+				}
+			}
+		}
+		return nil
+	}
+
+	rollbackResults := linker.Rollback(results)
+	summary := linker.SummarizeRollback(rollbackResults)
+	logging.Info("recover rollback", "restored", summary.Restored, "removed", summary.Removed, "errors", summary.Errors)
+
+	if summary.Errors == 0 {
+		if err := j.Finish(); err != nil {
+			return err
+		}
+	}
+
+	if out.IsJSON() {
+		if err := out.JSON(syncResult(syncResultInput{Rollback: rollbackResults})); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range rollbackResults {
+			switch r.Status {
+			case "removed":
+				out.Success("%s removed", r.Action.Target)
+			case "restored":
+				out.Success("%s restored", r.Action.Target)
+			case "error":
+				out.Error("%s: %v", r.Action.Target, r.Error)
+			}
+		}
+	}
+
+	if summary.Errors > 0 {
+		return fmt.Errorf("rollback finished with %d error(s); the journal was kept at %s", summary.Errors, j.Path())
+	}
+	if !out.IsJSON() {
+		out.Success("Rollback complete (%d restored, %d removed).", summary.Restored, summary.Removed)
+	}
+	return nil
+}
+
+func recoverResume(ctx context.Context, out *output.Printer, j *journal.Journal) error {
+	actions, recorder := j.Unfinished()
+	if flagDryRun {
+		recorder = nil
+	} else {
+		endBackupSession := backup.BeginSession(backup.Metadata{
+			Reason:  "recover",
+			Repo:    j.State.Repo,
+			Profile: j.State.Profile,
+		})
+		defer endBackupSession()
+	}
+
+	results := linker.ApplyRecorded(ctx, actions, j.State.RepoPath, flagDryRun, recorder)
+	summary := linker.Summarize(results)
+	logging.Info("recover resume", "actions", len(actions), "errors", summary.Errors, "dry_run", flagDryRun)
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("resume cancelled; the journal was kept at %s: %w", j.Path(), ctxErr)
+	}
+
+	if !flagDryRun && summary.Errors == 0 {
+		if err := j.Finish(); err != nil {
+			return err
+		}
+	}
+
+	if out.IsJSON() {
+		if err := out.JSON(syncResult(syncResultInput{Results: results, DryRun: flagDryRun})); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			switch r.Status {
+			case "error":
+				out.Error("%s → %s: %v", r.Action.Source, r.Action.Target, r.Error)
+			case "would_create", "would_copy", "would_backup_and_link", "would_backup_and_copy":
+				out.Info("  Would apply: %s → %s", r.Action.Source, r.Action.Target)
+			default:
+				out.Success("%s → %s (%s)", r.Action.Source, r.Action.Target, r.Status)
+			}
+		}
+	}
+
+	if summary.Errors > 0 {
+		return fmt.Errorf("%d errors while resuming; the journal was kept at %s", summary.Errors, j.Path())
+	}
+	if !flagDryRun && !out.IsJSON() {
+		out.Success("Resumed %d action(s). Run `dotctl sync` to run post-sync hooks and push.", len(actions))
+	}
+	return nil
+}
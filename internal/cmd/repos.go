@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/felipe-veas/dotctl/internal/auth"
 	"github.com/felipe-veas/dotctl/internal/config"
@@ -40,19 +42,23 @@ func newReposListCmd() *cobra.Command {
 			}
 
 			type item struct {
-				Name   string `json:"name"`
-				URL    string `json:"url"`
-				Path   string `json:"path"`
-				Active bool   `json:"active"`
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Path    string `json:"path"`
+				Branch  string `json:"branch,omitempty"`
+				Overlay string `json:"overlay,omitempty"`
+				Active  bool   `json:"active"`
 			}
 
 			items := make([]item, 0, len(cfg.Repos))
 			for _, repo := range cfg.Repos {
 				items = append(items, item{
-					Name:   repo.Name,
-					URL:    repo.URL,
-					Path:   repo.Path,
-					Active: repo.Name == cfg.ActiveRepo,
+					Name:    repo.Name,
+					URL:     repo.URL,
+					Path:    repo.Path,
+					Branch:  repo.Branch,
+					Overlay: repo.Overlay,
+					Active:  repo.Name == cfg.ActiveRepo,
 				})
 			}
 
@@ -72,6 +78,13 @@ func newReposListCmd() *cobra.Command {
 				out.Info("%s %s", marker, repo.Name)
 				out.Info("    URL:  %s", repo.URL)
 				out.Info("    Path: %s", repo.Path)
+				if repo.Branch != "" {
+					if repo.Overlay != "" {
+						out.Info("    Branch: %s (overlay on %s)", repo.Branch, repo.Overlay)
+					} else {
+						out.Info("    Branch: %s", repo.Branch)
+					}
+				}
 			}
 			return nil
 		},
@@ -82,6 +95,8 @@ func newReposAddCmd() *cobra.Command {
 	var name string
 	var url string
 	var path string
+	var branch string
+	var overlay string
 	var activate bool
 
 	cmd := &cobra.Command{
@@ -112,6 +127,16 @@ func newReposAddCmd() *cobra.Command {
 					return fmt.Errorf("repo %q already configured; use --force to update", name)
 				}
 			}
+			repo := config.RepoConfig{
+				Name:    name,
+				URL:     url,
+				Path:    path,
+				Branch:  strings.TrimSpace(branch),
+				Overlay: strings.TrimSpace(overlay),
+			}
+			if err := repo.ValidateBranch(); err != nil {
+				return err
+			}
 
 			if !gitops.IsSSHURL(url) {
 				if _, err := auth.EnsureGHAuthenticated(); err != nil {
@@ -123,12 +148,11 @@ func newReposAddCmd() *cobra.Command {
 			if err := gitops.Clone(url, path); err != nil {
 				return err
 			}
+			if err := checkoutRepoBranch(context.Background(), repo, alreadyCloned); err != nil {
+				return err
+			}
 
-			if _, err := cfg.UpsertRepo(config.RepoConfig{
-				Name: name,
-				URL:  url,
-				Path: path,
-			}); err != nil {
+			if _, err := cfg.UpsertRepo(repo); err != nil {
 				return err
 			}
 			if activate {
@@ -168,6 +192,8 @@ func newReposAddCmd() *cobra.Command {
 	cmd.Flags().StringVar(&name, "name", "", "repo name")
 	cmd.Flags().StringVar(&url, "url", "", "GitHub repo URL (HTTPS or SSH)")
 	cmd.Flags().StringVar(&path, "path", "", "local path to clone repo")
+	cmd.Flags().StringVar(&branch, "branch", "", "branch this machine syncs (created from --overlay or the default branch if missing)")
+	cmd.Flags().StringVar(&overlay, "overlay", "", "shared branch to rebase --branch onto on every sync (e.g. main)")
 	cmd.Flags().BoolVar(&activate, "activate", true, "set this repo as active")
 
 	return cmd
@@ -0,0 +1,582 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/backup"
+	"github.com/felipe-veas/dotctl/internal/deploystate"
+	"github.com/felipe-veas/dotctl/internal/gitops"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/lock"
+	"github.com/felipe-veas/dotctl/internal/logging"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// Conflict resolutions. repo and local match gitops.SideRepo/SideLocal.
+const (
+	resolveRepo   = gitops.SideRepo
+	resolveLocal  = gitops.SideLocal
+	resolveMerged = "merged"
+	resolveSkip   = "skip"
+)
+
+type resolveItemJSON struct {
+	Kind       string `json:"kind"` // git (repo file in a stopped rebase) or target (copy-mode target)
+	Path       string `json:"path"` // repo-relative file or target path
+	Source     string `json:"source,omitempty"`
+	Status     string `json:"status"` // conflict, resolved, would_resolve, skipped, error
+	Resolution string `json:"resolution,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+type resolveResultJSON struct {
+	DryRun bool              `json:"dry_run"`
+	Rebase string            `json:"rebase"` // none, continued, in_progress
+	Items  []resolveItemJSON `json:"items"`
+}
+
+// resolveOptions control how conflicts are resolved.
+type resolveOptions struct {
+	Resolution string // applied to every conflict; empty means ask
+	DryRun     bool
+	ListOnly   bool
+	// Choose asks for the resolution of one conflict; nil means non-interactive.
+	Choose func(item resolveItemJSON) (string, error)
+	// Merge lets the user edit merged, which starts with conflict markers.
+	Merge func(ctx context.Context, versions gitops.ConflictVersions, merged string) error
+}
+
+func newResolveCmd() *cobra.Command {
+	var (
+		strategy string
+		abort    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resolve",
+		Short: "Resolve rebase conflicts and copy-mode target conflicts",
+		Long: `List and resolve conflicts left by dotctl sync or dotctl pull:
+
+  - files in the repo where git pull --rebase stopped on a conflict
+  - copy-mode targets changed both in the repo and locally since the last sync
+
+For each conflict the diff is shown and you pick the repo version, the local
+version, or a merged result edited in merge_tool (from the config) or
+$VISUAL/$EDITOR. Once every repo file is resolved the rebase is continued.
+
+--strategy ours keeps the local version of every conflict and --strategy
+theirs takes the repo version, without prompting. With --json and no
+--strategy the conflicts are only listed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runResolve(cmd, strategy, abort)
+		},
+	}
+
+	cmd.Flags().StringVar(&strategy, "strategy", "", "resolve every conflict without prompting: ours (local) or theirs (repo)")
+	cmd.Flags().BoolVar(&abort, "abort", false, "abort the stopped rebase instead of resolving it")
+	return cmd
+}
+
+func runResolve(cmd *cobra.Command, strategy string, abort bool) (err error) {
+	out := output.New(flagJSON)
+
+	cfg, _, err := resolveConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext(cmd)
+	defer stop()
+
+	// Resolving changes the rebase, the index, targets and the deploy state;
+	// keep a concurrent sync (watch, tray) out. Listing stays lock-free.
+	listOnly := strategy == "" && out.IsJSON() && !abort
+	if !flagDryRun && !listOnly {
+		syncLock, lockErr := lock.Acquire(lock.DefaultSyncLockPath())
+		if lockErr != nil {
+			return lockErr
+		}
+		defer func() {
+			if releaseErr := syncLock.Release(); releaseErr != nil && err == nil {
+				err = fmt.Errorf("releasing sync lock: %w", releaseErr)
+			}
+		}()
+	}
+
+	if abort {
+		return runResolveAbort(ctx, out, cfg.Repo.Path)
+	}
+
+	opts := resolveOptions{DryRun: flagDryRun}
+	switch strategy {
+	case "":
+		if out.IsJSON() {
+			opts.ListOnly = true
+		} else {
+			opts.Choose = terminalResolveChoice(out, os.Stdin, os.Stdout)
+			opts.Merge = mergeToolRunner(cfg.MergeTool)
+		}
+	case "ours":
+		opts.Resolution = resolveLocal
+	case "theirs":
+		opts.Resolution = resolveRepo
+	default:
+		return fmt.Errorf("invalid --strategy %q (want ours or theirs)", strategy)
+	}
+
+	result := resolveResultJSON{DryRun: opts.DryRun, Rebase: "none"}
+	result.Items, result.Rebase, err = resolveGitConflicts(ctx, cfg.Repo.Path, opts)
+	if err != nil {
+		return err
+	}
+
+	// The manifest cannot be trusted while the repo holds conflict markers.
+	if result.Rebase != "in_progress" {
+		state, err := resolveManifestState(cfg)
+		if err != nil {
+			return err
+		}
+		deployed, err := deploystate.Load(deploystate.Path())
+		if err != nil {
+			return err
+		}
+		targetItems, err := resolveTargetConflicts(ctx, cfg.Repo.Path, state.Actions, deployed, opts)
+		result.Items = append(result.Items, targetItems...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if out.IsJSON() {
+		if err := out.JSON(result); err != nil {
+			return err
+		}
+		return resolveError(result, opts)
+	}
+
+	reportResolve(out, result, opts)
+	return resolveError(result, opts)
+}
+
+func runResolveAbort(ctx context.Context, out *output.Printer, repoPath string) error {
+	if !gitops.RebaseInProgress(repoPath) {
+		return fmt.Errorf("no rebase in progress in %s", repoPath)
+	}
+	if flagDryRun {
+		if out.IsJSON() {
+			return out.JSON(map[string]any{"dry_run": true, "command": "git rebase --abort"})
+		}
+		out.Info("Would run: git rebase --abort")
+		return nil
+	}
+
+	if err := gitops.AbortRebase(ctx, repoPath); err != nil {
+		return err
+	}
+	if out.IsJSON() {
+		return out.JSON(map[string]any{"status": "ok", "rebase": "aborted"})
+	}
+	out.Success("Rebase aborted; the repo is back to its state before the pull")
+	return nil
+}
+
+// resolveGitConflicts resolves the files of a stopped rebase and continues
+// it, commit by commit, until it finishes or a conflict is left unresolved.
+// It returns the handled files and the rebase state: none, continued or
+// in_progress.
+func resolveGitConflicts(ctx context.Context, repoPath string, opts resolveOptions) ([]resolveItemJSON, string, error) {
+	var items []resolveItemJSON
+	rebase := "none"
+
+	for gitops.RebaseInProgress(repoPath) {
+		files, err := gitops.ConflictedFiles(ctx, repoPath)
+		if err != nil {
+			return items, "in_progress", err
+		}
+
+		unresolved := 0
+		for _, file := range files {
+			item := resolveItemJSON{Kind: "git", Path: file, Status: "conflict"}
+			item.Diff, _ = gitops.ConflictDiff(ctx, repoPath, file)
+
+			item = resolveItem(item, opts, func(resolution string) error {
+				if resolution == resolveMerged {
+					return mergeGitFile(ctx, repoPath, file, opts.Merge)
+				}
+				return gitops.ResolveConflict(ctx, repoPath, file, resolution)
+			})
+			if item.Status != "resolved" {
+				unresolved++
+			}
+			items = append(items, item)
+		}
+
+		if opts.ListOnly || opts.DryRun || unresolved > 0 || ctx.Err() != nil {
+			return items, "in_progress", ctx.Err()
+		}
+
+		continueOutput, err := gitops.ContinueRebase(ctx, repoPath)
+		if err != nil {
+			// The next commit of the rebase conflicts too; resolve it in turn.
+			if next, _ := gitops.ConflictedFiles(ctx, repoPath); gitops.RebaseInProgress(repoPath) && len(next) > 0 {
+				logging.Info("rebase stopped on the next commit", "repo", repoPath)
+				continue
+			}
+			return items, "in_progress", err
+		}
+		logging.Info("rebase continued", "repo", repoPath, "output", continueOutput)
+		rebase = "continued"
+	}
+	return items, rebase, nil
+}
+
+func mergeGitFile(ctx context.Context, repoPath, file string, merge func(context.Context, gitops.ConflictVersions, string) error) error {
+	if merge == nil {
+		return errors.New("merging requires an interactive terminal")
+	}
+	versions, cleanup, err := gitops.ConflictStages(ctx, repoPath, file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	merged := filepath.Join(repoPath, file)
+	if err := merge(ctx, versions, merged); err != nil {
+		return err
+	}
+	if err := checkMerged(merged); err != nil {
+		return err
+	}
+	return gitops.MarkResolved(ctx, repoPath, file)
+}
+
+// resolveTargetConflicts resolves copy-mode targets changed both in the repo
+// and locally since the last sync, and records the result as deployed.
+func resolveTargetConflicts(ctx context.Context, repoPath string, actions []manifest.Action, deployed *deploystate.State, opts resolveOptions) ([]resolveItemJSON, error) {
+	var items []resolveItemJSON
+	for _, action := range actions {
+		base, key := recordedHash(deployed, action)
+		if action.Mode != "copy" || base == "" {
+			continue
+		}
+		state, err := linker.ClassifyCopy(action, repoPath, base, key)
+		if err != nil || state.Class != linker.CopyConflict {
+			continue
+		}
+		if ctx.Err() != nil {
+			return items, ctx.Err()
+		}
+
+		item := resolveItemJSON{Kind: "target", Path: action.Target, Source: action.Source, Status: "conflict"}
+		item.Diff = threeWayDiff(action, repoPath, deployed)
+		if action.Template && opts.Resolution == resolveLocal {
+			// Rendered output cannot be written back into the template.
+			item.Status, item.Reason = "skipped", "template entries can only take the repo version"
+			items = append(items, item)
+			continue
+		}
+
+		item = resolveItem(item, opts, func(resolution string) error {
+			return resolveTarget(ctx, repoPath, action, deployed, resolution, opts.Merge)
+		})
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func resolveTarget(ctx context.Context, repoPath string, action manifest.Action, deployed *deploystate.State, resolution string, merge func(context.Context, gitops.ConflictVersions, string) error) error {
+	sourcePath := filepath.Join(repoPath, action.Source)
+
+	switch resolution {
+	case resolveRepo:
+		results := linker.Apply(ctx, []manifest.Action{action}, repoPath, false)
+		if len(results) == 0 {
+			return ctx.Err()
+		}
+		if results[0].Error != nil {
+			return results[0].Error
+		}
+		recordDeployed(deployed, repoPath, results)
+		return nil
+
+	case resolveLocal, resolveMerged:
+		if action.Template {
+			return errors.New("template entries can only take the repo version")
+		}
+		if resolution == resolveMerged {
+			if err := mergeTarget(ctx, repoPath, action, deployed, merge); err != nil {
+				return err
+			}
+		}
+		res := applyCapture(repoPath, action, sourcePath, captureResultJSON{})
+		if res.Status == "error" {
+			return errors.New(res.Reason)
+		}
+		recordDeployed(deployed, repoPath, []linker.Result{{Action: action, Status: "copied"}})
+		return nil
+
+	default:
+		return fmt.Errorf("unknown resolution %q", resolution)
+	}
+}
+
+// mergeTarget three-way merges the repo version into the local target, lets
+// the user finish the merge, and writes the result to the target (after a
+// backup). The caller then captures the target into the repo.
+func mergeTarget(ctx context.Context, repoPath string, action manifest.Action, deployed *deploystate.State, merge func(context.Context, gitops.ConflictVersions, string) error) error {
+	if merge == nil {
+		return errors.New("merging requires an interactive terminal")
+	}
+	if info, err := os.Stat(action.Target); err != nil {
+		return fmt.Errorf("reading target: %w", err)
+	} else if info.IsDir() {
+		return errors.New("directories can only take the repo or the local version")
+	}
+
+	base, err := deployed.Base(action.Target)
+	if err != nil && !errors.Is(err, deploystate.ErrNoBase) {
+		return err
+	}
+	repoData, err := linker.DeployedContent(action, filepath.Join(repoPath, action.Source))
+	if err != nil {
+		return err
+	}
+	localData, err := os.ReadFile(action.Target)
+	if err != nil {
+		return fmt.Errorf("reading target: %w", err)
+	}
+
+	// The files may hold decrypted secrets: keep them in a private directory.
+	dir, err := os.MkdirTemp("", "dotctl-merge-*")
+	if err != nil {
+		return fmt.Errorf("preparing merge: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	name := filepath.Base(action.Target)
+	versions := gitops.ConflictVersions{
+		Base:  filepath.Join(dir, "base_"+name),
+		Repo:  filepath.Join(dir, "repo_"+name),
+		Local: filepath.Join(dir, "local_"+name),
+	}
+	merged := filepath.Join(dir, name)
+	for path, data := range map[string][]byte{versions.Base: base, versions.Repo: repoData, versions.Local: localData, merged: localData} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return fmt.Errorf("preparing merge: %w", err)
+		}
+	}
+
+	labels := [3]string{"local: " + action.Target, "base (last sync)", "repo: " + action.Source}
+	if _, err := gitops.MergeFile(ctx, merged, versions.Base, versions.Repo, labels); err != nil {
+		return err
+	}
+	if err := merge(ctx, versions, merged); err != nil {
+		return err
+	}
+	if err := checkMerged(merged); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(merged)
+	if err != nil {
+		return fmt.Errorf("reading merged result: %w", err)
+	}
+	if action.Backup {
+		if _, err := backup.CreateFor(action.Target, action.Source); err != nil {
+			return fmt.Errorf("creating backup of %s: %w", action.Target, err)
+		}
+	}
+	return writeSourceAtomic(action.Target, data)
+}
+
+// checkMerged refuses a merge result that still holds conflict markers.
+func checkMerged(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading merged result: %w", err)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("<<<<<<< ")) || bytes.HasPrefix(line, []byte(">>>>>>> ")) {
+			return fmt.Errorf("merged result %s still contains conflict markers", path)
+		}
+	}
+	return nil
+}
+
+// resolveItem picks the resolution for one conflict and applies it.
+func resolveItem(item resolveItemJSON, opts resolveOptions, apply func(resolution string) error) resolveItemJSON {
+	if opts.ListOnly {
+		return item
+	}
+
+	resolution := opts.Resolution
+	if resolution == "" {
+		if opts.Choose == nil {
+			item.Status, item.Reason = "skipped", "no resolution chosen (use --strategy)"
+			return item
+		}
+		choice, err := opts.Choose(item)
+		if err != nil {
+			item.Status, item.Reason = "error", err.Error()
+			return item
+		}
+		resolution = choice
+	}
+
+	if resolution == resolveSkip {
+		item.Status = "skipped"
+		return item
+	}
+	item.Resolution = resolution
+	if opts.DryRun {
+		item.Status = "would_resolve"
+		return item
+	}
+
+	if err := apply(resolution); err != nil {
+		item.Status, item.Reason = "error", err.Error()
+		logging.Error("resolving conflict failed", "kind", item.Kind, "path", item.Path, "resolution", resolution, "error", err)
+		return item
+	}
+	item.Status = "resolved"
+	logging.Info("conflict resolved", "kind", item.Kind, "path", item.Path, "resolution", resolution)
+	return item
+}
+
+func terminalResolveChoice(out *output.Printer, in io.Reader, w io.Writer) func(resolveItemJSON) (string, error) {
+	reader := bufio.NewReader(in)
+	return func(item resolveItemJSON) (string, error) {
+		if item.Kind == "git" {
+			out.Warn("%s (rebase conflict in repo)", item.Path)
+		} else {
+			out.Warn("%s → %s (changed in repo and locally)", item.Source, item.Path)
+		}
+		if d := strings.TrimSpace(item.Diff); d != "" {
+			out.Info("%s", d)
+		}
+
+		for {
+			if _, err := fmt.Fprint(w, "Keep [r]epo, [l]ocal or [m]erged version, or [s]kip? "); err != nil {
+				return "", err
+			}
+			answer, err := reader.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("reading choice: %w", err)
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "r", "repo":
+				return resolveRepo, nil
+			case "l", "local":
+				return resolveLocal, nil
+			case "m", "merge", "merged":
+				return resolveMerged, nil
+			case "s", "skip":
+				return resolveSkip, nil
+			}
+			if errors.Is(err, io.EOF) {
+				return resolveSkip, nil
+			}
+		}
+	}
+}
+
+// mergeToolRunner runs the configured merge tool, or the user's editor on the
+// merged file. Like git mergetool, the tool reads the file paths from the
+// BASE, LOCAL, REMOTE and MERGED environment variables.
+func mergeToolRunner(tool string) func(context.Context, gitops.ConflictVersions, string) error {
+	return func(ctx context.Context, versions gitops.ConflictVersions, merged string) error {
+		command := strings.TrimSpace(tool)
+		if command == "" {
+			command = editorCommand() + ` "$MERGED"`
+		}
+
+		c := exec.CommandContext(ctx, "sh", "-c", command)
+		c.Env = append(os.Environ(),
+			"BASE="+versions.Base,
+			"LOCAL="+versions.Local,
+			"REMOTE="+versions.Repo,
+			"MERGED="+merged,
+		)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("merge tool %q failed: %w", command, err)
+		}
+		return nil
+	}
+}
+
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(env)); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+func reportResolve(out *output.Printer, result resolveResultJSON, opts resolveOptions) {
+	if len(result.Items) == 0 {
+		out.Success("No conflicts to resolve.")
+		return
+	}
+
+	for _, item := range result.Items {
+		name := item.Path
+		if item.Kind == "git" {
+			name += " (repo)"
+		}
+		switch item.Status {
+		case "resolved":
+			out.Success("%s: kept %s version", name, item.Resolution)
+		case "would_resolve":
+			out.Info("  Would keep %s version: %s", item.Resolution, name)
+		case "skipped":
+			if item.Reason != "" {
+				out.Info("Skipped: %s (%s)", name, item.Reason)
+			} else {
+				out.Info("Skipped: %s", name)
+			}
+		case "error":
+			out.Error("%s: %s", name, item.Reason)
+		default:
+			out.Warn("Conflict: %s", name)
+		}
+	}
+
+	switch result.Rebase {
+	case "continued":
+		out.Success("Rebase continued; run dotctl sync to apply and push")
+	case "in_progress":
+		if !opts.DryRun && !opts.ListOnly {
+			out.Warn("Rebase still in progress; run dotctl resolve again (or dotctl resolve --abort)")
+		}
+	}
+}
+
+func resolveError(result resolveResultJSON, opts resolveOptions) error {
+	if opts.ListOnly || opts.DryRun {
+		return nil
+	}
+	left := 0
+	for _, item := range result.Items {
+		if item.Status == "error" || item.Status == "skipped" {
+			left++
+		}
+	}
+	if left > 0 {
+		return fmt.Errorf("%d conflict(s) left unresolved", left)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/deploystate"
+	"github.com/felipe-veas/dotctl/internal/gitops"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+// setupTargetConflict deploys "a\nb\nc\n" and then changes the first line in
+// the repo and the last line locally.
+func setupTargetConflict(t *testing.T) (string, manifest.Action, *deploystate.State) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	repo := t.TempDir()
+	deployed, err := deploystate.Load(filepath.Join(t.TempDir(), "deployed.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	action := manifest.Action{Source: "app.conf", Target: filepath.Join(t.TempDir(), "app.conf"), Mode: "copy", Backup: true}
+	deployCopy(t, repo, deployed, action, "a\nb\nc\n")
+	writeCaptureFile(t, filepath.Join(repo, action.Source), "repo\nb\nc\n")
+	writeCaptureFile(t, action.Target, "a\nb\nlocal\n")
+	return repo, action, deployed
+}
+
+func assertNoConflict(t *testing.T, repo string, action manifest.Action, deployed *deploystate.State) {
+	t.Helper()
+	base, key := recordedHash(deployed, action)
+	state, err := linker.ClassifyCopy(action, repo, base, key)
+	if err != nil {
+		t.Fatalf("ClassifyCopy: %v", err)
+	}
+	if state.Class != linker.CopyUnchanged {
+		t.Fatalf("class after resolve = %q, want %q", state.Class, linker.CopyUnchanged)
+	}
+}
+
+func TestResolveTargetConflictsStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		resolution string
+		want       string
+	}{
+		{resolveRepo, "repo\nb\nc\n"},
+		{resolveLocal, "a\nb\nlocal\n"},
+	} {
+		t.Run(tc.resolution, func(t *testing.T) {
+			repo, action, deployed := setupTargetConflict(t)
+
+			items, err := resolveTargetConflicts(context.Background(), repo, []manifest.Action{action}, deployed, resolveOptions{Resolution: tc.resolution})
+			if err != nil {
+				t.Fatalf("resolveTargetConflicts: %v", err)
+			}
+			if len(items) != 1 || items[0].Status != "resolved" || items[0].Resolution != tc.resolution {
+				t.Fatalf("items = %+v", items)
+			}
+			if got := readCaptureFile(t, action.Target); got != tc.want {
+				t.Fatalf("target = %q, want %q", got, tc.want)
+			}
+			if got := readCaptureFile(t, filepath.Join(repo, action.Source)); got != tc.want {
+				t.Fatalf("source = %q, want %q", got, tc.want)
+			}
+			assertNoConflict(t, repo, action, deployed)
+		})
+	}
+}
+
+func TestResolveTargetConflictsListAndDryRun(t *testing.T) {
+	repo, action, deployed := setupTargetConflict(t)
+	actions := []manifest.Action{action}
+
+	items, err := resolveTargetConflicts(context.Background(), repo, actions, deployed, resolveOptions{ListOnly: true})
+	if err != nil || len(items) != 1 || items[0].Status != "conflict" {
+		t.Fatalf("list = %+v, %v", items, err)
+	}
+	if !strings.Contains(items[0].Diff, "+repo") || !strings.Contains(items[0].Diff, "+local") {
+		t.Fatalf("diff should show both sides:\n%s", items[0].Diff)
+	}
+
+	items, err = resolveTargetConflicts(context.Background(), repo, actions, deployed, resolveOptions{Resolution: resolveRepo, DryRun: true})
+	if err != nil || len(items) != 1 || items[0].Status != "would_resolve" {
+		t.Fatalf("dry-run = %+v, %v", items, err)
+	}
+	if got := readCaptureFile(t, action.Target); got != "a\nb\nlocal\n" {
+		t.Fatalf("dry-run changed target: %q", got)
+	}
+}
+
+func TestResolveTargetConflictMerged(t *testing.T) {
+	requireGit(t)
+	repo, action, deployed := setupTargetConflict(t)
+
+	var seen string
+	opts := resolveOptions{
+		Choose: func(resolveItemJSON) (string, error) { return resolveMerged, nil },
+		Merge: func(_ context.Context, versions gitops.ConflictVersions, merged string) error {
+			data, err := os.ReadFile(merged)
+			if err != nil {
+				return err
+			}
+			seen = string(data)
+			if base := readCaptureFile(t, versions.Base); base != "a\nb\nc\n" {
+				t.Errorf("base = %q", base)
+			}
+			return nil
+		},
+	}
+
+	items, err := resolveTargetConflicts(context.Background(), repo, []manifest.Action{action}, deployed, opts)
+	if err != nil || len(items) != 1 || items[0].Status != "resolved" {
+		t.Fatalf("items = %+v, %v", items, err)
+	}
+	// Non-overlapping edits merge cleanly before the tool even runs.
+	const want = "repo\nb\nlocal\n"
+	if seen != want {
+		t.Fatalf("merge tool saw %q, want %q", seen, want)
+	}
+	if got := readCaptureFile(t, action.Target); got != want {
+		t.Fatalf("target = %q, want %q", got, want)
+	}
+	if got := readCaptureFile(t, filepath.Join(repo, action.Source)); got != want {
+		t.Fatalf("source = %q, want %q", got, want)
+	}
+	assertNoConflict(t, repo, action, deployed)
+}
+
+func TestResolveTargetConflictMergedRejectsMarkers(t *testing.T) {
+	requireGit(t)
+	repo, action, deployed := setupTargetConflict(t)
+	writeCaptureFile(t, action.Target, "local\nb\nc\n")
+
+	opts := resolveOptions{
+		Resolution: resolveMerged,
+		Merge:      func(context.Context, gitops.ConflictVersions, string) error { return nil },
+	}
+	items, err := resolveTargetConflicts(context.Background(), repo, []manifest.Action{action}, deployed, opts)
+	if err != nil || len(items) != 1 || items[0].Status != "error" {
+		t.Fatalf("items = %+v, %v", items, err)
+	}
+	if !strings.Contains(items[0].Reason, "conflict markers") {
+		t.Fatalf("reason = %q, want conflict markers", items[0].Reason)
+	}
+	if got := readCaptureFile(t, action.Target); got != "local\nb\nc\n" {
+		t.Fatalf("target changed despite failed merge: %q", got)
+	}
+}
@@ -78,6 +78,11 @@ func NewRootCmd() *cobra.Command {
 		newDoctorCmd(),
 		newReposCmd(),
 		newSecretsCmd(),
+		newBackupCmd(),
+		newRecoverCmd(),
+		newPackagesCmd(),
+		newCaptureCmd(),
+		newResolveCmd(),
 	)
 
 	return root
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/felipe-veas/dotctl/internal/output"
 	"github.com/felipe-veas/dotctl/internal/secrets"
@@ -20,6 +21,7 @@ func newSecretsCmd() *cobra.Command {
 		newSecretsDecryptCmd(),
 		newSecretsStatusCmd(),
 		newSecretsRotateCmd(),
+		newSecretsRecipientsCmd(),
 	)
 
 	return cmd
@@ -28,6 +30,8 @@ func newSecretsCmd() *cobra.Command {
 func newSecretsInitCmd() *cobra.Command {
 	var identityPath string
 	var importPath string
+	var sshKeyPath string
+	var passphrase bool
 
 	cmd := &cobra.Command{
 		Use:   "init",
@@ -36,7 +40,11 @@ func newSecretsInitCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			out := output.New(flagJSON)
 
-			cfg, _, err := resolveConfig()
+			if sshKeyPath != "" && importPath != "" {
+				return fmt.Errorf("--ssh-key and --import are mutually exclusive")
+			}
+
+			cfg, cfgPath, err := resolveConfig()
 			if err != nil {
 				return err
 			}
@@ -44,6 +52,8 @@ func newSecretsInitCmd() *cobra.Command {
 			id, err := secrets.Init(cfg.Repo.Path, secrets.InitOptions{
 				IdentityPath: identityPath,
 				ImportPath:   importPath,
+				SSHKeyPath:   sshKeyPath,
+				Passphrase:   passphrase,
 				Force:        flagForce,
 			})
 			if err != nil {
@@ -56,9 +66,25 @@ func newSecretsInitCmd() *cobra.Command {
 					"private_path": id.PrivatePath,
 					"public_key":   id.PublicKey,
 					"imported":     importPath != "",
+					"ssh":          sshKeyPath != "",
+					"encrypted":    id.Encrypted,
 				})
 			}
 
+			if sshKeyPath != "" {
+				out.Success("Using SSH key as identity")
+				out.Field("Private key", id.PrivatePath)
+				out.Field("Public key", id.PublicKey)
+				out.Info("")
+				out.Info("Next steps:")
+				if !slices.Contains(secrets.SSHKeyPaths(), id.PrivatePath) {
+					out.Info("  - Add the key to secrets.ssh_keys in %s so dotctl finds it", cfgPath)
+				}
+				out.Info("  - On a machine that can decrypt existing files, run:")
+				out.Info("    dotctl secrets recipients add '%s'", id.PublicKey)
+				return nil
+			}
+
 			if importPath != "" {
 				out.Success("Imported age identity")
 			} else {
@@ -66,11 +92,18 @@ func newSecretsInitCmd() *cobra.Command {
 			}
 			out.Field("Private key", id.PrivatePath)
 			out.Field("Public key", id.PublicKey)
+			if id.Encrypted {
+				out.Field("Protection", "passphrase (scrypt)")
+			}
 			out.Info("")
 			out.Info("Next steps:")
-			out.Info("  1. Copy %s to your other machines", id.PrivatePath)
+			out.Info("  1. Copy %s to your other machines, or run 'dotctl secrets init' on each", id.PrivatePath)
+			out.Info("     and add its key here with 'dotctl secrets recipients add <public-key>'")
 			out.Info("  2. Use 'dotctl secrets encrypt <file>' to protect sensitive files")
 			out.Info("  3. Add 'decrypt: true' to manifest entries for encrypted files")
+			out.Info("")
+			out.Info("Files encrypted before this key was added stay unreadable here until a")
+			out.Info("machine that can decrypt them runs 'dotctl secrets recipients add %s'.", id.PublicKey)
 
 			return nil
 		},
@@ -78,6 +111,8 @@ func newSecretsInitCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&identityPath, "identity", "", "path for the identity file")
 	cmd.Flags().StringVar(&importPath, "import", "", "import an existing identity file")
+	cmd.Flags().StringVar(&sshKeyPath, "ssh-key", "", "use an SSH private key (ed25519 or rsa) instead of an age identity")
+	cmd.Flags().BoolVar(&passphrase, "passphrase", false, "store the identity encrypted with a passphrase")
 
 	return cmd
 }
@@ -85,6 +120,7 @@ func newSecretsInitCmd() *cobra.Command {
 func newSecretsEncryptCmd() *cobra.Command {
 	var recipientKey string
 	var keep bool
+	var structured bool
 
 	cmd := &cobra.Command{
 		Use:   "encrypt <file> [file...]",
@@ -111,6 +147,7 @@ func newSecretsEncryptCmd() *cobra.Command {
 				encPath, err := secrets.Encrypt(cfg.Repo.Path, file, secrets.EncryptOptions{
 					RecipientKey: recipientKey,
 					Keep:         keep,
+					Structured:   structured,
 				})
 				if err != nil {
 					results = append(results, result{File: file, Error: err.Error()})
@@ -139,8 +176,9 @@ func newSecretsEncryptCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&recipientKey, "recipient", "", "age public key (default: from repo)")
+	cmd.Flags().StringVar(&recipientKey, "recipient", "", "age or SSH public key (default: all recipients in the repo)")
 	cmd.Flags().BoolVar(&keep, "keep", false, "keep original plaintext file")
+	cmd.Flags().BoolVar(&structured, "structured", false, "encrypt only the values of a YAML, JSON, dotenv or INI file (sops layout), keeping keys readable")
 
 	return cmd
 }
@@ -214,7 +252,7 @@ func newSecretsDecryptCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&identityPath, "identity", "", "path to age identity file")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "path to age identity or SSH private key")
 	cmd.Flags().BoolVar(&keep, "keep", false, "keep encrypted file after decrypting")
 	cmd.Flags().BoolVar(&stdout, "stdout", false, "output decrypted content to stdout")
 
@@ -246,14 +284,22 @@ func newSecretsStatusCmd() *cobra.Command {
 			// Identity info.
 			if status.Identity != nil {
 				out.Success("Identity: %s", status.Identity.PrivatePath)
-				out.Field("Public key", status.Identity.PublicKey)
+				if status.Identity.PublicKey != "" {
+					out.Field("Public key", status.Identity.PublicKey)
+				}
+				if status.Identity.Encrypted {
+					out.Field("Protection", "passphrase")
+				}
 			} else {
 				out.Warn("Identity: not configured (run 'dotctl secrets init')")
 			}
 
 			// Recipient info.
 			if status.RecipientFile != "" {
-				out.Success("Recipient: %s", status.RecipientFile)
+				out.Success("Recipients: %s (%d)", status.RecipientFile, len(status.Recipients))
+				for _, r := range status.Recipients {
+					out.Info("  %s", formatRecipient(r))
+				}
 			} else {
 				out.Warn("Recipient: not found")
 			}
@@ -340,3 +386,169 @@ func newSecretsRotateCmd() *cobra.Command {
 
 	return cmd
 }
+
+func newSecretsRecipientsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Manage the public keys secrets are encrypted for",
+		Long: `Manage the public keys in .age-recipient.txt, one per machine or teammate.
+
+Adding or removing a recipient re-encrypts every encrypted file in the
+repository for the new set, which requires an identity that can decrypt them.`,
+	}
+
+	cmd.AddCommand(
+		newSecretsRecipientsListCmd(),
+		newSecretsRecipientsAddCmd(),
+		newSecretsRecipientsRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func newSecretsRecipientsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List recipients",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := output.New(flagJSON)
+
+			cfg, _, err := resolveConfig()
+			if err != nil {
+				return err
+			}
+
+			recipients, err := secrets.ReadRecipients(cfg.Repo.Path)
+			if err != nil {
+				return err
+			}
+
+			if out.IsJSON() {
+				return out.JSON(map[string]any{
+					"recipients": recipients,
+				})
+			}
+
+			if len(recipients) == 0 {
+				out.Info("No recipients in %s.", secrets.DefaultRecipientFile)
+				return nil
+			}
+			for _, r := range recipients {
+				out.Info("%s", formatRecipient(r))
+			}
+			return nil
+		},
+	}
+}
+
+func newSecretsRecipientsAddCmd() *cobra.Command {
+	var identityPath string
+	var comment string
+
+	cmd := &cobra.Command{
+		Use:   "add <age-or-ssh-public-key>",
+		Short: "Add a recipient and re-encrypt all protected files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := output.New(flagJSON)
+
+			cfg, _, err := resolveConfig()
+			if err != nil {
+				return err
+			}
+
+			result, err := secrets.AddRecipient(cfg.Repo.Path, args[0], secrets.RecipientOptions{
+				IdentityPath: identityPath,
+				Comment:      comment,
+			})
+			if err != nil {
+				return err
+			}
+
+			if out.IsJSON() {
+				return out.JSON(map[string]any{
+					"status":       "ok",
+					"added":        args[0],
+					"recipients":   result.Recipients,
+					"re_encrypted": result.ReEncrypted,
+				})
+			}
+
+			out.Success("Added recipient %s", args[0])
+			printRecipientsResult(out, result)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&identityPath, "identity", "", "path to age identity or SSH private key")
+	cmd.Flags().StringVar(&comment, "comment", "", "label for the recipient, e.g. a hostname")
+
+	return cmd
+}
+
+func newSecretsRecipientsRemoveCmd() *cobra.Command {
+	var identityPath string
+
+	cmd := &cobra.Command{
+		Use:   "remove <public-key|comment>",
+		Short: "Remove a recipient and re-encrypt all protected files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := output.New(flagJSON)
+
+			cfg, _, err := resolveConfig()
+			if err != nil {
+				return err
+			}
+
+			result, err := secrets.RemoveRecipient(cfg.Repo.Path, args[0], secrets.RecipientOptions{
+				IdentityPath: identityPath,
+				Force:        flagForce,
+			})
+			if err != nil {
+				return err
+			}
+
+			if out.IsJSON() {
+				return out.JSON(map[string]any{
+					"status":       "ok",
+					"removed":      args[0],
+					"recipients":   result.Recipients,
+					"re_encrypted": result.ReEncrypted,
+				})
+			}
+
+			out.Success("Removed recipient %s", args[0])
+			printRecipientsResult(out, result)
+			out.Info("")
+			out.Info("The removed key can still decrypt older revisions in git history;")
+			out.Info("rotate the secret values themselves if it should lose access.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&identityPath, "identity", "", "path to age identity or SSH private key")
+
+	return cmd
+}
+
+func printRecipientsResult(out *output.Printer, result *secrets.RecipientsResult) {
+	out.Field("Recipients", fmt.Sprintf("%d", len(result.Recipients)))
+	if len(result.ReEncrypted) > 0 {
+		out.Info("")
+		out.Info("Re-encrypted %d file(s):", len(result.ReEncrypted))
+		for _, f := range result.ReEncrypted {
+			out.Info("  %s", f)
+		}
+		out.Info("")
+		out.Info("Run 'dotctl push' to sync re-encrypted files")
+	}
+}
+
+func formatRecipient(r secrets.Recipient) string {
+	if r.Comment == "" {
+		return r.PublicKey
+	}
+	return fmt.Sprintf("%s  # %s", r.PublicKey, r.Comment)
+}
@@ -1,27 +1,50 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/felipe-veas/dotctl/internal/auth"
 	"github.com/felipe-veas/dotctl/internal/gitops"
+	"github.com/felipe-veas/dotctl/internal/lock"
+	"github.com/felipe-veas/dotctl/internal/logging"
 	"github.com/felipe-veas/dotctl/internal/output"
 	"github.com/felipe-veas/dotctl/pkg/types"
 	"github.com/spf13/cobra"
 )
 
+// statusFetchTimeout bounds the optional fetch so status stays responsive
+// on a slow or unreachable remote.
+const statusFetchTimeout = 15 * time.Second
+
+// statusOptions holds status-only flags.
+type statusOptions struct {
+	// Fetch updates origin first so ahead/behind reflect the remote.
+	Fetch bool
+	// FetchMaxAge skips the fetch when the last one is more recent.
+	FetchMaxAge time.Duration
+}
+
 func newStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts statusOptions
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show current dotctl status",
 		Args:  cobra.NoArgs,
-		RunE:  runStatus,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStatus(opts)
+		},
 	}
+	cmd.Flags().BoolVar(&opts.Fetch, "fetch", false, "fetch from origin first so ahead/behind counts are current")
+	cmd.Flags().DurationVar(&opts.FetchMaxAge, "fetch-max-age", 0, "with --fetch, skip fetching when the last fetch is more recent than this (e.g. 15m)")
+	return cmd
 }
 
-func runStatus(cmd *cobra.Command, args []string) error {
+func runStatus(opts statusOptions) error {
 	out := output.New(flagJSON)
 
 	cfg, _, err := resolveConfig()
@@ -52,13 +75,51 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	}
 
 	if gitops.IsRepo(cfg.Repo.Path) {
-		inspect, inspectErr := gitops.Inspect(cfg.Repo.Path)
+		fetch := opts.Fetch
+		var syncLock *lock.FileLock
+		if fetch {
+			// Fetching writes to the repo; never race a running sync, report
+			// the counts from the last fetch instead.
+			var lockErr error
+			syncLock, lockErr = lock.Acquire(lock.DefaultSyncLockPath())
+			if lockErr != nil {
+				fetch = false
+				status.Warnings = append(status.Warnings, fmt.Sprintf("fetch skipped, ahead/behind are from the last fetch: %v", lockErr))
+			}
+		}
+		inspect, inspectErr := gitops.InspectContext(context.Background(), cfg.Repo.Path, gitops.InspectOptions{
+			Fetch:        fetch,
+			FetchMaxAge:  opts.FetchMaxAge,
+			FetchTimeout: statusFetchTimeout,
+		})
+		// Release right away so a sync started meanwhile is not refused.
+		if releaseErr := syncLock.Release(); releaseErr != nil {
+			logging.Warn("failed to release sync lock", "path", syncLock.Path(), "error", releaseErr)
+		}
 		if inspectErr != nil {
 			status.Errors = append(status.Errors, inspectErr.Error())
 			status.Repo.Status = "error"
 		} else {
 			status.Repo.Branch = inspect.Branch
 			status.Repo.LastCommit = inspect.LastCommit
+			status.Repo.Upstream = inspect.Upstream
+			status.Repo.Ahead = inspect.Ahead
+			status.Repo.Behind = inspect.Behind
+			status.Repo.Untracked = inspect.Untracked
+			status.Repo.RebaseInProgress = inspect.Rebasing
+			status.Repo.MergeInProgress = inspect.Merging
+			if !inspect.LastFetch.IsZero() {
+				status.Repo.LastFetch = inspect.LastFetch.Format("2006-01-02 15:04:05")
+			}
+			if inspect.FetchErr != nil {
+				status.Warnings = append(status.Warnings, fmt.Sprintf("fetch failed, ahead/behind are from the last fetch: %v", inspect.FetchErr))
+			}
+			if inspect.Rebasing || inspect.Merging {
+				status.Warnings = append(status.Warnings, "a git rebase or merge stopped on conflicts; run dotctl resolve")
+			}
+			if cfg.Repo.Branch != "" && inspect.Branch != cfg.Repo.Branch {
+				status.Warnings = append(status.Warnings, fmt.Sprintf("repo is on branch %s but config expects %s; run dotctl sync to switch", inspect.Branch, cfg.Repo.Branch))
+			}
 			if inspect.Dirty {
 				status.Repo.Status = "dirty"
 			} else {
@@ -116,6 +177,20 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	if status.Repo.LastCommit != "" {
 		out.Field("Commit", status.Repo.LastCommit)
 	}
+	if status.Repo.Upstream != "" {
+		out.Field("Upstream", fmt.Sprintf("%s (%d ahead, %d behind)", status.Repo.Upstream, status.Repo.Ahead, status.Repo.Behind))
+	}
+	if status.Repo.Behind > 0 {
+		out.Info("%d update(s) available; run dotctl sync", status.Repo.Behind)
+	}
+	if status.Repo.Untracked > 0 {
+		out.Field("Untracked", fmt.Sprintf("%d file(s)", status.Repo.Untracked))
+	}
+	if status.Repo.LastFetch != "" {
+		out.Field("Last fetch", status.Repo.LastFetch)
+	} else if status.Repo.Upstream != "" {
+		out.Field("Last fetch", "never")
+	}
 	if status.Repo.LastSync != "" {
 		out.Field("Last sync", status.Repo.LastSync)
 	} else {
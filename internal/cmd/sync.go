@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/felipe-veas/dotctl/internal/backup"
 	"github.com/felipe-veas/dotctl/internal/config"
+	"github.com/felipe-veas/dotctl/internal/deploystate"
 	"github.com/felipe-veas/dotctl/internal/gitops"
+	"github.com/felipe-veas/dotctl/internal/journal"
 	"github.com/felipe-veas/dotctl/internal/linker"
 	"github.com/felipe-veas/dotctl/internal/lock"
 	"github.com/felipe-veas/dotctl/internal/logging"
@@ -15,17 +22,51 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// syncOptions holds sync-only flags.
+type syncOptions struct {
+	// Capture copies diverged copy-mode targets back into the repo before apply.
+	Capture bool
+}
+
 func newSyncCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts syncOptions
+
+	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Pull, apply manifest, push changes",
 		Long:  "Syncs dotfiles with full flow: git pull --rebase, apply manifest, git push.",
 		Args:  cobra.NoArgs,
-		RunE:  runSync,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signalContext(cmd)
+			defer stop()
+			return runSyncContext(ctx, opts)
+		},
 	}
+	cmd.Flags().BoolVar(&opts.Capture, "capture", false, "capture local edits of copy-mode targets into the repo before applying (see dotctl capture)")
+	return cmd
+}
+
+// signalContext returns the command context cancelled on SIGINT or SIGTERM.
+func signalContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	parent := cmd.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
+
+// errSyncCancelled wraps the context error when sync stops on a signal.
+func errSyncCancelled(cause error) error {
+	return fmt.Errorf("sync cancelled: %w", cause)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	ctx, stop := signalContext(cmd)
+	defer stop()
+	return runSyncContext(ctx, syncOptions{})
 }
 
-func runSync(cmd *cobra.Command, args []string) (err error) {
+func runSyncContext(ctx context.Context, opts syncOptions) (err error) {
 	out := output.New(flagJSON)
 
 	cfg, cfgPath, err := resolveConfig()
@@ -51,19 +92,26 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 		logging.Debug("sync lock released", "path", syncLock.Path())
 	}()
 
-	endBackupSession := func() {}
-	if !flagDryRun {
-		endBackupSession = backup.BeginSession()
+	if err := checkUnfinishedSync(out, flagDryRun); err != nil {
+		return err
 	}
-	defer endBackupSession()
 
+	// report collects each phase's results for the JSON output.
+	report := syncResultInput{DryRun: flagDryRun}
 	pullOutput := ""
 	if !flagDryRun {
-		pullOutput, err = gitops.PullRebase(cfg.Repo.Path)
+		pullOutput, err = pullRepo(ctx, cfg.Repo)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = errSyncCancelled(ctxErr)
+				if out.IsJSON() {
+					_ = out.JSON(withSyncStatus(syncResult(report), err))
+				}
+			}
 			return err
 		}
 		logging.Info("sync pull complete", "output", pullOutput)
+		report.PullOutput = pullOutput
 		if !out.IsJSON() {
 			if pullOutput == "" {
 				out.Success("Pull complete")
@@ -77,6 +125,39 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return err
 	}
+	report.Skipped = state.Skipped
+
+	var captureResults []captureResultJSON
+	// withStatus sets the sync status and attaches the capture phase results.
+	withStatus := func(res syncResultJSON, err error) syncResultJSON {
+		res.Captured = captureResults
+		return withSyncStatus(res, err)
+	}
+	if opts.Capture {
+		captureOpts := captureOptions{DryRun: flagDryRun, Force: flagForce}
+		if !out.IsJSON() {
+			captureOpts.Confirm = terminalCaptureConfirm(out, os.Stdin, os.Stdout)
+		}
+		captureResults, err = captureTargets(cfg.Repo.Path, state.Actions, captureOpts)
+		if err == nil {
+			err = captureError(captureResults)
+		}
+		if !out.IsJSON() {
+			reportCapture(out, captureResults)
+		}
+		if err != nil {
+			if out.IsJSON() {
+				_ = out.JSON(withStatus(syncResult(report), err))
+			}
+			return err
+		}
+	}
+	endBackupSession := func() {}
+	if !flagDryRun {
+		endBackupSession = backup.BeginSession(syncBackupMetadata(cfg, state))
+	}
+	defer endBackupSession()
+
 	backfillResults, err := backfillMissingSourcesFromTargets(cfg.Repo.Path, state.Actions, flagDryRun)
 	if err != nil {
 		return err
@@ -92,13 +173,14 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 		reportManagedSourcePrune(out, pruneResults, flagDryRun)
 	}
 
-	if decryptTool, decryptCount, decryptErr := detectDecryptToolForActions(state.Actions); decryptCount > 0 {
+	if backends, decryptErr := resolveDecryptBackends(cfg.Repo.Path, state.Actions); len(backends) > 0 {
 		if decryptErr != nil {
 			return decryptErr
 		}
-		logging.Info("decrypt mode enabled", "entries", decryptCount, "tool", decryptTool)
+		decryptTools := decryptToolSummary(backends)
+		logging.Info("decrypt mode enabled", "entries", len(backends), "tools", decryptTools)
 		if !out.IsJSON() {
-			out.Info("Decrypt enabled for %d file(s) using %s.", decryptCount, decryptTool)
+			out.Info("Decrypt enabled for %d file(s) using %s.", len(backends), decryptTools)
 		}
 	}
 
@@ -109,10 +191,14 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 	preHooks := manifest.ResolveHooks(state.Manifest.Hooks.PreSync, state.Context)
 	postHooks := manifest.ResolveHooks(state.Manifest.Hooks.PostSync, state.Context)
 
-	preHookResults, err := runHooks(out, "pre_sync", preHooks, cfg.Repo.Path, flagDryRun)
+	hookContext, err := newHookEnv(cfg, state.Context)
+	if err != nil {
+		return err
+	}
+	report.PreHooks, err = runHooks(ctx, out, "pre_sync", preHooks, hookContext, flagDryRun)
 	if err != nil {
 		if out.IsJSON() {
-			_ = out.JSON(syncResult(nil, state.Skipped, flagDryRun, pullOutput, nil, preHookResults, nil, nil, nil))
+			_ = out.JSON(withStatus(syncResult(report), err))
 		}
 		return err
 	}
@@ -120,68 +206,124 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 	if len(state.Actions) == 0 {
 		out.Info("No actions to apply for profile %q on %s.", cfg.Profile, state.Context.OS)
 
-		postHookResults, err := runHooks(out, "post_sync", postHooks, cfg.Repo.Path, flagDryRun)
+		postEnv := hookContext
+		postEnv.ChangedTargets = []string{}
+		report.PostHooks, err = runHooks(ctx, out, "post_sync", postHooks, postEnv, flagDryRun)
 		if err != nil {
 			if out.IsJSON() {
-				_ = out.JSON(syncResult(nil, state.Skipped, flagDryRun, pullOutput, nil, preHookResults, postHookResults, nil, nil))
+				_ = out.JSON(withStatus(syncResult(report), err))
 			}
 			return err
 		}
 
-		var pushResult *gitops.PushResult
-		var backupRotation *backup.RotationResult
 		if !flagDryRun {
-			res, pushErr := gitops.Push(cfg.Repo.Path, "", cfg.Profile, time.Now())
+			res, pushErr := pushRepo(ctx, cfg.Repo, "", cfg.Profile, time.Now())
 			if pushErr != nil {
 				return pushErr
 			}
-			pushResult = &res
+			report.Push = &res
 			if res.NothingToPush {
 				out.Info("Nothing to push")
 			}
 			if err := persistLastSync(cfgPath, cfg); err != nil {
 				return err
 			}
-			backupRotation = rotateBackups(out, cfg)
+			report.BackupRotation = rotateBackups(out, cfg)
 		}
 
 		if out.IsJSON() {
-			return out.JSON(syncResult(nil, state.Skipped, flagDryRun, pullOutput, pushResult, preHookResults, postHookResults, nil, backupRotation))
+			return out.JSON(withStatus(syncResult(report), err))
 		}
 		return nil
 	}
 
+	deployed, err := deploystate.Load(deploystate.Path())
+	if err != nil {
+		return err
+	}
+	applyActions, conflictResults := checkCopyConflicts(out, cfg.Repo.Path, state.Actions, deployed, flagForce)
+
 	if flagDryRun {
 		out.Header("Dry run (no changes will be made):")
 	} else {
 		out.Header(fmt.Sprintf("Applying manifest (profile: %s, os: %s)...", cfg.Profile, state.Context.OS))
 	}
 
-	results := linker.Apply(state.Actions, cfg.Repo.Path, flagDryRun)
-	rollbackResults := make([]linker.RollbackResult, 0)
+	var syncJournal *journal.Journal
+	if !flagDryRun {
+		syncJournal, err = journal.Start(journal.Path(), journal.State{
+			Repo:     cfg.Repo.Name,
+			RepoPath: cfg.Repo.Path,
+			Profile:  cfg.Profile,
+			Snapshot: backup.SessionName(),
+		}, applyActions)
+		if err != nil {
+			return err
+		}
+	}
+	setJournalPhase := func(phase string) {
+		if syncJournal == nil {
+			return
+		}
+		if err := syncJournal.SetPhase(phase); err != nil {
+			logging.Warn("recording sync journal phase failed", "phase", phase, "error", err)
+		}
+	}
+	finishJournal := func() {
+		if syncJournal == nil {
+			return
+		}
+		if err := syncJournal.Finish(); err != nil {
+			logging.Warn("removing sync journal failed", "path", syncJournal.Path(), "error", err)
+		}
+	}
+
+	var recorder linker.Recorder
+	if syncJournal != nil {
+		recorder = syncJournal
+	}
+	results := linker.ApplyRecorded(ctx, applyActions, cfg.Repo.Path, flagDryRun, recorder)
+	results = append(results, conflictResults...)
+	report.Results = results
 	rollbackIfNeeded := func(cause error) error {
 		if flagDryRun {
 			return cause
 		}
+		if captured := countCaptured(captureResults); captured > 0 {
+			// Captures changed the repo before the journal started.
+			note := fmt.Sprintf("%d captured source(s) stay modified in the repo; rollback only restores targets", captured)
+			logging.Warn("captures not rolled back", "count", captured)
+			report.Warnings = append(report.Warnings, note)
+			if !out.IsJSON() {
+				out.Warn("%s.", note)
+			}
+		}
 
-		rollbackResults = linker.Rollback(results)
-		if len(rollbackResults) == 0 {
+		report.Rollback = linker.Rollback(results)
+		if len(report.Rollback) == 0 {
+			finishJournal()
 			return cause
 		}
 
-		summary := linker.SummarizeRollback(rollbackResults)
+		summary := linker.SummarizeRollback(report.Rollback)
 		logging.Warn("sync rollback attempted", "restored", summary.Restored, "removed", summary.Removed, "errors", summary.Errors)
 		if !out.IsJSON() {
+			what := "failed"
+			if errors.Is(cause, context.Canceled) {
+				what = "cancelled"
+			}
 			if summary.Errors == 0 {
-				out.Warn("Sync failed, rollback complete (%d restored, %d removed).", summary.Restored, summary.Removed)
+				out.Warn("Sync %s, rollback complete (%d restored, %d removed).", what, summary.Restored, summary.Removed)
 			} else {
-				out.Warn("Sync failed, rollback finished with %d error(s).", summary.Errors)
+				out.Warn("Sync %s, rollback finished with %d error(s).", what, summary.Errors)
 			}
 		}
 
 		if summary.Errors > 0 {
+			// Keep the journal so `dotctl recover --rollback` can retry.
 			return fmt.Errorf("%w (rollback had %d errors)", cause, summary.Errors)
 		}
+		finishJournal()
 		return cause
 	}
 
@@ -190,76 +332,120 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 		case "created":
 			out.Success("%s → %s (symlink created)", r.Action.Source, r.Action.Target)
 		case "copied":
-			if r.Decrypted {
+			switch {
+			case r.Decrypted && r.Rendered:
+				out.Success("%s → %s (decrypted, rendered and copied)", r.Action.Source, r.Action.Target)
+			case r.Decrypted:
 				out.Success("%s → %s (decrypted and copied)", r.Action.Source, r.Action.Target)
-			} else {
+			case r.Rendered:
+				out.Success("%s → %s (rendered and copied)", r.Action.Source, r.Action.Target)
+			default:
 				out.Success("%s → %s (copied)", r.Action.Source, r.Action.Target)
 			}
 		case "already_linked":
 			out.Success("%s → %s (already linked)", r.Action.Source, r.Action.Target)
 		case "backed_up":
-			if r.Decrypted {
+			switch {
+			case r.Decrypted && r.Rendered:
+				out.Success("%s → %s (backed up to %s, decrypted, rendered and copied)", r.Action.Source, r.Action.Target, r.BackupPath)
+			case r.Decrypted:
 				out.Success("%s → %s (backed up to %s, decrypted and copied)", r.Action.Source, r.Action.Target, r.BackupPath)
-			} else {
+			case r.Rendered:
+				out.Success("%s → %s (backed up to %s, rendered and copied)", r.Action.Source, r.Action.Target, r.BackupPath)
+			default:
 				out.Success("%s → %s (backed up to %s)", r.Action.Source, r.Action.Target, r.BackupPath)
 			}
 		case "would_create":
 			out.Info("  Would create symlink: %s → %s", r.Action.Source, r.Action.Target)
 		case "would_copy":
-			if r.Action.Decrypt {
+			switch {
+			case r.Action.Decrypt && r.Action.Template:
+				out.Info("  Would decrypt, render and copy: %s → %s", r.Action.Source, r.Action.Target)
+			case r.Action.Decrypt:
 				out.Info("  Would decrypt and copy: %s → %s", r.Action.Source, r.Action.Target)
-			} else {
+			case r.Action.Template:
+				out.Info("  Would render and copy: %s → %s", r.Action.Source, r.Action.Target)
+			default:
 				out.Info("  Would copy: %s → %s", r.Action.Source, r.Action.Target)
 			}
 		case "would_backup_and_link":
 			out.Info("  Would backup and link: %s → %s", r.Action.Source, r.Action.Target)
 		case "would_backup_and_copy":
-			if r.Action.Decrypt {
+			switch {
+			case r.Action.Decrypt && r.Action.Template:
+				out.Info("  Would backup, decrypt, render and copy: %s → %s", r.Action.Source, r.Action.Target)
+			case r.Action.Decrypt:
 				out.Info("  Would backup, decrypt and copy: %s → %s", r.Action.Source, r.Action.Target)
-			} else {
+			case r.Action.Template:
+				out.Info("  Would backup, render and copy: %s → %s", r.Action.Source, r.Action.Target)
+			default:
 				out.Info("  Would backup and copy: %s → %s", r.Action.Source, r.Action.Target)
 			}
+		case "conflict":
+			out.Warn("%s → %s: skipped, %v", r.Action.Source, r.Action.Target, r.Error)
 		case "error":
 			out.Error("%s → %s: %v", r.Action.Source, r.Action.Target, r.Error)
 		}
 	}
 
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = rollbackIfNeeded(errSyncCancelled(ctxErr))
+		if out.IsJSON() {
+			_ = out.JSON(withStatus(syncResult(report), err))
+		}
+		return err
+	}
+
 	summary := linker.Summarize(results)
 	if !flagDryRun {
 		out.Info("")
 		out.Info("Summary: %d created, %d already ok, %d backed up, %d errors",
 			summary.Created+summary.Copied, summary.AlreadyOK, summary.BackedUp, summary.Errors)
+		if summary.Conflicts > 0 {
+			out.Warn("%d target(s) not updated because of conflicts; see `dotctl diff --details`.", summary.Conflicts)
+		}
 	}
 
 	if summary.Errors > 0 {
 		err = rollbackIfNeeded(fmt.Errorf("%d errors during sync", summary.Errors))
 		if out.IsJSON() {
-			_ = out.JSON(syncResult(results, state.Skipped, flagDryRun, pullOutput, nil, preHookResults, nil, rollbackResults, nil))
+			_ = out.JSON(withStatus(syncResult(report), err))
 		}
 		return err
 	}
 
-	postHookResults, err := runHooks(out, "post_sync", postHooks, cfg.Repo.Path, flagDryRun)
+	setJournalPhase(journal.PhasePostSync)
+	report.OnChangeHooks, err = runOnChangeHooks(ctx, out, hookContext, results, flagDryRun)
 	if err != nil {
 		err = rollbackIfNeeded(err)
 		if out.IsJSON() {
-			_ = out.JSON(syncResult(results, state.Skipped, flagDryRun, pullOutput, nil, preHookResults, postHookResults, rollbackResults, nil))
+			_ = out.JSON(withStatus(syncResult(report), err))
+		}
+		return err
+	}
+
+	postEnv := hookContext
+	postEnv.ChangedTargets = changedTargets(results)
+	report.PostHooks, err = runHooks(ctx, out, "post_sync", postHooks, postEnv, flagDryRun)
+	if err != nil {
+		err = rollbackIfNeeded(err)
+		if out.IsJSON() {
+			_ = out.JSON(withStatus(syncResult(report), err))
 		}
 		return err
 	}
 
-	var pushResult *gitops.PushResult
-	var backupRotation *backup.RotationResult
 	if !flagDryRun {
-		res, pushErr := gitops.Push(cfg.Repo.Path, "", cfg.Profile, time.Now())
+		setJournalPhase(journal.PhasePush)
+		res, pushErr := pushRepo(ctx, cfg.Repo, "", cfg.Profile, time.Now())
 		if pushErr != nil {
 			err = rollbackIfNeeded(pushErr)
 			if out.IsJSON() {
-				_ = out.JSON(syncResult(results, state.Skipped, flagDryRun, pullOutput, nil, preHookResults, postHookResults, rollbackResults, nil))
+				_ = out.JSON(withStatus(syncResult(report), err))
 			}
 			return err
 		}
-		pushResult = &res
+		report.Push = &res
 
 		if !out.IsJSON() {
 			if res.NothingToPush {
@@ -272,21 +458,37 @@ func runSync(cmd *cobra.Command, args []string) (err error) {
 		if err := persistLastSync(cfgPath, cfg); err != nil {
 			err = rollbackIfNeeded(err)
 			if out.IsJSON() {
-				_ = out.JSON(syncResult(results, state.Skipped, flagDryRun, pullOutput, pushResult, preHookResults, postHookResults, rollbackResults, nil))
+				_ = out.JSON(withStatus(syncResult(report), err))
 			}
 			return err
 		}
-		backupRotation = rotateBackups(out, cfg)
+		recordDeployed(deployed, cfg.Repo.Path, results)
+		finishJournal()
+		report.BackupRotation = rotateBackups(out, cfg)
 	}
 
 	if out.IsJSON() {
-		return out.JSON(syncResult(results, state.Skipped, flagDryRun, pullOutput, pushResult, preHookResults, postHookResults, rollbackResults, backupRotation))
+		return out.JSON(withStatus(syncResult(report), err))
 	}
 
 	logging.Info("sync complete", "profile", cfg.Profile, "dry_run", flagDryRun)
 	return nil
 }
 
+func syncBackupMetadata(cfg *config.Config, state manifestState) backup.Metadata {
+	commit, err := gitops.LastCommit(cfg.Repo.Path)
+	if err != nil {
+		logging.Debug("backup metadata: reading commit failed", "error", err)
+	}
+	return backup.Metadata{
+		Reason:   "sync",
+		Repo:     cfg.Repo.Name,
+		Commit:   commit,
+		Profile:  cfg.Profile,
+		Hostname: state.Context.Hostname,
+	}
+}
+
 func persistLastSync(cfgPath string, cfg *config.Config) error {
 	now := time.Now().UTC()
 	cfg.LastSync = &now
@@ -356,14 +558,18 @@ func reportManagedSourceBackfill(out *output.Printer, results []sourceBackfillRe
 }
 
 type syncResultJSON struct {
+	Status        string              `json:"status"` // "ok", "error" or "cancelled"
 	DryRun        bool                `json:"dry_run"`
 	PullOutput    string              `json:"pull_output,omitempty"`
 	Applied       []actionResultJSON  `json:"applied"`
 	Skipped       []skippedJSON       `json:"skipped"`
 	PreSyncHooks  []hookResultJSON    `json:"pre_sync_hooks,omitempty"`
 	PostSyncHooks []hookResultJSON    `json:"post_sync_hooks,omitempty"`
+	OnChangeHooks []hookResultJSON    `json:"on_change_hooks,omitempty"`
+	Captured      []captureResultJSON `json:"captured,omitempty"`
 	Rollback      []rollbackJSON      `json:"rollback,omitempty"`
 	BackupRotate  *backupRotationJSON `json:"backup_rotation,omitempty"`
+	Warnings      []string            `json:"warnings,omitempty"`
 	Summary       summaryJSON         `json:"summary"`
 	Push          *gitops.PushResult  `json:"push,omitempty"`
 }
@@ -373,9 +579,11 @@ type actionResultJSON struct {
 	Target     string `json:"target"`
 	Mode       string `json:"mode"`
 	Decrypt    bool   `json:"decrypt,omitempty"`
+	Template   bool   `json:"template,omitempty"`
 	Status     string `json:"status"`
 	BackupPath string `json:"backup_path,omitempty"`
 	Decrypted  bool   `json:"decrypted,omitempty"`
+	Rendered   bool   `json:"rendered,omitempty"`
 	Error      string `json:"error,omitempty"`
 }
 
@@ -390,6 +598,7 @@ type summaryJSON struct {
 	AlreadyOK int `json:"already_ok"`
 	BackedUp  int `json:"backed_up"`
 	Errors    int `json:"errors"`
+	Conflicts int `json:"conflicts"`
 }
 
 type rollbackJSON struct {
@@ -404,27 +613,35 @@ type backupRotationJSON struct {
 	Removed int `json:"removed"`
 }
 
-func syncResult(
-	results []linker.Result,
-	skipped []manifest.Action,
-	dryRun bool,
-	pullOutput string,
-	push *gitops.PushResult,
-	preHooks []hookResultJSON,
-	postHooks []hookResultJSON,
-	rollback []linker.RollbackResult,
-	backupRotation *backup.RotationResult,
-) syncResultJSON {
+// syncResultInput collects what a sync produced so far for its JSON report.
+// Phases that did not run are left zero.
+type syncResultInput struct {
+	Results        []linker.Result
+	Skipped        []manifest.Action
+	DryRun         bool
+	PullOutput     string
+	Push           *gitops.PushResult
+	PreHooks       []hookResultJSON
+	PostHooks      []hookResultJSON
+	OnChangeHooks  []hookResultJSON
+	Rollback       []linker.RollbackResult
+	BackupRotation *backup.RotationResult
+	Warnings       []string
+}
+
+func syncResult(in syncResultInput) syncResultJSON {
 	var applied []actionResultJSON
-	for _, r := range results {
+	for _, r := range in.Results {
 		ar := actionResultJSON{
 			Source:     r.Action.Source,
 			Target:     r.Action.Target,
 			Mode:       r.Action.Mode,
 			Decrypt:    r.Action.Decrypt,
+			Template:   r.Action.Template,
 			Status:     r.Status,
 			BackupPath: r.BackupPath,
 			Decrypted:  r.Decrypted,
+			Rendered:   r.Rendered,
 		}
 		if r.Error != nil {
 			ar.Error = r.Error.Error()
@@ -433,7 +650,7 @@ func syncResult(
 	}
 
 	var skippedList []skippedJSON
-	for _, s := range skipped {
+	for _, s := range in.Skipped {
 		skippedList = append(skippedList, skippedJSON{
 			Source: s.Source,
 			Target: s.Target,
@@ -442,7 +659,7 @@ func syncResult(
 	}
 
 	var rollbackList []rollbackJSON
-	for _, r := range rollback {
+	for _, r := range in.Rollback {
 		item := rollbackJSON{
 			Source: r.Action.Source,
 			Target: r.Action.Target,
@@ -454,34 +671,50 @@ func syncResult(
 		rollbackList = append(rollbackList, item)
 	}
 
-	summary := linker.Summarize(results)
+	summary := linker.Summarize(in.Results)
 	var rotationJSON *backupRotationJSON
-	if backupRotation != nil {
+	if in.BackupRotation != nil {
 		rotationJSON = &backupRotationJSON{
-			Kept:    backupRotation.Kept,
-			Removed: backupRotation.Removed,
+			Kept:    in.BackupRotation.Kept,
+			Removed: in.BackupRotation.Removed,
 		}
 	}
 
 	return syncResultJSON{
-		DryRun:        dryRun,
-		PullOutput:    pullOutput,
+		DryRun:        in.DryRun,
+		PullOutput:    in.PullOutput,
 		Applied:       applied,
 		Skipped:       skippedList,
-		PreSyncHooks:  preHooks,
-		PostSyncHooks: postHooks,
+		PreSyncHooks:  in.PreHooks,
+		PostSyncHooks: in.PostHooks,
+		OnChangeHooks: in.OnChangeHooks,
 		Rollback:      rollbackList,
 		BackupRotate:  rotationJSON,
+		Warnings:      in.Warnings,
 		Summary: summaryJSON{
 			Created:   summary.Created + summary.Copied,
 			AlreadyOK: summary.AlreadyOK,
 			BackedUp:  summary.BackedUp,
 			Errors:    summary.Errors,
+			Conflicts: summary.Conflicts,
 		},
-		Push: push,
+		Push: in.Push,
 	}
 }
 
+// withSyncStatus sets the top-level status from the error sync is returning.
+func withSyncStatus(res syncResultJSON, err error) syncResultJSON {
+	switch {
+	case err == nil:
+		res.Status = "ok"
+	case errors.Is(err, context.Canceled):
+		res.Status = "cancelled"
+	default:
+		res.Status = "error"
+	}
+	return res
+}
+
 func rotateBackups(out *output.Printer, cfg *config.Config) *backup.RotationResult {
 	result, err := backup.Rotate(cfg.Backup.Keep)
 	if err != nil {
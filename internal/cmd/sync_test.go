@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithSyncStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{errors.New("3 errors during sync"), "error"},
+		{errSyncCancelled(context.Canceled), "cancelled"},
+	}
+
+	for _, tt := range tests {
+		got := withSyncStatus(syncResultJSON{}, tt.err).Status
+		if got != tt.want {
+			t.Errorf("withSyncStatus(%v).Status = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/felipe-veas/dotctl/internal/decrypt"
 	"github.com/felipe-veas/dotctl/internal/output"
+	"github.com/felipe-veas/dotctl/internal/secrets"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 )
@@ -18,18 +20,22 @@ import (
 func newWatchCmd() *cobra.Command {
 	var debounce time.Duration
 	var cooldown time.Duration
+	var passphraseCache time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "watch",
 		Short: "Watch repo files and run sync automatically",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			secrets.CacheIdentities(passphraseCache)
+			defer secrets.CacheIdentities(0)
 			return runWatch(cmd, debounce, cooldown)
 		},
 	}
 
 	cmd.Flags().DurationVar(&debounce, "debounce", 2*time.Second, "debounce window before triggering sync")
 	cmd.Flags().DurationVar(&cooldown, "cooldown", 4*time.Second, "ignore filesystem events briefly after each sync")
+	cmd.Flags().DurationVar(&passphraseCache, "passphrase-cache", 0, "keep a passphrase-protected identity unlocked in memory this long (0 = ask every sync)")
 
 	return cmd
 }
@@ -88,6 +94,7 @@ func runWatch(cmd *cobra.Command, debounce, cooldown time.Duration) error {
 			out.Info("Change detected (%s), running sync...", reason)
 		}
 		syncErr := runSync(cmd, nil)
+		decrypt.Forget()
 		if syncErr != nil {
 			if !out.IsJSON() {
 				out.Warn("Auto-sync failed: %v", syncErr)
@@ -30,6 +30,28 @@ type Config struct {
 	Profile  string       `yaml:"profile"`
 	Backup   BackupConfig `yaml:"backup,omitempty"`
 	LastSync *time.Time   `yaml:"last_sync,omitempty"`
+
+	// MergeTool is the shell command `dotctl resolve` runs to merge a
+	// conflict; $BASE, $LOCAL, $REMOTE and $MERGED name the files. Empty
+	// means open $MERGED in $VISUAL or $EDITOR.
+	MergeTool string `yaml:"merge_tool,omitempty"`
+
+	// GitBackend selects how git operations run: auto (default), exec
+	// (the git binary) or native (built-in, no git needed).
+	GitBackend string `yaml:"git_backend,omitempty"`
+
+	Secrets SecretsConfig `yaml:"secrets,omitempty"`
+}
+
+// SecretsConfig controls how `dotctl secrets` and decryption find keys.
+type SecretsConfig struct {
+	// SSHKeys are SSH private keys (ssh-ed25519 or ssh-rsa) used as the
+	// identity when no age identity exists. Empty means ~/.ssh/id_ed25519
+	// and ~/.ssh/id_rsa.
+	SSHKeys []string `yaml:"ssh_keys,omitempty"`
+	// PassphraseCommand is a shell command printing the passphrase of a
+	// passphrase-protected identity, tried before a terminal prompt.
+	PassphraseCommand string `yaml:"passphrase_command,omitempty"`
 }
 
 // RepoConfig holds the remote repository configuration.
@@ -37,6 +59,24 @@ type RepoConfig struct {
 	Name string `yaml:"name,omitempty"`
 	URL  string `yaml:"url"`
 	Path string `yaml:"path"`
+
+	// Branch is the branch this machine checks out, pulls and pushes.
+	// Empty means whatever branch the clone has checked out.
+	Branch string `yaml:"branch,omitempty"`
+	// Overlay names a shared branch (such as main) that Branch is rebased
+	// onto on every sync, so Branch holds only this machine's commits.
+	Overlay string `yaml:"overlay,omitempty"`
+}
+
+// ValidateBranch checks the branch settings of the repo.
+func (r RepoConfig) ValidateBranch() error {
+	switch {
+	case r.Overlay != "" && r.Branch == "":
+		return fmt.Errorf("repo %q: overlay %q requires branch", r.Name, r.Overlay)
+	case r.Overlay != "" && r.Overlay == r.Branch:
+		return fmt.Errorf("repo %q: overlay cannot be the branch itself (%q)", r.Name, r.Branch)
+	}
+	return nil
 }
 
 // BackupConfig controls backup retention behavior.
@@ -151,11 +191,23 @@ func (c *Config) UpsertRepo(repo RepoConfig) (bool, error) {
 	if strings.TrimSpace(repo.Path) == "" {
 		repo.Path = DefaultRepoPath(repo.Name)
 	}
+	repo.Branch = strings.TrimSpace(repo.Branch)
+	repo.Overlay = strings.TrimSpace(repo.Overlay)
+	if err := repo.ValidateBranch(); err != nil {
+		return false, err
+	}
 
 	for i := range c.Repos {
 		if c.Repos[i].Name == repo.Name {
-			c.Repos[i].URL = repo.URL
-			c.Repos[i].Path = repo.Path
+			// Keep the branch settings unless new ones are given.
+			next := c.Repos[i]
+			next.URL = repo.URL
+			next.Path = repo.Path
+			if repo.Branch != "" {
+				next.Branch = repo.Branch
+				next.Overlay = repo.Overlay
+			}
+			c.Repos[i] = next
 			if c.ActiveRepo == repo.Name {
 				c.Repo = c.Repos[i]
 			}
@@ -224,3 +224,40 @@ func TestConfigUpsertRepoAndRemove(t *testing.T) {
 		t.Fatalf("Repos len = %d, want 1", len(cfg.Repos))
 	}
 }
+
+func TestConfigUpsertRepoBranch(t *testing.T) {
+	cfg := &Config{
+		Repos:      []RepoConfig{{Name: "work", URL: "github.com/user/work", Path: "/tmp/work"}},
+		ActiveRepo: "work",
+		Profile:    "dev",
+	}
+
+	if _, err := cfg.UpsertRepo(RepoConfig{Name: "work", URL: "github.com/user/work", Overlay: "main"}); err == nil {
+		t.Fatal("expected error for overlay without branch")
+	}
+	if _, err := cfg.UpsertRepo(RepoConfig{Name: "work", URL: "github.com/user/work", Branch: "main", Overlay: "main"}); err == nil {
+		t.Fatal("expected error for overlay equal to branch")
+	}
+
+	if _, err := cfg.UpsertRepo(RepoConfig{Name: "work", URL: "github.com/user/work", Branch: " laptop ", Overlay: "main"}); err != nil {
+		t.Fatalf("UpsertRepo add: %v", err)
+	}
+	if cfg.Repo.Branch != "laptop" || cfg.Repo.Overlay != "main" {
+		t.Fatalf("active repo branch = %q overlay = %q, want laptop/main", cfg.Repo.Branch, cfg.Repo.Overlay)
+	}
+
+	// Updating without a branch keeps the existing branch settings.
+	if _, err := cfg.UpsertRepo(RepoConfig{Name: "work", URL: "github.com/user/work2"}); err != nil {
+		t.Fatalf("UpsertRepo update: %v", err)
+	}
+	if cfg.Repos[0].Branch != "laptop" || cfg.Repos[0].Overlay != "main" || cfg.Repos[0].URL != "github.com/user/work2" {
+		t.Fatalf("updated repo = %+v", cfg.Repos[0])
+	}
+
+	if _, err := cfg.UpsertRepo(RepoConfig{Name: "work", URL: "github.com/user/work2", Branch: "desktop"}); err != nil {
+		t.Fatalf("UpsertRepo branch update: %v", err)
+	}
+	if cfg.Repos[0].Branch != "desktop" || cfg.Repos[0].Overlay != "" {
+		t.Fatalf("updated repo = %+v, want branch desktop without overlay", cfg.Repos[0])
+	}
+}
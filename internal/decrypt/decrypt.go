@@ -3,22 +3,42 @@ package decrypt
 import (
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
+
+	"github.com/felipe-veas/dotctl/internal/secrets"
 )
 
 // Tool identifies a supported decryption backend.
 type Tool string
 
 const (
-	ToolSOPS Tool = "sops"
-	ToolAGE  Tool = "age"
+	ToolSOPS    Tool = "sops"
+	ToolAGE     Tool = "age"
+	ToolBuiltin Tool = "builtin" // dotctl's own age implementation
+)
+
+// Backend selection modes, matching the manifest's decrypt values.
+const (
+	ModeAuto = "auto"
+	ModeAge  = "age"
+	ModeSOPS = "sops"
 )
 
 var (
 	lookPath = exec.LookPath
 	runTool  = runToolOutput
+
+	// loadIdentity and lookupIdentity return the dotctl identity with and
+	// without unlocking it; they are variables so tests can stub them.
+	loadIdentity   = func() (*secrets.Identity, error) { return secrets.FindIdentity("") }
+	lookupIdentity = func() (*secrets.Identity, error) { return secrets.LookupIdentity("") }
+
+	identityMu sync.Mutex
+	identity   *secrets.Identity
 )
 
 // DetectTool returns the preferred decryption tool available on PATH.
@@ -33,15 +53,87 @@ func DetectTool() (Tool, error) {
 	return "", fmt.Errorf("decrypt entries require sops or age in PATH%s", installHint())
 }
 
-// DecryptFile decrypts sourcePath and returns plaintext bytes and the tool used.
-func DecryptFile(sourcePath string) ([]byte, Tool, error) {
-	tool, err := DetectTool()
+// Backend returns the tool DecryptFile uses for sourcePath under mode
+// ("auto", "age" or "sops"; empty means auto) without decrypting anything or
+// asking for a passphrase. Age files are decrypted in-process with the dotctl
+// identity. Value-encrypted (sops layout) files are too when the identity is
+// one of their age recipients; in auto mode they otherwise go to sops, which
+// may hold its own key. Other formats need sops (or age) on PATH.
+func Backend(sourcePath, mode string) (Tool, error) {
+	switch mode {
+	case ModeSOPS:
+		if _, err := lookPath(string(ToolSOPS)); err != nil {
+			return "", fmt.Errorf("decrypt: sops entries require sops in PATH%s", installHint())
+		}
+		return ToolSOPS, nil
+	case ModeAge, ModeAuto, "":
+	default:
+		return "", fmt.Errorf("unsupported decrypt backend: %s", mode)
+	}
+
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("reading %q: %w", sourcePath, err)
+	}
+	if secrets.IsAgeCiphertext(data) {
+		if _, err := lookupIdentity(); err != nil {
+			return "", fmt.Errorf("no dotctl identity to decrypt %s (run 'dotctl secrets init' or import the key): %w", sourcePath, err)
+		}
+		return ToolBuiltin, nil
+	}
+
+	recipients := secrets.StructuredRecipients(sourcePath, data)
+	if len(recipients) == 0 {
+		if mode == ModeAge {
+			return "", fmt.Errorf("%s is not encrypted with age (use decrypt: sops or auto)", sourcePath)
+		}
+		return DetectTool()
+	}
+	builtinErr := structuredIdentityError(sourcePath, recipients)
+	if builtinErr == nil {
+		return ToolBuiltin, nil
+	}
+	if mode == ModeAge {
+		return "", builtinErr
+	}
+	// sops may decrypt with its own key (SOPS_AGE_KEY_FILE, keys.txt).
+	if _, err := lookPath(string(ToolSOPS)); err == nil {
+		return ToolSOPS, nil
+	}
+	return "", builtinErr
+}
+
+// structuredIdentityError reports why the dotctl identity cannot decrypt a
+// value-encrypted file for recipients, or nil when it can. A locked identity
+// does not expose its public key and is assumed to match.
+func structuredIdentityError(sourcePath string, recipients []string) error {
+	id, err := lookupIdentity()
+	if err != nil {
+		return fmt.Errorf("no dotctl identity to decrypt %s (run 'dotctl secrets init' or import the key): %w", sourcePath, err)
+	}
+	if id.PublicKey == "" {
+		return nil
+	}
+	for _, recipient := range recipients {
+		if recipient == id.PublicKey {
+			return nil
+		}
+	}
+	return fmt.Errorf("dotctl identity %s is not a recipient of %s (add it with 'dotctl secrets recipients add' or install sops)", id.PublicKey, sourcePath)
+}
+
+// DecryptFile decrypts sourcePath with the backend chosen by Backend and
+// returns plaintext bytes and the tool used.
+func DecryptFile(sourcePath, mode string) ([]byte, Tool, error) {
+	tool, err := Backend(sourcePath, mode)
 	if err != nil {
 		return nil, "", err
 	}
 
 	var out []byte
 	switch tool {
+	case ToolBuiltin:
+		out, err = decryptBuiltin(sourcePath)
 	case ToolSOPS:
 		out, err = runTool(string(tool), "--decrypt", sourcePath)
 	case ToolAGE:
@@ -56,6 +148,39 @@ func DecryptFile(sourcePath string) ([]byte, Tool, error) {
 	return out, tool, nil
 }
 
+func decryptBuiltin(sourcePath string) ([]byte, error) {
+	id, err := builtinIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return secrets.DecryptFileWithIdentity(sourcePath, id)
+}
+
+// builtinIdentity loads the dotctl identity once, so decrypting several
+// entries asks for a passphrase at most once until Forget is called.
+func builtinIdentity() (*secrets.Identity, error) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	if identity != nil {
+		return identity, nil
+	}
+	id, err := loadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	identity = id
+	return id, nil
+}
+
+// Forget drops the identity loaded for built-in decryption. Long-running
+// callers such as watch call it after each pass so an unlocked key is only
+// kept as long as the secrets identity cache allows.
+func Forget() {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	identity = nil
+}
+
 func runToolOutput(name string, args ...string) ([]byte, error) {
 	cmd := exec.Command(name, args...)
 	out, err := cmd.Output()
@@ -2,7 +2,11 @@ package decrypt
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/secrets"
 )
 
 func TestDetectToolPrefersSOPS(t *testing.T) {
@@ -86,7 +90,12 @@ func TestDecryptFileUsesSOPS(t *testing.T) {
 		return []byte("plain\n"), nil
 	}
 
-	plain, tool, err := DecryptFile("configs/secrets/api.enc.yaml")
+	source := filepath.Join(t.TempDir(), "api.enc.yaml")
+	if err := os.WriteFile(source, []byte("api_key: ENC[AES256_GCM,data:...]\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	plain, tool, err := DecryptFile(source, ModeAuto)
 	if err != nil {
 		t.Fatalf("DecryptFile() error = %v", err)
 	}
@@ -99,7 +108,184 @@ func TestDecryptFileUsesSOPS(t *testing.T) {
 	if calledName != "sops" {
 		t.Fatalf("called tool = %q, want sops", calledName)
 	}
-	if len(calledArgs) != 2 || calledArgs[0] != "--decrypt" || calledArgs[1] != "configs/secrets/api.enc.yaml" {
-		t.Fatalf("called args = %#v, want [--decrypt configs/secrets/api.enc.yaml]", calledArgs)
+	if len(calledArgs) != 2 || calledArgs[0] != "--decrypt" || calledArgs[1] != source {
+		t.Fatalf("called args = %#v, want [--decrypt %s]", calledArgs, source)
+	}
+}
+
+// stubIdentity makes the built-in backend use a fresh identity and returns it
+// with a counter of how often it was loaded.
+func stubIdentity(t *testing.T) (*secrets.Identity, *int) {
+	t.Helper()
+	id, err := secrets.GenerateIdentity(filepath.Join(t.TempDir(), "age-identity.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+
+	origLoad, origLookup := loadIdentity, lookupIdentity
+	loads := 0
+	loadIdentity = func() (*secrets.Identity, error) {
+		loads++
+		return id, nil
+	}
+	lookupIdentity = func() (*secrets.Identity, error) { return id, nil }
+	Forget()
+	t.Cleanup(func() {
+		loadIdentity, lookupIdentity = origLoad, origLookup
+		Forget()
+	})
+	return id, &loads
+}
+
+func writeAgeFile(t *testing.T, id *secrets.Identity, plaintext string) string {
+	t.Helper()
+	ciphertext, err := secrets.EncryptBytes([]byte(plaintext), id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptBytes: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "token.enc.txt")
+	if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestDecryptFileBuiltinAge(t *testing.T) {
+	id, loads := stubIdentity(t)
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(file string) (string, error) { return "", errors.New("not found") }
+
+	first := writeAgeFile(t, id, "one\n")
+	second := writeAgeFile(t, id, "two\n")
+
+	for _, tc := range []struct{ path, mode, want string }{
+		{first, ModeAuto, "one\n"},
+		{second, ModeAge, "two\n"},
+	} {
+		plain, tool, err := DecryptFile(tc.path, tc.mode)
+		if err != nil {
+			t.Fatalf("DecryptFile(%s) error = %v", tc.mode, err)
+		}
+		if tool != ToolBuiltin {
+			t.Errorf("DecryptFile(%s) tool = %q, want %q", tc.mode, tool, ToolBuiltin)
+		}
+		if string(plain) != tc.want {
+			t.Errorf("DecryptFile(%s) output = %q, want %q", tc.mode, plain, tc.want)
+		}
+	}
+	if *loads != 1 {
+		t.Errorf("identity loaded %d times, want 1", *loads)
+	}
+}
+
+func TestBackendPinned(t *testing.T) {
+	id, _ := stubIdentity(t)
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(file string) (string, error) {
+		if file == "sops" {
+			return "/tmp/sops", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	ageFile := writeAgeFile(t, id, "x")
+	sopsFile := filepath.Join(t.TempDir(), "api.enc.yaml")
+	if err := os.WriteFile(sopsFile, []byte("api_key: ENC[...]\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if tool, err := Backend(ageFile, ModeSOPS); err != nil || tool != ToolSOPS {
+		t.Errorf("Backend(age file, sops) = %q, %v; want sops", tool, err)
+	}
+	if tool, err := Backend(sopsFile, ModeAuto); err != nil || tool != ToolSOPS {
+		t.Errorf("Backend(sops file, auto) = %q, %v; want sops", tool, err)
+	}
+	if _, err := Backend(sopsFile, ModeAge); err == nil {
+		t.Error("Backend(sops file, age) expected error")
+	}
+}
+
+func TestBackendWithoutIdentity(t *testing.T) {
+	id, _ := stubIdentity(t)
+	ageFile := writeAgeFile(t, id, "x")
+	lookupIdentity = func() (*secrets.Identity, error) { return nil, errors.New("opening identity file: not found") }
+
+	if _, err := Backend(ageFile, ModeAuto); err == nil {
+		t.Fatal("Backend() expected error without an identity")
+	}
+}
+
+func TestDecryptFileBuiltinStructured(t *testing.T) {
+	id, _ := stubIdentity(t)
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(file string) (string, error) { return "", errors.New("not found") }
+
+	ciphertext, err := secrets.EncryptStructured([]byte("token: abc\n"), secrets.FormatYAML, id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "api.enc.yaml")
+	if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	plain, tool, err := DecryptFile(path, ModeAuto)
+	if err != nil {
+		t.Fatalf("DecryptFile() error = %v", err)
+	}
+	if tool != ToolBuiltin || string(plain) != "token: abc\n" {
+		t.Fatalf("DecryptFile() = %q, %q; want built-in plaintext", plain, tool)
+	}
+}
+
+func TestBackendStructuredFallsBackToSOPS(t *testing.T) {
+	id, _ := stubIdentity(t)
+	other, err := secrets.GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	sopsInstalled := true
+	lookPath = func(file string) (string, error) {
+		if file == "sops" && sopsInstalled {
+			return "/tmp/sops", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	// A file encrypted by sops for a key dotctl does not hold.
+	ciphertext, err := secrets.EncryptStructured([]byte("token: abc\n"), secrets.FormatYAML, other.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "api.enc.yaml")
+	if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if tool, err := Backend(path, ModeAuto); err != nil || tool != ToolSOPS {
+		t.Errorf("Backend(foreign recipient, auto) = %q, %v; want sops", tool, err)
+	}
+	if _, err := Backend(path, ModeAge); err == nil {
+		t.Error("Backend(foreign recipient, age) expected error")
+	}
+
+	lookupIdentity = func() (*secrets.Identity, error) { return nil, errors.New("opening identity file: not found") }
+	if tool, err := Backend(path, ModeAuto); err != nil || tool != ToolSOPS {
+		t.Errorf("Backend(no identity, auto) = %q, %v; want sops", tool, err)
+	}
+
+	sopsInstalled = false
+	if _, err := Backend(path, ModeAuto); err == nil {
+		t.Error("Backend(no identity, no sops) expected error")
+	}
+
+	lookupIdentity = func() (*secrets.Identity, error) { return id, nil }
+	if _, err := Backend(path, ModeAuto); err == nil {
+		t.Error("Backend(identity not a recipient, no sops) expected error")
 	}
 }
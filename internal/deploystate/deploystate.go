@@ -0,0 +1,219 @@
+// Package deploystate records what dotctl last deployed to each copy-mode
+// target, so a later sync can tell repo changes, local edits and conflicts
+// apart.
+package deploystate
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/platform"
+)
+
+// ErrNoBase indicates no copy of the deployed content was kept for a target.
+var ErrNoBase = errors.New("no base content recorded")
+
+// Path returns the state file location under the state directory.
+func Path() string {
+	return filepath.Join(platform.StateDir(), "deployed.json")
+}
+
+// Entry is what dotctl last wrote to one target.
+type Entry struct {
+	Source     string    `json:"source"`
+	Hash       string    `json:"hash"` // linker.ContentHash of the deployed content
+	DeployedAt time.Time `json:"deployed_at"`
+	HasBase    bool      `json:"has_base,omitempty"` // a copy of the content is kept for merges
+}
+
+// keySize is the length of the per-machine key decrypted hashes are sealed with.
+const keySize = 32
+
+// State maps absolute target paths to their last deployment.
+type State struct {
+	path    string
+	key     []byte
+	Targets map[string]Entry `json:"targets"`
+}
+
+// Load reads the state file. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	s := &State{path: path, Targets: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("reading deploy state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing deploy state %s: %w", path, err)
+	}
+	if s.Targets == nil {
+		s.Targets = make(map[string]Entry)
+	}
+	return s, nil
+}
+
+// Hash returns the recorded hash for target, or "" if none.
+func (s *State) Hash(target string) string {
+	return s.Targets[target].Hash
+}
+
+// Record stores the deployed hash for target. base, when non-nil, is kept
+// as the merge base for later conflict resolution; pass nil for content that
+// must not be stored in plaintext (decrypted secrets) or for directories.
+func (s *State) Record(target, source, hash string, base []byte) error {
+	entry := Entry{Source: source, Hash: hash, DeployedAt: time.Now().UTC()}
+	if base != nil {
+		if err := writeObject(s.objectPath(hash), base); err != nil {
+			return err
+		}
+		entry.HasBase = true
+	}
+	s.Targets[target] = entry
+	return nil
+}
+
+// Key returns the per-machine key the hashes of decrypted targets are sealed
+// with, creating it on first use. A plain hash of decrypted content would let
+// anyone who can read the state guess short secrets offline.
+func (s *State) Key() ([]byte, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+	path := s.keyPath()
+	key, err := os.ReadFile(path)
+	switch {
+	case err == nil && len(key) == keySize:
+		s.key = key
+		return key, nil
+	case err != nil && !os.IsNotExist(err):
+		return nil, fmt.Errorf("reading deploy state key: %w", err)
+	}
+
+	key = make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating deploy state key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("creating deploy state directory: %w", err)
+	}
+	if err := writeAtomic(path, key, 0o600); err != nil {
+		return nil, fmt.Errorf("writing deploy state key: %w", err)
+	}
+	s.key = key
+	return key, nil
+}
+
+// Forget removes the record for target.
+func (s *State) Forget(target string) {
+	delete(s.Targets, target)
+}
+
+// Base returns the content last deployed to target.
+func (s *State) Base(target string) ([]byte, error) {
+	entry, ok := s.Targets[target]
+	if !ok || !entry.HasBase {
+		return nil, ErrNoBase
+	}
+	data, err := os.ReadFile(s.objectPath(entry.Hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoBase
+		}
+		return nil, fmt.Errorf("reading base content for %s: %w", target, err)
+	}
+	return data, nil
+}
+
+// Save writes the state file atomically, readable only by the user, and removes base copies no target
+// refers to anymore.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding deploy state: %w", err)
+	}
+	if err := writeAtomic(s.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("writing deploy state: %w", err)
+	}
+	s.pruneObjects()
+	return nil
+}
+
+func (s *State) keyPath() string {
+	return filepath.Join(filepath.Dir(s.path), "deployed.key")
+}
+
+func (s *State) objectsDir() string {
+	return filepath.Join(filepath.Dir(s.path), "deployed-objects")
+}
+
+func (s *State) objectPath(hash string) string {
+	return filepath.Join(s.objectsDir(), strings.ReplaceAll(hash, ":", "-"))
+}
+
+func (s *State) pruneObjects() {
+	entries, err := os.ReadDir(s.objectsDir())
+	if err != nil {
+		return
+	}
+	keep := make(map[string]bool, len(s.Targets))
+	for _, e := range s.Targets {
+		if e.HasBase {
+			keep[filepath.Base(s.objectPath(e.Hash))] = true
+		}
+	}
+	for _, e := range entries {
+		if !keep[e.Name()] && !strings.HasPrefix(e.Name(), ".") {
+			_ = os.Remove(filepath.Join(s.objectsDir(), e.Name()))
+		}
+	}
+}
+
+// writeObject stores base content readable only by the user; targets such as
+// ~/.ssh/config may be sensitive even when not encrypted in the repo.
+func writeObject(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating deploy state directory: %w", err)
+	}
+	if err := writeAtomic(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing base content: %w", err)
+	}
+	return nil
+}
+
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
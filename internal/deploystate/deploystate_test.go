@@ -0,0 +1,103 @@
+package deploystate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordLoadAndBase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deployed.json")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := s.Record("/home/u/.gitconfig", "git/config", "sha256:aa", []byte("[user]\n")); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := s.Record("/home/u/.env", "env/.env.enc", "sha256:bb", nil); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := loaded.Hash("/home/u/.gitconfig"); got != "sha256:aa" {
+		t.Fatalf("Hash = %q, want sha256:aa", got)
+	}
+	base, err := loaded.Base("/home/u/.gitconfig")
+	if err != nil || string(base) != "[user]\n" {
+		t.Fatalf("Base = %q, %v", base, err)
+	}
+	if _, err := loaded.Base("/home/u/.env"); !errors.Is(err, ErrNoBase) {
+		t.Fatalf("Base for hash-only entry err = %v, want ErrNoBase", err)
+	}
+
+	info, err := os.Stat(loaded.objectPath("sha256:aa"))
+	if err != nil {
+		t.Fatalf("stat object: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("object mode = %04o, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestSavePrunesUnreferencedObjects(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "deployed.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := s.Record("/t", "src", "sha256:old", []byte("old")); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := s.Record("/t", "src", "sha256:new", []byte("new")); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if _, err := os.Stat(s.objectPath("sha256:old")); !os.IsNotExist(err) {
+		t.Fatalf("old object should be pruned, stat err = %v", err)
+	}
+	if _, err := os.Stat(s.objectPath("sha256:new")); err != nil {
+		t.Fatalf("new object missing: %v", err)
+	}
+}
+
+func TestKeyPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deployed.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	key, err := s.Key()
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	info, err := os.Stat(s.keyPath())
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("key mode = %04o, want 0600", info.Mode().Perm())
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	again, err := reloaded.Key()
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if string(again) != string(key) {
+		t.Fatal("key changed across loads")
+	}
+}
@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Git backend names accepted in the config (git_backend).
+const (
+	BackendAuto   = "auto"   // exec when git is on PATH, native otherwise
+	BackendExec   = "exec"   // shell out to the git binary
+	BackendNative = "native" // pure-Go implementation (go-git)
+)
+
+// Backend performs the repository operations dotctl needs. Paths are the
+// root of a working tree; errors are wrapped with hints by the callers in
+// this package.
+type Backend interface {
+	Name() string
+	Version(ctx context.Context) (string, error)
+	Clone(ctx context.Context, url, path string) error
+	// PullRebase fetches the upstream branch and replays local commits on
+	// top of it. With autostash, uncommitted changes are kept across it.
+	PullRebase(ctx context.Context, path string, autostash bool) (string, error)
+	Status(ctx context.Context, path string) ([]StatusEntry, error)
+	AddAll(ctx context.Context, path string) error
+	Commit(ctx context.Context, path, message string) error
+	// Push pushes the current branch to its upstream. With lease, a rewritten
+	// branch replaces the remote one as long as the remote has not moved
+	// since the last fetch (git push --force-with-lease).
+	Push(ctx context.Context, path string, lease bool) error
+	// Fetch updates the remote-tracking branches of origin.
+	Fetch(ctx context.Context, path string) error
+	// RefExists reports whether a fully qualified ref exists locally.
+	RefExists(ctx context.Context, path, ref string) (bool, error)
+	// Checkout switches to branch. A branch that does not exist locally is
+	// created at the revision start, tracking the same name on origin.
+	Checkout(ctx context.Context, path, branch, start string) error
+	// Rebase replays the commits of the current branch onto a revision,
+	// with autostash like PullRebase.
+	Rebase(ctx context.Context, path, onto string, autostash bool) (string, error)
+	// AheadBehind counts the commits only on HEAD and only on its upstream.
+	// upstream is "" when the branch tracks nothing that has been fetched.
+	AheadBehind(ctx context.Context, path string) (upstream string, ahead, behind int, err error)
+	Branch(ctx context.Context, path string) (string, error)
+	Head(ctx context.Context, path string) (string, error)
+	TrackedFiles(ctx context.Context, path string) ([]string, error)
+}
+
+// StatusEntry is one changed path, with git's porcelain status codes for the
+// index (Staging) and the working tree (Worktree); ' ' means unmodified.
+type StatusEntry struct {
+	Path     string
+	Staging  byte
+	Worktree byte
+}
+
+var (
+	lookPath = exec.LookPath
+
+	backendMu     sync.RWMutex
+	activeBackend Backend
+	backendName   = BackendAuto
+)
+
+// NewBackend returns the backend with the given name ("" means auto).
+func NewBackend(name string) (Backend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", BackendAuto:
+		if _, err := lookPath("git"); err == nil {
+			return execBackend{}, nil
+		}
+		return nativeBackend{}, nil
+	case BackendExec:
+		return execBackend{}, nil
+	case BackendNative:
+		return nativeBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown git backend %q (want %s, %s or %s)", name, BackendAuto, BackendExec, BackendNative)
+	}
+}
+
+// SetBackend selects the backend used by the package-level functions.
+func SetBackend(name string) error {
+	b, err := NewBackend(name)
+	if err != nil {
+		return err
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	activeBackend, backendName = b, name
+	return nil
+}
+
+// CurrentBackend returns the selected backend, resolving auto on first use.
+func CurrentBackend() Backend {
+	backendMu.RLock()
+	b := activeBackend
+	backendMu.RUnlock()
+	if b != nil {
+		return b
+	}
+
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if activeBackend == nil {
+		activeBackend, _ = NewBackend(backendName)
+	}
+	return activeBackend
+}
@@ -0,0 +1,499 @@
+package gitops
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// The conformance suite runs every backend against local bare repositories.
+// Fixtures are built with go-git so the native backend is tested even where
+// the git binary is missing.
+
+func forEachBackend(t *testing.T, test func(t *testing.T, b Backend)) {
+	t.Helper()
+	for _, name := range []string{BackendExec, BackendNative} {
+		t.Run(name, func(t *testing.T) {
+			if name == BackendExec {
+				requireGit(t)
+			}
+			b, err := NewBackend(name)
+			if err != nil {
+				t.Fatalf("NewBackend: %v", err)
+			}
+			test(t, b)
+		})
+	}
+}
+
+// newBareRemote returns a bare repository holding one commit with README.md.
+func newBareRemote(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	remote := filepath.Join(base, "remote.git")
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatalf("init bare: %v", err)
+	}
+
+	seed := filepath.Join(base, "seed")
+	repo, err := git.PlainInit(seed, false)
+	if err != nil {
+		t.Fatalf("init seed: %v", err)
+	}
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{remote}}); err != nil {
+		t.Fatalf("create remote: %v", err)
+	}
+	writeRepoFile(t, seed, "README.md", "seed\n")
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+	if _, err := wt.Add("README.md"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	sig := &object.Signature{Name: "seed", Email: "seed@example.com", When: time.Now()}
+	if _, err := wt.Commit("seed", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin"}); err != nil {
+		t.Fatalf("push seed: %v", err)
+	}
+	return remote
+}
+
+// cloneWith clones remote with b and configures a commit identity.
+func cloneWith(t *testing.T, b Backend, remote, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := b.Clone(context.Background(), remote, path); err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		t.Fatalf("open clone: %v", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	cfg.User.Name, cfg.User.Email = name, name+"@example.com"
+	cfg.Raw.Section("commit").SetOption("gpgsign", "false")
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("set config: %v", err)
+	}
+	return path
+}
+
+func writeRepoFile(t *testing.T, repo, name, content string) {
+	t.Helper()
+	path := filepath.Join(repo, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func readRepoFile(t *testing.T, repo, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(repo, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+// commitAll stages, commits and optionally pushes with b.
+func commitAll(t *testing.T, b Backend, repo, message string, push bool) {
+	t.Helper()
+	ctx := context.Background()
+	if err := b.AddAll(ctx, repo); err != nil {
+		t.Fatalf("AddAll: %v", err)
+	}
+	if err := b.Commit(ctx, repo, message); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if push {
+		if err := b.Push(ctx, repo, false); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+}
+
+func TestBackendCloneAndInspect(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		clone := cloneWith(t, b, newBareRemote(t), "client")
+
+		branch, err := b.Branch(ctx, clone)
+		if err != nil || branch != "master" {
+			t.Fatalf("Branch = %q, %v; want master", branch, err)
+		}
+		head, err := b.Head(ctx, clone)
+		if err != nil || len(head) != 7 {
+			t.Fatalf("Head = %q, %v; want short hash", head, err)
+		}
+		files, err := b.TrackedFiles(ctx, clone)
+		if err != nil || len(files) != 1 || files[0] != "README.md" {
+			t.Fatalf("TrackedFiles = %v, %v", files, err)
+		}
+		entries, err := b.Status(ctx, clone)
+		if err != nil || len(entries) != 0 {
+			t.Fatalf("Status of fresh clone = %+v, %v", entries, err)
+		}
+	})
+}
+
+func TestBackendStatusCommitPush(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+
+		writeRepoFile(t, client, "README.md", "changed\n")
+		writeRepoFile(t, client, "configs/new.conf", "new\n")
+		entries, err := b.Status(ctx, client)
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		got := map[string]string{}
+		for _, e := range entries {
+			got[e.Path] = string([]byte{e.Staging, e.Worktree})
+		}
+		if got["README.md"] != " M" || got["configs/new.conf"] != "??" {
+			t.Fatalf("Status = %q, want README.md \" M\" and configs/new.conf \"??\"", got)
+		}
+
+		commitAll(t, b, client, "update", true)
+		if entries, _ := b.Status(ctx, client); len(entries) != 0 {
+			t.Fatalf("Status after commit = %+v, want clean", entries)
+		}
+
+		other := cloneWith(t, b, remote, "other")
+		if got := readRepoFile(t, other, "configs/new.conf"); got != "new\n" {
+			t.Fatalf("pushed file = %q", got)
+		}
+
+		// Deletions are staged too.
+		if err := os.Remove(filepath.Join(other, "configs/new.conf")); err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+		commitAll(t, b, other, "delete", true)
+		if files, _ := b.TrackedFiles(ctx, other); len(files) != 1 {
+			t.Fatalf("TrackedFiles after delete = %v", files)
+		}
+	})
+}
+
+func TestBackendPullRebase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+		writer := cloneWith(t, b, remote, "writer")
+
+		// Fast-forward.
+		writeRepoFile(t, writer, "a.conf", "a\n")
+		commitAll(t, b, writer, "add a", true)
+		if _, err := b.PullRebase(ctx, client, false); err != nil {
+			t.Fatalf("PullRebase (fast-forward): %v", err)
+		}
+		if got := readRepoFile(t, client, "a.conf"); got != "a\n" {
+			t.Fatalf("a.conf = %q", got)
+		}
+
+		// Diverged history touching different files is replayed.
+		writeRepoFile(t, writer, "b.conf", "b\n")
+		commitAll(t, b, writer, "add b", true)
+		writeRepoFile(t, client, "c.conf", "c\n")
+		commitAll(t, b, client, "add c", false)
+		if _, err := b.PullRebase(ctx, client, false); err != nil {
+			t.Fatalf("PullRebase (diverged): %v", err)
+		}
+		for name, want := range map[string]string{"b.conf": "b\n", "c.conf": "c\n"} {
+			if got := readRepoFile(t, client, name); got != want {
+				t.Fatalf("%s = %q, want %q", name, got, want)
+			}
+		}
+		if err := b.Push(ctx, client, false); err != nil {
+			t.Fatalf("Push after rebase: %v", err)
+		}
+
+		// Up to date.
+		if _, err := b.PullRebase(ctx, client, false); err != nil {
+			t.Fatalf("PullRebase (up to date): %v", err)
+		}
+	})
+}
+
+func TestBackendPullRebaseAutostash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+		writer := cloneWith(t, b, remote, "writer")
+
+		writeRepoFile(t, writer, "a.conf", "a\n")
+		commitAll(t, b, writer, "add a", true)
+		writeRepoFile(t, client, ".gitignore", "plugins/\n")
+
+		if _, err := b.PullRebase(context.Background(), client, true); err != nil {
+			t.Fatalf("PullRebase: %v", err)
+		}
+		if got := readRepoFile(t, client, ".gitignore"); got != "plugins/\n" {
+			t.Fatalf(".gitignore = %q, want it kept", got)
+		}
+		if got := readRepoFile(t, client, "a.conf"); got != "a\n" {
+			t.Fatalf("a.conf = %q", got)
+		}
+	})
+}
+
+func TestBackendPushRejectedWhenBehind(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+		writer := cloneWith(t, b, remote, "writer")
+
+		writeRepoFile(t, writer, "a.conf", "a\n")
+		commitAll(t, b, writer, "add a", true)
+		writeRepoFile(t, client, "b.conf", "b\n")
+		commitAll(t, b, client, "add b", false)
+
+		err := b.Push(context.Background(), client, false)
+		if err == nil {
+			t.Fatal("expected push to be rejected")
+		}
+		if !strings.Contains(withPushHint(err).Error(), "remote contains newer commits") {
+			t.Fatalf("push error should get the pull hint, got: %v", err)
+		}
+	})
+}
+
+func TestNativePullRebaseRefusesOverlappingChanges(t *testing.T) {
+	b := nativeBackend{}
+	ctx := context.Background()
+	remote := newBareRemote(t)
+	client := cloneWith(t, b, remote, "client")
+	writer := cloneWith(t, b, remote, "writer")
+
+	writeRepoFile(t, writer, "README.md", "repo\n")
+	commitAll(t, b, writer, "repo edit", true)
+	writeRepoFile(t, client, "README.md", "local\n")
+	commitAll(t, b, client, "local edit", false)
+	before, _ := b.Head(ctx, client)
+
+	_, err := b.PullRebase(ctx, client, false)
+	if err == nil || !strings.Contains(err.Error(), "README.md") {
+		t.Fatalf("PullRebase error = %v, want overlap on README.md", err)
+	}
+	if after, _ := b.Head(ctx, client); after != before {
+		t.Fatalf("HEAD moved from %s to %s on refused rebase", before, after)
+	}
+	if got := readRepoFile(t, client, "README.md"); got != "local\n" {
+		t.Fatalf("README.md = %q, want local content kept", got)
+	}
+}
+
+func TestNewBackendAuto(t *testing.T) {
+	orig := lookPath
+	t.Cleanup(func() { lookPath = orig })
+
+	lookPath = func(string) (string, error) { return "", exec.ErrNotFound }
+	b, err := NewBackend("")
+	if err != nil || b.Name() != BackendNative {
+		t.Fatalf("auto without git = %v, %v; want native", b, err)
+	}
+
+	lookPath = func(string) (string, error) { return "/usr/bin/git", nil }
+	if b, _ := NewBackend(BackendAuto); b.Name() != BackendExec {
+		t.Fatalf("auto with git = %s, want exec", b.Name())
+	}
+
+	if _, err := NewBackend("libgit2"); err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+}
+
+func TestBackendCheckoutAndAheadBehind(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+		writer := cloneWith(t, b, remote, "writer")
+
+		assertAheadBehind := func(wantUpstream string, wantAhead, wantBehind int) {
+			t.Helper()
+			upstream, ahead, behind, err := b.AheadBehind(ctx, client)
+			if err != nil {
+				t.Fatalf("AheadBehind: %v", err)
+			}
+			if upstream != wantUpstream || ahead != wantAhead || behind != wantBehind {
+				t.Fatalf("AheadBehind = %q %d/%d, want %q %d/%d", upstream, ahead, behind, wantUpstream, wantAhead, wantBehind)
+			}
+		}
+
+		assertAheadBehind("origin/master", 0, 0)
+		writeRepoFile(t, client, "local.conf", "local\n")
+		commitAll(t, b, client, "add local", false)
+		writeRepoFile(t, writer, "shared.conf", "shared\n")
+		commitAll(t, b, writer, "add shared", true)
+		if err := b.Fetch(ctx, client); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		assertAheadBehind("origin/master", 1, 1)
+
+		// A new branch starts at the given revision and tracks its own name,
+		// which does not exist on origin until the first push.
+		if err := b.Checkout(ctx, client, "laptop", "origin/master"); err != nil {
+			t.Fatalf("Checkout new: %v", err)
+		}
+		if branch, _ := b.Branch(ctx, client); branch != "laptop" {
+			t.Fatalf("Branch = %q, want laptop", branch)
+		}
+		if got := readRepoFile(t, client, "shared.conf"); got != "shared\n" {
+			t.Fatalf("shared.conf = %q", got)
+		}
+		if exists, err := b.RefExists(ctx, client, "refs/remotes/origin/laptop"); err != nil || exists {
+			t.Fatalf("RefExists(origin/laptop) = %v, %v; want false", exists, err)
+		}
+		assertAheadBehind("", 0, 0)
+
+		if err := b.Push(ctx, client, false); err != nil {
+			t.Fatalf("Push new branch: %v", err)
+		}
+		if err := b.Fetch(ctx, client); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		assertAheadBehind("origin/laptop", 0, 0)
+
+		// Switching back to an existing branch keeps its commits.
+		if err := b.Checkout(ctx, client, "master", "HEAD"); err != nil {
+			t.Fatalf("Checkout existing: %v", err)
+		}
+		if got := readRepoFile(t, client, "local.conf"); got != "local\n" {
+			t.Fatalf("local.conf = %q", got)
+		}
+		if exists, err := b.RefExists(ctx, client, "refs/heads/laptop"); err != nil || !exists {
+			t.Fatalf("RefExists(laptop) = %v, %v; want true", exists, err)
+		}
+	})
+}
+
+func TestBackendOverlayRebase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+		writer := cloneWith(t, b, remote, "writer")
+
+		if err := b.Checkout(ctx, client, "laptop", "origin/master"); err != nil {
+			t.Fatalf("Checkout: %v", err)
+		}
+		writeRepoFile(t, client, "host.conf", "host\n")
+		commitAll(t, b, client, "add host", true)
+
+		writeRepoFile(t, writer, "shared.conf", "shared\n")
+		commitAll(t, b, writer, "add shared", true)
+
+		if err := b.Fetch(ctx, client); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if _, err := b.Rebase(ctx, client, "origin/master", false); err != nil {
+			t.Fatalf("Rebase: %v", err)
+		}
+		for name, want := range map[string]string{"host.conf": "host\n", "shared.conf": "shared\n"} {
+			if got := readRepoFile(t, client, name); got != want {
+				t.Fatalf("%s = %q, want %q", name, got, want)
+			}
+		}
+
+		// The rewritten branch replaces the remote one only with a lease.
+		if err := b.Push(ctx, client, false); err == nil {
+			t.Fatal("expected plain push of a rebased branch to be rejected")
+		}
+		if err := b.Push(ctx, client, true); err != nil {
+			t.Fatalf("Push with lease: %v", err)
+		}
+		if err := b.Fetch(ctx, client); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		upstream, ahead, behind, err := b.AheadBehind(ctx, client)
+		if err != nil || upstream != "origin/laptop" || ahead != 0 || behind != 0 {
+			t.Fatalf("AheadBehind = %q %d/%d, %v; want origin/laptop in sync", upstream, ahead, behind, err)
+		}
+	})
+}
+
+func TestBackendFetchRecordsLastFetch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		client := cloneWith(t, b, newBareRemote(t), "client")
+		if err := os.Remove(filepath.Join(client, ".git", "FETCH_HEAD")); err != nil && !os.IsNotExist(err) {
+			t.Fatalf("remove FETCH_HEAD: %v", err)
+		}
+		if !LastFetch(client).IsZero() {
+			t.Fatal("LastFetch should be zero before any fetch")
+		}
+
+		if err := b.Fetch(context.Background(), client); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if LastFetch(client).IsZero() {
+			t.Fatal("LastFetch should be set after a fetch")
+		}
+		if got := readRepoFile(t, client, ".git/FETCH_HEAD"); !strings.Contains(got, "branch 'master' of") {
+			t.Fatalf("FETCH_HEAD = %q, want the master branch", got)
+		}
+	})
+}
+
+func TestBackendStatusHonorsGlobalExcludes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		client := cloneWith(t, b, remote, "client")
+
+		home := t.TempDir()
+		configHome := filepath.Join(home, ".config")
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", configHome)
+		writeRepoFile(t, client, "api.secret", "token\n")
+		writeRepoFile(t, client, "notes.tmp", "scratch\n")
+		writeRepoFile(t, client, "kept.conf", "kept\n")
+
+		statusPaths := func() []string {
+			t.Helper()
+			entries, err := b.Status(ctx, client)
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			var paths []string
+			for _, e := range entries {
+				paths = append(paths, e.Path)
+			}
+			return paths
+		}
+
+		// The default global ignore file applies when core.excludesfile is unset.
+		writeRepoFile(t, configHome, "git/ignore", "*.tmp\n")
+		if got := strings.Join(statusPaths(), ","); got != "api.secret,kept.conf" {
+			t.Fatalf("Status with default excludes = %s, want api.secret,kept.conf", got)
+		}
+
+		// core.excludesfile in ~/.gitconfig replaces it.
+		writeRepoFile(t, home, "global-ignore", "*.secret\n")
+		writeRepoFile(t, home, ".gitconfig", "[core]\n\texcludesfile = "+filepath.Join(home, "global-ignore")+"\n")
+		if got := strings.Join(statusPaths(), ","); got != "kept.conf,notes.tmp" {
+			t.Fatalf("Status with core.excludesfile = %s, want kept.conf,notes.tmp", got)
+		}
+	})
+}
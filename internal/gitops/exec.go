@@ -0,0 +1,185 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// execBackend runs the git binary. It honours the user's git configuration,
+// credential helpers and hooks.
+type execBackend struct{}
+
+func (execBackend) Name() string { return BackendExec }
+
+func (execBackend) Version(ctx context.Context) (string, error) {
+	return runGitCommand(ctx, "", "--version")
+}
+
+func (execBackend) Clone(ctx context.Context, url, path string) error {
+	_, err := runGitCommand(ctx, "", "clone", url, path)
+	return err
+}
+
+func (execBackend) PullRebase(ctx context.Context, path string, autostash bool) (string, error) {
+	args := []string{"pull", "--rebase"}
+	if autostash {
+		args = append(args, "--autostash")
+	}
+	return runGitCommand(ctx, path, args...)
+}
+
+// Status parses `git status --porcelain=v2`, whose lines (unlike v1) never
+// start with a space that output trimming would eat.
+func (execBackend) Status(ctx context.Context, path string) ([]StatusEntry, error) {
+	out, err := runGitCommand(ctx, path, "status", "--porcelain=v2", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []StatusEntry
+	for _, line := range splitLines(out) {
+		var fields []string
+		switch line[0] {
+		case '1': // 1 XY sub mH mI mW hH hI path
+			fields = strings.SplitN(line, " ", 9)
+		case '2': // 2 XY sub mH mI mW hH hI Xscore path\torigPath
+			fields = strings.SplitN(line, " ", 10)
+			if len(fields) == 10 {
+				fields[9], _, _ = strings.Cut(fields[9], "\t")
+			}
+		case 'u': // u XY sub m1 m2 m3 mW h1 h2 h3 path
+			fields = strings.SplitN(line, " ", 11)
+		case '?':
+			entries = append(entries, StatusEntry{Path: strings.TrimPrefix(line, "? "), Staging: '?', Worktree: '?'})
+			continue
+		default:
+			continue
+		}
+		if len(fields) < 3 || len(fields[1]) != 2 {
+			continue
+		}
+		entries = append(entries, StatusEntry{
+			Path:     fields[len(fields)-1],
+			Staging:  porcelainCode(fields[1][0]),
+			Worktree: porcelainCode(fields[1][1]),
+		})
+	}
+	return entries, nil
+}
+
+// porcelainCode maps v2's '.' (unmodified) to v1's ' '.
+func porcelainCode(c byte) byte {
+	if c == '.' {
+		return ' '
+	}
+	return c
+}
+
+func (execBackend) AddAll(ctx context.Context, path string) error {
+	_, err := runGitCommand(ctx, path, "add", "-A")
+	return err
+}
+
+func (execBackend) Commit(ctx context.Context, path, message string) error {
+	_, err := runGitCommand(ctx, path, "commit", "-m", message)
+	return err
+}
+
+func (execBackend) Push(ctx context.Context, path string, lease bool) error {
+	args := []string{"push"}
+	if lease {
+		args = append(args, "--force-with-lease")
+	}
+	_, err := runGitCommand(ctx, path, args...)
+	return err
+}
+
+func (execBackend) Fetch(ctx context.Context, path string) error {
+	_, err := runGitCommand(ctx, path, "fetch", "--quiet", defaultRemote)
+	return err
+}
+
+func (execBackend) RefExists(ctx context.Context, path, ref string) (bool, error) {
+	_, err := runGitCommand(ctx, path, "show-ref", "--verify", "--quiet", ref)
+	if err == nil {
+		return true, nil
+	}
+	// show-ref exits 1 without output when the ref is missing.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+func (b execBackend) Checkout(ctx context.Context, path, branch, start string) error {
+	exists, err := b.RefExists(ctx, path, "refs/heads/"+branch)
+	if err != nil {
+		return err
+	}
+	if exists {
+		_, err := runGitCommand(ctx, path, "checkout", "--quiet", branch)
+		return err
+	}
+
+	if _, err := runGitCommand(ctx, path, "checkout", "--quiet", "--no-track", "-b", branch, start); err != nil {
+		return err
+	}
+	// Set the upstream by hand: origin/<branch> may not exist until the
+	// first push, and `git branch --set-upstream-to` requires it.
+	if _, err := runGitCommand(ctx, path, "config", "branch."+branch+".remote", defaultRemote); err != nil {
+		return err
+	}
+	_, err = runGitCommand(ctx, path, "config", "branch."+branch+".merge", "refs/heads/"+branch)
+	return err
+}
+
+func (execBackend) Rebase(ctx context.Context, path, onto string, autostash bool) (string, error) {
+	args := []string{"rebase"}
+	if autostash {
+		args = append(args, "--autostash")
+	}
+	return runGitCommand(ctx, path, append(args, onto)...)
+}
+
+func (execBackend) AheadBehind(ctx context.Context, path string) (string, int, int, error) {
+	upstream, err := runGitCommand(ctx, path, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil {
+		// No upstream configured, or not fetched yet.
+		return "", 0, 0, nil
+	}
+	out, err := runGitCommand(ctx, path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return "", 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", 0, 0, fmt.Errorf("git rev-list failed: unexpected output %q", out)
+	}
+	ahead, aheadErr := strconv.Atoi(fields[0])
+	behind, behindErr := strconv.Atoi(fields[1])
+	if aheadErr != nil || behindErr != nil {
+		return "", 0, 0, fmt.Errorf("git rev-list failed: unexpected output %q", out)
+	}
+	return upstream, ahead, behind, nil
+}
+
+func (execBackend) Branch(ctx context.Context, path string) (string, error) {
+	return runGitCommand(ctx, path, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+func (execBackend) Head(ctx context.Context, path string) (string, error) {
+	return runGitCommand(ctx, path, "rev-parse", "--short", "HEAD")
+}
+
+func (execBackend) TrackedFiles(ctx context.Context, path string) ([]string, error) {
+	out, err := runGitCommand(ctx, path, "ls-files")
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(out), nil
+}
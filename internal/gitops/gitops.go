@@ -1,6 +1,7 @@
 package gitops
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -29,11 +30,42 @@ var (
 	traceWriter  io.Writer = os.Stderr
 )
 
-// InspectResult contains basic repository metadata.
+// InspectResult contains basic repository metadata. Ahead and Behind count
+// commits against Upstream as of the last fetch; Upstream is empty when the
+// branch tracks nothing that has been fetched.
 type InspectResult struct {
 	Branch     string
 	LastCommit string
 	Dirty      bool
+	Upstream   string
+	Ahead      int
+	Behind     int
+	// Untracked counts files git does not track yet (they also make the
+	// repo Dirty).
+	Untracked int
+	// LastFetch is when origin was last fetched (by a fetch or pull); zero
+	// if never.
+	LastFetch time.Time
+	// Fetched reports that InspectContext fetched origin; FetchErr holds the
+	// error when that failed, in which case the counts are from the
+	// previous fetch.
+	Fetched  bool
+	FetchErr error
+	// Rebasing and Merging report a rebase or merge stopped on conflicts.
+	Rebasing bool
+	Merging  bool
+}
+
+// InspectOptions controls the optional remote work of InspectContext.
+type InspectOptions struct {
+	// Fetch updates origin first so Ahead and Behind reflect the remote.
+	Fetch bool
+	// FetchMaxAge skips the fetch when the last one is more recent; zero
+	// always fetches.
+	FetchMaxAge time.Duration
+	// FetchTimeout bounds the fetch alone; the local inspection runs on the
+	// caller's context. Zero means no limit beyond that context.
+	FetchTimeout time.Duration
 }
 
 // PushResult describes the outcome of a push operation.
@@ -44,14 +76,20 @@ type PushResult struct {
 	NothingToPush bool   `json:"nothing_to_push"`
 }
 
-func runGit(dir string, args ...string) (string, error) {
+// gitCancelGrace is how long git gets to exit after SIGINT before it is killed.
+const gitCancelGrace = 5 * time.Second
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
 	traceGit(dir, args...)
 
-	cmd := exec.Command("git", args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
 	if dir != "" {
 		cmd.Dir = dir
 	}
 	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	// Interrupt rather than kill so git can clean up its lock files.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = gitCancelGrace
 
 	out, err := cmd.CombinedOutput()
 	output := strings.TrimSpace(string(out))
@@ -63,6 +101,9 @@ func runGit(dir string, args ...string) (string, error) {
 		if len(args) > 0 {
 			op = args[0]
 		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("git %s cancelled: %w", op, ctxErr)
+		}
 		if output != "" {
 			return "", fmt.Errorf("git %s failed: %s", op, output)
 		}
@@ -201,9 +242,9 @@ func BrowserURL(repoURL string) string {
 	}
 }
 
-// GitVersion returns the installed git version string.
+// GitVersion describes the active git backend (the git version for exec).
 func GitVersion() (string, error) {
-	return runGitCommand("", "--version")
+	return CurrentBackend().Version(context.Background())
 }
 
 // IsRepo reports whether path looks like a Git repository.
@@ -221,6 +262,11 @@ func ensureRepo(path string) error {
 
 // Clone clones repoURL into path. If path already contains a git repo, it is treated as success.
 func Clone(repoURL, path string) error {
+	return CloneContext(context.Background(), repoURL, path)
+}
+
+// CloneContext is Clone with cancellation; git is interrupted when ctx is done.
+func CloneContext(ctx context.Context, repoURL, path string) error {
 	if IsRepo(path) {
 		return nil
 	}
@@ -242,7 +288,7 @@ func Clone(repoURL, path string) error {
 		return fmt.Errorf("creating clone parent dir: %w", err)
 	}
 
-	if _, err := runGitCommand("", "clone", NormalizeCloneURL(repoURL), path); err != nil {
+	if err := CurrentBackend().Clone(ctx, NormalizeCloneURL(repoURL), path); err != nil {
 		return fmt.Errorf("cloning repository: %w", err)
 	}
 
@@ -251,68 +297,170 @@ func Clone(repoURL, path string) error {
 
 // PullRebase runs git pull --rebase for path.
 func PullRebase(path string) (string, error) {
+	return PullRebaseContext(context.Background(), path)
+}
+
+// PullRebaseContext is PullRebase with cancellation; git is interrupted when ctx is done.
+func PullRebaseContext(ctx context.Context, path string) (string, error) {
 	if err := ensureRepo(path); err != nil {
 		return "", err
 	}
 
-	dirty, err := IsDirty(path)
+	autostash, err := needsAutostash(ctx, path, "pulling")
 	if err != nil {
 		return "", err
 	}
-	pullArgs := []string{"pull", "--rebase"}
+
+	out, err := CurrentBackend().PullRebase(ctx, path, autostash)
+	if err != nil {
+		wrapped := fmt.Errorf("pulling latest changes: %w", err)
+		return "", withPullHint(wrapped)
+	}
+
+	return out, nil
+}
+
+// Fetch updates the remote-tracking branches of origin.
+func Fetch(ctx context.Context, path string) error {
+	if err := ensureRepo(path); err != nil {
+		return err
+	}
+	if err := CurrentBackend().Fetch(ctx, path); err != nil {
+		return fmt.Errorf("fetching origin: %w", err)
+	}
+	return nil
+}
+
+// RemoteBranchExists reports whether origin has branch, as of the last fetch.
+func RemoteBranchExists(ctx context.Context, path, branch string) (bool, error) {
+	if err := ensureRepo(path); err != nil {
+		return false, err
+	}
+	exists, err := CurrentBackend().RefExists(ctx, path, "refs/remotes/"+defaultRemote+"/"+branch)
+	if err != nil {
+		return false, fmt.Errorf("looking up origin/%s: %w", branch, err)
+	}
+	return exists, nil
+}
+
+// CheckoutBranch switches the repository to branch. A branch missing locally
+// is created from origin/<branch>, else from origin/<base> when base is set,
+// else from HEAD; it tracks origin/<branch>, which the first push creates.
+// The remote is not fetched; call Fetch first.
+func CheckoutBranch(ctx context.Context, path, branch, base string) error {
+	current, err := Branch(path)
+	if err != nil {
+		return err
+	}
+	if current == branch {
+		return nil
+	}
+
+	dirty, err := isDirty(ctx, path)
+	if err != nil {
+		return err
+	}
 	if dirty {
-		onlyGitignore, err := isOnlyPathDirty(path, ".gitignore")
+		return fmt.Errorf("switching to branch %s: %w: commit or stash your local changes first", branch, ErrRepoDirty)
+	}
+
+	start := "HEAD"
+	candidates := []string{branch}
+	if base != "" {
+		candidates = append(candidates, base)
+	}
+	for _, c := range candidates {
+		exists, err := RemoteBranchExists(ctx, path, c)
 		if err != nil {
-			return "", err
+			return err
 		}
-		if !onlyGitignore {
-			return "", fmt.Errorf("%w: commit or stash your local changes before pulling", ErrRepoDirty)
+		if exists {
+			start = defaultRemote + "/" + c
+			break
 		}
-		pullArgs = append(pullArgs, "--autostash")
 	}
 
-	out, err := runGitCommand(path, pullArgs...)
+	if err := CurrentBackend().Checkout(ctx, path, branch, start); err != nil {
+		return fmt.Errorf("switching to branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// RebaseOnto rebases the current branch onto origin/<base>, which keeps an
+// overlay branch (host-specific commits on top of a shared branch) current.
+// The remote is not fetched; call Fetch first.
+func RebaseOnto(ctx context.Context, path, base string) (string, error) {
+	if err := ensureRepo(path); err != nil {
+		return "", err
+	}
+	autostash, err := needsAutostash(ctx, path, "rebasing")
 	if err != nil {
-		wrapped := fmt.Errorf("pulling latest changes: %w", err)
-		return "", withPullHint(wrapped)
+		return "", err
 	}
 
+	out, err := CurrentBackend().Rebase(ctx, path, defaultRemote+"/"+base, autostash)
+	if err != nil {
+		return "", withPullHint(fmt.Errorf("rebasing onto %s/%s: %w", defaultRemote, base, err))
+	}
 	return out, nil
 }
 
-func isOnlyPathDirty(path, relativePath string) (bool, error) {
-	statusAll, err := runGitCommand(path, "status", "--porcelain")
+// needsAutostash reports whether a rebase must carry uncommitted changes
+// along, which is allowed only for .gitignore (dotctl init edits it).
+func needsAutostash(ctx context.Context, path, doing string) (bool, error) {
+	dirty, err := isDirty(ctx, path)
+	if err != nil || !dirty {
+		return false, err
+	}
+	onlyGitignore, err := isOnlyPathDirty(ctx, path, ".gitignore")
 	if err != nil {
-		return false, fmt.Errorf("checking repo status: %w", err)
+		return false, err
 	}
-	statusAll = strings.TrimSpace(statusAll)
-	if statusAll == "" {
-		return false, nil
+	if !onlyGitignore {
+		return false, fmt.Errorf("%w: commit or stash your local changes before %s", ErrRepoDirty, doing)
 	}
+	return true, nil
+}
 
-	statusPath, err := runGitCommand(path, "status", "--porcelain", "--", relativePath)
+func isOnlyPathDirty(ctx context.Context, path, relativePath string) (bool, error) {
+	entries, err := Status(ctx, path)
 	if err != nil {
-		return false, fmt.Errorf("checking repo status for %s: %w", relativePath, err)
+		return false, err
 	}
-	statusPath = strings.TrimSpace(statusPath)
-	if statusPath == "" {
+	if len(entries) == 0 {
 		return false, nil
 	}
+	for _, e := range entries {
+		if e.Path != relativePath {
+			return false, nil
+		}
+	}
+	return true, nil
+}
 
-	return statusAll == statusPath, nil
+// Status lists the changed paths of the working tree.
+func Status(ctx context.Context, path string) ([]StatusEntry, error) {
+	if err := ensureRepo(path); err != nil {
+		return nil, err
+	}
+	entries, err := CurrentBackend().Status(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("checking repo status: %w", err)
+	}
+	return entries, nil
 }
 
 // IsDirty reports whether the repository has uncommitted changes.
 func IsDirty(path string) (bool, error) {
-	if err := ensureRepo(path); err != nil {
-		return false, err
-	}
+	return isDirty(context.Background(), path)
+}
 
-	out, err := runGitCommand(path, "status", "--porcelain")
+func isDirty(ctx context.Context, path string) (bool, error) {
+	entries, err := Status(ctx, path)
 	if err != nil {
-		return false, fmt.Errorf("checking repo status: %w", err)
+		return false, err
 	}
-	return strings.TrimSpace(out) != "", nil
+	return len(entries) > 0, nil
 }
 
 // TrackedFiles returns files currently tracked by git (git ls-files).
@@ -321,25 +469,13 @@ func TrackedFiles(path string) ([]string, error) {
 		return nil, err
 	}
 
-	out, err := runGitCommand(path, "ls-files")
+	files, err := CurrentBackend().TrackedFiles(context.Background(), path)
 	if err != nil {
 		return nil, fmt.Errorf("listing tracked files: %w", err)
 	}
-
-	if strings.TrimSpace(out) == "" {
-		return []string{}, nil
-	}
-
-	lines := strings.Split(out, "\n")
-	files := make([]string, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		files = append(files, line)
+	if files == nil {
+		files = []string{}
 	}
-
 	return files, nil
 }
 
@@ -348,7 +484,7 @@ func Branch(path string) (string, error) {
 	if err := ensureRepo(path); err != nil {
 		return "", err
 	}
-	out, err := runGitCommand(path, "rev-parse", "--abbrev-ref", "HEAD")
+	out, err := CurrentBackend().Branch(context.Background(), path)
 	if err != nil {
 		return "", fmt.Errorf("getting current branch: %w", err)
 	}
@@ -360,19 +496,43 @@ func LastCommit(path string) (string, error) {
 	if err := ensureRepo(path); err != nil {
 		return "", err
 	}
-	out, err := runGitCommand(path, "rev-parse", "--short", "HEAD")
+	out, err := CurrentBackend().Head(context.Background(), path)
 	if err != nil {
 		return "", fmt.Errorf("getting last commit: %w", err)
 	}
 	return strings.TrimSpace(out), nil
 }
 
-// Inspect gathers branch, commit and dirty state in one call.
+// Inspect gathers branch, commit, dirty and upstream state in one call,
+// without contacting the remote.
 func Inspect(path string) (InspectResult, error) {
+	return InspectContext(context.Background(), path, InspectOptions{})
+}
+
+// InspectContext is Inspect with an optional fetch of origin first. A failed
+// fetch (for example while offline) is reported in FetchErr rather than
+// returned, so callers still get the local state.
+func InspectContext(ctx context.Context, path string, opts InspectOptions) (InspectResult, error) {
 	if err := ensureRepo(path); err != nil {
 		return InspectResult{}, err
 	}
 
+	result := InspectResult{LastFetch: LastFetch(path)}
+	if opts.Fetch && (opts.FetchMaxAge <= 0 || time.Since(result.LastFetch) >= opts.FetchMaxAge) {
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.FetchTimeout > 0 {
+			fetchCtx, cancel = context.WithTimeout(ctx, opts.FetchTimeout)
+		}
+		err := Fetch(fetchCtx, path)
+		cancel()
+		if err != nil {
+			result.FetchErr = err
+		} else {
+			result.Fetched = true
+			result.LastFetch = LastFetch(path)
+		}
+	}
+
 	branch, err := Branch(path)
 	if err != nil {
 		return InspectResult{}, err
@@ -381,12 +541,37 @@ func Inspect(path string) (InspectResult, error) {
 	if err != nil {
 		return InspectResult{}, err
 	}
-	dirty, err := IsDirty(path)
+	entries, err := Status(ctx, path)
 	if err != nil {
 		return InspectResult{}, err
 	}
+	upstream, ahead, behind, err := CurrentBackend().AheadBehind(ctx, path)
+	if err != nil {
+		return InspectResult{}, fmt.Errorf("comparing with upstream: %w", err)
+	}
+
+	result.Branch = branch
+	result.LastCommit = commit
+	result.Dirty = len(entries) > 0
+	for _, e := range entries {
+		if e.Worktree == '?' {
+			result.Untracked++
+		}
+	}
+	result.Upstream, result.Ahead, result.Behind = upstream, ahead, behind
+	result.Rebasing = RebaseInProgress(path)
+	result.Merging = MergeInProgress(path)
+	return result, nil
+}
 
-	return InspectResult{Branch: branch, LastCommit: commit, Dirty: dirty}, nil
+// LastFetch returns when origin was last fetched into the repository, from
+// the modification time of .git/FETCH_HEAD; zero if it was never fetched.
+func LastFetch(path string) time.Time {
+	info, err := os.Stat(filepath.Join(path, ".git", "FETCH_HEAD"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
 // DefaultCommitMessage builds the default message used by dotctl push.
@@ -400,38 +585,65 @@ func DefaultCommitMessage(profile string, now time.Time) string {
 
 // Push stages, commits and pushes local changes.
 func Push(path, message, profile string, now time.Time) (PushResult, error) {
+	return PushContext(context.Background(), path, message, profile, now)
+}
+
+// PushContext is Push with cancellation; git is interrupted when ctx is done.
+func PushContext(ctx context.Context, path, message, profile string, now time.Time) (PushResult, error) {
+	return push(ctx, path, message, profile, now, false)
+}
+
+// PushOverlayContext is PushContext for an overlay branch, whose history
+// RebaseOnto rewrites: it replaces the remote branch with --force-with-lease,
+// and pushes a rebased branch even when there is nothing new to commit.
+func PushOverlayContext(ctx context.Context, path, message, profile string, now time.Time) (PushResult, error) {
+	return push(ctx, path, message, profile, now, true)
+}
+
+func push(ctx context.Context, path, message, profile string, now time.Time, overlay bool) (PushResult, error) {
 	result := PushResult{}
 
 	if err := ensureRepo(path); err != nil {
 		return result, err
 	}
 
-	if _, err := runGitCommand(path, "add", "-A"); err != nil {
+	backend := CurrentBackend()
+	if err := backend.AddAll(ctx, path); err != nil {
 		return result, fmt.Errorf("staging changes: %w", err)
 	}
 
-	dirty, err := IsDirty(path)
+	dirty, err := isDirty(ctx, path)
 	if err != nil {
 		return result, err
 	}
 	if !dirty {
-		result.NothingToPush = true
-		return result, nil
-	}
-
-	message = strings.TrimSpace(message)
-	if message == "" {
-		message = DefaultCommitMessage(profile, now)
-	}
+		if !overlay {
+			result.NothingToPush = true
+			return result, nil
+		}
+		upstream, ahead, behind, err := backend.AheadBehind(ctx, path)
+		if err != nil {
+			return result, fmt.Errorf("comparing with upstream: %w", err)
+		}
+		if upstream != "" && ahead == 0 && behind == 0 {
+			result.NothingToPush = true
+			return result, nil
+		}
+	} else {
+		message = strings.TrimSpace(message)
+		if message == "" {
+			message = DefaultCommitMessage(profile, now)
+		}
 
-	if _, err := runGitCommand(path, "commit", "-m", message); err != nil {
-		wrapped := fmt.Errorf("creating commit: %w", err)
-		return result, withCommitHint(wrapped)
+		if err := backend.Commit(ctx, path, message); err != nil {
+			wrapped := fmt.Errorf("creating commit: %w", err)
+			return result, withCommitHint(wrapped)
+		}
+		result.Committed = true
+		result.Message = message
 	}
-	result.Committed = true
-	result.Message = message
 
-	if _, err := runGitCommand(path, "push"); err != nil {
+	if err := backend.Push(ctx, path, overlay); err != nil {
 		wrapped := fmt.Errorf("pushing to origin: %w", err)
 		return result, withPushHint(wrapped)
 	}
@@ -444,7 +656,7 @@ func withPullHint(err error) error {
 	msg := strings.ToLower(err.Error())
 	switch {
 	case strings.Contains(msg, "conflict"), strings.Contains(msg, "unmerged files"), strings.Contains(msg, "could not apply"):
-		return fmt.Errorf("%w\nresolve rebase conflicts, then run: git rebase --continue (or --abort) and retry dotctl sync", err)
+		return fmt.Errorf("%w\nresolve rebase conflicts with: dotctl resolve (or git rebase --continue/--abort), then retry dotctl sync", err)
 	case strings.Contains(msg, "couldn't find remote ref"), strings.Contains(msg, "no such ref"):
 		return fmt.Errorf("%w\nremote branch/reference not found; verify origin branch configuration and repository access", err)
 	default:
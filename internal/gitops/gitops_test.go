@@ -1,6 +1,7 @@
 package gitops
 
 import (
+	"context"
 	"errors"
 	"os"
 	"os/exec"
@@ -245,6 +246,160 @@ func TestPushNothingToPush(t *testing.T) {
 	}
 }
 
+func TestCheckoutBranchOverlay(t *testing.T) {
+	requireGit(t)
+	ctx := context.Background()
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", remote, client)
+	gitCmd(t, "", "clone", remote, writer)
+	setRepoIdentity(t, client, "client", "client@example.com")
+	setRepoIdentity(t, writer, "writer", "writer@example.com")
+	base := gitCmd(t, client, "rev-parse", "--abbrev-ref", "HEAD")
+
+	// The host branch does not exist yet: it starts from the base branch.
+	if err := CheckoutBranch(ctx, client, "laptop", base); err != nil {
+		t.Fatalf("CheckoutBranch: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(client, "host.conf"), []byte("host\n"), 0o644); err != nil {
+		t.Fatalf("write host file: %v", err)
+	}
+	res, err := PushOverlayContext(ctx, client, "", "laptop", time.Now())
+	if err != nil || !res.Pushed {
+		t.Fatalf("PushOverlayContext = %+v, %v", res, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(writer, "shared.conf"), []byte("shared\n"), 0o644); err != nil {
+		t.Fatalf("write shared file: %v", err)
+	}
+	gitCmd(t, writer, "add", "shared.conf")
+	gitCmd(t, writer, "commit", "-m", "shared")
+	gitCmd(t, writer, "push")
+
+	if err := Fetch(ctx, client); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if _, err := RebaseOnto(ctx, client, base); err != nil {
+		t.Fatalf("RebaseOnto: %v", err)
+	}
+	inspect, err := Inspect(client)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if inspect.Branch != "laptop" || inspect.Upstream != "origin/laptop" || inspect.Ahead != 2 || inspect.Behind != 1 {
+		t.Fatalf("Inspect = %+v, want laptop 2 ahead/1 behind origin/laptop", inspect)
+	}
+
+	// Nothing new to commit, but the rebased branch still has to be pushed.
+	res, err = PushOverlayContext(ctx, client, "", "laptop", time.Now())
+	if err != nil || !res.Pushed || res.Committed {
+		t.Fatalf("PushOverlayContext after rebase = %+v, %v", res, err)
+	}
+	res, err = PushOverlayContext(ctx, client, "", "laptop", time.Now())
+	if err != nil || !res.NothingToPush {
+		t.Fatalf("PushOverlayContext when in sync = %+v, %v", res, err)
+	}
+	if got := gitCmd(t, remote, "show", "laptop:shared.conf"); got != "shared" {
+		t.Fatalf("remote laptop shared.conf = %q", got)
+	}
+}
+
+func TestCheckoutBranchDirty(t *testing.T) {
+	requireGit(t)
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	gitCmd(t, "", "clone", remote, client)
+	if err := os.WriteFile(filepath.Join(client, "README.md"), []byte("local\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	err := CheckoutBranch(context.Background(), client, "laptop", "")
+	if !errors.Is(err, ErrRepoDirty) {
+		t.Fatalf("CheckoutBranch error = %v, want ErrRepoDirty", err)
+	}
+}
+
+func TestInspectContextFetch(t *testing.T) {
+	requireGit(t)
+	ctx := context.Background()
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", remote, client)
+	gitCmd(t, "", "clone", remote, writer)
+	setRepoIdentity(t, writer, "writer", "writer@example.com")
+
+	for _, name := range []string{"a.conf", "b.conf"} {
+		if err := os.WriteFile(filepath.Join(writer, name), []byte(name+"\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		gitCmd(t, writer, "add", name)
+		gitCmd(t, writer, "commit", "-m", "add "+name)
+	}
+	gitCmd(t, writer, "push")
+	if err := os.WriteFile(filepath.Join(client, "new.conf"), []byte("new\n"), 0o644); err != nil {
+		t.Fatalf("write new file: %v", err)
+	}
+
+	// Without a fetch the clone does not know about the new commits.
+	res, err := Inspect(client)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if res.Behind != 0 || res.Fetched || res.Untracked != 1 || !res.Dirty {
+		t.Fatalf("Inspect = %+v, want 0 behind, 1 untracked, not fetched", res)
+	}
+
+	// A fetch that runs out of time still returns the local state.
+	res, err = InspectContext(ctx, client, InspectOptions{Fetch: true, FetchTimeout: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("InspectContext with fetch timeout: %v", err)
+	}
+	if res.FetchErr == nil || res.Fetched || res.Behind != 0 || res.Branch == "" {
+		t.Fatalf("InspectContext with fetch timeout = %+v, want local state with a fetch error", res)
+	}
+
+	res, err = InspectContext(ctx, client, InspectOptions{Fetch: true})
+	if err != nil {
+		t.Fatalf("InspectContext: %v", err)
+	}
+	if !res.Fetched || res.FetchErr != nil || res.Behind != 2 || res.Ahead != 0 || res.LastFetch.IsZero() {
+		t.Fatalf("InspectContext = %+v, want fetched and 2 behind", res)
+	}
+	if res.Rebasing || res.Merging {
+		t.Fatalf("InspectContext = %+v, want no rebase or merge in progress", res)
+	}
+
+	// A recent fetch is reused.
+	res, err = InspectContext(ctx, client, InspectOptions{Fetch: true, FetchMaxAge: time.Hour})
+	if err != nil || res.Fetched || res.Behind != 2 {
+		t.Fatalf("InspectContext with max age = %+v, %v; want no fetch", res, err)
+	}
+}
+
+func TestInspectContextFetchFailure(t *testing.T) {
+	requireGit(t)
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	gitCmd(t, "", "clone", remote, client)
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatalf("remove remote: %v", err)
+	}
+
+	res, err := InspectContext(context.Background(), client, InspectOptions{Fetch: true})
+	if err != nil {
+		t.Fatalf("InspectContext: %v", err)
+	}
+	if res.FetchErr == nil || res.Fetched || res.Branch == "" {
+		t.Fatalf("InspectContext = %+v, want local state with a fetch error", res)
+	}
+}
+
 func TestTrackedFiles(t *testing.T) {
 	requireGit(t)
 
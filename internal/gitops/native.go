@@ -0,0 +1,830 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// nativeBackend implements Backend with go-git, for machines without the git
+// binary. SSH remotes authenticate with ssh-agent or an unencrypted key in
+// ~/.ssh; HTTPS remotes with a token (DOTCTL_GIT_TOKEN, GH_TOKEN,
+// GITHUB_TOKEN or `gh auth token`). Git hooks and credential helpers are not
+// run.
+type nativeBackend struct{}
+
+const defaultRemote = "origin"
+
+func (nativeBackend) Name() string { return BackendNative }
+
+func (nativeBackend) Version(context.Context) (string, error) {
+	return "native git backend (go-git v5)", nil
+}
+
+func (nativeBackend) Clone(ctx context.Context, url, path string) error {
+	traceNative(path, "clone "+url)
+	auth, err := nativeAuth(url)
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(path)
+	if _, err := git.PlainCloneContext(ctx, path, false, &git.CloneOptions{URL: url, Auth: auth}); err != nil {
+		// Like git, do not leave a half-cloned directory behind.
+		if os.IsNotExist(statErr) {
+			_ = os.RemoveAll(path)
+		}
+		return nativeError("clone", err)
+	}
+	return nil
+}
+
+// PullRebase fetches the upstream branch and then fast-forwards, or replays
+// local commits onto upstream when both sides have new commits. Unlike git,
+// replaying refuses (and leaves the repo untouched) when a local commit and
+// upstream changed the same file, since go-git cannot merge file contents.
+func (b nativeBackend) PullRebase(ctx context.Context, path string, autostash bool) (string, error) {
+	traceNative(path, "pull --rebase")
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", nativeError("pull", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", nativeError("pull", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", errors.New("git pull failed: HEAD is detached; check out a branch first")
+	}
+	remoteName, mergeRef := upstreamOf(repo, head.Name())
+
+	if err := fetch(ctx, repo, path, remoteName); err != nil {
+		return "", err
+	}
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, mergeRef.Short()), true)
+	if err != nil {
+		return "", fmt.Errorf("git pull failed: couldn't find remote ref %s", mergeRef)
+	}
+
+	return rebaseOnto(ctx, repo, path, head, remoteRef.Hash(), autostash, "pull")
+}
+
+// Rebase replays the commits of the current branch onto a revision, with the
+// same limits as PullRebase.
+func (nativeBackend) Rebase(ctx context.Context, path, onto string, autostash bool) (string, error) {
+	traceNative(path, "rebase "+onto)
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", nativeError("rebase", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", nativeError("rebase", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", errors.New("git rebase failed: HEAD is detached; check out a branch first")
+	}
+	target, err := repo.ResolveRevision(plumbing.Revision(onto))
+	if err != nil {
+		return "", fmt.Errorf("git rebase failed: invalid upstream %s: %w", onto, err)
+	}
+	return rebaseOnto(ctx, repo, path, head, *target, autostash, "rebase")
+}
+
+// rebaseOnto moves the branch at head onto target: a fast-forward when it has
+// no commits of its own, a replay otherwise. op names the git command in
+// errors.
+func rebaseOnto(ctx context.Context, repo *git.Repository, path string, head *plumbing.Reference, target plumbing.Hash, autostash bool, op string) (string, error) {
+	local, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", nativeError(op, err)
+	}
+	upstream, err := repo.CommitObject(target)
+	if err != nil {
+		return "", nativeError(op, err)
+	}
+	if local.Hash == upstream.Hash {
+		return "Already up to date.", nil
+	}
+
+	bases, err := local.MergeBase(upstream)
+	if err != nil {
+		return "", nativeError(op, err)
+	}
+	if len(bases) == 0 {
+		return "", fmt.Errorf("git %s failed: local and upstream branches have no common history", op)
+	}
+	base := bases[0]
+	if base.Hash == upstream.Hash {
+		return fmt.Sprintf("Current branch %s is up to date.", head.Name().Short()), nil
+	}
+
+	stash, err := stashFiles(ctx, path, autostash)
+	if err != nil {
+		return "", err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", nativeError(op, err)
+	}
+
+	var message string
+	if base.Hash == local.Hash {
+		if err := wt.Reset(&git.ResetOptions{Commit: upstream.Hash, Mode: git.HardReset}); err != nil {
+			return "", nativeError(op, err)
+		}
+		message = fmt.Sprintf("Fast-forwarded %s to %s.", head.Name().Short(), upstream.Hash.String()[:7])
+	} else {
+		if message, err = replayCommits(ctx, repo, wt, path, base, local, upstream, op); err != nil {
+			return "", err
+		}
+	}
+
+	if err := stash.restore(); err != nil {
+		return message, err
+	}
+	return message, nil
+}
+
+func (nativeBackend) Status(_ context.Context, path string) ([]StatusEntry, error) {
+	wt, err := openWorktree(path)
+	if err != nil {
+		return nil, nativeError("status", err)
+	}
+	wt.Excludes = append(wt.Excludes, globalExcludes()...)
+	status, err := wt.Status()
+	if err != nil {
+		return nil, nativeError("status", err)
+	}
+
+	entries := make([]StatusEntry, 0, len(status))
+	for file, s := range status {
+		if s.Staging == git.Unmodified && s.Worktree == git.Unmodified {
+			continue
+		}
+		entries = append(entries, StatusEntry{Path: file, Staging: byte(s.Staging), Worktree: byte(s.Worktree)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// AddAll stages every change like `git add -A`, including deletions.
+func (b nativeBackend) AddAll(ctx context.Context, path string) error {
+	traceNative(path, "add -A")
+	wt, err := openWorktree(path)
+	if err != nil {
+		return nativeError("add", err)
+	}
+	entries, err := b.Status(ctx, path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Worktree == byte(git.Unmodified) {
+			continue
+		}
+		if e.Worktree == byte(git.Deleted) {
+			_, err = wt.Remove(e.Path)
+		} else {
+			_, err = wt.Add(e.Path)
+		}
+		if err != nil {
+			return nativeError("add", err)
+		}
+	}
+	return nil
+}
+
+func (nativeBackend) Commit(_ context.Context, path, message string) error {
+	traceNative(path, "commit")
+	wt, err := openWorktree(path)
+	if err != nil {
+		return nativeError("commit", err)
+	}
+	if _, err := wt.Commit(message, &git.CommitOptions{}); err != nil {
+		if errors.Is(err, git.ErrMissingAuthor) {
+			return errors.New("git commit failed: Author identity unknown (set user.name and user.email)")
+		}
+		return nativeError("commit", err)
+	}
+	return nil
+}
+
+// Push pushes the current branch to its upstream branch.
+func (nativeBackend) Push(ctx context.Context, path string, lease bool) error {
+	traceNative(path, "push")
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nativeError("push", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nativeError("push", err)
+	}
+	remoteName, mergeRef := upstreamOf(repo, head.Name())
+	auth, err := remoteAuth(repo, remoteName)
+	if err != nil {
+		return err
+	}
+
+	opts := &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(head.Name().String() + ":" + mergeRef.String())},
+		Auth:       auth,
+	}
+	// go-git checks the lease against the remote-tracking ref, which does
+	// not exist before the first push of a branch.
+	if lease {
+		if _, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, mergeRef.Short()), true); err == nil {
+			opts.ForceWithLease = &git.ForceWithLease{}
+		}
+	}
+	err = repo.PushContext(ctx, opts)
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nativeError("push", err)
+	}
+	return nil
+}
+
+func (nativeBackend) Fetch(ctx context.Context, path string) error {
+	traceNative(path, "fetch "+defaultRemote)
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nativeError("fetch", err)
+	}
+	return fetch(ctx, repo, path, defaultRemote)
+}
+
+func (nativeBackend) RefExists(_ context.Context, path, ref string) (bool, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return false, nativeError("show-ref", err)
+	}
+	if _, err := repo.Reference(plumbing.ReferenceName(ref), true); err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return false, nil
+		}
+		return false, nativeError("show-ref", err)
+	}
+	return true, nil
+}
+
+func (nativeBackend) Checkout(_ context.Context, path, branch, start string) error {
+	traceNative(path, "checkout "+branch)
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nativeError("checkout", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nativeError("checkout", err)
+	}
+
+	name := plumbing.NewBranchReferenceName(branch)
+	if _, err := repo.Reference(name, false); err == nil {
+		if err := wt.Checkout(&git.CheckoutOptions{Branch: name}); err != nil {
+			return nativeError("checkout", err)
+		}
+		return nil
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(start))
+	if err != nil {
+		return fmt.Errorf("git checkout failed: invalid start point %s: %w", start, err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Branch: name, Create: true}); err != nil {
+		return nativeError("checkout", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nativeError("checkout", err)
+	}
+	cfg.Branches[branch] = &gitconfig.Branch{Name: branch, Remote: defaultRemote, Merge: name}
+	if err := repo.SetConfig(cfg); err != nil {
+		return nativeError("checkout", err)
+	}
+	return nil
+}
+
+func (nativeBackend) AheadBehind(_ context.Context, path string) (string, int, int, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", 0, 0, nativeError("rev-list", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", 0, 0, nativeError("rev-list", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", 0, 0, nil
+	}
+	remoteName, mergeRef := upstreamOf(repo, head.Name())
+	upstream := plumbing.NewRemoteReferenceName(remoteName, mergeRef.Short())
+	remoteRef, err := repo.Reference(upstream, true)
+	if err != nil {
+		return "", 0, 0, nil
+	}
+
+	local, err := reachableCommits(repo, head.Hash())
+	if err != nil {
+		return "", 0, 0, err
+	}
+	remote, err := reachableCommits(repo, remoteRef.Hash())
+	if err != nil {
+		return "", 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for h := range local {
+		if !remote[h] {
+			ahead++
+		}
+	}
+	for h := range remote {
+		if !local[h] {
+			behind++
+		}
+	}
+	return upstream.Short(), ahead, behind, nil
+}
+
+// reachableCommits returns every commit reachable from hash. Dotfile repos
+// are small enough to walk whole.
+func reachableCommits(repo *git.Repository, hash plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	iter, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return nil, nativeError("rev-list", err)
+	}
+	defer iter.Close()
+
+	seen := map[plumbing.Hash]bool{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, nativeError("rev-list", err)
+	}
+	return seen, nil
+}
+
+func (nativeBackend) Branch(_ context.Context, path string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", nativeError("rev-parse", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", nativeError("rev-parse", err)
+	}
+	if !head.Name().IsBranch() {
+		return "HEAD", nil
+	}
+	return head.Name().Short(), nil
+}
+
+func (nativeBackend) Head(_ context.Context, path string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", nativeError("rev-parse", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", nativeError("rev-parse", err)
+	}
+	return head.Hash().String()[:7], nil
+}
+
+func (nativeBackend) TrackedFiles(_ context.Context, path string) ([]string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, nativeError("ls-files", err)
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, nativeError("ls-files", err)
+	}
+	files := make([]string, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		files = append(files, e.Name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// globalExcludes returns the ignore patterns git reads outside the work tree,
+// which go-git's Status skips: core.excludesfile from /etc/gitconfig and
+// ~/.gitconfig, or $XDG_CONFIG_HOME/git/ignore when ~/.gitconfig names none.
+func globalExcludes() []gitignore.Pattern {
+	root := osfs.New("/")
+	patterns, _ := gitignore.LoadSystemPatterns(root)
+	global, _ := gitignore.LoadGlobalPatterns(root)
+	if global == nil {
+		global = defaultGlobalExcludes()
+	}
+	return append(patterns, global...)
+}
+
+// defaultGlobalExcludes reads git's default global ignore file.
+func defaultGlobalExcludes() []gitignore.Pattern {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	data, err := os.ReadFile(filepath.Join(configHome, "git", "ignore"))
+	if err != nil {
+		return nil
+	}
+	var patterns []gitignore.Pattern
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	return patterns
+}
+
+func openWorktree(path string) (*git.Worktree, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Worktree()
+}
+
+// upstreamOf returns the remote and remote branch a local branch tracks,
+// defaulting to the same branch name on origin.
+func upstreamOf(repo *git.Repository, branch plumbing.ReferenceName) (string, plumbing.ReferenceName) {
+	remote, merge := defaultRemote, branch
+	if cfg, err := repo.Config(); err == nil {
+		if b, ok := cfg.Branches[branch.Short()]; ok {
+			if b.Remote != "" {
+				remote = b.Remote
+			}
+			if b.Merge != "" {
+				merge = b.Merge
+			}
+		}
+	}
+	return remote, merge
+}
+
+func fetch(ctx context.Context, repo *git.Repository, path, remoteName string) error {
+	auth, err := remoteAuth(repo, remoteName)
+	if err != nil {
+		return err
+	}
+	err = repo.FetchContext(ctx, &git.FetchOptions{RemoteName: remoteName, Auth: auth})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nativeError("fetch", err)
+	}
+	return writeFetchHead(repo, path, remoteName)
+}
+
+// writeFetchHead records the fetched branches in .git/FETCH_HEAD like git
+// does, which go-git skips; its mtime is the last fetch time (LastFetch).
+func writeFetchHead(repo *git.Repository, path, remoteName string) error {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nativeError("fetch", err)
+	}
+	url := ""
+	if urls := remote.Config().URLs; len(urls) > 0 {
+		url = urls[0]
+	}
+	merge := plumbing.ReferenceName("")
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		if r, m := upstreamOf(repo, head.Name()); r == remoteName {
+			merge = m
+		}
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nativeError("fetch", err)
+	}
+	var forMerge, others []string
+	prefix := "refs/remotes/" + remoteName + "/"
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		branch := strings.TrimPrefix(name, prefix)
+		if branch == "HEAD" {
+			return nil
+		}
+		if plumbing.NewBranchReferenceName(branch) == merge {
+			forMerge = append(forMerge, fmt.Sprintf("%s\t\tbranch '%s' of %s\n", ref.Hash(), branch, url))
+		} else {
+			others = append(others, fmt.Sprintf("%s\tnot-for-merge\tbranch '%s' of %s\n", ref.Hash(), branch, url))
+		}
+		return nil
+	})
+	sort.Strings(others)
+
+	content := strings.Join(append(forMerge, others...), "")
+	if err := os.WriteFile(filepath.Join(path, ".git", "FETCH_HEAD"), []byte(content), 0o644); err != nil {
+		return fmt.Errorf("git fetch failed: writing FETCH_HEAD: %w", err)
+	}
+	return nil
+}
+
+// replayCommits rebuilds the local commits since base on top of upstream,
+// keeping their authors and messages. Commits whose changes upstream already
+// has are dropped, like `git rebase` does.
+func replayCommits(ctx context.Context, repo *git.Repository, wt *git.Worktree, root string, base, local, upstream *object.Commit, op string) (string, error) {
+	var commits []*object.Commit
+	for c := local; c.Hash != base.Hash; {
+		if c.NumParents() != 1 {
+			return "", fmt.Errorf("git %s failed: local commit %s is a merge; the native git backend can only rebase linear history (use git_backend: exec)", op, c.Hash.String()[:7])
+		}
+		commits = append(commits, c)
+		parent, err := c.Parent(0)
+		if err != nil {
+			return "", nativeError(op, err)
+		}
+		c = parent
+	}
+
+	upstreamPaths, err := changedPaths(base, upstream)
+	if err != nil {
+		return "", err
+	}
+	changes := make([]object.Changes, len(commits))
+	var overlap []string
+	for i := len(commits) - 1; i >= 0; i-- {
+		parent, _ := commits[i].Parent(0)
+		ch, err := diffCommits(parent, commits[i])
+		if err != nil {
+			return "", err
+		}
+		changes[i] = ch
+		for _, c := range ch {
+			if name := changeName(c); upstreamPaths[name] {
+				overlap = append(overlap, name)
+				delete(upstreamPaths, name)
+			}
+		}
+	}
+	if len(overlap) > 0 {
+		sort.Strings(overlap)
+		return "", fmt.Errorf("git %s failed: local and upstream commits both change %s; the native git backend cannot rebase overlapping changes (use git_backend: exec, or rebase with git and resolve)", op, strings.Join(overlap, ", "))
+	}
+
+	if err := wt.Reset(&git.ResetOptions{Commit: upstream.Hash, Mode: git.HardReset}); err != nil {
+		return "", nativeError(op, err)
+	}
+
+	replayed := 0
+	for i := len(commits) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("git %s cancelled: %w", op, err)
+		}
+		c := commits[i]
+		for _, change := range changes[i] {
+			if err := applyChange(wt, root, change); err != nil {
+				return "", nativeError(op, err)
+			}
+		}
+
+		committer := c.Committer
+		committer.When = time.Now()
+		author := c.Author
+		if _, err := wt.Commit(c.Message, &git.CommitOptions{Author: &author, Committer: &committer}); err != nil {
+			if errors.Is(err, git.ErrEmptyCommit) {
+				continue
+			}
+			return "", nativeError(op, err)
+		}
+		replayed++
+	}
+	return fmt.Sprintf("Successfully rebased %d local commit(s) onto %s.", replayed, upstream.Hash.String()[:7]), nil
+}
+
+func diffCommits(from, to *object.Commit) (object.Changes, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, nativeError("pull", err)
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, nativeError("pull", err)
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, nativeError("pull", err)
+	}
+	return changes, nil
+}
+
+func changedPaths(from, to *object.Commit) (map[string]bool, error) {
+	changes, err := diffCommits(from, to)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		paths[c.From.Name], paths[c.To.Name] = true, true
+	}
+	delete(paths, "")
+	return paths, nil
+}
+
+func changeName(c *object.Change) string {
+	if c.To.Name != "" {
+		return c.To.Name
+	}
+	return c.From.Name
+}
+
+// applyChange writes one file change of a replayed commit into the worktree
+// and index.
+func applyChange(wt *git.Worktree, root string, change *object.Change) error {
+	action, err := change.Action()
+	if err != nil {
+		return err
+	}
+	if action == merkletrie.Delete {
+		_, err := wt.Remove(change.From.Name)
+		return err
+	}
+
+	_, file, err := change.Files()
+	if err != nil {
+		return err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(change.To.Name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	_ = os.Remove(target)
+	switch file.Mode {
+	case filemode.Symlink:
+		err = os.Symlink(content, target)
+	case filemode.Executable:
+		err = os.WriteFile(target, []byte(content), 0o755)
+	default:
+		err = os.WriteFile(target, []byte(content), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = wt.Add(change.To.Name)
+	return err
+}
+
+// stashedFiles keeps the content of uncommitted files across a reset, the
+// native stand-in for `git pull --autostash`.
+type stashedFiles map[string][]byte
+
+func stashFiles(ctx context.Context, path string, autostash bool) (stashedFiles, error) {
+	stash := stashedFiles{}
+	if !autostash {
+		return stash, nil
+	}
+	entries, err := nativeBackend{}.Status(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(path, filepath.FromSlash(e.Path)))
+		if err != nil {
+			return nil, fmt.Errorf("stashing %s: %w", e.Path, err)
+		}
+		stash[filepath.Join(path, filepath.FromSlash(e.Path))] = data
+	}
+	return stash, nil
+}
+
+func (s stashedFiles) restore() error {
+	for file, data := range s {
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			return fmt.Errorf("restoring stashed %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func remoteAuth(repo *git.Repository, remoteName string) (transport.AuthMethod, error) {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, nativeError("remote", err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("remote %s has no URL", remoteName)
+	}
+	return nativeAuth(urls[0])
+}
+
+// nativeAuth picks credentials for a remote URL. Local and file remotes need
+// none.
+func nativeAuth(url string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing remote URL %q: %w", url, err)
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+		if os.Getenv("SSH_AUTH_SOCK") != "" {
+			if auth, err := gitssh.NewSSHAgentAuth(user); err == nil {
+				return auth, nil
+			}
+		}
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			key := filepath.Join(home, ".ssh", name)
+			if _, err := os.Stat(key); err != nil {
+				continue
+			}
+			if auth, err := gitssh.NewPublicKeysFromFile(user, key, ""); err == nil {
+				return auth, nil
+			}
+		}
+		return nil, fmt.Errorf("no ssh-agent or unencrypted key in ~/.ssh to authenticate to %s", endpoint.Host)
+	case "http", "https":
+		if token := httpToken(); token != "" {
+			return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+		}
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+// httpToken returns a token for HTTPS remotes from the environment, falling
+// back to the GitHub CLI.
+func httpToken() string {
+	for _, env := range []string{"DOTCTL_GIT_TOKEN", "GH_TOKEN", "GITHUB_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(env)); token != "" {
+			return token
+		}
+	}
+	if _, err := lookPath("gh"); err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "gh", "auth", "token").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// nativeError formats go-git errors like runGit does, so the hint helpers
+// recognise them.
+func nativeError(op string, err error) error {
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return fmt.Errorf("git %s failed: %w", op, ErrNotGitRepo)
+	}
+	return fmt.Errorf("git %s failed: %w", op, err)
+}
+
+func traceNative(dir, op string) {
+	traceMu.RLock()
+	enabled := traceEnabled
+	w := traceWriter
+	traceMu.RUnlock()
+
+	if !enabled || w == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "[verbose] git (native, cwd=%s): %s\n", resolvedDir(dir), op)
+}
@@ -0,0 +1,278 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Sides of a conflicted file, named from the point of view of this machine.
+// During `git pull --rebase` git calls the upstream version "ours" and the
+// local commit being replayed "theirs"; these names hide that inversion.
+const (
+	SideRepo  = "repo"  // the version already pushed to the remote
+	SideLocal = "local" // the version from this machine's commit
+)
+
+// ConflictVersions holds temporary files with each version of a conflicted
+// file, for handing to a merge tool. Missing versions (file added or deleted
+// on one side) are os.DevNull.
+type ConflictVersions struct {
+	Base  string
+	Repo  string
+	Local string
+}
+
+// ErrGitBinaryRequired is returned by the conflict helpers below when the
+// native backend is selected and git is not on PATH: resolving a stopped
+// rebase or merging files always runs the git binary.
+var ErrGitBinaryRequired = errors.New("resolve requires the git binary (git_backend: exec); install git")
+
+// requireGitBinary returns ErrGitBinaryRequired when the git binary the
+// conflict helpers run is unavailable.
+func requireGitBinary() error {
+	if CurrentBackend().Name() != BackendNative {
+		return nil
+	}
+	if _, err := lookPath("git"); err != nil {
+		return ErrGitBinaryRequired
+	}
+	return nil
+}
+
+// RebaseInProgress reports whether a rebase stopped in the repository.
+func RebaseInProgress(path string) bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		if info, err := os.Stat(filepath.Join(path, ".git", dir)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeInProgress reports whether a merge stopped in the repository.
+func MergeInProgress(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".git", "MERGE_HEAD"))
+	return err == nil
+}
+
+// ConflictedFiles lists repo-relative paths with unresolved conflicts.
+func ConflictedFiles(ctx context.Context, path string) ([]string, error) {
+	if err := ensureRepo(path); err != nil {
+		return nil, err
+	}
+	if err := requireGitBinary(); err != nil {
+		return nil, err
+	}
+	out, err := runGitCommand(ctx, path, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("listing conflicted files: %w", err)
+	}
+	return splitLines(out), nil
+}
+
+// ConflictDiff returns the combined diff git shows for a conflicted file.
+func ConflictDiff(ctx context.Context, path, file string) (string, error) {
+	if err := requireGitBinary(); err != nil {
+		return "", err
+	}
+	out, err := runGitCommand(ctx, path, "diff", "--", file)
+	if err != nil {
+		return "", fmt.Errorf("diffing %s: %w", file, err)
+	}
+	return out, nil
+}
+
+// ResolveConflict keeps one side of a conflicted file and marks it resolved.
+// If that side deleted the file, the file is removed.
+func ResolveConflict(ctx context.Context, path, file, side string) error {
+	if err := requireGitBinary(); err != nil {
+		return err
+	}
+	flag, stage, err := checkoutFlag(path, side)
+	if err != nil {
+		return err
+	}
+
+	stages, err := conflictStageNumbers(ctx, path, file)
+	if err != nil {
+		return err
+	}
+	if !stages[stage] {
+		// The chosen side has no version of the file: it was deleted there.
+		if _, err := runGitCommand(ctx, path, "rm", "--quiet", "--", file); err != nil {
+			return fmt.Errorf("taking %s version of %s (deleted): %w", side, file, err)
+		}
+		return nil
+	}
+	if _, err := runGitCommand(ctx, path, "checkout", flag, "--", file); err != nil {
+		return fmt.Errorf("taking %s version of %s: %w", side, file, err)
+	}
+	return MarkResolved(ctx, path, file)
+}
+
+// checkoutFlag maps a side to git's --ours/--theirs, which swap meaning
+// between a rebase and a merge, and to the index stage holding that version.
+func checkoutFlag(path, side string) (string, string, error) {
+	rebase := RebaseInProgress(path)
+	switch {
+	case side == SideRepo && rebase, side == SideLocal && !rebase:
+		return "--ours", "2", nil
+	case side == SideLocal && rebase, side == SideRepo && !rebase:
+		return "--theirs", "3", nil
+	default:
+		return "", "", fmt.Errorf("unknown conflict side %q (want %s or %s)", side, SideRepo, SideLocal)
+	}
+}
+
+// conflictStageNumbers returns the index stages ("1" base, "2" ours, "3"
+// theirs) present for a conflicted file.
+func conflictStageNumbers(ctx context.Context, path, file string) (map[string]bool, error) {
+	out, err := runGitCommand(ctx, path, "ls-files", "-u", "--", file)
+	if err != nil {
+		return nil, fmt.Errorf("listing versions of %s: %w", file, err)
+	}
+	// Output: "<mode> <object> <stage>\t<file>" per stage.
+	stages := make(map[string]bool)
+	for _, line := range splitLines(out) {
+		info, _, _ := strings.Cut(line, "\t")
+		if fields := strings.Fields(info); len(fields) == 3 {
+			stages[fields[2]] = true
+		}
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("%s has no unresolved conflict", file)
+	}
+	return stages, nil
+}
+
+// ConflictStages writes the base, repo and local versions of a conflicted
+// file to temporary files next to it. The returned cleanup removes them.
+func ConflictStages(ctx context.Context, path, file string) (ConflictVersions, func(), error) {
+	if err := requireGitBinary(); err != nil {
+		return ConflictVersions{}, func() {}, err
+	}
+	out, err := runGitCommand(ctx, path, "checkout-index", "--temp", "--stage=all", "--", file)
+	if err != nil {
+		return ConflictVersions{}, func() {}, fmt.Errorf("extracting versions of %s: %w", file, err)
+	}
+
+	// Output: "<stage1> <stage2> <stage3>\t<file>", "." for a missing stage.
+	names, _, _ := strings.Cut(out, "\t")
+	stages := strings.Fields(names)
+	if len(stages) != 3 {
+		return ConflictVersions{}, func() {}, fmt.Errorf("extracting versions of %s: unexpected output %q", file, out)
+	}
+
+	var temps []string
+	resolve := func(name string) string {
+		if name == "." {
+			return os.DevNull
+		}
+		p := filepath.Join(path, name)
+		temps = append(temps, p)
+		return p
+	}
+	versions := ConflictVersions{Base: resolve(stages[0])}
+	ours, theirs := resolve(stages[1]), resolve(stages[2])
+	if RebaseInProgress(path) {
+		versions.Repo, versions.Local = ours, theirs
+	} else {
+		versions.Repo, versions.Local = theirs, ours
+	}
+
+	cleanup := func() {
+		for _, p := range temps {
+			_ = os.Remove(p)
+		}
+	}
+	return versions, cleanup, nil
+}
+
+// MarkResolved stages a file whose conflict was resolved by hand.
+func MarkResolved(ctx context.Context, path, file string) error {
+	if err := requireGitBinary(); err != nil {
+		return err
+	}
+	if _, err := runGitCommand(ctx, path, "add", "--", file); err != nil {
+		return fmt.Errorf("marking %s resolved: %w", file, err)
+	}
+	return nil
+}
+
+// ContinueRebase continues a stopped rebase without opening an editor. A
+// commit whose changes were entirely dropped by the resolution is skipped,
+// as git refuses to continue with an empty commit.
+func ContinueRebase(ctx context.Context, path string) (string, error) {
+	if err := ensureRepo(path); err != nil {
+		return "", err
+	}
+	if err := requireGitBinary(); err != nil {
+		return "", err
+	}
+
+	staged, err := runGitCommand(ctx, path, "diff", "--cached", "--name-only")
+	if err != nil {
+		return "", fmt.Errorf("checking staged changes: %w", err)
+	}
+	args := []string{"-c", "core.editor=true", "rebase", "--continue"}
+	if strings.TrimSpace(staged) == "" {
+		args = []string{"rebase", "--skip"}
+	}
+
+	out, err := runGitCommand(ctx, path, args...)
+	if err != nil {
+		return "", withPullHint(fmt.Errorf("continuing rebase: %w", err))
+	}
+	return out, nil
+}
+
+// AbortRebase abandons a stopped rebase, restoring the pre-pull state.
+func AbortRebase(ctx context.Context, path string) error {
+	if err := ensureRepo(path); err != nil {
+		return err
+	}
+	if err := requireGitBinary(); err != nil {
+		return err
+	}
+	if _, err := runGitCommand(ctx, path, "rebase", "--abort"); err != nil {
+		return fmt.Errorf("aborting rebase: %w", err)
+	}
+	return nil
+}
+
+// MergeFile merges the changes from base to other into current in place,
+// leaving conflict markers labelled with labels (current, base, other) where
+// both sides changed the same lines. It reports whether conflicts remain.
+func MergeFile(ctx context.Context, current, base, other string, labels [3]string) (bool, error) {
+	if err := requireGitBinary(); err != nil {
+		return false, err
+	}
+	_, err := runGitCommand(ctx, "", "merge-file",
+		"-L", labels[0], "-L", labels[1], "-L", labels[2],
+		current, base, other)
+	if err == nil {
+		return false, nil
+	}
+
+	// merge-file exits with the number of conflicts (capped at 127).
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return true, nil
+	}
+	return false, fmt.Errorf("merging %s: %w", current, err)
+}
+
+func splitLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
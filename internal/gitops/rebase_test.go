@@ -0,0 +1,236 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupRebaseConflict returns a clone stopped in `git pull --rebase` on a
+// README.md conflict: the remote has "repo" and the local commit "local".
+func setupRebaseConflict(t *testing.T) string {
+	t.Helper()
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", remote, client)
+	gitCmd(t, "", "clone", remote, writer)
+	setRepoIdentity(t, client, "client", "client@example.com")
+	setRepoIdentity(t, writer, "writer", "writer@example.com")
+
+	commitFile(t, writer, "README.md", "repo\n")
+	gitCmd(t, writer, "push", "origin", "HEAD")
+	commitFile(t, client, "README.md", "local\n")
+
+	_, err := PullRebase(client)
+	if err == nil {
+		t.Fatal("expected pull conflict")
+	}
+	if !strings.Contains(err.Error(), "dotctl resolve") {
+		t.Fatalf("pull error should suggest dotctl resolve, got: %v", err)
+	}
+	return client
+}
+
+func commitFile(t *testing.T, repo, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	gitCmd(t, repo, "add", name)
+	gitCmd(t, repo, "commit", "-m", "update "+name)
+}
+
+func TestInspectReportsRebaseInProgress(t *testing.T) {
+	requireGit(t)
+	client := setupRebaseConflict(t)
+
+	res, err := Inspect(client)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if !res.Rebasing || res.Merging {
+		t.Fatalf("Inspect = %+v, want a rebase in progress", res)
+	}
+}
+
+func TestResolveConflictAndContinue(t *testing.T) {
+	requireGit(t)
+
+	for _, tc := range []struct {
+		side string
+		want string
+	}{
+		{SideLocal, "local"},
+		{SideRepo, "repo"},
+	} {
+		t.Run(tc.side, func(t *testing.T) {
+			ctx := context.Background()
+			client := setupRebaseConflict(t)
+
+			if !RebaseInProgress(client) {
+				t.Fatal("expected rebase in progress")
+			}
+			files, err := ConflictedFiles(ctx, client)
+			if err != nil {
+				t.Fatalf("ConflictedFiles: %v", err)
+			}
+			if len(files) != 1 || files[0] != "README.md" {
+				t.Fatalf("conflicted files = %v, want [README.md]", files)
+			}
+
+			if err := ResolveConflict(ctx, client, "README.md", tc.side); err != nil {
+				t.Fatalf("ResolveConflict: %v", err)
+			}
+			// A file without a conflict is left alone rather than removed.
+			if err := ResolveConflict(ctx, client, "README.md", tc.side); err == nil {
+				t.Fatal("ResolveConflict on a resolved file: expected error")
+			}
+			if _, err := os.Stat(filepath.Join(client, "README.md")); err != nil {
+				t.Fatalf("README.md after second ResolveConflict: %v", err)
+			}
+			if _, err := ContinueRebase(ctx, client); err != nil {
+				t.Fatalf("ContinueRebase: %v", err)
+			}
+			if RebaseInProgress(client) {
+				t.Fatal("rebase should be finished")
+			}
+
+			data, err := os.ReadFile(filepath.Join(client, "README.md"))
+			if err != nil {
+				t.Fatalf("read README.md: %v", err)
+			}
+			if strings.TrimSpace(string(data)) != tc.want {
+				t.Fatalf("README.md = %q, want %q", data, tc.want)
+			}
+		})
+	}
+}
+
+func TestConflictStagesAndAbort(t *testing.T) {
+	requireGit(t)
+	ctx := context.Background()
+	client := setupRebaseConflict(t)
+
+	versions, cleanup, err := ConflictStages(ctx, client, "README.md")
+	if err != nil {
+		t.Fatalf("ConflictStages: %v", err)
+	}
+	for path, want := range map[string]string{versions.Base: "seed", versions.Repo: "repo", versions.Local: "local"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if strings.TrimSpace(string(data)) != want {
+			t.Fatalf("%s = %q, want %q", path, data, want)
+		}
+	}
+	cleanup()
+	if _, err := os.Stat(versions.Local); !os.IsNotExist(err) {
+		t.Fatalf("cleanup should remove %s", versions.Local)
+	}
+
+	if err := AbortRebase(ctx, client); err != nil {
+		t.Fatalf("AbortRebase: %v", err)
+	}
+	if RebaseInProgress(client) {
+		t.Fatal("rebase should be aborted")
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return p
+	}
+	labels := [3]string{"local", "base", "repo"}
+
+	base := write("base", "a\nb\nc\n")
+	current := write("current", "A\nb\nc\n")
+	other := write("other", "a\nb\nC\n")
+	conflicts, err := MergeFile(context.Background(), current, base, other, labels)
+	if err != nil || conflicts {
+		t.Fatalf("MergeFile clean = %v, %v", conflicts, err)
+	}
+	if data, _ := os.ReadFile(current); string(data) != "A\nb\nC\n" {
+		t.Fatalf("merged = %q", data)
+	}
+
+	current = write("current", "x\nb\nc\n")
+	other = write("other", "y\nb\nc\n")
+	conflicts, err = MergeFile(context.Background(), current, base, other, labels)
+	if err != nil || !conflicts {
+		t.Fatalf("MergeFile conflicting = %v, %v", conflicts, err)
+	}
+	if data, _ := os.ReadFile(current); !strings.Contains(string(data), "<<<<<<< local") {
+		t.Fatalf("merged should hold conflict markers, got %q", data)
+	}
+}
+
+func TestResolveConflictDeletedSide(t *testing.T) {
+	requireGit(t)
+	ctx := context.Background()
+
+	remote := setupRemoteRepo(t)
+	client := filepath.Join(t.TempDir(), "client")
+	writer := filepath.Join(t.TempDir(), "writer")
+	gitCmd(t, "", "clone", remote, client)
+	gitCmd(t, "", "clone", remote, writer)
+	setRepoIdentity(t, client, "client", "client@example.com")
+	setRepoIdentity(t, writer, "writer", "writer@example.com")
+
+	// The repo deletes README.md while this machine edits it.
+	gitCmd(t, writer, "rm", "--quiet", "README.md")
+	gitCmd(t, writer, "commit", "-m", "remove README.md")
+	gitCmd(t, writer, "push", "origin", "HEAD")
+	commitFile(t, client, "README.md", "local\n")
+	if _, err := PullRebase(client); err == nil {
+		t.Fatal("expected pull conflict")
+	}
+
+	if err := ResolveConflict(ctx, client, "README.md", SideRepo); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(client, "README.md")); !os.IsNotExist(err) {
+		t.Fatalf("README.md should be deleted, stat err = %v", err)
+	}
+	if files, err := ConflictedFiles(ctx, client); err != nil || len(files) != 0 {
+		t.Fatalf("ConflictedFiles = %v, %v; want none", files, err)
+	}
+}
+
+func TestConflictHelpersRequireGitBinary(t *testing.T) {
+	origLookPath := lookPath
+	backendMu.RLock()
+	origBackend, origName := activeBackend, backendName
+	backendMu.RUnlock()
+	t.Cleanup(func() {
+		lookPath = origLookPath
+		backendMu.Lock()
+		activeBackend, backendName = origBackend, origName
+		backendMu.Unlock()
+	})
+
+	lookPath = func(string) (string, error) { return "", exec.ErrNotFound }
+	if err := SetBackend(BackendNative); err != nil {
+		t.Fatalf("SetBackend: %v", err)
+	}
+
+	dir := t.TempDir()
+	if _, err := MergeFile(context.Background(), filepath.Join(dir, "a"), os.DevNull, os.DevNull, [3]string{"a", "b", "c"}); !errors.Is(err, ErrGitBinaryRequired) {
+		t.Fatalf("MergeFile error = %v, want ErrGitBinaryRequired", err)
+	}
+	if err := ResolveConflict(context.Background(), dir, "a", SideRepo); !errors.Is(err, ErrGitBinaryRequired) {
+		t.Fatalf("ResolveConflict error = %v, want ErrGitBinaryRequired", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package hookledger records which run-once and on-change hooks have
+// completed, and the content hash they ran against, so later syncs and
+// bootstraps can skip them until something they depend on changes.
+package hookledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/platform"
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Path returns the ledger file for a repository and profile. The repository
+// path is hashed into the name so two clones with the same name do not share
+// a ledger.
+func Path(repoName, repoPath, profile string) string {
+	name := unsafeNameChars.ReplaceAllString(repoName, "_")
+	if name == "" {
+		name = "repo"
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(repoPath)))
+	file := fmt.Sprintf("%s-%s-%s.json", name, unsafeNameChars.ReplaceAllString(profile, "_"), hex.EncodeToString(sum[:4]))
+	return filepath.Join(platform.StateDir(), "hooks", file)
+}
+
+// Entry records the last successful run of a hook.
+type Entry struct {
+	Phase       string    `json:"phase"`
+	Command     string    `json:"command"`
+	Description string    `json:"description,omitempty"`
+	Hash        string    `json:"hash"`
+	RanAt       time.Time `json:"ran_at"`
+}
+
+// Ledger is the set of recorded hook runs, keyed by Key.
+type Ledger struct {
+	path    string
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Load reads a ledger. A missing file yields an empty ledger.
+func Load(path string) (*Ledger, error) {
+	l := &Ledger{path: path, Entries: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, fmt.Errorf("reading hook ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("parsing hook ledger %s: %w", path, err)
+	}
+	if l.Entries == nil {
+		l.Entries = make(map[string]Entry)
+	}
+	return l, nil
+}
+
+// Key identifies a hook within a phase.
+func Key(phase string, hook manifest.Hook) string {
+	return phase + ":" + hook.Command
+}
+
+// ShouldRun reports whether a hook with the given fingerprint needs to run,
+// and why it is skipped when it does not.
+func (l *Ledger) ShouldRun(phase string, hook manifest.Hook, hash string) (bool, string) {
+	entry, ok := l.Entries[Key(phase, hook)]
+	switch hook.RunPolicy() {
+	case manifest.RunOnce:
+		if ok {
+			return false, "already ran " + entry.RanAt.Local().Format(time.RFC3339)
+		}
+	case manifest.RunOnChange:
+		if ok && entry.Hash == hash {
+			return false, "unchanged since " + entry.RanAt.Local().Format(time.RFC3339)
+		}
+	}
+	return true, ""
+}
+
+// Record stores a successful run and saves the ledger.
+func (l *Ledger) Record(phase string, hook manifest.Hook, hash string) error {
+	l.Entries[Key(phase, hook)] = Entry{
+		Phase:       phase,
+		Command:     hook.Command,
+		Description: hook.Description,
+		Hash:        hash,
+		RanAt:       time.Now().UTC(),
+	}
+	return l.Save()
+}
+
+// Reset forgets every recorded hook whose command or description equals
+// name, and returns the number of entries removed. Call Save to persist.
+func (l *Ledger) Reset(name string) int {
+	removed := 0
+	for key, entry := range l.Entries {
+		if entry.Command == name || (entry.Description != "" && entry.Description == name) {
+			delete(l.Entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Save writes the ledger atomically.
+func (l *Ledger) Save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding hook ledger: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("creating hook ledger directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".hook-ledger-*")
+	if err != nil {
+		return fmt.Errorf("writing hook ledger: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing hook ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing hook ledger: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing hook ledger: %w", err)
+	}
+	return nil
+}
+
+// Fingerprint hashes what a hook depends on: its command, shell and env,
+// every command argument that is a file under workDir or repoRoot (so
+// "bash scripts/setup.sh" tracks the script, not bash), and every watched
+// path (globs are expanded and directories walked) under repoRoot.
+func Fingerprint(hook manifest.Hook, repoRoot, workDir string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "command\x00%s\x00shell\x00%s\x00", hook.Command, hook.Shell)
+
+	names := make([]string, 0, len(hook.Env))
+	for name := range hook.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "env\x00%s=%s\x00", name, hook.Env[name])
+	}
+
+	for _, field := range strings.Fields(hook.Command) {
+		script := strings.Trim(field, `"'`)
+		if script == "" {
+			continue
+		}
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(workDir, script)
+		}
+		if !within(script, workDir) && !within(script, repoRoot) {
+			continue
+		}
+		if info, err := os.Stat(script); err == nil && info.Mode().IsRegular() {
+			if err := hashFile(h, "script", script); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, pattern := range hook.Watch {
+		matches, err := filepath.Glob(filepath.Join(repoRoot, filepath.FromSlash(pattern)))
+		if err != nil {
+			return "", fmt.Errorf("watch %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(h, "missing\x00%s\x00", pattern)
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, walkErr error) error {
+				if walkErr != nil {
+					return walkErr
+				}
+				if d.IsDir() {
+					if d.Name() == ".git" {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				rel, _ := filepath.Rel(repoRoot, path)
+				return hashFile(h, filepath.ToSlash(rel), path)
+			})
+			if err != nil {
+				return "", fmt.Errorf("hashing watched path %s: %w", match, err)
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func hashFile(w io.Writer, label, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(w, "file\x00%s\x00", label)
+	_, err = io.Copy(w, f)
+	return err
+}
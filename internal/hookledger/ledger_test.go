@@ -0,0 +1,145 @@
+package hookledger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+func TestPathIsPerRepoAndProfile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	a := Path("my dots", "/home/u/dots", "work")
+	if !strings.HasPrefix(filepath.Base(a), "my_dots-work-") {
+		t.Fatalf("Path = %q, want sanitized name and profile", a)
+	}
+	if b := Path("my dots", "/home/u/other", "work"); b == a {
+		t.Fatal("different repo paths should not share a ledger")
+	}
+	if c := Path("my dots", "/home/u/dots", "home"); c == a {
+		t.Fatal("different profiles should not share a ledger")
+	}
+}
+
+func TestLedgerOnceAndReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	hook := manifest.Hook{Command: "./install.sh", Description: "install tools", Run: manifest.RunOnce}
+
+	l, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if run, _ := l.ShouldRun("bootstrap", hook, "h1"); !run {
+		t.Fatal("first run should run")
+	}
+	if err := l.Record("bootstrap", hook, "h1"); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if run, reason := reloaded.ShouldRun("bootstrap", hook, "h2"); run || !strings.HasPrefix(reason, "already ran") {
+		t.Fatalf("ShouldRun = %v (%q), want skipped once hook", run, reason)
+	}
+	if run, _ := reloaded.ShouldRun("post_sync", hook, "h1"); !run {
+		t.Fatal("ledger entries are per phase")
+	}
+
+	if n := reloaded.Reset("install tools"); n != 1 {
+		t.Fatalf("Reset by description removed %d, want 1", n)
+	}
+	if run, _ := reloaded.ShouldRun("bootstrap", hook, "h1"); !run {
+		t.Fatal("reset hook should run again")
+	}
+}
+
+func TestLedgerOnChange(t *testing.T) {
+	l, err := Load(filepath.Join(t.TempDir(), "ledger.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	hook := manifest.Hook{Command: "brew bundle", Run: manifest.RunOnChange}
+	if err := l.Record("bootstrap", hook, "h1"); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if run, reason := l.ShouldRun("bootstrap", hook, "h1"); run || !strings.HasPrefix(reason, "unchanged since") {
+		t.Fatalf("ShouldRun = %v (%q), want skipped", run, reason)
+	}
+	if run, _ := l.ShouldRun("bootstrap", hook, "h2"); !run {
+		t.Fatal("changed hash should run")
+	}
+}
+
+func TestFingerprintTracksScriptAndWatchedFiles(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "scripts", "defaults.sh"), "defaults write a b\n")
+	writeFile(t, filepath.Join(repo, "Brewfile"), "brew \"git\"\n")
+	writeFile(t, filepath.Join(repo, "brew", "extra.rb"), "cask \"x\"\n")
+
+	hook := manifest.Hook{
+		Command: "./scripts/defaults.sh --apply",
+		Run:     manifest.RunOnChange,
+		Watch:   manifest.StringOrSlice{"Brewfile", "brew/*"},
+	}
+	fingerprint := func() string {
+		t.Helper()
+		h, err := Fingerprint(hook, repo, repo)
+		if err != nil {
+			t.Fatalf("Fingerprint: %v", err)
+		}
+		return h
+	}
+
+	base := fingerprint()
+	if again := fingerprint(); again != base {
+		t.Fatal("fingerprint is not stable")
+	}
+
+	writeFile(t, filepath.Join(repo, "scripts", "defaults.sh"), "defaults write a c\n")
+	afterScript := fingerprint()
+	if afterScript == base {
+		t.Fatal("script change should change the fingerprint")
+	}
+
+	writeFile(t, filepath.Join(repo, "brew", "extra.rb"), "cask \"y\"\n")
+	if fingerprint() == afterScript {
+		t.Fatal("watched file change should change the fingerprint")
+	}
+}
+
+func TestFingerprintTracksInterpretedScript(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "scripts", "setup.sh"), "echo one\n")
+
+	for _, command := range []string{"bash scripts/setup.sh", "sh -c ./scripts/setup.sh"} {
+		hook := manifest.Hook{Command: command, Run: manifest.RunOnChange}
+		before, err := Fingerprint(hook, repo, repo)
+		if err != nil {
+			t.Fatalf("Fingerprint: %v", err)
+		}
+		writeFile(t, filepath.Join(repo, "scripts", "setup.sh"), "echo "+command+"\n")
+		after, err := Fingerprint(hook, repo, repo)
+		if err != nil {
+			t.Fatalf("Fingerprint: %v", err)
+		}
+		if after == before {
+			t.Errorf("%q: script change should change the fingerprint", command)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Package journal persists a write-ahead record of an in-progress sync so an
+// interrupted run (killed process, sleeping laptop) can be rolled back or
+// resumed by the next dotctl invocation.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/felipe-veas/dotctl/internal/backup"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/platform"
+)
+
+// ErrNoJournal indicates there is no unfinished sync to recover.
+var ErrNoJournal = errors.New("no unfinished sync journal")
+
+// Entry statuses besides the linker result statuses.
+const (
+	StatusPlanned = "planned" // not started
+	StatusPending = "pending" // started, outcome unknown
+)
+
+// Sync phases recorded in the journal.
+const (
+	PhaseApply    = "apply"
+	PhasePostSync = "post_sync"
+	PhasePush     = "push"
+)
+
+// Path returns the journal location under the state directory.
+func Path() string {
+	return filepath.Join(platform.StateDir(), "sync-journal.json")
+}
+
+// State is the on-disk journal content.
+type State struct {
+	StartedAt time.Time `json:"started_at"`
+	PID       int       `json:"pid"`
+	Repo      string    `json:"repo,omitempty"`
+	RepoPath  string    `json:"repo_path"`
+	Profile   string    `json:"profile,omitempty"`
+	Snapshot  string    `json:"snapshot,omitempty"` // backup snapshot holding pre-sync copies
+	Phase     string    `json:"phase"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Entry tracks one manifest action.
+type Entry struct {
+	Action     manifest.Action `json:"action"`
+	Status     string          `json:"status"` // planned, pending, or a linker.Result status
+	BackupPath string          `json:"backup_path,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Journal is an open sync journal. It implements linker.Recorder.
+type Journal struct {
+	mu    sync.Mutex
+	path  string
+	State State
+}
+
+// Start writes a new journal listing every planned action.
+func Start(path string, state State, actions []manifest.Action) (*Journal, error) {
+	state.Entries = make([]Entry, len(actions))
+	for i, action := range actions {
+		state.Entries[i] = Entry{Action: action, Status: StatusPlanned}
+	}
+	if state.StartedAt.IsZero() {
+		state.StartedAt = time.Now().UTC()
+	}
+	if state.PID == 0 {
+		state.PID = os.Getpid()
+	}
+	if state.Phase == "" {
+		state.Phase = PhaseApply
+	}
+
+	j := &Journal{path: path, State: state}
+	if err := j.write(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Load reads an existing journal. It returns ErrNoJournal if none exists.
+func Load(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoJournal
+		}
+		return nil, fmt.Errorf("reading sync journal: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing sync journal %s: %w", path, err)
+	}
+	return &Journal{path: path, State: state}, nil
+}
+
+// Path returns the file backing the journal.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Begin marks an action as started before it touches the filesystem.
+func (j *Journal) Begin(index int, action manifest.Action) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if index < 0 || index >= len(j.State.Entries) {
+		return fmt.Errorf("journal entry %d out of range", index)
+	}
+	j.State.Entries[index].Status = StatusPending
+	return j.writeLocked()
+}
+
+// Done records the outcome of an action.
+func (j *Journal) Done(index int, result linker.Result) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if index < 0 || index >= len(j.State.Entries) {
+		return fmt.Errorf("journal entry %d out of range", index)
+	}
+	entry := &j.State.Entries[index]
+	entry.Status = result.Status
+	entry.BackupPath = result.BackupPath
+	entry.Error = ""
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	return j.writeLocked()
+}
+
+// SetPhase records that the sync moved on to a later phase.
+func (j *Journal) SetPhase(phase string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.State.Phase = phase
+	return j.writeLocked()
+}
+
+// Finish removes the journal after the sync completed or was fully rolled back.
+func (j *Journal) Finish() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing sync journal: %w", err)
+	}
+	return nil
+}
+
+// Unfinished returns the actions that were never applied successfully, plus a
+// recorder that maps progress on that subset back onto the journal entries.
+func (j *Journal) Unfinished() ([]manifest.Action, linker.Recorder) {
+	var (
+		actions []manifest.Action
+		indexes []int
+	)
+	for i, e := range j.State.Entries {
+		switch e.Status {
+		case StatusPlanned, StatusPending, "error":
+			actions = append(actions, e.Action)
+			indexes = append(indexes, i)
+		}
+	}
+	return actions, subsetRecorder{journal: j, indexes: indexes}
+}
+
+type subsetRecorder struct {
+	journal *Journal
+	indexes []int
+}
+
+func (r subsetRecorder) Begin(index int, action manifest.Action) error {
+	return r.journal.Begin(r.indexes[index], action)
+}
+
+func (r subsetRecorder) Done(index int, result linker.Result) error {
+	return r.journal.Done(r.indexes[index], result)
+}
+
+// RollbackResults converts journal entries into linker results suitable for
+// linker.Rollback. Pending entries (interrupted mid-apply) are resolved against
+// the backup snapshot: if a pre-sync copy exists the target is restored from
+// it; if the target is a symlink already pointing at the source it is removed;
+// otherwise the entry is left alone because its state cannot be known.
+func (j *Journal) RollbackResults() []linker.Result {
+	snapshotCopies := j.snapshotCopies()
+
+	results := make([]linker.Result, 0, len(j.State.Entries))
+	for _, e := range j.State.Entries {
+		r := linker.Result{Action: e.Action, Status: e.Status, BackupPath: e.BackupPath}
+		if e.Status == StatusPending {
+			switch {
+			case snapshotCopies[e.Action.Target] != "":
+				r.Status = "backed_up"
+				r.BackupPath = snapshotCopies[e.Action.Target]
+			case isLinkedTo(e.Action.Target, filepath.Join(j.State.RepoPath, e.Action.Source)):
+				r.Status = "created"
+			default:
+				r.Status = "skipped"
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (j *Journal) snapshotCopies() map[string]string {
+	copies := make(map[string]string)
+	if j.State.Snapshot == "" {
+		return copies
+	}
+	snap, err := backup.Show(j.State.Snapshot)
+	if err != nil {
+		return copies
+	}
+	for _, e := range snap.Entries {
+		if e.Copy == 0 {
+			copies[e.Target] = e.BackupPath
+		}
+	}
+	return copies
+}
+
+func isLinkedTo(target, source string) bool {
+	dest, err := os.Readlink(target)
+	return err == nil && dest == source
+}
+
+func (j *Journal) write() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.writeLocked()
+}
+
+// writeLocked persists the journal atomically (temp file, fsync, rename).
+func (j *Journal) writeLocked() error {
+	data, err := json.MarshalIndent(j.State, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding sync journal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("creating journal directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".sync-journal-*")
+	if err != nil {
+		return fmt.Errorf("writing sync journal: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing sync journal: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("syncing sync journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing sync journal: %w", err)
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing sync journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/backup"
+	"github.com/felipe-veas/dotctl/internal/linker"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+func setupSync(t *testing.T) (repo, home string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+
+	repo = filepath.Join(dir, "repo")
+	home = filepath.Join(dir, "home")
+	for _, p := range []string{repo, home} {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	for _, name := range []string{"zshrc", "gitconfig", "tmux.conf"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("repo "+name), 0o644); err != nil {
+			t.Fatalf("write source: %v", err)
+		}
+	}
+	return repo, home
+}
+
+func TestLoadWithoutJournal(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "sync-journal.json"))
+	if !errors.Is(err, ErrNoJournal) {
+		t.Fatalf("err = %v, want ErrNoJournal", err)
+	}
+}
+
+func TestInterruptedSyncRollback(t *testing.T) {
+	repo, home := setupSync(t)
+
+	// ~/.zshrc existed before the sync, ~/.gitconfig did not.
+	zshrc := filepath.Join(home, ".zshrc")
+	if err := os.WriteFile(zshrc, []byte("local zshrc"), 0o644); err != nil {
+		t.Fatalf("write zshrc: %v", err)
+	}
+	actions := []manifest.Action{
+		{Source: "zshrc", Target: zshrc, Mode: "symlink", Backup: true},
+		{Source: "gitconfig", Target: filepath.Join(home, ".gitconfig"), Mode: "copy", Backup: true},
+		{Source: "tmux.conf", Target: filepath.Join(home, ".tmux.conf"), Mode: "symlink", Backup: true},
+	}
+
+	endSession := backup.BeginSession(backup.Metadata{Reason: "sync"})
+	path := Path()
+	j, err := Start(path, State{RepoPath: repo, Snapshot: backup.SessionName()}, actions)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Apply the first two actions, then "crash" after recording Begin for the third.
+	results := linker.ApplyRecorded(context.Background(), actions[:2], repo, false, j)
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("apply %s: %v", r.Action.Target, r.Error)
+		}
+	}
+	if err := j.Begin(2, actions[2]); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	endSession()
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.State.Entries[0].Status != "backed_up" || loaded.State.Entries[1].Status != "copied" || loaded.State.Entries[2].Status != StatusPending {
+		t.Fatalf("entries = %+v", loaded.State.Entries)
+	}
+
+	unfinished, _ := loaded.Unfinished()
+	if len(unfinished) != 1 || unfinished[0].Source != "tmux.conf" {
+		t.Fatalf("unfinished = %+v, want tmux.conf", unfinished)
+	}
+
+	rollback := linker.Rollback(loaded.RollbackResults())
+	if summary := linker.SummarizeRollback(rollback); summary.Errors != 0 || summary.Restored != 1 || summary.Removed != 1 {
+		t.Fatalf("rollback summary = %+v (%+v)", summary, rollback)
+	}
+
+	data, err := os.ReadFile(zshrc)
+	if err != nil || string(data) != "local zshrc" {
+		t.Fatalf("zshrc = %q, %v; want restored local content", string(data), err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".gitconfig")); !os.IsNotExist(err) {
+		t.Fatalf("gitconfig should be removed, err = %v", err)
+	}
+}
+
+func TestResumeCompletesUnfinishedActions(t *testing.T) {
+	repo, home := setupSync(t)
+	actions := []manifest.Action{
+		{Source: "zshrc", Target: filepath.Join(home, ".zshrc"), Mode: "symlink"},
+		{Source: "gitconfig", Target: filepath.Join(home, ".gitconfig"), Mode: "copy"},
+	}
+
+	j, err := Start(Path(), State{RepoPath: repo}, actions)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	linker.ApplyRecorded(context.Background(), actions[:1], repo, false, j)
+
+	loaded, err := Load(Path())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	remaining, recorder := loaded.Unfinished()
+	results := linker.ApplyRecorded(context.Background(), remaining, repo, false, recorder)
+	if len(results) != 1 || results[0].Status != "copied" {
+		t.Fatalf("results = %+v, want gitconfig copied", results)
+	}
+	if loaded.State.Entries[1].Status != "copied" {
+		t.Fatalf("journal entry = %+v, want copied", loaded.State.Entries[1])
+	}
+
+	if err := loaded.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if _, err := Load(Path()); !errors.Is(err, ErrNoJournal) {
+		t.Fatalf("journal still present after Finish: %v", err)
+	}
+}
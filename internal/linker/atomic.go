@@ -0,0 +1,149 @@
+package linker
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes the content produced by write to a temp file in the
+// target's directory, fsyncs it and renames it over target, so target is either
+// the old content or the new content, never a partial write.
+func writeFileAtomic(target string, perm fs.FileMode, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(target)
+	tmp, err := createTemp(dir, tempPattern(target))
+	if err != nil {
+		return wrapPathError("creating temp file", dir, err)
+	}
+	tmpPath := tmp.Name()
+	closed := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if !closed {
+			_ = tmp.Close()
+		}
+		_ = os.Remove(tmpPath)
+	}()
+
+	if err = write(tmp); err != nil {
+		return wrapPathError("writing temp file", tmpPath, err)
+	}
+	if err = syncFile(tmp); err != nil {
+		return wrapPathError("syncing temp file", tmpPath, err)
+	}
+	closed = true
+	if err = tmp.Close(); err != nil {
+		return wrapPathError("closing temp file", tmpPath, err)
+	}
+	if err = os.Chmod(tmpPath, perm.Perm()); err != nil {
+		return wrapPathError("setting temp file mode", tmpPath, err)
+	}
+	if err = replacePath(tmpPath, target); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// copyDirAtomic copies src into a temp directory next to dst and swaps it into
+// place. Files get perm, or their source mode when perm is zero.
+func copyDirAtomic(src, dst string, perm fs.FileMode) (err error) {
+	dir := filepath.Dir(dst)
+	tmpDir, err := os.MkdirTemp(dir, tempPattern(dst))
+	if err != nil {
+		return wrapPathError("creating temp directory", dir, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(tmpDir)
+		}
+	}()
+
+	if err = copyDir(src, tmpDir, perm); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpDir, 0o755); err != nil {
+		return wrapPathError("setting temp directory mode", tmpDir, err)
+	}
+	return replacePath(tmpDir, dst)
+}
+
+// symlinkAtomic creates a symlink at a temp name and renames it over target.
+func symlinkAtomic(sourcePath, target string) (err error) {
+	dir := filepath.Dir(target)
+	// Reserve a unique name, then replace the placeholder with the link.
+	placeholder, err := createTemp(dir, tempPattern(target))
+	if err != nil {
+		return wrapPathError("creating temp symlink", dir, err)
+	}
+	tmpPath := placeholder.Name()
+	_ = placeholder.Close()
+	if err = os.Remove(tmpPath); err != nil {
+		return wrapPathError("creating temp symlink", tmpPath, err)
+	}
+
+	if err = symlink(sourcePath, tmpPath); err != nil {
+		return wrapPathError("creating symlink", target, err)
+	}
+	if err = replacePath(tmpPath, target); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// replacePath renames tmpPath over target. rename(2) cannot replace a
+// directory or put a directory over a file, so in those cases the old entry is
+// moved aside first and removed once the new one is in place.
+func replacePath(tmpPath, target string) error {
+	oldInfo, err := os.Lstat(target)
+	if err != nil && !os.IsNotExist(err) {
+		return wrapPathError("checking existing target", target, err)
+	}
+	newInfo, err := os.Lstat(tmpPath)
+	if err != nil {
+		return wrapPathError("checking temp file", tmpPath, err)
+	}
+
+	if oldInfo == nil || (!oldInfo.IsDir() && !newInfo.IsDir()) {
+		if err := renamePath(tmpPath, target); err != nil {
+			return wrapPathError("replacing target", target, err)
+		}
+		return nil
+	}
+
+	aside := tmpPath + ".old"
+	if err := renamePath(target, aside); err != nil {
+		return wrapPathError("moving old target aside", target, err)
+	}
+	if err := renamePath(tmpPath, target); err != nil {
+		if restoreErr := renamePath(aside, target); restoreErr != nil {
+			return fmt.Errorf("replacing target %q: %w (old target left at %q: %v)", target, err, aside, restoreErr)
+		}
+		return wrapPathError("replacing target", target, err)
+	}
+	if err := os.RemoveAll(aside); err != nil {
+		return wrapPathError("removing old target", aside, err)
+	}
+	return nil
+}
+
+func tempPattern(target string) string {
+	return "." + filepath.Base(target) + ".dotctl-tmp-*"
+}
+
+// syncDir flushes the directory entry after a rename. Best effort: some
+// filesystems do not support fsync on directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
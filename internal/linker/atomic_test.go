@@ -0,0 +1,141 @@
+package linker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".dotctl-tmp-") {
+			t.Errorf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestApplyCopyFullDiskKeepsOldTarget(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	target := filepath.Join(targetDir, ".zshrc")
+	if err := os.WriteFile(target, []byte("# old"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	origSync := syncFile
+	t.Cleanup(func() { syncFile = origSync })
+	syncFile = func(f *os.File) error {
+		return &os.PathError{Op: "fsync", Path: f.Name(), Err: syscall.ENOSPC}
+	}
+
+	results := Apply(context.Background(), []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: target, Mode: "copy", Backup: true},
+	}, repoRoot, false)
+
+	r := results[0]
+	if r.Status != "error" {
+		t.Fatalf("status = %q, want error", r.Status)
+	}
+	if !strings.Contains(r.Error.Error(), "no space left on device") {
+		t.Fatalf("error = %v, want no-space message", r.Error)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	if string(data) != "# old" {
+		t.Fatalf("target = %q, want old content untouched", string(data))
+	}
+	assertNoTempFiles(t, targetDir)
+}
+
+func TestApplySymlinkRenameFailureKeepsOldTarget(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	target := filepath.Join(targetDir, ".zshrc")
+	if err := os.WriteFile(target, []byte("# old"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	origRename := renamePath
+	t.Cleanup(func() { renamePath = origRename })
+	renamePath = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EACCES}
+	}
+
+	results := Apply(context.Background(), []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: target, Mode: "symlink", Backup: false},
+	}, repoRoot, false)
+
+	if results[0].Status != "error" || !strings.Contains(results[0].Error.Error(), "permission denied") {
+		t.Fatalf("result = %+v, want permission error", results[0])
+	}
+
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatalf("lstat target: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatal("target was replaced despite rename failure")
+	}
+	assertNoTempFiles(t, targetDir)
+}
+
+func TestWriteFileAtomicCreateTempFailure(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret.yaml")
+	if err := os.WriteFile(target, []byte("old: value"), 0o600); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	origCreate := createTemp
+	t.Cleanup(func() { createTemp = origCreate })
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: syscall.ENOSPC}
+	}
+
+	err := writeFileAtomic(target, 0o600, writeBytes([]byte("new: value")))
+	if err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		t.Fatalf("err = %v, want no-space error", err)
+	}
+
+	data, readErr := os.ReadFile(target)
+	if readErr != nil || string(data) != "old: value" {
+		t.Fatalf("target = %q, %v; want old content", string(data), readErr)
+	}
+}
+
+func TestApplyCopyDirectoryReplacesAtomically(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	target := filepath.Join(targetDir, "nvim")
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatalf("mkdir target: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "stale.lua"), []byte("-- stale"), 0o644); err != nil {
+		t.Fatalf("write stale: %v", err)
+	}
+
+	results := Apply(context.Background(), []manifest.Action{
+		{Source: "configs/nvim", Target: target, Mode: "copy", Backup: false},
+	}, repoRoot, false)
+	if results[0].Status != "copied" {
+		t.Fatalf("status = %q (err: %v), want copied", results[0].Status, results[0].Error)
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "stale.lua")); !os.IsNotExist(err) {
+		t.Fatalf("stale file should be gone, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "lua", "plugins.lua")); err != nil {
+		t.Fatalf("expected copied file: %v", err)
+	}
+	assertNoTempFiles(t, targetDir)
+}
@@ -8,6 +8,15 @@ import (
 	"syscall"
 )
 
+// Filesystem operations used for atomic target replacement. Tests swap these
+// to inject failures (full disk, permission errors) at each step.
+var (
+	createTemp = os.CreateTemp
+	syncFile   = func(f *os.File) error { return f.Sync() }
+	renamePath = os.Rename
+	symlink    = os.Symlink
+)
+
 func wrapPathError(operation, path string, err error) error {
 	if err == nil {
 		return nil
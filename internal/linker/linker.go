@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,27 +11,60 @@ import (
 
 	"github.com/felipe-veas/dotctl/internal/backup"
 	"github.com/felipe-veas/dotctl/internal/decrypt"
+	"github.com/felipe-veas/dotctl/internal/logging"
 	"github.com/felipe-veas/dotctl/internal/manifest"
 )
 
 // Result represents the outcome of applying a single action.
 type Result struct {
 	Action     manifest.Action
-	Status     string // "created", "already_linked", "backed_up", "copied", "skipped", "error"
+	Status     string // "created", "already_linked", "backed_up", "copied", "skipped", "conflict", "error"
 	BackupPath string // non-empty if a backup was created
 	Decrypted  bool
+	Rendered   bool
 	Error      error
 }
 
 // Apply executes a list of actions (creating symlinks or copies).
 // repoRoot is the absolute path to the cloned repo.
-// If dryRun is true, no filesystem changes are made.
-func Apply(actions []manifest.Action, repoRoot string, dryRun bool) []Result {
+// If dryRun is true, no filesystem changes are made. When ctx is cancelled,
+// Apply stops before the next action and returns the results so far.
+func Apply(ctx context.Context, actions []manifest.Action, repoRoot string, dryRun bool) []Result {
+	return ApplyRecorded(ctx, actions, repoRoot, dryRun, nil)
+}
+
+// Recorder is notified before and after each action is applied, so callers can
+// keep a write-ahead journal that survives the process being killed.
+type Recorder interface {
+	Begin(index int, action manifest.Action) error
+	Done(index int, result Result) error
+}
+
+// ApplyRecorded is Apply with progress reported to rec (which may be nil).
+// An action is not applied if its Begin record cannot be written.
+func ApplyRecorded(ctx context.Context, actions []manifest.Action, repoRoot string, dryRun bool, rec Recorder) []Result {
 	var results []Result
 
-	for _, action := range actions {
+	for i, action := range actions {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if rec != nil && !dryRun {
+			if err := rec.Begin(i, action); err != nil {
+				results = append(results, Result{Action: action, Status: "error", Error: fmt.Errorf("recording sync journal: %w", err)})
+				continue
+			}
+		}
+
 		sourcePath := filepath.Join(repoRoot, action.Source)
 		r := applyOne(action, sourcePath, dryRun)
+
+		if rec != nil && !dryRun {
+			if err := rec.Done(i, r); err != nil {
+				logging.Warn("recording sync journal failed", "target", action.Target, "error", err)
+			}
+		}
 		results = append(results, r)
 	}
 
@@ -54,16 +88,34 @@ func applyOne(action manifest.Action, sourcePath string, dryRun bool) Result {
 		}
 	}
 
+	if action.Template && action.Mode != "copy" {
+		return Result{
+			Action: action,
+			Status: "error",
+			Error:  fmt.Errorf("template=true requires mode=copy: %s", action.Source),
+		}
+	}
+
 	targetDir := filepath.Dir(action.Target)
 
+	var result Result
 	switch action.Mode {
 	case "symlink":
-		return applySymlink(action, sourcePath, targetDir, dryRun)
+		result = applySymlink(action, sourcePath, targetDir, dryRun)
 	case "copy":
-		return applyCopy(action, sourcePath, targetDir, dryRun)
+		result = applyCopy(action, sourcePath, targetDir, dryRun)
 	default:
 		return Result{Action: action, Status: "error", Error: fmt.Errorf("unknown mode: %s", action.Mode)}
 	}
+
+	switch result.Status {
+	case "created", "already_linked", "copied", "backed_up":
+		if err := applyPermissions(action); err != nil {
+			result.Status = "error"
+			result.Error = err
+		}
+	}
+	return result
 }
 
 func applySymlink(action manifest.Action, sourcePath, targetDir string, dryRun bool) Result {
@@ -92,25 +144,14 @@ func applySymlink(action manifest.Action, sourcePath, targetDir string, dryRun b
 			return Result{Action: action, Status: "would_backup_and_link"}
 		}
 
-		backupPath := ""
+		// The old target is replaced atomically by createSymlink.
 		if action.Backup {
-			var backupErr error
-			backupPath, backupErr = backup.Create(action.Target)
+			backupPath, backupErr := backup.CreateFor(action.Target, action.Source)
 			if backupErr != nil {
 				return Result{Action: action, Status: "error", Error: wrapPathError("creating backup", action.Target, backupErr)}
 			}
-
-			if err := os.RemoveAll(action.Target); err != nil {
-				return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("removing old target", action.Target, err)}
-			}
-
 			return createSymlink(action, sourcePath, targetDir, backupPath)
 		}
-
-		// No backup, just overwrite
-		if err := os.RemoveAll(action.Target); err != nil {
-			return Result{Action: action, Status: "error", Error: wrapPathError("removing old target", action.Target, err)}
-		}
 	}
 
 	if dryRun {
@@ -125,8 +166,8 @@ func createSymlink(action manifest.Action, sourcePath, targetDir, backupPath str
 		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("creating target directory", targetDir, err)}
 	}
 
-	if err := os.Symlink(sourcePath, action.Target); err != nil {
-		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("creating symlink", action.Target, err)}
+	if err := symlinkAtomic(sourcePath, action.Target); err != nil {
+		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: err}
 	}
 
 	status := "created"
@@ -150,24 +191,14 @@ func applyCopy(action manifest.Action, sourcePath, targetDir string, dryRun bool
 			return Result{Action: action, Status: "would_backup_and_copy"}
 		}
 
-		backupPath := ""
+		// The old target is replaced atomically by doCopy.
 		if action.Backup {
-			var backupErr error
-			backupPath, backupErr = backup.Create(action.Target)
+			backupPath, backupErr := backup.CreateFor(action.Target, action.Source)
 			if backupErr != nil {
 				return Result{Action: action, Status: "error", Error: wrapPathError("creating backup", action.Target, backupErr)}
 			}
-
-			if err := os.RemoveAll(action.Target); err != nil {
-				return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("removing old target", action.Target, err)}
-			}
-
 			return doCopy(action, sourcePath, targetDir, backupPath)
 		}
-
-		if err := os.RemoveAll(action.Target); err != nil {
-			return Result{Action: action, Status: "error", Error: wrapPathError("removing old target", action.Target, err)}
-		}
 	}
 
 	if dryRun {
@@ -190,13 +221,16 @@ func doCopy(action manifest.Action, sourcePath, targetDir, backupPath string) Re
 	if action.Decrypt {
 		return doDecryptCopy(action, sourcePath, srcInfo, backupPath)
 	}
+	if action.Template {
+		return doRenderCopy(action, sourcePath, srcInfo, backupPath)
+	}
 
 	if srcInfo.IsDir() {
-		if err := copyDir(sourcePath, action.Target); err != nil {
+		if err := copyDirAtomic(sourcePath, action.Target, action.Perm); err != nil {
 			return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("copying directory", action.Target, err)}
 		}
 	} else {
-		if err := copyFile(sourcePath, action.Target, srcInfo.Mode()); err != nil {
+		if err := copyFileAtomic(sourcePath, action.Target, targetFileMode(action, srcInfo.Mode())); err != nil {
 			return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("copying file", action.Target, err)}
 		}
 	}
@@ -218,7 +252,7 @@ func doDecryptCopy(action manifest.Action, sourcePath string, srcInfo fs.FileInf
 		}
 	}
 
-	plaintext, _, err := decrypt.DecryptFile(sourcePath)
+	plaintext, _, err := decrypt.DecryptFile(sourcePath, action.DecryptWith)
 	if err != nil {
 		return Result{
 			Action:     action,
@@ -228,12 +262,20 @@ func doDecryptCopy(action manifest.Action, sourcePath string, srcInfo fs.FileInf
 		}
 	}
 
-	// Decrypted files should never be world-readable.
+	if action.Template {
+		plaintext, err = manifest.RenderContent(action.Source, plaintext, action.Vars)
+		if err != nil {
+			return Result{Action: action, Status: "error", BackupPath: backupPath, Error: err}
+		}
+	}
+
+	// Decrypted files should never be world-readable unless perm says so.
 	perm := srcInfo.Mode().Perm()
 	if perm > 0o600 {
 		perm = 0o600
 	}
-	if err := os.WriteFile(action.Target, plaintext, perm); err != nil {
+	perm = targetFileMode(action, perm)
+	if err := writeFileAtomic(action.Target, perm, writeBytes(plaintext)); err != nil {
 		return Result{
 			Action:     action,
 			Status:     "error",
@@ -252,6 +294,73 @@ func doDecryptCopy(action manifest.Action, sourcePath string, srcInfo fs.FileInf
 		Status:     status,
 		BackupPath: backupPath,
 		Decrypted:  true,
+		Rendered:   action.Template,
+	}
+}
+
+func doRenderCopy(action manifest.Action, sourcePath string, srcInfo fs.FileInfo, backupPath string) Result {
+	if srcInfo.IsDir() {
+		return Result{
+			Action:     action,
+			Status:     "error",
+			BackupPath: backupPath,
+			Error:      fmt.Errorf("template=true is not supported for directories: %s", action.Source),
+		}
+	}
+
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("reading source", sourcePath, err)}
+	}
+
+	rendered, err := manifest.RenderContent(action.Source, data, action.Vars)
+	if err != nil {
+		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: err}
+	}
+
+	if err := writeFileAtomic(action.Target, targetFileMode(action, srcInfo.Mode()), writeBytes(rendered)); err != nil {
+		return Result{Action: action, Status: "error", BackupPath: backupPath, Error: wrapPathError("writing rendered file", action.Target, err)}
+	}
+
+	status := "copied"
+	if backupPath != "" {
+		status = "backed_up"
+	}
+	return Result{Action: action, Status: status, BackupPath: backupPath, Rendered: true}
+}
+
+// targetFileMode is the mode a copied file gets: the declared perm, else
+// srcMode. It is set before the file is renamed into place, so a restricted
+// file is never visible with a wider mode.
+func targetFileMode(action manifest.Action, srcMode fs.FileMode) fs.FileMode {
+	if action.Perm != 0 {
+		return action.Perm
+	}
+	return srcMode.Perm()
+}
+
+// copyFileAtomic copies src over dst via writeFileAtomic.
+func copyFileAtomic(src, dst string, perm fs.FileMode) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return wrapPathError("opening source file", src, err)
+	}
+	defer func() {
+		if closeErr := in.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	return writeFileAtomic(dst, perm, func(w io.Writer) error {
+		_, copyErr := io.Copy(w, in)
+		return copyErr
+	})
+}
+
+func writeBytes(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
 	}
 }
 
@@ -283,7 +392,9 @@ func copyFile(src, dst string, perm fs.FileMode) (err error) {
 	return nil
 }
 
-func copyDir(src, dst string) error {
+// copyDir copies src into dst. Files get perm, or their source mode when
+// perm is zero.
+func copyDir(src, dst string, perm fs.FileMode) error {
 	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return wrapPathError("walking source directory", path, err)
@@ -306,7 +417,15 @@ func copyDir(src, dst string) error {
 		if infoErr != nil {
 			return wrapPathError("reading source file metadata", path, infoErr)
 		}
-		return copyFile(path, target, info.Mode())
+		mode := info.Mode().Perm()
+		if perm != 0 {
+			mode = perm
+		}
+		if err := copyFile(path, target, mode); err != nil {
+			return err
+		}
+		// OpenFile applies the umask; set the mode exactly.
+		return os.Chmod(target, mode)
 	})
 }
 
@@ -317,6 +436,7 @@ type Summary struct {
 	BackedUp    int
 	Copied      int
 	Errors      int
+	Conflicts   int
 	WouldCreate int
 	WouldBackup int
 }
@@ -336,6 +456,8 @@ func Summarize(results []Result) Summary {
 			s.Copied++
 		case "error":
 			s.Errors++
+		case "conflict":
+			s.Conflicts++
 		case "would_create", "would_copy":
 			s.WouldCreate++
 		case "would_backup_and_link", "would_backup_and_copy":
@@ -423,7 +545,7 @@ func rollbackOne(result Result) RollbackResult {
 				Error:  fmt.Errorf("missing backup path for %q", result.Action.Target),
 			}
 		}
-		if err := restoreFromBackup(result.BackupPath, result.Action.Target); err != nil {
+		if err := backup.Restore(result.BackupPath, result.Action.Target); err != nil {
 			return RollbackResult{
 				Action: result.Action,
 				Status: "error",
@@ -435,7 +557,7 @@ func rollbackOne(result Result) RollbackResult {
 		if result.BackupPath == "" {
 			return RollbackResult{Action: result.Action, Status: "skipped"}
 		}
-		if err := restoreFromBackup(result.BackupPath, result.Action.Target); err != nil {
+		if err := backup.Restore(result.BackupPath, result.Action.Target); err != nil {
 			return RollbackResult{
 				Action: result.Action,
 				Status: "error",
@@ -447,41 +569,3 @@ func rollbackOne(result Result) RollbackResult {
 		return RollbackResult{Action: result.Action, Status: "skipped"}
 	}
 }
-
-func restoreFromBackup(backupPath, target string) error {
-	if err := os.RemoveAll(target); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("removing target before restore: %w", err)
-	}
-
-	info, err := os.Lstat(backupPath)
-	if err != nil {
-		return fmt.Errorf("stat backup %q: %w", backupPath, err)
-	}
-
-	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-		return fmt.Errorf("creating target parent dir: %w", err)
-	}
-
-	if info.Mode()&os.ModeSymlink != 0 {
-		dest, readErr := os.Readlink(backupPath)
-		if readErr != nil {
-			return fmt.Errorf("reading backup symlink: %w", readErr)
-		}
-		if err := os.Symlink(dest, target); err != nil {
-			return fmt.Errorf("restoring symlink: %w", err)
-		}
-		return nil
-	}
-
-	if info.IsDir() {
-		if err := copyDir(backupPath, target); err != nil {
-			return fmt.Errorf("restoring directory: %w", err)
-		}
-		return nil
-	}
-
-	if err := copyFile(backupPath, target, info.Mode()); err != nil {
-		return fmt.Errorf("restoring file: %w", err)
-	}
-	return nil
-}
@@ -1,12 +1,15 @@
 package linker
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/felipe-veas/dotctl/internal/decrypt"
 	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/secrets"
 )
 
 // setupRepo creates a fake repo with source files.
@@ -49,7 +52,7 @@ func TestApplySymlinkCreate(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "symlink", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if len(results) != 1 {
 		t.Fatalf("results = %d, want 1", len(results))
 	}
@@ -81,10 +84,10 @@ func TestApplySymlinkIdempotent(t *testing.T) {
 	}
 
 	// First apply
-	Apply(actions, repoRoot, false)
+	Apply(context.Background(), actions, repoRoot, false)
 
 	// Second apply — should be idempotent
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "already_linked" {
 		t.Errorf("second apply status = %q, want %q", results[0].Status, "already_linked")
 	}
@@ -103,7 +106,7 @@ func TestApplySymlinkWithBackup(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: targetPath, Mode: "symlink", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	r := results[0]
 
 	if r.Status != "backed_up" {
@@ -139,7 +142,7 @@ func TestApplyDryRun(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "symlink", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, true)
+	results := Apply(context.Background(), actions, repoRoot, true)
 	if results[0].Status != "would_create" {
 		t.Errorf("dry-run status = %q, want %q", results[0].Status, "would_create")
 	}
@@ -162,7 +165,7 @@ func TestApplyDryRunWithExisting(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: targetPath, Mode: "symlink", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, true)
+	results := Apply(context.Background(), actions, repoRoot, true)
 	if results[0].Status != "would_backup_and_link" {
 		t.Errorf("dry-run status = %q, want %q", results[0].Status, "would_backup_and_link")
 	}
@@ -181,7 +184,7 @@ func TestApplyCopy(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "copy", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "copied" {
 		t.Errorf("status = %q, want %q", results[0].Status, "copied")
 	}
@@ -234,7 +237,7 @@ func TestApplyCopyDecrypt(t *testing.T) {
 		},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if len(results) != 1 {
 		t.Fatalf("results = %d, want 1", len(results))
 	}
@@ -254,6 +257,101 @@ func TestApplyCopyDecrypt(t *testing.T) {
 	}
 }
 
+func TestApplyCopyDecryptBuiltinAge(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	t.Setenv("PATH", t.TempDir()) // neither sops nor age available
+	t.Cleanup(decrypt.Forget)
+
+	id, err := secrets.GenerateIdentity(secrets.DefaultIdentityPath())
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	ciphertext, err := secrets.EncryptBytes([]byte("TOKEN=abc\n"), id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptBytes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, "configs", ".env.enc.age"), ciphertext, 0o644); err != nil {
+		t.Fatalf("write encrypted source: %v", err)
+	}
+
+	targetPath := filepath.Join(targetDir, ".env")
+	actions := []manifest.Action{
+		{Source: "configs/.env.enc.age", Target: targetPath, Mode: "copy", Decrypt: true, DecryptWith: manifest.DecryptAge},
+	}
+
+	results := Apply(context.Background(), actions, repoRoot, false)
+	if results[0].Status != "copied" || !results[0].Decrypted {
+		t.Fatalf("result = %+v, want decrypted copy", results[0])
+	}
+	data, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("read decrypted target: %v", err)
+	}
+	if string(data) != "TOKEN=abc\n" {
+		t.Fatalf("target content = %q", data)
+	}
+	info, _ := os.Stat(targetPath)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("target mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestApplyCopyTemplate(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+
+	templatePath := filepath.Join(repoRoot, "configs", "git", "config")
+	if err := os.MkdirAll(filepath.Dir(templatePath), 0o755); err != nil {
+		t.Fatalf("mkdir template dir: %v", err)
+	}
+	if err := os.WriteFile(templatePath, []byte("# profile={{ .profile }}\n"), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	targetPath := filepath.Join(targetDir, ".gitconfig")
+	actions := []manifest.Action{
+		{
+			Source:   "configs/git/config",
+			Target:   targetPath,
+			Mode:     "copy",
+			Template: true,
+			Backup:   true,
+			Vars:     map[string]string{"profile": "laptop"},
+		},
+	}
+
+	results := Apply(context.Background(), actions, repoRoot, false)
+	if results[0].Status != "copied" {
+		t.Fatalf("status = %q, want copied (error: %v)", results[0].Status, results[0].Error)
+	}
+	if !results[0].Rendered {
+		t.Fatal("expected Rendered=true")
+	}
+
+	data, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("read rendered target: %v", err)
+	}
+	if string(data) != "# profile=laptop\n" {
+		t.Fatalf("target content = %q, want rendered template", string(data))
+	}
+}
+
+func TestApplyTemplateRejectsSymlinkMode(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+
+	actions := []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "symlink", Template: true},
+	}
+
+	results := Apply(context.Background(), actions, repoRoot, false)
+	if results[0].Status != "error" {
+		t.Fatalf("status = %q, want error", results[0].Status)
+	}
+	if _, err := os.Lstat(filepath.Join(targetDir, ".zshrc")); !os.IsNotExist(err) {
+		t.Fatalf("target should not be created, lstat err = %v", err)
+	}
+}
+
 func TestApplyCopyDir(t *testing.T) {
 	repoRoot, targetDir := setupRepo(t)
 
@@ -261,7 +359,7 @@ func TestApplyCopyDir(t *testing.T) {
 		{Source: "configs/nvim", Target: filepath.Join(targetDir, ".config", "nvim"), Mode: "copy", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "copied" {
 		t.Errorf("status = %q, want %q (error: %v)", results[0].Status, "copied", results[0].Error)
 	}
@@ -283,7 +381,7 @@ func TestApplySourceMissing(t *testing.T) {
 		{Source: "configs/nonexistent", Target: filepath.Join(targetDir, "x"), Mode: "symlink"},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "error" {
 		t.Errorf("status = %q, want %q", results[0].Status, "error")
 	}
@@ -296,7 +394,7 @@ func TestApplyCreatesParentDirs(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, "deep", "nested", ".zshrc"), Mode: "symlink"},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "created" {
 		t.Errorf("status = %q, want %q (error: %v)", results[0].Status, "created", results[0].Error)
 	}
@@ -340,7 +438,7 @@ func TestApplySymlinkWrongTarget(t *testing.T) {
 		{Source: "configs/zsh/.zshrc", Target: targetPath, Mode: "symlink", Backup: true},
 	}
 
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	r := results[0]
 
 	if r.Status != "backed_up" {
@@ -362,7 +460,7 @@ func TestRollbackCreatedRemovesTarget(t *testing.T) {
 	actions := []manifest.Action{
 		{Source: "configs/zsh/.zshrc", Target: targetPath, Mode: "symlink", Backup: true},
 	}
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "created" {
 		t.Fatalf("status = %q, want created", results[0].Status)
 	}
@@ -389,7 +487,7 @@ func TestRollbackBackedUpRestoresOriginalFile(t *testing.T) {
 	actions := []manifest.Action{
 		{Source: "configs/zsh/.zshrc", Target: targetPath, Mode: "symlink", Backup: true},
 	}
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if results[0].Status != "backed_up" {
 		t.Fatalf("status = %q, want backed_up", results[0].Status)
 	}
@@ -422,7 +520,7 @@ func TestApplySourceSymlinkLoop(t *testing.T) {
 	actions := []manifest.Action{
 		{Source: "configs/loop", Target: filepath.Join(targetDir, "loop-target"), Mode: "symlink", Backup: true},
 	}
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if len(results) != 1 {
 		t.Fatalf("results = %d, want 1", len(results))
 	}
@@ -454,7 +552,7 @@ func TestApplyPermissionDeniedTarget(t *testing.T) {
 	actions := []manifest.Action{
 		{Source: "configs/zsh/.zshrc", Target: filepath.Join(blockedDir, ".zshrc"), Mode: "symlink", Backup: true},
 	}
-	results := Apply(actions, repoRoot, false)
+	results := Apply(context.Background(), actions, repoRoot, false)
 	if len(results) != 1 {
 		t.Fatalf("results = %d, want 1", len(results))
 	}
@@ -465,3 +563,20 @@ func TestApplyPermissionDeniedTarget(t *testing.T) {
 		t.Fatalf("expected permission denied error, got: %v", results[0].Error)
 	}
 }
+
+func TestApplyStopsWhenContextCancelled(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := Apply(ctx, []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "symlink"},
+	}, repoRoot, false)
+	if len(results) != 0 {
+		t.Fatalf("results = %+v, want none after cancellation", results)
+	}
+	if _, err := os.Lstat(filepath.Join(targetDir, ".zshrc")); !os.IsNotExist(err) {
+		t.Fatalf("target should not be created, err = %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package linker
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+// applyPermissions enforces the dir_perm declared for an action on the
+// directory containing the target. perm is applied by the copy itself,
+// before the file is renamed into place.
+func applyPermissions(action manifest.Action) error {
+	if action.DirPerm != 0 {
+		dir := filepath.Dir(action.Target)
+		if err := chmodIfNeeded(dir, action.DirPerm); err != nil {
+			return wrapPathError("setting directory permissions", dir, err)
+		}
+	}
+	return nil
+}
+
+func chmodIfNeeded(path string, perm fs.FileMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm() == perm {
+		return nil
+	}
+	return os.Chmod(path, perm)
+}
+
+// PermissionDrift reports how the target's permissions differ from the
+// declared perm/dir_perm, or "" if they match (or nothing is declared).
+// Missing targets are not reported; that is a separate status.
+func PermissionDrift(action manifest.Action) string {
+	if action.Perm != 0 && action.Mode == "copy" {
+		info, err := os.Stat(action.Target)
+		if err == nil {
+			if !info.IsDir() {
+				if got := info.Mode().Perm(); got != action.Perm {
+					return fmt.Sprintf("mode %04o, want %04o", got, action.Perm)
+				}
+			} else if drift := dirFilesDrift(action.Target, action.Perm); drift != "" {
+				return drift
+			}
+		}
+	}
+
+	if action.DirPerm != 0 {
+		dir := filepath.Dir(action.Target)
+		if info, err := os.Stat(dir); err == nil {
+			if got := info.Mode().Perm(); got != action.DirPerm {
+				return fmt.Sprintf("directory %s mode %04o, want %04o", dir, got, action.DirPerm)
+			}
+		}
+	}
+	return ""
+}
+
+func dirFilesDrift(root string, perm fs.FileMode) string {
+	var drift string
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if got := info.Mode().Perm(); got != perm {
+			rel, _ := filepath.Rel(root, path)
+			drift = fmt.Sprintf("%s mode %04o, want %04o", rel, got, perm)
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return drift
+}
@@ -0,0 +1,125 @@
+package linker
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+func TestApplyCopyEnforcesPermissions(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	target := filepath.Join(targetDir, ".ssh", "config")
+
+	actions := []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: target, Mode: "copy", Perm: 0o600, DirPerm: 0o700},
+	}
+
+	results := Apply(context.Background(), actions, repoRoot, false)
+	if results[0].Status != "copied" {
+		t.Fatalf("status = %q, want copied (err: %v)", results[0].Status, results[0].Error)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("stat target: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Errorf("target mode = %04o, want 0600", got)
+	}
+	dirInfo, err := os.Stat(filepath.Dir(target))
+	if err != nil {
+		t.Fatalf("stat target dir: %v", err)
+	}
+	if got := dirInfo.Mode().Perm(); got != 0o700 {
+		t.Errorf("target dir mode = %04o, want 0700", got)
+	}
+	if drift := PermissionDrift(actions[0]); drift != "" {
+		t.Errorf("PermissionDrift = %q, want none", drift)
+	}
+}
+
+func TestApplyCopyPermSetBeforeRename(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+
+	// Every file renamed into place must already have the declared mode.
+	origRename := renamePath
+	t.Cleanup(func() { renamePath = origRename })
+	renamePath = func(oldpath, newpath string) error {
+		_ = filepath.WalkDir(oldpath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if info, statErr := os.Stat(path); statErr == nil && info.Mode().Perm() != 0o600 {
+				t.Errorf("%s renamed into place with mode %04o, want 0600", path, info.Mode().Perm())
+			}
+			return nil
+		})
+		return origRename(oldpath, newpath)
+	}
+
+	actions := []manifest.Action{
+		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc"), Mode: "copy", Perm: 0o600},
+		{Source: "configs/zsh/.zshrc", Target: filepath.Join(targetDir, ".zshrc.rendered"), Mode: "copy", Perm: 0o600, Template: true},
+		{Source: "configs/nvim", Target: filepath.Join(targetDir, "nvim"), Mode: "copy", Perm: 0o600},
+	}
+	for _, r := range Apply(context.Background(), actions, repoRoot, false) {
+		if r.Status != "copied" {
+			t.Fatalf("%s status = %q, want copied (err: %v)", r.Action.Target, r.Status, r.Error)
+		}
+		if drift := PermissionDrift(r.Action); drift != "" {
+			t.Errorf("%s PermissionDrift = %q, want none", r.Action.Target, drift)
+		}
+	}
+}
+
+func TestApplySymlinkEnforcesDirPerm(t *testing.T) {
+	repoRoot, targetDir := setupRepo(t)
+	parent := filepath.Join(targetDir, ".config", "zsh")
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		t.Fatalf("mkdir parent: %v", err)
+	}
+
+	action := manifest.Action{Source: "configs/zsh/.zshrc", Target: filepath.Join(parent, ".zshrc"), Mode: "symlink", DirPerm: 0o700}
+	if drift := PermissionDrift(action); drift == "" {
+		t.Fatal("expected permission drift before apply")
+	}
+
+	results := Apply(context.Background(), []manifest.Action{action}, repoRoot, false)
+	if results[0].Status != "created" {
+		t.Fatalf("status = %q, want created (err: %v)", results[0].Status, results[0].Error)
+	}
+
+	info, err := os.Stat(parent)
+	if err != nil {
+		t.Fatalf("stat parent: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o700 {
+		t.Errorf("parent mode = %04o, want 0700", got)
+	}
+
+	// The repo file behind the symlink must not be touched.
+	srcInfo, err := os.Stat(filepath.Join(repoRoot, "configs", "zsh", ".zshrc"))
+	if err != nil {
+		t.Fatalf("stat source: %v", err)
+	}
+	if got := srcInfo.Mode().Perm(); got != 0o644 {
+		t.Errorf("source mode = %04o, want 0644", got)
+	}
+}
+
+func TestPermissionDriftReportsChangedMode(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "config")
+	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+
+	action := manifest.Action{Target: target, Mode: "copy", Perm: 0o600}
+	if got, want := PermissionDrift(action), "mode 0644, want 0600"; got != want {
+		t.Fatalf("PermissionDrift = %q, want %q", got, want)
+	}
+}
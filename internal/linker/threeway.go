@@ -0,0 +1,209 @@
+package linker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/decrypt"
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+// Three-way classes of a copy-mode target, comparing the content dotctl last
+// deployed (base), the content the repo would deploy now (repo) and the
+// content on disk (local).
+const (
+	CopyNew          = "new"           // target does not exist
+	CopyUntracked    = "untracked"     // nothing recorded for the target yet
+	CopyUnchanged    = "unchanged"     // neither side changed
+	CopyRepoChanged  = "repo_changed"  // only the repo changed
+	CopyLocalChanged = "local_changed" // only the target was edited
+	CopyInSync       = "in_sync"       // both changed to the same content
+	CopyConflict     = "conflict"      // both changed differently
+)
+
+// CopyState is the three-way classification of a copy-mode target.
+type CopyState struct {
+	Class     string
+	BaseHash  string
+	RepoHash  string
+	LocalHash string
+}
+
+// sealedPrefix marks a content hash keyed with SealHash.
+const sealedPrefix = "hmac-sha256:"
+
+// ClassifyCopy compares a copy-mode target with the hash recorded when dotctl
+// last deployed it. baseHash is "" when nothing was recorded. For decrypted
+// actions, key seals the local and repo hashes the way the base was recorded.
+func ClassifyCopy(action manifest.Action, repoRoot, baseHash string, key []byte) (CopyState, error) {
+	state := CopyState{BaseHash: baseHash}
+
+	localHash, err := ContentHash(action.Target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			state.Class = CopyNew
+			return state, nil
+		}
+		return state, wrapPathError("hashing target", action.Target, err)
+	}
+	if action.Decrypt && key != nil {
+		localHash = SealHash(key, localHash)
+	}
+	state.LocalHash = localHash
+
+	if baseHash == "" {
+		state.Class = CopyUntracked
+		return state, nil
+	}
+
+	repoHash, err := DeployedHash(action, filepath.Join(repoRoot, action.Source))
+	if err != nil {
+		return state, err
+	}
+	if action.Decrypt && key != nil {
+		repoHash = SealHash(key, repoHash)
+	}
+	state.RepoHash = repoHash
+
+	switch {
+	case localHash == baseHash && repoHash == baseHash:
+		state.Class = CopyUnchanged
+	case localHash == baseHash:
+		state.Class = CopyRepoChanged
+	case repoHash == baseHash:
+		state.Class = CopyLocalChanged
+	case repoHash == localHash:
+		state.Class = CopyInSync
+	default:
+		state.Class = CopyConflict
+	}
+	return state, nil
+}
+
+// DeployedHash returns the hash of the content a copy action writes: the
+// source after decryption and template rendering.
+func DeployedHash(action manifest.Action, sourcePath string) (string, error) {
+	if !action.Decrypt && !action.Template {
+		hash, err := ContentHash(sourcePath)
+		if err != nil {
+			return "", wrapPathError("hashing source", sourcePath, err)
+		}
+		return hash, nil
+	}
+
+	data, err := DeployedContent(action, sourcePath)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
+
+// DeployedContent returns the bytes a file copy action writes to its target.
+func DeployedContent(action manifest.Action, sourcePath string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if action.Decrypt {
+		data, _, err = decrypt.DecryptFile(sourcePath, action.DecryptWith)
+		if err != nil {
+			return nil, wrapPathError("decrypting source", sourcePath, err)
+		}
+	} else {
+		data, err = os.ReadFile(sourcePath)
+		if err != nil {
+			return nil, wrapPathError("reading source", sourcePath, err)
+		}
+	}
+
+	if action.Template {
+		data, err = manifest.RenderContent(action.Source, data, action.Vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// SealHash keys a content hash with a per-machine secret, so a recorded hash
+// of decrypted content cannot be used to guess the plaintext offline.
+func SealHash(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = io.WriteString(mac, hash)
+	return sealedPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsSealed reports whether hash was produced by SealHash.
+func IsSealed(hash string) bool {
+	return strings.HasPrefix(hash, sealedPrefix)
+}
+
+// ContentHash hashes a file's content, or a directory's relative paths and
+// file contents. Permissions are not included.
+func ContentHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return hashFile(path)
+	}
+
+	var lines []string
+	err = filepath.WalkDir(path, func(current string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fileHash, err := hashFile(current)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, current)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, filepath.ToSlash(rel)+"\x00"+fileHash+"\n")
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		_, _ = io.WriteString(h, line)
+	}
+	return "dir:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,89 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+)
+
+func TestClassifyCopy(t *testing.T) {
+	repo := t.TempDir()
+	home := t.TempDir()
+	source := filepath.Join(repo, "settings.json")
+	target := filepath.Join(home, "settings.json")
+	action := manifest.Action{Source: "settings.json", Target: target, Mode: "copy"}
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	base := hashBytes([]byte("base\n"))
+
+	tests := []struct {
+		name  string
+		repo  string
+		local string // "" = target missing
+		base  string
+		want  string
+	}{
+		{"missing target", "base\n", "", base, CopyNew},
+		{"no record", "base\n", "base\n", "", CopyUntracked},
+		{"unchanged", "base\n", "base\n", base, CopyUnchanged},
+		{"repo changed", "repo\n", "base\n", base, CopyRepoChanged},
+		{"local changed", "base\n", "local\n", base, CopyLocalChanged},
+		{"both same", "same\n", "same\n", base, CopyInSync},
+		{"conflict", "repo\n", "local\n", base, CopyConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write(source, tt.repo)
+			_ = os.Remove(target)
+			if tt.local != "" {
+				write(target, tt.local)
+			}
+
+			state, err := ClassifyCopy(action, repo, tt.base, nil)
+			if err != nil {
+				t.Fatalf("ClassifyCopy: %v", err)
+			}
+			if state.Class != tt.want {
+				t.Fatalf("class = %q, want %q (%+v)", state.Class, tt.want, state)
+			}
+		})
+	}
+}
+
+func TestContentHashDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	first, err := ContentHash(dir)
+	if err != nil {
+		t.Fatalf("ContentHash: %v", err)
+	}
+	if !strings.HasPrefix(first, "dir:") {
+		t.Fatalf("hash = %q, want dir: prefix", first)
+	}
+
+	if err := os.Rename(filepath.Join(dir, "sub", "a"), filepath.Join(dir, "sub", "b")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	second, err := ContentHash(dir)
+	if err != nil {
+		t.Fatalf("ContentHash: %v", err)
+	}
+	if first == second {
+		t.Fatal("renaming a file should change the directory hash")
+	}
+}
@@ -0,0 +1,181 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/profile"
+)
+
+// Condition represents when-filters for an entry or hook.
+// All clauses set on a Condition must match; Any and All nest further conditions.
+type Condition struct {
+	OS       StringOrSlice `yaml:"os"`
+	Profile  StringOrSlice `yaml:"profile"`
+	Hostname StringOrSlice `yaml:"hostname"` // glob patterns, e.g. "work-*"
+	Arch     StringOrSlice `yaml:"arch"`
+	Env      StringOrSlice `yaml:"env"`     // "NAME" (set and non-empty) or "NAME=value"
+	Exists   StringOrSlice `yaml:"exists"`  // paths that must exist (~ expanded)
+	Command  StringOrSlice `yaml:"command"` // binaries that must be on PATH
+
+	Not *Condition  `yaml:"not"`
+	Any []Condition `yaml:"any"`
+	All []Condition `yaml:"all"`
+}
+
+// lookPath is a seam for tests.
+var lookPath = exec.LookPath
+
+// Evaluate reports whether the condition matches ctx. When it does not,
+// reason names the first clause that failed, e.g. "arch: amd64 not in [arm64]".
+func (c Condition) Evaluate(ctx profile.Context) (ok bool, reason string) {
+	if !c.OS.Matches(ctx.OS) {
+		return false, "os: " + ctx.OS + " not in " + sliceStr(c.OS)
+	}
+	if !c.Profile.Matches(ctx.Profile) {
+		return false, "profile: " + ctx.Profile + " not in " + sliceStr(c.Profile)
+	}
+	if !c.Arch.Matches(ctx.Arch) {
+		return false, "arch: " + ctx.Arch + " not in " + sliceStr(c.Arch)
+	}
+	if !matchesAnyGlob(c.Hostname, ctx.Hostname) {
+		return false, "hostname: " + ctx.Hostname + " does not match " + sliceStr(c.Hostname)
+	}
+	for _, spec := range c.Env {
+		if ok, reason := envMatches(spec); !ok {
+			return false, reason
+		}
+	}
+	for _, p := range c.Exists {
+		if _, err := os.Stat(expandHome(p, ctx.Home)); err != nil {
+			return false, "exists: " + p + " not found"
+		}
+	}
+	for _, name := range c.Command {
+		if _, err := lookPath(name); err != nil {
+			return false, "command: " + name + " not found on PATH"
+		}
+	}
+
+	if c.Not != nil {
+		if ok, _ := c.Not.Evaluate(ctx); ok {
+			return false, "not: " + c.Not.describe() + " matched"
+		}
+	}
+
+	for i, sub := range c.All {
+		if ok, reason := sub.Evaluate(ctx); !ok {
+			return false, fmt.Sprintf("all[%d]: %s", i, reason)
+		}
+	}
+
+	if len(c.Any) > 0 {
+		reasons := make([]string, 0, len(c.Any))
+		for _, sub := range c.Any {
+			ok, reason := sub.Evaluate(ctx)
+			if ok {
+				return true, ""
+			}
+			reasons = append(reasons, reason)
+		}
+		return false, "any: no alternative matched (" + strings.Join(reasons, "; ") + ")"
+	}
+
+	return true, ""
+}
+
+// validate checks glob patterns and env specs so mistakes surface at load
+// time instead of silently never matching.
+func (c Condition) validate() error {
+	for _, pattern := range c.Hostname {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("when.hostname: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, spec := range c.Env {
+		name, _, _ := strings.Cut(spec, "=")
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("when.env: invalid entry %q (want NAME or NAME=value)", spec)
+		}
+	}
+	if c.Not != nil {
+		if err := c.Not.validate(); err != nil {
+			return fmt.Errorf("not: %w", err)
+		}
+	}
+	for i, sub := range c.All {
+		if err := sub.validate(); err != nil {
+			return fmt.Errorf("all[%d]: %w", i, err)
+		}
+	}
+	for i, sub := range c.Any {
+		if err := sub.validate(); err != nil {
+			return fmt.Errorf("any[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// describe summarizes the clauses set on c, used in negation skip reasons.
+func (c Condition) describe() string {
+	var parts []string
+	add := func(name string, values StringOrSlice) {
+		if len(values) > 0 {
+			parts = append(parts, name+" "+sliceStr(values))
+		}
+	}
+	add("os", c.OS)
+	add("profile", c.Profile)
+	add("hostname", c.Hostname)
+	add("arch", c.Arch)
+	add("env", c.Env)
+	add("exists", c.Exists)
+	add("command", c.Command)
+	if c.Not != nil {
+		parts = append(parts, "not("+c.Not.describe()+")")
+	}
+	if len(c.All) > 0 {
+		parts = append(parts, fmt.Sprintf("all(%d conditions)", len(c.All)))
+	}
+	if len(c.Any) > 0 {
+		parts = append(parts, fmt.Sprintf("any(%d conditions)", len(c.Any)))
+	}
+	if len(parts) == 0 {
+		return "(empty condition)"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func matchesAnyGlob(patterns StringOrSlice, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func envMatches(spec string) (bool, string) {
+	name, want, hasValue := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	got, set := os.LookupEnv(name)
+	if !hasValue {
+		if !set || got == "" {
+			return false, "env: " + name + " not set"
+		}
+		return true, ""
+	}
+	if !set {
+		return false, "env: " + name + " not set (want " + want + ")"
+	}
+	if got != want {
+		return false, "env: " + name + "=" + got + ", want " + want
+	}
+	return true, ""
+}
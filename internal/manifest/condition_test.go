@@ -0,0 +1,138 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/profile"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".config", "work"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	t.Setenv("DOTCTL_TEST_WORK", "1")
+	t.Setenv("DOTCTL_TEST_EMPTY", "")
+
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(name string) (string, error) {
+		if name == "brew" {
+			return "/opt/homebrew/bin/brew", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	ctx := profile.Context{OS: "darwin", Arch: "arm64", Hostname: "work-mbp.local", Profile: "work", Home: home}
+
+	tests := []struct {
+		name   string
+		cond   Condition
+		want   bool
+		reason string
+	}{
+		{"empty", Condition{}, true, ""},
+		{"hostname glob", Condition{Hostname: StringOrSlice{"work-*"}}, true, ""},
+		{"hostname mismatch", Condition{Hostname: StringOrSlice{"home-*"}}, false, "hostname: work-mbp.local does not match [home-*]"},
+		{"arch mismatch", Condition{Arch: StringOrSlice{"amd64"}}, false, "arch: arm64 not in [amd64]"},
+		{"env set", Condition{Env: StringOrSlice{"DOTCTL_TEST_WORK"}}, true, ""},
+		{"env empty", Condition{Env: StringOrSlice{"DOTCTL_TEST_EMPTY"}}, false, "env: DOTCTL_TEST_EMPTY not set"},
+		{"env equals", Condition{Env: StringOrSlice{"DOTCTL_TEST_WORK=1"}}, true, ""},
+		{"env differs", Condition{Env: StringOrSlice{"DOTCTL_TEST_WORK=0"}}, false, "env: DOTCTL_TEST_WORK=1, want 0"},
+		{"exists", Condition{Exists: StringOrSlice{"~/.config/work"}}, true, ""},
+		{"exists missing", Condition{Exists: StringOrSlice{"~/.config/home"}}, false, "exists: ~/.config/home not found"},
+		{"command", Condition{Command: StringOrSlice{"brew"}}, true, ""},
+		{"command missing", Condition{Command: StringOrSlice{"apt"}}, false, "command: apt not found on PATH"},
+		{"not", Condition{Not: &Condition{OS: StringOrSlice{"linux"}}}, true, ""},
+		{"not matched", Condition{Not: &Condition{OS: StringOrSlice{"darwin"}}}, false, "not: os [darwin] matched"},
+		{
+			"any",
+			Condition{Any: []Condition{{Command: StringOrSlice{"apt"}}, {Command: StringOrSlice{"brew"}}}},
+			true, "",
+		},
+		{
+			"any none",
+			Condition{Any: []Condition{{Command: StringOrSlice{"apt"}}, {Arch: StringOrSlice{"amd64"}}}},
+			false, "any: no alternative matched (command: apt not found on PATH; arch: arm64 not in [amd64])",
+		},
+		{
+			"all",
+			Condition{All: []Condition{{OS: StringOrSlice{"darwin"}}, {Profile: StringOrSlice{"home"}}}},
+			false, "all[1]: profile: work not in [home]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tt.cond.Evaluate(ctx)
+			if got != tt.want {
+				t.Fatalf("Evaluate = %v (%s), want %v", got, reason, tt.want)
+			}
+			if reason != tt.reason {
+				t.Fatalf("reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseConditionsFromYAML(t *testing.T) {
+	m, err := Parse([]byte(`
+files:
+  - source: configs/work/.npmrc
+    target: ~/.npmrc
+    when:
+      hostname: "work-*"
+      env: [CORP_VPN, "TEAM=platform"]
+      not:
+        arch: amd64
+      any:
+        - command: brew
+        - exists: /etc/apt
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	when := m.Files[0].When
+	if len(when.Hostname) != 1 || len(when.Env) != 2 || when.Not == nil || len(when.Any) != 2 {
+		t.Fatalf("parsed condition = %+v", when)
+	}
+	if when.Any[1].Exists[0] != "/etc/apt" {
+		t.Fatalf("any[1].exists = %v", when.Any[1].Exists)
+	}
+}
+
+func TestParseRejectsInvalidConditions(t *testing.T) {
+	cases := map[string]string{
+		"bad glob": `
+files:
+  - source: a
+    target: ~/.a
+    when:
+      hostname: "work-["
+`,
+		"empty env name": `
+hooks:
+  post_sync:
+    - command: echo hi
+      when:
+        any:
+          - env: "=value"
+`,
+	}
+
+	for name, data := range cases {
+		_, err := Parse([]byte(data))
+		if err == nil {
+			t.Errorf("%s: expected validation error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "when.") {
+			t.Errorf("%s: error should name the clause, got: %v", name, err)
+		}
+	}
+}
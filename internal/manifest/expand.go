@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// expandedPath is one file produced by expanding a directory or glob entry.
+type expandedPath struct {
+	source string // repo-relative, slash-separated
+	target string // absolute
+}
+
+// expandEntry turns a directory entry with expand: true or a glob source into
+// per-file source/target pairs.
+//
+// For a glob, each match is placed inside target under its base name; matched
+// directories are linked as a whole unless expand is also set. For an expanded
+// directory, each file keeps its path relative to the source directory.
+func expandEntry(f FileEntry, source, target, repoRoot string) ([]expandedPath, error) {
+	if !hasGlobMeta(source) {
+		return expandDir(source, target, repoRoot)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(repoRoot, filepath.FromSlash(source)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source pattern %q: %w", source, err)
+	}
+	sort.Strings(matches)
+
+	var result []expandedPath
+	for _, match := range matches {
+		rel, err := filepath.Rel(repoRoot, match)
+		if err != nil {
+			return nil, err
+		}
+		relSource := filepath.ToSlash(rel)
+		matchTarget := filepath.Join(target, filepath.Base(match))
+
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("reading source %q: %w", relSource, err)
+		}
+		if info.IsDir() && f.Expand {
+			files, err := expandDir(relSource, matchTarget, repoRoot)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, files...)
+			continue
+		}
+		result = append(result, expandedPath{source: relSource, target: matchTarget})
+	}
+	return result, nil
+}
+
+// expandDir walks the source directory and maps every file (or symlink) to the
+// same relative path under target. A missing directory yields no entries.
+func expandDir(source, target, repoRoot string) ([]expandedPath, error) {
+	root := filepath.Join(repoRoot, filepath.FromSlash(source))
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading source %q: %w", source, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("expand=true requires source %q to be a directory", source)
+	}
+
+	var result []expandedPath
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		result = append(result, expandedPath{
+			source: path.Join(source, filepath.ToSlash(rel)),
+			target: filepath.Join(target, rel),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("expanding source %q: %w", source, err)
+	}
+	return result, nil
+}
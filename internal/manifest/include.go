@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeLoader resolves include directives relative to the repo root
+// (the directory containing the top-level manifest).
+type includeLoader struct {
+	root   string
+	loaded map[string]bool
+}
+
+// load parses the manifest at absPath and merges every included manifest into it.
+// stack holds the chain of files currently being loaded, for cycle detection.
+func (l *includeLoader) load(absPath string, stack []string) (*Manifest, error) {
+	rel := l.relative(absPath)
+	for _, p := range stack {
+		if p == absPath {
+			chain := make([]string, 0, len(stack)+1)
+			for _, s := range stack {
+				chain = append(chain, l.relative(s))
+			}
+			chain = append(chain, rel)
+			return nil, fmt.Errorf("include cycle detected: %s", strings.Join(chain, " -> "))
+		}
+	}
+	l.loaded[absPath] = true
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("reading manifest: %w", err)
+		}
+		return nil, fmt.Errorf("reading included manifest %s: %w", rel, err)
+	}
+
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("parsing manifest YAML (see line/column in error): %w", err)
+		}
+		return nil, fmt.Errorf("parsing included manifest %s (see line/column in error): %w", rel, err)
+	}
+
+	for i := range m.Files {
+		m.Files[i].origin = rel
+		m.Files[i].index = i
+	}
+
+	stack = append(stack, absPath)
+	varOrigins := make(map[string]string)
+	for _, pattern := range m.Include {
+		matches, err := l.expand(pattern, rel)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if l.loaded[match] && !containsPath(stack, match) {
+				// Already merged through another include (diamond); skip it.
+				continue
+			}
+			child, err := l.load(match, stack)
+			if err != nil {
+				return nil, err
+			}
+			if err := mergeIncluded(&m, child, l.relative(match), varOrigins); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &m, nil
+}
+
+// expand resolves one include entry into absolute file paths, sorted for
+// deterministic merge order. Literal paths must exist; globs may match nothing.
+func (l *includeLoader) expand(pattern, from string) ([]string, error) {
+	normalized, err := normalizeRepoPath("include", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", from, err)
+	}
+
+	full := filepath.Join(l.root, filepath.FromSlash(normalized))
+	if !hasGlobMeta(normalized) {
+		info, err := os.Stat(full)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%s: included manifest %q not found", from, pattern)
+			}
+			return nil, fmt.Errorf("%s: reading included manifest %q: %w", from, pattern, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s: include %q is a directory (use a glob like %s/*.yaml)", from, pattern, normalized)
+		}
+		return []string{full}, nil
+	}
+
+	matches, err := filepath.Glob(full)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid include pattern %q: %w", from, pattern, err)
+	}
+
+	files := make([]string, 0, len(matches))
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading included manifest %q: %w", from, l.relative(match), err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, match)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (l *includeLoader) relative(absPath string) string {
+	rel, err := filepath.Rel(l.root, absPath)
+	if err != nil {
+		return absPath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// mergeIncluded appends the files, ignore patterns and hooks of child to parent.
+// Parent vars take precedence; conflicting values between included files are errors.
+func mergeIncluded(parent, child *Manifest, childPath string, varOrigins map[string]string) error {
+	for k, v := range child.Vars {
+		if existing, ok := parent.Vars[k]; ok {
+			if prev, fromInclude := varOrigins[k]; fromInclude && existing != v {
+				return fmt.Errorf("var %q defined with different values in %s and %s", k, prev, childPath)
+			}
+			continue
+		}
+		if parent.Vars == nil {
+			parent.Vars = make(map[string]string)
+		}
+		parent.Vars[k] = v
+		varOrigins[k] = childPath
+	}
+
+	parent.Files = append(parent.Files, child.Files...)
+
+	for _, pattern := range child.Ignore {
+		if !containsString(parent.Ignore, pattern) {
+			parent.Ignore = append(parent.Ignore, pattern)
+		}
+	}
+
+	parent.Hooks.PreSync = append(parent.Hooks.PreSync, child.Hooks.PreSync...)
+	parent.Hooks.PostSync = append(parent.Hooks.PostSync, child.Hooks.PostSync...)
+	parent.Hooks.Bootstrap = append(parent.Hooks.Bootstrap, child.Hooks.Bootstrap...)
+	parent.Packages = append(parent.Packages, child.Packages...)
+	return nil
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+func containsPath(paths []string, p string) bool {
+	for _, candidate := range paths {
+		if candidate == p {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+func TestLoadMergesIncludes(t *testing.T) {
+	root := writeManifestFiles(t, map[string]string{
+		"manifest.yaml": `
+version: 1
+include:
+  - manifests/*.yaml
+  - extra/git.yaml
+vars:
+  config_home: "~/.config"
+files:
+  - source: configs/zsh/.zshrc
+    target: ~/.zshrc
+hooks:
+  post_sync:
+    - command: echo root
+`,
+		"manifests/nvim.yaml": `
+vars:
+  nvim_dir: "~/.config/nvim"
+  config_home: "~/ignored"
+files:
+  - source: configs/nvim
+    target: "{{ .nvim_dir }}"
+ignore:
+  - "*.log"
+`,
+		"manifests/tmux.yaml": `
+files:
+  - source: configs/tmux/tmux.conf
+    target: ~/.tmux.conf
+hooks:
+  post_sync:
+    - command: tmux source-file ~/.tmux.conf
+`,
+		"extra/git.yaml": `
+files:
+  - source: configs/git/config
+    target: ~/.gitconfig
+`,
+	})
+
+	m, err := Load(filepath.Join(root, "manifest.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	gotSources := make([]string, 0, len(m.Files))
+	for _, f := range m.Files {
+		gotSources = append(gotSources, f.Source)
+	}
+	want := "configs/zsh/.zshrc,configs/nvim,configs/tmux/tmux.conf,configs/git/config"
+	if strings.Join(gotSources, ",") != want {
+		t.Fatalf("sources = %v, want %s", gotSources, want)
+	}
+	if m.Vars["config_home"] != "~/.config" {
+		t.Errorf("config_home = %q, parent var should win", m.Vars["config_home"])
+	}
+	if m.Vars["nvim_dir"] != "~/.config/nvim" {
+		t.Errorf("nvim_dir = %q, want included var", m.Vars["nvim_dir"])
+	}
+	if len(m.Ignore) != 1 || m.Ignore[0] != "*.log" {
+		t.Errorf("ignore = %v, want [*.log]", m.Ignore)
+	}
+	if len(m.Hooks.PostSync) != 2 || m.Hooks.PostSync[0].Command != "echo root" {
+		t.Errorf("post_sync hooks = %+v, want root hook first then included hook", m.Hooks.PostSync)
+	}
+}
+
+func TestLoadIncludeDuplicateTargetNamesBothFiles(t *testing.T) {
+	root := writeManifestFiles(t, map[string]string{
+		"manifest.yaml": `
+include: [manifests/a.yaml]
+files:
+  - source: configs/zsh/.zshrc
+    target: ~/.zshrc
+`,
+		"manifests/a.yaml": `
+files:
+  - source: configs/zsh/zshrc-alt
+    target: ~/.zshrc
+`,
+	})
+
+	_, err := Load(filepath.Join(root, "manifest.yaml"))
+	if err == nil {
+		t.Fatal("expected duplicate target error")
+	}
+	if !strings.Contains(err.Error(), "manifests/a.yaml") || !strings.Contains(err.Error(), "manifest.yaml files[0]") {
+		t.Fatalf("error should name both files, got: %v", err)
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	root := writeManifestFiles(t, map[string]string{
+		"manifest.yaml":    "include: [manifests/a.yaml]\n",
+		"manifests/a.yaml": "include: [manifests/b.yaml]\n",
+		"manifests/b.yaml": "include: [manifests/a.yaml]\n",
+	})
+
+	_, err := Load(filepath.Join(root, "manifest.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got: %v", err)
+	}
+}
+
+func TestLoadIncludeRejectsEscapingPaths(t *testing.T) {
+	for _, include := range []string{"../other.yaml", "/etc/dotctl.yaml", "manifests/../../x.yaml"} {
+		root := writeManifestFiles(t, map[string]string{
+			"manifest.yaml": "include: [\"" + include + "\"]\n",
+		})
+
+		_, err := Load(filepath.Join(root, "manifest.yaml"))
+		if err == nil {
+			t.Errorf("include %q: expected error", include)
+		}
+	}
+}
+
+func TestLoadIncludeMissingLiteralPath(t *testing.T) {
+	root := writeManifestFiles(t, map[string]string{
+		"manifest.yaml": "include: [manifests/missing.yaml, optional/*.yaml]\n",
+	})
+
+	_, err := Load(filepath.Join(root, "manifest.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "manifests/missing.yaml") {
+		t.Fatalf("expected missing include error, got: %v", err)
+	}
+}
+
+func TestLoadIncludeConflictingVars(t *testing.T) {
+	root := writeManifestFiles(t, map[string]string{
+		"manifest.yaml":    "include: [manifests/*.yaml]\n",
+		"manifests/a.yaml": "vars:\n  editor: nvim\n",
+		"manifests/b.yaml": "vars:\n  editor: vim\n",
+	})
+
+	_, err := Load(filepath.Join(root, "manifest.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "manifests/a.yaml") || !strings.Contains(err.Error(), "manifests/b.yaml") {
+		t.Fatalf("expected var conflict error naming both files, got: %v", err)
+	}
+}
+
+func TestParseRejectsInclude(t *testing.T) {
+	if _, err := Parse([]byte("include: [manifests/a.yaml]\n")); err == nil {
+		t.Fatal("expected error for include in Parse")
+	}
+}
@@ -1,31 +1,53 @@
 package manifest
 
 import (
+	"bytes"
 	"fmt"
-	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"text/template"
 
 	"gopkg.in/yaml.v3"
 )
 
-// Load reads and parses a manifest.yaml file.
+// Load reads and parses a manifest.yaml file, merging any manifests listed
+// under include. Include paths are relative to the directory containing path.
 func Load(path string) (*Manifest, error) {
-	data, err := os.ReadFile(path)
+	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading manifest: %w", err)
 	}
 
-	return Parse(data)
+	loader := &includeLoader{
+		root:   filepath.Dir(absPath),
+		loaded: make(map[string]bool),
+	}
+	m, err := loader.load(absPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
 
 // Parse parses manifest YAML bytes.
+// Manifests using include must be loaded from disk with Load.
 func Parse(data []byte) (*Manifest, error) {
 	var m Manifest
 	if err := yaml.Unmarshal(data, &m); err != nil {
 		return nil, fmt.Errorf("parsing manifest YAML (see line/column in error): %w", err)
 	}
+	if len(m.Include) > 0 {
+		return nil, fmt.Errorf("include requires loading the manifest from a file")
+	}
+	for i := range m.Files {
+		m.Files[i].index = i
+	}
 
 	if err := validate(&m); err != nil {
 		return nil, err
@@ -36,53 +58,157 @@ func Parse(data []byte) (*Manifest, error) {
 
 // validate checks the manifest for basic errors.
 func validate(m *Manifest) error {
-	seen := make(map[string]bool)
+	seen := make(map[string]FileEntry)
 	for i := range m.Files {
+		label := m.Files[i].label()
 		source, err := normalizeSourcePath(m.Files[i].Source)
 		if err != nil {
-			return fmt.Errorf("files[%d]: %w", i, err)
+			return fmt.Errorf("%s: %w", label, err)
 		}
 		m.Files[i].Source = source
 
 		f := m.Files[i]
 		if f.Target == "" {
-			return fmt.Errorf("files[%d]: target is required", i)
+			return fmt.Errorf("%s: target is required", label)
 		}
 		mode := f.LinkMode()
 		if mode != "symlink" && mode != "copy" {
-			return fmt.Errorf("files[%d]: invalid mode %q (must be 'symlink' or 'copy')", i, mode)
+			return fmt.Errorf("%s: invalid mode %q (must be 'symlink' or 'copy')", label, mode)
 		}
-		if f.Decrypt {
+		if f.Decrypt.Enabled() {
 			if mode != "copy" {
-				return fmt.Errorf("files[%d]: decrypt=true requires mode=copy", i)
+				return fmt.Errorf("%s: decrypt=true requires mode=copy", label)
 			}
 			if !hasEncryptedSuffix(f.Source) {
-				return fmt.Errorf("files[%d]: decrypt=true requires encrypted source name containing '.enc.'", i)
+				return fmt.Errorf("%s: decrypt=true requires encrypted source name containing '.enc.'", label)
+			}
+		}
+		if f.Decrypt.Enabled() && (f.Expand || hasGlobMeta(f.Source)) {
+			return fmt.Errorf("%s: decrypt=true is not supported with expand or glob sources", label)
+		}
+		if f.Template && mode != "copy" {
+			return fmt.Errorf("%s: template=true requires mode=copy", label)
+		}
+		if f.Perm != 0 && mode != "copy" {
+			return fmt.Errorf("%s: perm requires mode=copy (use dir_perm for symlink targets)", label)
+		}
+		switch f.CapturePolicy() {
+		case CaptureAsk, CaptureAlways, CaptureNever:
+		default:
+			return fmt.Errorf("%s: invalid capture %q (must be 'ask', 'always' or 'never')", label, f.Capture)
+		}
+		if f.Capture != "" && mode != "copy" {
+			return fmt.Errorf("%s: capture requires mode=copy", label)
+		}
+		for j, command := range f.OnChange {
+			if strings.TrimSpace(command) == "" {
+				return fmt.Errorf("%s: on_change[%d]: command is required", label, j)
+			}
+		}
+		if err := f.When.validate(); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		if prev, ok := seen[f.Target]; ok {
+			return fmt.Errorf("%s: duplicate target %q (already defined in %s)", label, f.Target, prev.label())
+		}
+		seen[f.Target] = f
+	}
+
+	for i, set := range m.Packages {
+		label := fmt.Sprintf("packages[%d]", i)
+		if !containsString(PackageManagers, set.Manager) {
+			return fmt.Errorf("%s: invalid manager %q (must be one of %s)", label, set.Manager, strings.Join(PackageManagers, ", "))
+		}
+		if len(set.Names) == 0 {
+			return fmt.Errorf("%s: names is required", label)
+		}
+		for j, name := range set.Names {
+			if strings.TrimSpace(name) == "" || strings.HasPrefix(name, "-") {
+				return fmt.Errorf("%s: invalid package name %q at names[%d]", label, name, j)
 			}
 		}
-		if seen[f.Target] {
-			return fmt.Errorf("files[%d]: duplicate target %q", i, f.Target)
+		if err := set.When.validate(); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+	}
+
+	phases := []struct {
+		name  string
+		hooks []Hook
+	}{
+		{"pre_sync", m.Hooks.PreSync},
+		{"post_sync", m.Hooks.PostSync},
+		{"bootstrap", m.Hooks.Bootstrap},
+	}
+	for _, phase := range phases {
+		for i, h := range phase.hooks {
+			label := fmt.Sprintf("hooks.%s[%d]", phase.name, i)
+			if strings.TrimSpace(h.Command) == "" {
+				return fmt.Errorf("%s: command is required", label)
+			}
+			switch h.FailurePolicy() {
+			case OnFailureAbort, OnFailureWarn, OnFailureIgnore:
+			default:
+				return fmt.Errorf("%s: invalid on_failure %q (must be 'abort', 'warn' or 'ignore')", label, h.OnFailure)
+			}
+			switch h.RunPolicy() {
+			case RunAlways, RunOnce, RunOnChange:
+			default:
+				return fmt.Errorf("%s: invalid run %q (must be 'always', 'once' or 'onchange')", label, h.Run)
+			}
+			if len(h.Watch) > 0 && h.RunPolicy() != RunOnChange {
+				return fmt.Errorf("%s: watch requires run: onchange", label)
+			}
+			for j, w := range h.Watch {
+				normalized, err := normalizeRepoPath("watch", w)
+				if err != nil {
+					return fmt.Errorf("%s: %w", label, err)
+				}
+				h.Watch[j] = normalized
+			}
+			for name := range h.Env {
+				if name == "" || strings.ContainsAny(name, "= ") {
+					return fmt.Errorf("%s: invalid env variable name %q", label, name)
+				}
+			}
+			if err := h.When.validate(); err != nil {
+				return fmt.Errorf("%s: %w", label, err)
+			}
 		}
-		seen[f.Target] = true
 	}
 	return nil
 }
 
+// label identifies the entry in error messages, including the defining file
+// when the manifest was loaded from disk.
+func (f FileEntry) label() string {
+	if f.origin == "" {
+		return fmt.Sprintf("files[%d]", f.index)
+	}
+	return fmt.Sprintf("%s files[%d]", f.origin, f.index)
+}
+
 func normalizeSourcePath(source string) (string, error) {
-	trimmed := strings.TrimSpace(strings.ReplaceAll(source, "\\", "/"))
+	return normalizeRepoPath("source", source)
+}
+
+// normalizeRepoPath cleans a repo-relative path and rejects absolute paths or
+// paths escaping the repo root. field names the value in error messages.
+func normalizeRepoPath(field, value string) (string, error) {
+	trimmed := strings.TrimSpace(strings.ReplaceAll(value, "\\", "/"))
 	if trimmed == "" {
-		return "", fmt.Errorf("source is required")
+		return "", fmt.Errorf("%s is required", field)
 	}
 
 	normalized := path.Clean(trimmed)
 	if normalized == "." {
-		return "", fmt.Errorf("source is required")
+		return "", fmt.Errorf("%s is required", field)
 	}
 	if path.IsAbs(normalized) || isWindowsAbsolutePath(normalized) {
-		return "", fmt.Errorf("source %q must be relative to repo root", source)
+		return "", fmt.Errorf("%s %q must be relative to repo root", field, value)
 	}
 	if normalized == ".." || strings.HasPrefix(normalized, "../") {
-		return "", fmt.Errorf("source %q escapes repo root", source)
+		return "", fmt.Errorf("%s %q escapes repo root", field, value)
 	}
 
 	return normalized, nil
@@ -125,6 +251,22 @@ func ResolveTarget(target string, vars map[string]string) (string, error) {
 	return expandHome(buf.String(), vars["home"]), nil
 }
 
+// RenderContent renders file contents through text/template using the merged vars.
+// name is used in error messages to identify the source being rendered.
+func RenderContent(name string, data []byte, vars map[string]string) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %q: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("rendering template %q: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 // expandHome replaces a leading ~ with the home directory.
 func expandHome(path, home string) string {
 	if strings.HasPrefix(path, "~/") {
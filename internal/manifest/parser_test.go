@@ -1,7 +1,9 @@
 package manifest
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseValid(t *testing.T) {
@@ -193,6 +195,90 @@ files:
 	}
 }
 
+func TestParseDecryptBackend(t *testing.T) {
+	data := []byte(`
+version: 1
+files:
+  - source: a.enc.yaml
+    target: ~/.a
+    mode: copy
+    decrypt: true
+  - source: b.enc.yaml
+    target: ~/.b
+    mode: copy
+    decrypt: sops
+  - source: c.enc.env
+    target: ~/.c
+    mode: copy
+    decrypt: age
+  - source: d
+    target: ~/.d
+    decrypt: false
+`)
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Decrypt{DecryptAuto, DecryptSOPS, DecryptAge, ""}
+	for i, w := range want {
+		if m.Files[i].Decrypt != w {
+			t.Errorf("files[%d].Decrypt = %q, want %q", i, m.Files[i].Decrypt, w)
+		}
+	}
+	if m.Files[3].Decrypt.Enabled() {
+		t.Error("decrypt: false should not be enabled")
+	}
+
+	quoted, err := Parse([]byte("version: 1\nfiles:\n  - source: a.enc.yaml\n    target: ~/.a\n    mode: copy\n    decrypt: \"true\"\n  - source: b\n    target: ~/.b\n    decrypt: 'false'\n"))
+	if err != nil {
+		t.Fatalf("Parse quoted booleans: %v", err)
+	}
+	if quoted.Files[0].Decrypt != DecryptAuto || quoted.Files[1].Decrypt.Enabled() {
+		t.Fatalf("quoted decrypt = %q, %q, want %q and disabled", quoted.Files[0].Decrypt, quoted.Files[1].Decrypt, DecryptAuto)
+	}
+
+	_, err = Parse([]byte("version: 1\nfiles:\n  - source: a.enc.yaml\n    target: ~/.a\n    mode: copy\n    decrypt: gpg\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid decrypt") {
+		t.Fatalf("expected invalid decrypt error, got %v", err)
+	}
+}
+
+func TestParseTemplateRequiresCopyMode(t *testing.T) {
+	data := []byte(`
+version: 1
+files:
+  - source: configs/git/config
+    target: ~/.gitconfig
+    template: true
+`)
+
+	_, err := Parse(data)
+	if err == nil {
+		t.Fatal("expected error for template=true with symlink mode")
+	}
+}
+
+func TestRenderContent(t *testing.T) {
+	vars := map[string]string{
+		"profile":  "laptop",
+		"hostname": "mbp",
+	}
+
+	got, err := RenderContent("gitconfig", []byte("[user]\n  email = {{ if eq .profile \"laptop\" }}me@home{{ else }}me@work{{ end }}\n# {{ .hostname }}\n"), vars)
+	if err != nil {
+		t.Fatalf("RenderContent: %v", err)
+	}
+	want := "[user]\n  email = me@home\n# mbp\n"
+	if string(got) != want {
+		t.Errorf("RenderContent = %q, want %q", string(got), want)
+	}
+
+	if _, err := RenderContent("gitconfig", []byte("{{ .missing }}"), vars); err == nil {
+		t.Fatal("expected error for missing template variable")
+	}
+}
+
 func TestResolveTarget(t *testing.T) {
 	vars := map[string]string{
 		"home":        "/Users/test",
@@ -278,3 +364,111 @@ func TestParseInvalidYAML(t *testing.T) {
 		t.Fatal("expected error for invalid YAML")
 	}
 }
+
+func TestParsePermissions(t *testing.T) {
+	m, err := Parse([]byte(`
+files:
+  - source: configs/ssh/config
+    target: ~/.ssh/config
+    mode: copy
+    perm: 0600
+    dir_perm: "0o700"
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if m.Files[0].Perm != 0o600 || m.Files[0].DirPerm != 0o700 {
+		t.Fatalf("perm = %s, dir_perm = %s", m.Files[0].Perm, m.Files[0].DirPerm)
+	}
+
+	invalid := []string{
+		"files:\n  - source: a\n    target: ~/.a\n    perm: \"0600\"\n",             // symlink mode
+		"files:\n  - source: a\n    target: ~/.a\n    mode: copy\n    perm: 0999\n", // not octal
+		"files:\n  - source: a\n    target: ~/.a\n    mode: copy\n    perm: 1777\n", // out of range
+		"files:\n  - source: a\n    target: ~/.a\n    capture: always\n",            // symlink mode
+		"files:\n  - source: a\n    target: ~/.a\n    mode: copy\n    capture: yes\n",
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error for manifest:\n%s", data)
+		}
+	}
+}
+
+func TestParseHookOptions(t *testing.T) {
+	m, err := Parse([]byte(`
+hooks:
+  post_sync:
+    - command: make reload
+      timeout: 90s
+      env:
+        RELOAD: "1"
+      cwd: ~/src/tools
+      shell: bash -eo pipefail
+      on_failure: warn
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	h := m.Hooks.PostSync[0]
+	if time.Duration(h.Timeout) != 90*time.Second {
+		t.Fatalf("timeout = %s, want 1m30s", h.Timeout)
+	}
+	if h.Env["RELOAD"] != "1" || h.FailurePolicy() != OnFailureWarn {
+		t.Fatalf("env = %v, on_failure = %q", h.Env, h.FailurePolicy())
+	}
+	if got := h.WorkDir("/repo", "/home/u"); got != "/home/u/src/tools" {
+		t.Fatalf("WorkDir = %q, want /home/u/src/tools", got)
+	}
+	if got := strings.Join(h.ShellArgs(), " "); got != "bash -eo pipefail -c make reload" {
+		t.Fatalf("ShellArgs = %q", got)
+	}
+	if got := (Hook{Command: "x", Cwd: "scripts"}).WorkDir("/repo", "/home/u"); got != "/repo/scripts" {
+		t.Fatalf("relative WorkDir = %q, want /repo/scripts", got)
+	}
+
+	invalid := []string{
+		"hooks:\n  pre_sync:\n    - command: x\n      on_failure: retry\n",
+		"hooks:\n  pre_sync:\n    - command: x\n      timeout: soon\n",
+		"hooks:\n  pre_sync:\n    - command: x\n      timeout: -5s\n",
+		"hooks:\n  pre_sync:\n    - description: no command\n",
+		"hooks:\n  bootstrap:\n    - command: x\n      run: twice\n",
+		"hooks:\n  bootstrap:\n    - command: x\n      run: once\n      watch: Brewfile\n",
+		"hooks:\n  bootstrap:\n    - command: x\n      run: onchange\n      watch: ../outside\n",
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error for manifest:\n%s", data)
+		}
+	}
+}
+
+func TestParsePackages(t *testing.T) {
+	m, err := Parse([]byte(`
+packages:
+  - manager: brew
+    names: [git, ripgrep]
+    when:
+      os: darwin
+  - manager: go
+    names: golang.org/x/tools/gopls@latest
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(m.Packages) != 2 || len(m.Packages[0].Names) != 2 || m.Packages[1].Names[0] != "golang.org/x/tools/gopls@latest" {
+		t.Fatalf("packages = %+v", m.Packages)
+	}
+
+	invalid := []string{
+		"packages:\n  - manager: snap\n    names: [x]\n",
+		"packages:\n  - manager: brew\n",
+		"packages:\n  - manager: apt\n    names: [\"--allow-unauthenticated\"]\n",
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error for manifest:\n%s", data)
+		}
+	}
+}
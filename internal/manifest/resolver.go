@@ -1,27 +1,41 @@
 package manifest
 
 import (
+	"fmt"
+	"io/fs"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/felipe-veas/dotctl/internal/logging"
 	"github.com/felipe-veas/dotctl/internal/profile"
 )
 
 // Action represents a resolved file action to execute.
 type Action struct {
-	Source     string // relative path in repo
-	Target     string // absolute resolved target path
-	Mode       string // "symlink" or "copy"
-	Decrypt    bool   // whether source must be decrypted before copy
-	Backup     bool   // whether to backup existing file
-	SkipReason string // non-empty if skipped (for dry-run reporting)
+	Source      string      // relative path in repo
+	Target      string      // absolute resolved target path
+	Mode        string      // "symlink" or "copy"
+	Decrypt     bool        // whether source must be decrypted before copy
+	DecryptWith string      // decrypt backend: "auto", "age" or "sops"
+	Template    bool        // whether source contents must be rendered before copy
+	Backup      bool        // whether to backup existing file
+	Perm        fs.FileMode // enforced mode for copied files (0 = keep source mode)
+	DirPerm     fs.FileMode // enforced mode for the target's parent directory (0 = unchanged)
+	SkipReason  string      // non-empty if skipped (for dry-run reporting)
+	OnChange    []string    // commands to run when the target changes
+	Capture     string      // capture policy for copy mode: ask, always or never
+
+	// Vars is the merged template context, set only for template actions.
+	Vars map[string]string
 }
 
 // Resolve filters manifest entries by the current context and resolves targets.
+// Entries with expand: true or a glob source produce one action per file.
 // It returns a list of actions to apply and a list of skipped entries (for reporting).
 func Resolve(m *Manifest, ctx profile.Context, repoRoot string) (actions []Action, skipped []Action, err error) {
 	vars := MergeVars(m.Vars, ctx.Vars())
+	expandedTargets := make(map[string]string)
 
 	for _, f := range m.Files {
 		source, sourceErr := normalizeSourcePath(f.Source)
@@ -38,51 +52,90 @@ func Resolve(m *Manifest, ctx profile.Context, repoRoot string) (actions []Actio
 			continue
 		}
 
-		// Evaluate conditions
-		if !f.When.OS.Matches(ctx.OS) {
+		if ok, reason := f.When.Evaluate(ctx); !ok {
 			skipped = append(skipped, Action{
 				Source:     source,
 				Target:     f.Target,
-				SkipReason: "os: " + ctx.OS + " not in " + sliceStr(f.When.OS),
+				SkipReason: reason,
 			})
 			continue
 		}
 
-		if !f.When.Profile.Matches(ctx.Profile) {
+		// Resolve target path
+		resolvedTarget, resolveErr := ResolveTarget(f.Target, vars)
+		if resolveErr != nil {
+			return nil, nil, resolveErr
+		}
+
+		if !f.Expand && !hasGlobMeta(source) {
+			if prev, ok := expandedTargets[resolvedTarget]; ok {
+				return nil, nil, fmt.Errorf("%s: target %q for %s is also produced by %s", f.label(), resolvedTarget, source, prev)
+			}
+			expandedTargets[resolvedTarget] = source
+			actions = append(actions, newAction(f, source, resolvedTarget, vars))
+			continue
+		}
+
+		expanded, expandErr := expandEntry(f, source, resolvedTarget, repoRoot)
+		if expandErr != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.label(), expandErr)
+		}
+		if len(expanded) == 0 {
 			skipped = append(skipped, Action{
 				Source:     source,
 				Target:     f.Target,
-				SkipReason: "profile: " + ctx.Profile + " not in " + sliceStr(f.When.Profile),
+				SkipReason: "no files matched " + source,
 			})
 			continue
 		}
-
-		// Resolve target path
-		resolvedTarget, resolveErr := ResolveTarget(f.Target, vars)
-		if resolveErr != nil {
-			return nil, nil, resolveErr
+		for _, e := range expanded {
+			if pattern, ignored := matchedIgnorePattern(e.source, m.Ignore); ignored {
+				skipped = append(skipped, Action{
+					Source:     e.source,
+					Target:     e.target,
+					SkipReason: "ignored by pattern " + pattern,
+				})
+				continue
+			}
+			if prev, ok := expandedTargets[e.target]; ok {
+				return nil, nil, fmt.Errorf("%s: target %q for %s is also produced by %s", f.label(), e.target, e.source, prev)
+			}
+			expandedTargets[e.target] = e.source
+			actions = append(actions, newAction(f, e.source, e.target, vars))
 		}
-
-		actions = append(actions, Action{
-			Source:  source,
-			Target:  resolvedTarget,
-			Mode:    f.LinkMode(),
-			Decrypt: f.Decrypt,
-			Backup:  f.ShouldBackup(),
-		})
 	}
 
 	return actions, skipped, nil
 }
 
+func newAction(f FileEntry, source, target string, vars map[string]string) Action {
+	action := Action{
+		Source:   source,
+		Target:   target,
+		Mode:     f.LinkMode(),
+		Decrypt:  f.Decrypt.Enabled(),
+		Template: f.Template,
+		Backup:   f.ShouldBackup(),
+		Perm:     fs.FileMode(f.Perm),
+		DirPerm:  fs.FileMode(f.DirPerm),
+		OnChange: f.OnChange,
+		Capture:  f.CapturePolicy(),
+	}
+	if f.Decrypt.Enabled() {
+		action.DecryptWith = string(f.Decrypt)
+	}
+	if f.Template {
+		action.Vars = vars
+	}
+	return action
+}
+
 // ResolveHooks filters hooks by the current context.
 func ResolveHooks(hooks []Hook, ctx profile.Context) []Hook {
 	var result []Hook
 	for _, h := range hooks {
-		if !h.When.OS.Matches(ctx.OS) {
-			continue
-		}
-		if !h.When.Profile.Matches(ctx.Profile) {
+		if ok, reason := h.When.Evaluate(ctx); !ok {
+			logging.Debug("hook skipped", "command", h.Command, "reason", reason)
 			continue
 		}
 		result = append(result, h)
@@ -1,6 +1,9 @@
 package manifest
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/felipe-veas/dotctl/internal/profile"
@@ -129,7 +132,7 @@ func TestResolveDefaultMode(t *testing.T) {
 	m := &Manifest{
 		Files: []FileEntry{
 			{Source: "a", Target: "~/.a"},
-			{Source: "b", Target: "~/.b", Mode: "copy", Decrypt: true},
+			{Source: "b", Target: "~/.b", Mode: "copy", Decrypt: DecryptAuto},
 		},
 	}
 
@@ -252,3 +255,170 @@ func TestStringOrSliceMatches(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveExpandDirectory(t *testing.T) {
+	repo := t.TempDir()
+	for _, name := range []string{"init.lua", "lua/plugins.lua", "lazy-lock.json"} {
+		p := filepath.Join(repo, "configs", "nvim", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	m := &Manifest{
+		Ignore: []string{"lazy-lock.json"},
+		Files: []FileEntry{
+			{Source: "configs/nvim", Target: "~/.config/nvim", Expand: true},
+		},
+	}
+
+	ctx := profile.Context{OS: "linux", Profile: "test", Home: "/home/test"}
+	actions, skipped, err := Resolve(m, ctx, repo)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, a := range actions {
+		got[a.Source] = a.Target
+		if a.Mode != "symlink" {
+			t.Errorf("%s mode = %q, want symlink", a.Source, a.Mode)
+		}
+	}
+	want := map[string]string{
+		"configs/nvim/init.lua":        "/home/test/.config/nvim/init.lua",
+		"configs/nvim/lua/plugins.lua": "/home/test/.config/nvim/lua/plugins.lua",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("actions = %+v, want %v", actions, want)
+	}
+	for source, target := range want {
+		if got[source] != target {
+			t.Errorf("target for %s = %q, want %q", source, got[source], target)
+		}
+	}
+	if len(skipped) != 1 || skipped[0].Source != "configs/nvim/lazy-lock.json" {
+		t.Fatalf("skipped = %+v, want lazy-lock.json ignored", skipped)
+	}
+}
+
+func TestResolveGlobSource(t *testing.T) {
+	repo := t.TempDir()
+	binDir := filepath.Join(repo, "configs", "bin")
+	if err := os.MkdirAll(filepath.Join(binDir, "lib"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"git-sync", "tmux-session"} {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	m := &Manifest{
+		Files: []FileEntry{
+			{Source: "configs/bin/*", Target: "~/.local/bin/"},
+			{Source: "configs/missing/*", Target: "~/.missing/"},
+		},
+	}
+
+	ctx := profile.Context{OS: "linux", Profile: "test", Home: "/home/test"}
+	actions, skipped, err := Resolve(m, ctx, repo)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	if len(actions) != 3 {
+		t.Fatalf("actions = %+v, want 3", actions)
+	}
+	wantTargets := []string{"/home/test/.local/bin/git-sync", "/home/test/.local/bin/lib", "/home/test/.local/bin/tmux-session"}
+	for i, a := range actions {
+		if a.Target != wantTargets[i] {
+			t.Errorf("actions[%d].Target = %q, want %q", i, a.Target, wantTargets[i])
+		}
+	}
+	if len(skipped) != 1 || skipped[0].SkipReason == "" {
+		t.Fatalf("skipped = %+v, want unmatched glob reported", skipped)
+	}
+}
+
+func TestResolveExpandedTargetCollision(t *testing.T) {
+	repo := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		p := filepath.Join(repo, dir, "config")
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(dir), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	m := &Manifest{
+		Files: []FileEntry{
+			{Source: "a", Target: "~/.app", Expand: true},
+			{Source: "b", Target: "~/.app", Expand: true},
+		},
+	}
+
+	ctx := profile.Context{OS: "linux", Profile: "test", Home: "/home/test"}
+	if _, _, err := Resolve(m, ctx, repo); err == nil {
+		t.Fatal("expected error for colliding expanded targets")
+	}
+}
+
+func TestResolveExpandedThenPlainTargetCollision(t *testing.T) {
+	repo := t.TempDir()
+	p := filepath.Join(repo, "x", "a")
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(p, []byte("a"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// The plain entry targets a file the expanded entry already produces.
+	m := &Manifest{
+		Files: []FileEntry{
+			{Source: "x", Target: "~/.config/x", Expand: true},
+			{Source: "other/a", Target: "~/.config/x/a"},
+		},
+	}
+
+	ctx := profile.Context{OS: "linux", Profile: "test", Home: "/home/test"}
+	if _, _, err := Resolve(m, ctx, repo); err == nil || !strings.Contains(err.Error(), "also produced by x/a") {
+		t.Fatalf("Resolve error = %v, want collision with x/a", err)
+	}
+}
+
+func TestResolveCarriesOnChange(t *testing.T) {
+	m, err := Parse([]byte(`
+files:
+  - source: configs/tmux.conf
+    target: ~/.tmux.conf
+    on_change: tmux source-file ~/.tmux.conf
+  - source: configs/systemd
+    target: ~/.config/systemd/user
+    mode: copy
+    on_change:
+      - systemctl --user daemon-reload
+      - systemctl --user restart app.service
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	actions, _, err := Resolve(m, profile.Context{OS: "linux", Home: "/home/u"}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(actions[0].OnChange) != 1 || len(actions[1].OnChange) != 2 {
+		t.Fatalf("on_change = %v / %v", actions[0].OnChange, actions[1].OnChange)
+	}
+
+	if _, err := Parse([]byte("files:\n  - source: a\n    target: ~/.a\n    on_change: [\"\"]\n")); err == nil {
+		t.Fatal("expected error for empty on_change command")
+	}
+}
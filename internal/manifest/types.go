@@ -1,24 +1,47 @@
 package manifest
 
-import "fmt"
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Manifest represents the top-level manifest.yaml structure.
 type Manifest struct {
-	Version int               `yaml:"version"`
-	Vars    map[string]string `yaml:"vars"`
-	Files   []FileEntry       `yaml:"files"`
-	Ignore  []string          `yaml:"ignore"`
-	Hooks   HookSet           `yaml:"hooks"`
+	Version  int               `yaml:"version"`
+	Include  []string          `yaml:"include"` // repo-relative manifest paths or globs merged by Load
+	Vars     map[string]string `yaml:"vars"`
+	Files    []FileEntry       `yaml:"files"`
+	Ignore   []string          `yaml:"ignore"`
+	Hooks    HookSet           `yaml:"hooks"`
+	Packages []PackageSet      `yaml:"packages"`
 }
 
 // FileEntry represents a single file mapping in the manifest.
 type FileEntry struct {
-	Source  string    `yaml:"source"`
-	Target string    `yaml:"target"`
-	Mode   string    `yaml:"mode"`    // "symlink" (default) or "copy"
-	When   Condition `yaml:"when"`
-	Decrypt bool     `yaml:"decrypt"`
-	Backup  *bool    `yaml:"backup"` // nil = default true
+	Source   string    `yaml:"source"`
+	Target   string    `yaml:"target"`
+	Mode     string    `yaml:"mode"` // "symlink" (default) or "copy"
+	When     Condition `yaml:"when"`
+	Decrypt  Decrypt   `yaml:"decrypt"`  // true/"auto", "age" or "sops" (copy mode only)
+	Template bool      `yaml:"template"` // render source through text/template (copy mode only)
+	Expand   bool      `yaml:"expand"`   // apply each file in a source directory individually
+	Perm     FileMode  `yaml:"perm"`     // octal mode for copied files, e.g. "0600" (copy mode only)
+	DirPerm  FileMode  `yaml:"dir_perm"` // octal mode for the directory containing the target
+	Backup   *bool     `yaml:"backup"`   // nil = default true
+	Capture  string    `yaml:"capture"`  // "ask" (default), "always" or "never" (copy mode only)
+
+	// OnChange lists commands run after sync only when this entry's target
+	// was created, copied or replaced.
+	OnChange StringOrSlice `yaml:"on_change"`
+
+	// origin and index locate the entry in the manifest file that defined it
+	// (set by Load, used in validation errors).
+	origin string
+	index  int
 }
 
 // ShouldBackup returns whether this entry should create a backup before overwriting.
@@ -37,10 +60,73 @@ func (f FileEntry) LinkMode() string {
 	return f.Mode
 }
 
-// Condition represents when-filters for OS and profile.
-type Condition struct {
-	OS      StringOrSlice `yaml:"os"`
-	Profile StringOrSlice `yaml:"profile"`
+// PackageSet is a list of packages installed with one package manager.
+type PackageSet struct {
+	Manager string        `yaml:"manager"` // one of PackageManagers
+	Names   StringOrSlice `yaml:"names"`
+	When    Condition     `yaml:"when"`
+}
+
+// PackageManagers lists the supported package set managers.
+var PackageManagers = []string{"brew", "apt", "dnf", "pacman", "cargo", "go", "npm"}
+
+// Capture policies for copying local edits of copy-mode targets back into the repo.
+const (
+	CaptureAsk    = "ask"
+	CaptureAlways = "always"
+	CaptureNever  = "never"
+)
+
+// CapturePolicy returns the resolved capture policy, defaulting to "ask".
+func (f FileEntry) CapturePolicy() string {
+	if f.Capture == "" {
+		return CaptureAsk
+	}
+	return f.Capture
+}
+
+// Decrypt backends for decrypt entries.
+const (
+	DecryptAuto = "auto" // built-in age for age files, sops otherwise
+	DecryptAge  = "age"  // built-in age with the dotctl identity
+	DecryptSOPS = "sops" // the external sops binary
+)
+
+// Decrypt is an entry's decrypt setting: true (same as "auto") or a backend
+// name. Empty means the source is not decrypted.
+type Decrypt string
+
+// UnmarshalYAML implements custom YAML unmarshaling for Decrypt.
+func (d *Decrypt) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		*d = ""
+		if enabled {
+			*d = DecryptAuto
+		}
+		return nil
+	}
+
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return fmt.Errorf("expected true, false, \"auto\", \"age\" or \"sops\"")
+	}
+	switch backend := strings.ToLower(strings.TrimSpace(raw)); backend {
+	case "true":
+		*d = DecryptAuto
+	case "false":
+		*d = ""
+	case DecryptAuto, DecryptAge, DecryptSOPS:
+		*d = Decrypt(backend)
+	default:
+		return fmt.Errorf("invalid decrypt %q (must be true, 'auto', 'age' or 'sops')", raw)
+	}
+	return nil
+}
+
+// Enabled reports whether the source must be decrypted.
+func (d Decrypt) Enabled() bool {
+	return d != ""
 }
 
 // HookSet contains the different hook phases.
@@ -52,9 +138,130 @@ type HookSet struct {
 
 // Hook represents a command to run at a specific phase.
 type Hook struct {
-	Command     string    `yaml:"command"`
-	Description string    `yaml:"description"`
-	When        Condition `yaml:"when"`
+	Command     string            `yaml:"command"`
+	Description string            `yaml:"description"`
+	When        Condition         `yaml:"when"`
+	Timeout     Duration          `yaml:"timeout"`    // e.g. "30s", "5m"; zero = no limit
+	Env         map[string]string `yaml:"env"`        // extra environment variables
+	Cwd         string            `yaml:"cwd"`        // working directory, repo-relative, absolute or ~/...
+	Shell       string            `yaml:"shell"`      // interpreter invoked with -c (default /bin/sh)
+	OnFailure   string            `yaml:"on_failure"` // "abort" (default), "warn" or "ignore"
+	Run         string            `yaml:"run"`        // "always" (default), "once" or "onchange"
+	Watch       StringOrSlice     `yaml:"watch"`      // repo-relative paths or globs hashed for run: onchange
+}
+
+// Hook run policies.
+const (
+	RunAlways   = "always"
+	RunOnce     = "once"
+	RunOnChange = "onchange"
+)
+
+// Hook failure policies.
+const (
+	OnFailureAbort  = "abort"
+	OnFailureWarn   = "warn"
+	OnFailureIgnore = "ignore"
+)
+
+// DefaultHookShell runs hooks when no shell is configured.
+const DefaultHookShell = "/bin/sh"
+
+// FailurePolicy returns the resolved on_failure policy, defaulting to "abort".
+func (h Hook) FailurePolicy() string {
+	if h.OnFailure == "" {
+		return OnFailureAbort
+	}
+	return h.OnFailure
+}
+
+// RunPolicy returns the resolved run policy, defaulting to "always".
+func (h Hook) RunPolicy() string {
+	if h.Run == "" {
+		return RunAlways
+	}
+	return h.Run
+}
+
+// ShellArgs returns the interpreter and its arguments, split on whitespace so
+// values like "bash -eo pipefail" work. The command is appended after "-c".
+func (h Hook) ShellArgs() []string {
+	args := strings.Fields(h.Shell)
+	if len(args) == 0 {
+		args = []string{DefaultHookShell}
+	}
+	return append(args, "-c", h.Command)
+}
+
+// WorkDir resolves the hook's working directory: the repository root by
+// default, ~ expanded against home, relative paths joined to the repo root.
+func (h Hook) WorkDir(repoRoot, home string) string {
+	dir := strings.TrimSpace(h.Cwd)
+	if dir == "" {
+		return repoRoot
+	}
+	dir = expandHome(dir, home)
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(repoRoot, dir)
+}
+
+// Duration is a time span written as a Go duration string ("30s", "5m", "1h30m").
+// Zero means unset.
+type Duration time.Duration
+
+// UnmarshalYAML implements custom YAML unmarshaling for Duration.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return fmt.Errorf("expected duration string like \"30s\"")
+	}
+
+	parsed, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", raw)
+	}
+	if parsed <= 0 {
+		return fmt.Errorf("duration %q must be positive", raw)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// String formats the duration like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// FileMode is an octal permission written as "0600", "600" or "0o600".
+// Zero means unset.
+type FileMode fs.FileMode
+
+// UnmarshalYAML implements custom YAML unmarshaling for FileMode.
+func (m *FileMode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return fmt.Errorf("expected octal permission string like \"0600\"")
+	}
+
+	value := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(raw), "0o"), "0O")
+	parsed, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid octal permission %q", raw)
+	}
+	if parsed == 0 || parsed > 0o777 {
+		return fmt.Errorf("permission %q must be between 0001 and 0777", raw)
+	}
+
+	*m = FileMode(parsed)
+	return nil
+}
+
+// String formats the mode as four octal digits, e.g. "0600".
+func (m FileMode) String() string {
+	return fmt.Sprintf("%04o", uint32(m))
 }
 
 // StringOrSlice allows YAML values like "darwin" or ["darwin", "linux"].
@@ -0,0 +1,329 @@
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Seams for tests.
+var (
+	lookPath = exec.LookPath
+
+	// listCommand runs a read-only query and returns its stdout.
+	listCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, name, args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return out, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+			}
+			return out, fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+		}
+		return out, nil
+	}
+
+	// installCommand runs an install command attached to the terminal's stdin
+	// (sudo may prompt) with output written to w.
+	installCommand = func(ctx context.Context, w io.Writer, name string, args ...string) error {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = w
+		cmd.Stderr = w
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+		}
+		return nil
+	}
+
+	isRoot = func() bool { return os.Geteuid() == 0 }
+)
+
+// cliManager is a Manager driven by command-line tools.
+type cliManager struct {
+	name   string
+	binary string // must be on PATH for the manager to be available
+
+	// list returns the keys of every installed package.
+	list func(ctx context.Context) (map[string]bool, error)
+	// key maps a declared name to the key reported by list.
+	key func(name string) string
+
+	install    []string // install command; package names are appended
+	sudo       bool     // prefix install with sudo when not running as root
+	perPackage bool     // run the install command once per package
+}
+
+func (m *cliManager) Name() string { return m.name }
+
+func (m *cliManager) Available() bool {
+	_, err := lookPath(m.binary)
+	return err == nil
+}
+
+func (m *cliManager) Installed(ctx context.Context, names []string) (map[string]bool, error) {
+	all, err := m.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]bool, len(names))
+	for _, name := range names {
+		key := name
+		if m.key != nil {
+			key = m.key(name)
+		}
+		installed[name] = all[key]
+	}
+	return installed, nil
+}
+
+func (m *cliManager) Install(ctx context.Context, names []string, w io.Writer) error {
+	argv := append([]string{}, m.install...)
+	if m.sudo && !isRoot() {
+		argv = append([]string{"sudo"}, argv...)
+	}
+
+	if m.perPackage {
+		for _, name := range names {
+			if err := installCommand(ctx, w, argv[0], append(argv[1:], name)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return installCommand(ctx, w, argv[0], append(argv[1:], names...)...)
+}
+
+func newBrew() Manager {
+	return &cliManager{
+		name:   "brew",
+		binary: "brew",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			installed := make(map[string]bool)
+			for _, kind := range []string{"--formula", "--cask"} {
+				out, err := listCommand(ctx, "brew", "list", kind, "-1")
+				if err != nil {
+					return nil, err
+				}
+				addLines(installed, out)
+			}
+			return installed, nil
+		},
+		// Taps are declared as owner/tap/formula but listed by formula name.
+		key:     path.Base,
+		install: []string{"brew", "install"},
+	}
+}
+
+func newApt() Manager {
+	return &cliManager{
+		name:   "apt",
+		binary: "apt-get",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			out, err := listCommand(ctx, "dpkg-query", "-W", "-f=${Package}\t${db:Status-Status}\n")
+			if err != nil {
+				return nil, err
+			}
+			installed := make(map[string]bool)
+			for _, line := range lines(out) {
+				pkg, status, _ := strings.Cut(line, "\t")
+				if status == "installed" {
+					installed[pkg] = true
+				}
+			}
+			return installed, nil
+		},
+		key:     stripArch,
+		install: []string{"apt-get", "install", "-y"},
+		sudo:    true,
+	}
+}
+
+func newDnf() Manager {
+	return &cliManager{
+		name:   "dnf",
+		binary: "dnf",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			out, err := listCommand(ctx, "rpm", "-qa", "--qf", "%{NAME}\n")
+			if err != nil {
+				return nil, err
+			}
+			installed := make(map[string]bool)
+			addLines(installed, out)
+			return installed, nil
+		},
+		install: []string{"dnf", "install", "-y"},
+		sudo:    true,
+	}
+}
+
+func newPacman() Manager {
+	return &cliManager{
+		name:   "pacman",
+		binary: "pacman",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			out, err := listCommand(ctx, "pacman", "-Qq")
+			if err != nil {
+				return nil, err
+			}
+			installed := make(map[string]bool)
+			addLines(installed, out)
+			return installed, nil
+		},
+		install: []string{"pacman", "-S", "--needed", "--noconfirm"},
+		sudo:    true,
+	}
+}
+
+// cargoCrateLine matches the unindented "name v1.2.3:" lines of
+// `cargo install --list`; indented lines list the installed binaries.
+var cargoCrateLine = regexp.MustCompile(`^(\S+) v\S+.*:$`)
+
+func newCargo() Manager {
+	return &cliManager{
+		name:   "cargo",
+		binary: "cargo",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			out, err := listCommand(ctx, "cargo", "install", "--list")
+			if err != nil {
+				return nil, err
+			}
+			installed := make(map[string]bool)
+			for _, line := range lines(out) {
+				if m := cargoCrateLine.FindStringSubmatch(line); m != nil {
+					installed[m[1]] = true
+				}
+			}
+			return installed, nil
+		},
+		key:     stripVersion,
+		install: []string{"cargo", "install"},
+	}
+}
+
+func newGoInstall() Manager {
+	return &cliManager{
+		name:   "go",
+		binary: "go",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			dir, err := goBinDir(ctx)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("reading %s: %w", dir, err)
+			}
+			installed := make(map[string]bool)
+			for _, e := range entries {
+				if !e.IsDir() {
+					installed[strings.TrimSuffix(e.Name(), ".exe")] = true
+				}
+			}
+			return installed, nil
+		},
+		key:        goBinaryName,
+		install:    []string{"go", "install"},
+		perPackage: true, // go install only accepts several packages from one module
+	}
+}
+
+func newNpm() Manager {
+	return &cliManager{
+		name:   "npm",
+		binary: "npm",
+		list: func(ctx context.Context) (map[string]bool, error) {
+			out, err := listCommand(ctx, "npm", "ls", "-g", "--depth=0", "--json")
+			// npm ls exits non-zero on peer dependency problems but still prints the tree.
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			var tree struct {
+				Dependencies map[string]json.RawMessage `json:"dependencies"`
+			}
+			if jsonErr := json.Unmarshal(out, &tree); jsonErr != nil {
+				return nil, fmt.Errorf("parsing npm ls output: %w", jsonErr)
+			}
+			installed := make(map[string]bool, len(tree.Dependencies))
+			for name := range tree.Dependencies {
+				installed[name] = true
+			}
+			return installed, nil
+		},
+		key:     stripVersion,
+		install: []string{"npm", "install", "-g"},
+	}
+}
+
+// goBinDir returns where go install places binaries.
+func goBinDir(ctx context.Context) (string, error) {
+	out, err := listCommand(ctx, "go", "env", "GOBIN", "GOPATH")
+	if err != nil {
+		return "", err
+	}
+	values := lines(out)
+	if len(values) > 0 && values[0] != "" {
+		return values[0], nil
+	}
+	if len(values) > 1 && values[1] != "" {
+		gopath := filepath.SplitList(values[1])[0]
+		return filepath.Join(gopath, "bin"), nil
+	}
+	return "", fmt.Errorf("cannot determine go install directory")
+}
+
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// goBinaryName returns the binary built by `go install pkg@version`: the last
+// path element, skipping a /vN major version suffix.
+func goBinaryName(pkg string) string {
+	pkg = stripVersion(pkg)
+	base := path.Base(pkg)
+	if majorVersionSuffix.MatchString(base) {
+		base = path.Base(path.Dir(pkg))
+	}
+	return base
+}
+
+// stripVersion removes a trailing @version ("ripgrep@14", "typescript@5").
+// A leading @ (npm scopes like "@vue/cli") is kept.
+func stripVersion(name string) string {
+	if i := strings.LastIndex(name, "@"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// stripArch removes an apt :arch qualifier.
+func stripArch(name string) string {
+	pkg, _, _ := strings.Cut(name, ":")
+	return pkg
+}
+
+func lines(out []byte) []string {
+	var result []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		result = append(result, strings.TrimSpace(scanner.Text()))
+	}
+	return result
+}
+
+func addLines(set map[string]bool, out []byte) {
+	for _, line := range lines(out) {
+		if line != "" {
+			set[line] = true
+		}
+	}
+}
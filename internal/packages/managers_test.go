@@ -0,0 +1,117 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func stubListCommand(t *testing.T, outputs map[string]string) {
+	t.Helper()
+	orig := listCommand
+	t.Cleanup(func() { listCommand = orig })
+	listCommand = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		key := strings.TrimSpace(name + " " + strings.Join(args, " "))
+		out, ok := outputs[key]
+		if !ok {
+			return nil, fmt.Errorf("unexpected command %q", key)
+		}
+		return []byte(out), nil
+	}
+}
+
+func TestManagersDetectInstalled(t *testing.T) {
+	gobin := t.TempDir()
+	writeBinary(t, gobin, "gopls")
+
+	stubListCommand(t, map[string]string{
+		"brew list --formula -1":                           "git\nripgrep\n",
+		"brew list --cask -1":                              "iterm2\n",
+		"dpkg-query -W -f=${Package}\t${db:Status-Status}": "curl\tinstalled\nvim\tconfig-files\n",
+		"cargo install --list":                             "bat v0.24.0:\n    bat\nripgrep v14.1.0:\n    rg\n",
+		"go env GOBIN GOPATH":                              gobin + "\n/home/u/go\n",
+		"npm ls -g --depth=0 --json":                       `{"dependencies":{"@vue/cli":{},"typescript":{}}}`,
+	})
+
+	tests := []struct {
+		manager Manager
+		names   []string
+		want    string // installed names, comma separated
+	}{
+		{newBrew(), []string{"git", "homebrew/cask/iterm2", "fd"}, "git,homebrew/cask/iterm2"},
+		{newApt(), []string{"curl", "vim", "curl:amd64"}, "curl,curl:amd64"},
+		{newCargo(), []string{"bat", "ripgrep@14", "fd-find"}, "bat,ripgrep@14"},
+		{newGoInstall(), []string{"golang.org/x/tools/gopls@latest", "github.com/x/tool/v2@latest"}, "golang.org/x/tools/gopls@latest"},
+		{newNpm(), []string{"@vue/cli@5", "typescript", "eslint"}, "@vue/cli@5,typescript"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.manager.Name(), func(t *testing.T) {
+			installed, err := tt.manager.Installed(context.Background(), tt.names)
+			if err != nil {
+				t.Fatalf("Installed: %v", err)
+			}
+			var got []string
+			for _, n := range tt.names {
+				if installed[n] {
+					got = append(got, n)
+				}
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Fatalf("installed = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallUsesSudoAndPerPackage(t *testing.T) {
+	var calls []string
+	origInstall, origRoot := installCommand, isRoot
+	t.Cleanup(func() { installCommand, isRoot = origInstall, origRoot })
+	installCommand = func(_ context.Context, _ io.Writer, name string, args ...string) error {
+		calls = append(calls, strings.TrimSpace(name+" "+strings.Join(args, " ")))
+		return nil
+	}
+	isRoot = func() bool { return false }
+
+	if err := newApt().Install(context.Background(), []string{"curl", "jq"}, io.Discard); err != nil {
+		t.Fatalf("apt Install: %v", err)
+	}
+	if err := newGoInstall().Install(context.Background(), []string{"a/b@latest", "c/d@v1"}, io.Discard); err != nil {
+		t.Fatalf("go Install: %v", err)
+	}
+
+	want := []string{
+		"sudo apt-get install -y curl jq",
+		"go install a/b@latest",
+		"go install c/d@v1",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestGoBinaryName(t *testing.T) {
+	cases := map[string]string{
+		"golang.org/x/tools/gopls@latest":                               "gopls",
+		"github.com/golangci/golangci-lint/v2/cmd/golangci-lint@v2.1.0": "golangci-lint",
+		"github.com/x/tool/v2@latest":                                   "tool",
+		"mvdan.cc/gofumpt":                                              "gofumpt",
+	}
+	for pkg, want := range cases {
+		if got := goBinaryName(pkg); got != want {
+			t.Errorf("goBinaryName(%q) = %q, want %q", pkg, got, want)
+		}
+	}
+}
+
+func writeBinary(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
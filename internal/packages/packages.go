@@ -0,0 +1,204 @@
+// Package packages plans and installs the packages declared in the manifest's
+// packages section through pluggable package managers.
+package packages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/profile"
+)
+
+// Manager detects and installs packages for one package manager.
+type Manager interface {
+	// Name returns the manifest name of the manager ("brew", "apt", ...).
+	Name() string
+	// Available reports whether the manager can be used on this machine.
+	Available() bool
+	// Installed reports which of names are already installed.
+	Installed(ctx context.Context, names []string) (map[string]bool, error)
+	// Install installs names, writing the manager's output to w.
+	Install(ctx context.Context, names []string, w io.Writer) error
+}
+
+// Registry maps manager names to implementations.
+type Registry map[string]Manager
+
+// DefaultRegistry returns the managers that operate on the real system.
+func DefaultRegistry() Registry {
+	return Registry{
+		"brew":   newBrew(),
+		"apt":    newApt(),
+		"dnf":    newDnf(),
+		"pacman": newPacman(),
+		"cargo":  newCargo(),
+		"go":     newGoInstall(),
+		"npm":    newNpm(),
+	}
+}
+
+// ManagerPlan is the state of every package declared for one manager.
+type ManagerPlan struct {
+	Manager   string   `json:"manager"`
+	Available bool     `json:"available"`
+	Installed []string `json:"installed,omitempty"`
+	Missing   []string `json:"missing,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// SkippedSet is a package set excluded by its when condition.
+type SkippedSet struct {
+	Manager string   `json:"manager"`
+	Names   []string `json:"names"`
+	Reason  string   `json:"reason"`
+}
+
+// Plan is the result of comparing the manifest with the installed packages.
+type Plan struct {
+	Managers []ManagerPlan `json:"managers"`
+	Skipped  []SkippedSet  `json:"skipped,omitempty"`
+}
+
+// MissingCount returns the number of packages that need installing.
+func (p Plan) MissingCount() int {
+	n := 0
+	for _, mp := range p.Managers {
+		n += len(mp.Missing)
+	}
+	return n
+}
+
+// BuildPlan evaluates package sets against the context and asks each manager
+// which declared packages are missing. Sets for the same manager are merged
+// in manifest order. only, if non-empty, restricts the plan to one manager.
+func BuildPlan(ctx context.Context, sets []manifest.PackageSet, pctx profile.Context, registry Registry, only string) (Plan, error) {
+	var (
+		plan  Plan
+		order []string
+		names = make(map[string][]string)
+	)
+
+	for _, set := range sets {
+		if only != "" && set.Manager != only {
+			continue
+		}
+		if ok, reason := set.When.Evaluate(pctx); !ok {
+			plan.Skipped = append(plan.Skipped, SkippedSet{Manager: set.Manager, Names: set.Names, Reason: reason})
+			continue
+		}
+		if _, seen := names[set.Manager]; !seen {
+			order = append(order, set.Manager)
+		}
+		names[set.Manager] = appendUnique(names[set.Manager], set.Names...)
+	}
+
+	for _, name := range order {
+		manager, ok := registry[name]
+		if !ok {
+			return Plan{}, fmt.Errorf("unknown package manager %q", name)
+		}
+
+		mp := ManagerPlan{Manager: name, Available: manager.Available()}
+		if !mp.Available {
+			mp.Missing = names[name]
+			mp.Error = name + " is not available on this machine"
+			plan.Managers = append(plan.Managers, mp)
+			continue
+		}
+
+		installed, err := manager.Installed(ctx, names[name])
+		if err != nil {
+			mp.Error = err.Error()
+			mp.Missing = names[name]
+			plan.Managers = append(plan.Managers, mp)
+			continue
+		}
+		for _, pkg := range names[name] {
+			if installed[pkg] {
+				mp.Installed = append(mp.Installed, pkg)
+			} else {
+				mp.Missing = append(mp.Missing, pkg)
+			}
+		}
+		plan.Managers = append(plan.Managers, mp)
+	}
+
+	return plan, nil
+}
+
+// InstallResult is the outcome of installing one manager's missing packages.
+type InstallResult struct {
+	Manager  string   `json:"manager"`
+	Packages []string `json:"packages"`
+	Status   string   `json:"status"` // installed, would_install, error
+	Error    string   `json:"error,omitempty"`
+}
+
+// Install installs the missing packages of every available manager in the
+// plan. It continues past a failing manager and returns an error naming the
+// managers that failed.
+func Install(ctx context.Context, plan Plan, registry Registry, dryRun bool, w io.Writer) ([]InstallResult, error) {
+	var (
+		results []InstallResult
+		failed  []string
+	)
+
+	for _, mp := range plan.Managers {
+		if len(mp.Missing) == 0 {
+			continue
+		}
+		res := InstallResult{Manager: mp.Manager, Packages: mp.Missing}
+
+		switch {
+		case !mp.Available || mp.Error != "":
+			res.Status = "error"
+			res.Error = mp.Error
+		case dryRun:
+			res.Status = "would_install"
+		default:
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return results, fmt.Errorf("package install cancelled: %w", ctxErr)
+			}
+			if err := registry[mp.Manager].Install(ctx, mp.Missing, w); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return results, fmt.Errorf("package install cancelled: %w", ctxErr)
+				}
+				res.Status = "error"
+				res.Error = err.Error()
+			} else {
+				res.Status = "installed"
+			}
+		}
+
+		if res.Status == "error" {
+			failed = append(failed, mp.Manager)
+		}
+		results = append(results, res)
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return results, fmt.Errorf("installing packages failed for %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+func appendUnique(values []string, extra ...string) []string {
+	for _, v := range extra {
+		dup := false
+		for _, existing := range values {
+			if existing == v {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			values = append(values, v)
+		}
+	}
+	return values
+}
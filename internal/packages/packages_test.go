@@ -0,0 +1,120 @@
+package packages
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/felipe-veas/dotctl/internal/manifest"
+	"github.com/felipe-veas/dotctl/internal/profile"
+)
+
+type fakeManager struct {
+	name       string
+	available  bool
+	installed  map[string]bool
+	installErr error
+	calls      [][]string
+}
+
+func (f *fakeManager) Name() string    { return f.name }
+func (f *fakeManager) Available() bool { return f.available }
+
+func (f *fakeManager) Installed(_ context.Context, names []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, n := range names {
+		result[n] = f.installed[n]
+	}
+	return result, nil
+}
+
+func (f *fakeManager) Install(_ context.Context, names []string, _ io.Writer) error {
+	f.calls = append(f.calls, names)
+	if f.installErr != nil {
+		return f.installErr
+	}
+	for _, n := range names {
+		f.installed[n] = true
+	}
+	return nil
+}
+
+func TestBuildPlan(t *testing.T) {
+	brew := &fakeManager{name: "brew", available: true, installed: map[string]bool{"git": true}}
+	apt := &fakeManager{name: "apt", available: true, installed: map[string]bool{}}
+	cargo := &fakeManager{name: "cargo", available: false, installed: map[string]bool{}}
+	registry := Registry{"brew": brew, "apt": apt, "cargo": cargo}
+
+	sets := []manifest.PackageSet{
+		{Manager: "brew", Names: manifest.StringOrSlice{"git", "ripgrep"}},
+		{Manager: "apt", Names: manifest.StringOrSlice{"build-essential"}, When: manifest.Condition{OS: manifest.StringOrSlice{"linux"}}},
+		{Manager: "brew", Names: manifest.StringOrSlice{"ripgrep", "fd"}},
+		{Manager: "cargo", Names: manifest.StringOrSlice{"bat"}},
+	}
+
+	plan, err := BuildPlan(context.Background(), sets, profile.Context{OS: "darwin"}, registry, "")
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+	if len(plan.Managers) != 2 {
+		t.Fatalf("managers = %+v, want brew and cargo", plan.Managers)
+	}
+
+	brewPlan := plan.Managers[0]
+	if strings.Join(brewPlan.Installed, ",") != "git" || strings.Join(brewPlan.Missing, ",") != "ripgrep,fd" {
+		t.Fatalf("brew plan = %+v, want git installed and ripgrep,fd missing", brewPlan)
+	}
+	if cargoPlan := plan.Managers[1]; cargoPlan.Available || cargoPlan.Error == "" {
+		t.Fatalf("cargo plan = %+v, want unavailable with error", cargoPlan)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Reason != "os: darwin not in [linux]" {
+		t.Fatalf("skipped = %+v, want apt set skipped by os", plan.Skipped)
+	}
+	if plan.MissingCount() != 3 {
+		t.Fatalf("MissingCount = %d, want 3", plan.MissingCount())
+	}
+
+	only, err := BuildPlan(context.Background(), sets, profile.Context{OS: "darwin"}, registry, "cargo")
+	if err != nil {
+		t.Fatalf("BuildPlan with manager filter: %v", err)
+	}
+	if len(only.Managers) != 1 || only.Managers[0].Manager != "cargo" {
+		t.Fatalf("filtered managers = %+v, want cargo only", only.Managers)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	brew := &fakeManager{name: "brew", available: true, installed: map[string]bool{}}
+	npm := &fakeManager{name: "npm", available: true, installed: map[string]bool{}, installErr: errors.New("EACCES")}
+	registry := Registry{"brew": brew, "npm": npm}
+
+	plan := Plan{Managers: []ManagerPlan{
+		{Manager: "brew", Available: true, Missing: []string{"ripgrep"}},
+		{Manager: "npm", Available: true, Missing: []string{"typescript"}},
+		{Manager: "cargo", Available: false, Missing: []string{"bat"}, Error: "cargo is not available on this machine"},
+	}}
+
+	dry, err := Install(context.Background(), plan, registry, true, io.Discard)
+	if err == nil {
+		t.Fatal("dry-run should still report the unavailable manager")
+	}
+	if dry[0].Status != "would_install" || len(brew.calls) != 0 {
+		t.Fatalf("dry-run results = %+v, calls = %v", dry, brew.calls)
+	}
+
+	results, err := Install(context.Background(), plan, registry, false, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "cargo, npm") {
+		t.Fatalf("err = %v, want failure naming cargo and npm", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v, want three", results)
+	}
+	if results[0].Status != "installed" || !brew.installed["ripgrep"] {
+		t.Fatalf("brew result = %+v, want installed", results[0])
+	}
+	if results[1].Status != "error" || results[1].Error != "EACCES" {
+		t.Fatalf("npm result = %+v, want EACCES error", results[1])
+	}
+}
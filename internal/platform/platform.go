@@ -17,7 +17,7 @@ func ConfigDir() string {
 	return filepath.Join(home, ".config", "dotctl")
 }
 
-// StateDir returns the dotctl state directory (logs), respecting XDG_STATE_HOME.
+// StateDir returns the dotctl state directory (logs, sync lock and journal), respecting XDG_STATE_HOME.
 func StateDir() string {
 	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
 		return filepath.Join(xdg, "dotctl")
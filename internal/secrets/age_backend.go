@@ -7,10 +7,26 @@ import (
 	"os"
 
 	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
 )
 
 // GenerateIdentity creates a new age X25519 identity and writes it to path with 0600 permissions.
 func GenerateIdentity(path string) (*Identity, error) {
+	return generateIdentity(path, nil)
+}
+
+// GenerateProtectedIdentity is GenerateIdentity with the identity file
+// encrypted with passphrase (age's scrypt passphrase recipient), so the
+// private key is never stored in plaintext.
+func GenerateProtectedIdentity(path string, passphrase []byte) (*Identity, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	return generateIdentity(path, passphrase)
+}
+
+func generateIdentity(path string, passphrase []byte) (*Identity, error) {
 	id, err := age.GenerateX25519Identity()
 	if err != nil {
 		return nil, fmt.Errorf("generating age identity: %w", err)
@@ -22,32 +38,49 @@ func GenerateIdentity(path string) (*Identity, error) {
 		id.String(),
 	)
 
+	data := []byte(content)
+	if passphrase != nil {
+		if data, err = protectIdentity(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
 	dir := dirOf(path)
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return nil, fmt.Errorf("creating identity directory: %w", err)
 	}
 
-	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
 		return nil, fmt.Errorf("writing identity file: %w", err)
 	}
+	forgetIdentity(path)
 
 	return &Identity{
 		PrivatePath: path,
 		PublicKey:   id.Recipient().String(),
+		Encrypted:   passphrase != nil,
 		Recipient:   id.Recipient(),
 		identity:    id,
 	}, nil
 }
 
-// EncryptBytes encrypts plaintext for the given recipient public key string.
-func EncryptBytes(plaintext []byte, recipientKey string) ([]byte, error) {
-	recipient, err := age.ParseX25519Recipient(recipientKey)
-	if err != nil {
-		return nil, fmt.Errorf("parsing recipient key: %w", err)
+// EncryptBytes encrypts plaintext for the given recipient public key strings.
+// Any identity matching one of the recipients can decrypt the result.
+func EncryptBytes(plaintext []byte, recipientKeys ...string) ([]byte, error) {
+	if len(recipientKeys) == 0 {
+		return nil, fmt.Errorf("no recipients to encrypt for")
+	}
+	recipients := make([]age.Recipient, 0, len(recipientKeys))
+	for _, key := range recipientKeys {
+		recipient, err := parseRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing recipient key: %w", err)
+		}
+		recipients = append(recipients, recipient)
 	}
 
 	var buf bytes.Buffer
-	w, err := age.Encrypt(&buf, recipient)
+	w, err := age.Encrypt(&buf, recipients...)
 	if err != nil {
 		return nil, fmt.Errorf("creating age writer: %w", err)
 	}
@@ -69,7 +102,11 @@ func DecryptBytes(ciphertext []byte, id *Identity) ([]byte, error) {
 		return nil, fmt.Errorf("identity has no private key loaded")
 	}
 
-	r, err := age.Decrypt(bytes.NewReader(ciphertext), id.identity)
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+	r, err := age.Decrypt(src, id.identity)
 	if err != nil {
 		return nil, fmt.Errorf("decrypting: %w", err)
 	}
@@ -83,12 +120,12 @@ func DecryptBytes(ciphertext []byte, id *Identity) ([]byte, error) {
 }
 
 // EncryptFile reads a plaintext file and returns encrypted bytes.
-func EncryptFile(path, recipientKey string) ([]byte, error) {
+func EncryptFile(path string, recipientKeys ...string) ([]byte, error) {
 	plaintext, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading file %q: %w", path, err)
 	}
-	return EncryptBytes(plaintext, recipientKey)
+	return EncryptBytes(plaintext, recipientKeys...)
 }
 
 // DecryptFileWithIdentity reads an encrypted file and returns plaintext bytes.
@@ -97,5 +134,24 @@ func DecryptFileWithIdentity(path string, id *Identity) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading file %q: %w", path, err)
 	}
+	if IsStructuredCiphertext(path, ciphertext) {
+		format, _ := StructuredFormatOf(path)
+		return DecryptStructured(ciphertext, format, id)
+	}
 	return DecryptBytes(ciphertext, id)
 }
+
+// IsAgeCiphertext reports whether data is an age file, binary or armored
+// (age -a), rather than another format such as a sops document.
+func IsAgeCiphertext(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte("age-encryption.org/")) || bytes.HasPrefix(data, []byte(armor.Header))
+}
+
+// parseRecipient parses an age public key or an ssh-ed25519/ssh-rsa public key.
+func parseRecipient(key string) (age.Recipient, error) {
+	if IsSSHRecipient(key) {
+		return agessh.ParseRecipient(key)
+	}
+	return age.ParseX25519Recipient(key)
+}
@@ -6,13 +6,13 @@ import (
 	"path/filepath"
 )
 
-// Encrypt encrypts a file using the repo's recipient key.
+// Encrypt encrypts a file for every recipient in the repo's recipient file.
 // Returns the path of the encrypted file (relative to repoRoot).
 func Encrypt(repoRoot, filePath string, opts EncryptOptions) (string, error) {
-	recipientKey := opts.RecipientKey
-	if recipientKey == "" {
+	recipientKeys := []string{opts.RecipientKey}
+	if opts.RecipientKey == "" {
 		var err error
-		recipientKey, err = FindRecipient(repoRoot)
+		recipientKeys, err = FindRecipients(repoRoot)
 		if err != nil {
 			return "", fmt.Errorf("finding recipient: %w", err)
 		}
@@ -28,8 +28,14 @@ func Encrypt(repoRoot, filePath string, opts EncryptOptions) (string, error) {
 		return "", fmt.Errorf("file %q is already encrypted", filePath)
 	}
 
-	// Encrypt the file contents.
-	ciphertext, err := EncryptFile(absPath, recipientKey)
+	// Encrypt the file contents, or only its values.
+	var ciphertext []byte
+	var err error
+	if opts.Structured {
+		ciphertext, err = encryptStructuredFile(absPath, recipientKeys)
+	} else {
+		ciphertext, err = EncryptFile(absPath, recipientKeys...)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -55,16 +61,27 @@ func Encrypt(repoRoot, filePath string, opts EncryptOptions) (string, error) {
 	return rel, nil
 }
 
-// Decrypt decrypts a file using the local identity.
+func encryptStructuredFile(path string, recipientKeys []string) ([]byte, error) {
+	format, ok := StructuredFormatOf(path)
+	if !ok {
+		return nil, fmt.Errorf("structured encryption supports YAML, JSON, dotenv and INI files, not %q", filepath.Base(path))
+	}
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", path, err)
+	}
+	ciphertext, err := EncryptStructured(plaintext, format, recipientKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting %q: %w", path, err)
+	}
+	return ciphertext, nil
+}
+
+// Decrypt decrypts a file using the local identity (see FindIdentity).
 // If opts.Stdout is true, returns the plaintext bytes without writing to disk.
 // Otherwise, writes the decrypted file and returns its path.
 func Decrypt(repoRoot, filePath string, opts DecryptOptions) ([]byte, string, error) {
-	idPath := opts.IdentityPath
-	if idPath == "" {
-		idPath = DefaultIdentityPath()
-	}
-
-	id, err := FindIdentity(idPath)
+	id, err := FindIdentity(opts.IdentityPath)
 	if err != nil {
 		return nil, "", fmt.Errorf("loading identity: %w", err)
 	}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"os"
 	"path/filepath"
 	"time"
 )
@@ -8,6 +9,9 @@ import (
 // nowFunc is a variable for testing time-dependent code.
 var nowFunc = time.Now
 
+// renameFile is a variable so tests can make a rewrite fail halfway.
+var renameFile = os.Rename
+
 // dirOf returns the directory portion of a path, used for creating parent dirs.
 func dirOf(path string) string {
 	return filepath.Dir(path)
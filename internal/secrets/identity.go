@@ -1,11 +1,10 @@
 package secrets
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"filippo.io/age"
 	"github.com/felipe-veas/dotctl/internal/platform"
@@ -16,20 +15,69 @@ func DefaultIdentityPath() string {
 	return filepath.Join(platform.ConfigDir(), DefaultIdentityFile)
 }
 
-// FindIdentity locates and parses the age identity file.
-// If path is empty, the default location is used.
+// FindIdentity locates and parses an identity file: an age identity or an
+// SSH private key. If path is empty, the default age identity is used, or,
+// when it does not exist, the first configured SSH key (see SetSSHKeys).
+// A passphrase-protected identity is unlocked with the passphrase from
+// DOTCTL_AGE_PASSPHRASE, the passphrase command or a terminal prompt.
 func FindIdentity(path string) (*Identity, error) {
+	return findIdentity(path, true)
+}
+
+// LookupIdentity returns the identity FindIdentity would use without asking
+// for a passphrase. A passphrase-protected age identity comes back locked,
+// with only PrivatePath and Encrypted set, and cannot decrypt.
+func LookupIdentity(path string) (*Identity, error) {
+	return findIdentity(path, false)
+}
+
+// findIdentity is FindIdentity; without unlock, a passphrase-protected age
+// identity is returned locked, with only PrivatePath and Encrypted set.
+func findIdentity(path string, unlock bool) (*Identity, error) {
 	if path == "" {
 		path = DefaultIdentityPath()
+		if !IdentityExists(path) {
+			if sshKey, ok := findSSHKey(); ok {
+				path = sshKey
+			}
+		}
+	}
+	if id := cachedIdentityFor(path); id != nil {
+		return id, nil
 	}
 
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("opening identity file: %w", err)
 	}
-	defer func() { _ = f.Close() }()
 
-	identities, err := age.ParseIdentities(f)
+	encrypted := false
+	if isProtectedIdentity(data) {
+		if !unlock {
+			return &Identity{PrivatePath: path, Encrypted: true}, nil
+		}
+		if data, err = unprotectIdentity(path, data); err != nil {
+			return nil, err
+		}
+		encrypted = true
+	}
+
+	var id *Identity
+	if isSSHPrivateKey(data) {
+		id, err = parseSSHIdentity(path, data)
+	} else {
+		id, err = parseAgeIdentity(path, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id.Encrypted = id.Encrypted || encrypted
+	cacheIdentity(id)
+	return id, nil
+}
+
+func parseAgeIdentity(path string, data []byte) (*Identity, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("parsing identity file %q: %w", path, err)
 	}
@@ -40,7 +88,7 @@ func FindIdentity(path string) (*Identity, error) {
 
 	x25519, ok := identities[0].(*age.X25519Identity)
 	if !ok {
-		return nil, fmt.Errorf("unsupported identity type in %q (expected X25519)", path)
+		return nil, fmt.Errorf("unsupported identity type in %q (expected X25519 or SSH)", path)
 	}
 
 	return &Identity{
@@ -51,40 +99,20 @@ func FindIdentity(path string) (*Identity, error) {
 	}, nil
 }
 
-// FindRecipient reads the public key from .age-recipient.txt in the repo root.
+// FindRecipient returns the first public key in .age-recipient.txt in the
+// repo root. Use FindRecipients to encrypt for every recipient.
 func FindRecipient(repoRoot string) (string, error) {
-	path := filepath.Join(repoRoot, DefaultRecipientFile)
-
-	data, err := os.ReadFile(path)
+	keys, err := FindRecipients(repoRoot)
 	if err != nil {
-		return "", fmt.Errorf("reading recipient file: %w", err)
+		return "", err
 	}
-
-	// Parse the file: skip comments and blank lines, take the first recipient.
-	scanner := bufio.NewScanner(strings.NewReader(string(data)))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		// Validate it's a valid age recipient.
-		if _, err := age.ParseX25519Recipient(line); err != nil {
-			return "", fmt.Errorf("invalid recipient in %q: %w", path, err)
-		}
-		return line, nil
-	}
-
-	return "", fmt.Errorf("no recipient found in %q", path)
+	return keys[0], nil
 }
 
-// WriteRecipientFile writes the public key to .age-recipient.txt in the repo root.
+// WriteRecipientFile writes .age-recipient.txt in the repo root with publicKey
+// as its only recipient.
 func WriteRecipientFile(repoRoot, publicKey string) error {
-	path := filepath.Join(repoRoot, DefaultRecipientFile)
-	content := fmt.Sprintf("# age public key for dotctl secrets\n%s\n", publicKey)
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-		return fmt.Errorf("writing recipient file: %w", err)
-	}
-	return nil
+	return WriteRecipients(repoRoot, []Recipient{{PublicKey: publicKey}})
 }
 
 // IdentityExists returns true if an identity file exists at the given or default path.
@@ -2,6 +2,7 @@ package secrets
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,34 +10,60 @@ import (
 	"strings"
 )
 
-// Init generates a new age identity or imports an existing one.
-// It writes the recipient file to the repo root and ensures .gitignore is updated.
+// Init generates a new age identity, imports an existing one or, with
+// SSHKeyPath, uses an SSH key in place of an age identity. With Passphrase,
+// the generated or imported identity is stored passphrase-protected.
+// It adds the public key to the repo's recipient file, creating it if needed,
+// and ensures .gitignore is updated. Files already encrypted are not
+// re-encrypted: a machine that can decrypt them must run AddRecipient.
 func Init(repoRoot string, opts InitOptions) (*Identity, error) {
 	idPath := opts.IdentityPath
 	if idPath == "" {
 		idPath = DefaultIdentityPath()
 	}
 
-	// Check for existing identity.
-	if !opts.Force && IdentityExists(idPath) {
-		return nil, fmt.Errorf("identity already exists at %q (use --force to overwrite)", idPath)
-	}
-
 	var id *Identity
 	var err error
 
-	if opts.ImportPath != "" {
-		id, err = importIdentity(opts.ImportPath, idPath)
-	} else {
+	switch {
+	case opts.SSHKeyPath != "" && opts.Passphrase:
+		return nil, fmt.Errorf("a passphrase protects age identities only; protect the SSH key with ssh-keygen -p instead")
+	case opts.SSHKeyPath != "":
+		sshKeyPath, absErr := filepath.Abs(opts.SSHKeyPath)
+		if absErr != nil {
+			return nil, absErr
+		}
+		id, err = FindIdentity(sshKeyPath)
+		if err == nil && !IsSSHRecipient(id.PublicKey) {
+			err = fmt.Errorf("%q is not an SSH private key", opts.SSHKeyPath)
+		}
+	case !opts.Force && IdentityExists(idPath):
+		return nil, fmt.Errorf("identity already exists at %q (use --force to overwrite)", idPath)
+	case opts.ImportPath != "":
+		id, err = importIdentity(opts.ImportPath, idPath, opts.Passphrase)
+	case opts.Passphrase:
+		var passphrase []byte
+		if passphrase, err = newPassphrase(idPath); err == nil {
+			id, err = GenerateProtectedIdentity(idPath, passphrase)
+		}
+	default:
 		id, err = GenerateIdentity(idPath)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Write recipient file to repo.
-	if err := WriteRecipientFile(repoRoot, id.PublicKey); err != nil {
-		return nil, fmt.Errorf("writing recipient file: %w", err)
+	// Add the key to the repo's recipients, labelled with the hostname.
+	recipients, err := ReadRecipients(repoRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if !containsRecipient(recipients, id.PublicKey) {
+		hostname, _ := os.Hostname()
+		recipients = append(recipients, Recipient{PublicKey: id.PublicKey, Comment: hostname})
+		if err := WriteRecipients(repoRoot, recipients); err != nil {
+			return nil, fmt.Errorf("writing recipient file: %w", err)
+		}
 	}
 
 	// Ensure .gitignore contains the identity filename.
@@ -47,8 +74,9 @@ func Init(repoRoot string, opts InitOptions) (*Identity, error) {
 	return id, nil
 }
 
-// importIdentity copies an existing identity file to the target path.
-func importIdentity(srcPath, dstPath string) (*Identity, error) {
+// importIdentity copies an existing identity file to the target path. With
+// protect, a plaintext identity is passphrase-protected on the way.
+func importIdentity(srcPath, dstPath string, protect bool) (*Identity, error) {
 	// Validate the source is a valid identity.
 	id, err := FindIdentity(srcPath)
 	if err != nil {
@@ -60,6 +88,18 @@ func importIdentity(srcPath, dstPath string) (*Identity, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading import file: %w", err)
 	}
+	if protect && !isProtectedIdentity(content) {
+		if IsSSHRecipient(id.PublicKey) {
+			return nil, fmt.Errorf("a passphrase protects age identities only")
+		}
+		passphrase, err := newPassphrase(dstPath)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = protectIdentity(content, passphrase); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create parent dir and write with restricted permissions.
 	if err := os.MkdirAll(filepath.Dir(dstPath), 0o700); err != nil {
@@ -68,9 +108,12 @@ func importIdentity(srcPath, dstPath string) (*Identity, error) {
 	if err := os.WriteFile(dstPath, content, 0o600); err != nil {
 		return nil, fmt.Errorf("writing identity file: %w", err)
 	}
+	forgetIdentity(dstPath)
 
-	id.PrivatePath = dstPath
-	return id, nil
+	imported := *id
+	imported.PrivatePath = dstPath
+	imported.Encrypted = imported.Encrypted || isProtectedIdentity(content)
+	return &imported, nil
 }
 
 // ensureGitignore adds pattern to .gitignore in repoRoot if not already present.
@@ -0,0 +1,239 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv holds the passphrase of a protected identity for
+// non-interactive use.
+const PassphraseEnv = "DOTCTL_AGE_PASSPHRASE"
+
+var (
+	passphraseMu      sync.RWMutex
+	passphraseCommand string
+
+	// scryptWorkFactor overrides age's scrypt cost when non-zero (tests).
+	scryptWorkFactor int
+)
+
+// SetPassphraseCommand sets a shell command whose standard output is the
+// passphrase of a protected identity, such as `pass show dotctl/age`.
+func SetPassphraseCommand(command string) {
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+	passphraseCommand = strings.TrimSpace(command)
+}
+
+// readPassphrase returns the passphrase for a protected identity from
+// DOTCTL_AGE_PASSPHRASE, the passphrase command or, failing both, a
+// terminal prompt.
+func readPassphrase(prompt string) ([]byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if command := currentPassphraseCommand(); command != "" {
+		return runPassphraseCommand(command)
+	}
+	return promptPassphrase(prompt)
+}
+
+// newPassphrase returns the passphrase for a new identity at path. A
+// passphrase typed on the terminal is asked for twice.
+func newPassphrase(path string) ([]byte, error) {
+	var passphrase []byte
+	var err error
+	if os.Getenv(PassphraseEnv) != "" || currentPassphraseCommand() != "" {
+		passphrase, err = readPassphrase("")
+	} else {
+		passphrase, err = confirmPassphrase(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	return passphrase, nil
+}
+
+func confirmPassphrase(path string) ([]byte, error) {
+	passphrase, err := promptPassphrase(fmt.Sprintf("Enter new passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := promptPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func currentPassphraseCommand() string {
+	passphraseMu.RLock()
+	defer passphraseMu.RUnlock()
+	return passphraseCommand
+}
+
+func runPassphraseCommand(command string) ([]byte, error) {
+	c := exec.Command("sh", "-c", command)
+	c.Stdin, c.Stderr = os.Stdin, os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("passphrase command %q failed: %w", command, err)
+	}
+	return bytes.TrimRight(out, "\r\n"), nil
+}
+
+// promptPassphrase reads a passphrase from the terminal without echoing it.
+// It is a variable so tests can answer the prompt.
+var promptPassphrase = func(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("a passphrase is required but stdin is not a terminal (set %s or secrets.passphrase_command)", PassphraseEnv)
+	}
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase: %w", err)
+	}
+	return passphrase, nil
+}
+
+// isProtectedIdentity reports whether data is an identity file encrypted with
+// a passphrase, armored (age -p -a) or binary (age -p).
+func isProtectedIdentity(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(armor.Header)) || bytes.HasPrefix(data, []byte("age-encryption.org/"))
+}
+
+// protectIdentity encrypts identity file content with passphrase, in the
+// armored format `age -d` also reads.
+func protectIdentity(content, passphrase []byte) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(string(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("creating passphrase recipient: %w", err)
+	}
+	if scryptWorkFactor > 0 {
+		recipient.SetWorkFactor(scryptWorkFactor)
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("creating age writer: %w", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, fmt.Errorf("writing identity: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("finalizing encryption: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, fmt.Errorf("finalizing armor: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// unprotectIdentity decrypts a passphrase-protected identity file.
+func unprotectIdentity(path string, data []byte) ([]byte, error) {
+	passphrase, err := readPassphrase(fmt.Sprintf("Enter passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(string(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("creating passphrase identity: %w", err)
+	}
+
+	var src io.Reader = bytes.NewReader(bytes.TrimSpace(data))
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+	r, err := age.Decrypt(src, identity)
+	if err != nil {
+		var wrong *age.NoIdentityMatchError
+		if errors.As(err, &wrong) {
+			return nil, fmt.Errorf("unlocking identity file %q: incorrect passphrase", path)
+		}
+		return nil, fmt.Errorf("unlocking identity file %q: %w", path, err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unlocking identity file %q: %w", path, err)
+	}
+	return content, nil
+}
+
+type cachedIdentity struct {
+	id      *Identity
+	expires time.Time
+}
+
+var (
+	identityCacheMu  sync.Mutex
+	identityCacheTTL time.Duration
+	identityCache    map[string]cachedIdentity
+)
+
+// CacheIdentities keeps unlocked passphrase-protected identities in memory
+// for ttl, like an agent, so a long-running command such as watch prompts
+// once instead of on every sync. A ttl of 0 disables the cache and forgets
+// cached identities. Nothing is written to disk.
+func CacheIdentities(ttl time.Duration) {
+	identityCacheMu.Lock()
+	defer identityCacheMu.Unlock()
+	identityCacheTTL = ttl
+	if ttl <= 0 {
+		identityCache = nil
+	}
+}
+
+func cachedIdentityFor(path string) *Identity {
+	identityCacheMu.Lock()
+	defer identityCacheMu.Unlock()
+	entry, ok := identityCache[path]
+	if !ok {
+		return nil
+	}
+	if nowFunc().After(entry.expires) {
+		delete(identityCache, path)
+		return nil
+	}
+	return entry.id
+}
+
+func cacheIdentity(id *Identity) {
+	identityCacheMu.Lock()
+	defer identityCacheMu.Unlock()
+	if identityCacheTTL <= 0 || !id.Encrypted {
+		return
+	}
+	if identityCache == nil {
+		identityCache = make(map[string]cachedIdentity)
+	}
+	identityCache[id.PrivatePath] = cachedIdentity{id: id, expires: nowFunc().Add(identityCacheTTL)}
+}
+
+// forgetIdentity drops the cached identity for a path that is rewritten.
+func forgetIdentity(path string) {
+	identityCacheMu.Lock()
+	defer identityCacheMu.Unlock()
+	delete(identityCache, path)
+}
@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Keep scrypt cheap; the default cost takes about a second per call.
+	scryptWorkFactor = 10
+}
+
+// stubPrompt answers passphrase prompts with answer and counts them.
+func stubPrompt(t *testing.T, answer string) *int {
+	t.Helper()
+	t.Setenv(PassphraseEnv, "")
+	SetPassphraseCommand("")
+	prompts := 0
+	orig := promptPassphrase
+	promptPassphrase = func(string) ([]byte, error) {
+		prompts++
+		return []byte(answer), nil
+	}
+	t.Cleanup(func() { promptPassphrase = orig })
+	return &prompts
+}
+
+func TestInitWithPassphrase(t *testing.T) {
+	t.Setenv(PassphraseEnv, "s3cret")
+	repoRoot := t.TempDir()
+	idPath := filepath.Join(t.TempDir(), "age-identity.txt")
+
+	id, err := Init(repoRoot, InitOptions{IdentityPath: idPath, Passphrase: true})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !id.Encrypted {
+		t.Error("Encrypted = false, want true")
+	}
+
+	data, err := os.ReadFile(idPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "-----BEGIN AGE ENCRYPTED FILE-----") || strings.Contains(string(data), "AGE-SECRET-KEY") {
+		t.Fatalf("identity file is not passphrase-protected:\n%s", data)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoRoot, ".env"), []byte("A=1\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	encRel, err := Encrypt(repoRoot, ".env", EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	plain, _, err := Decrypt(repoRoot, encRel, DecryptOptions{IdentityPath: idPath, Stdout: true, Keep: true})
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plain) != "A=1\n" {
+		t.Errorf("plaintext = %q", plain)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := FindIdentity(idPath); err == nil || !strings.Contains(err.Error(), "incorrect passphrase") {
+		t.Errorf("FindIdentity with wrong passphrase: err = %v", err)
+	}
+}
+
+func TestGetStatusDoesNotUnlockIdentity(t *testing.T) {
+	t.Setenv(PassphraseEnv, "s3cret")
+	repoRoot := t.TempDir()
+	idPath := filepath.Join(t.TempDir(), "age-identity.txt")
+	if _, err := Init(repoRoot, InitOptions{IdentityPath: idPath, Passphrase: true}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	prompts := stubPrompt(t, "s3cret")
+	status, err := GetStatus(repoRoot, idPath)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if status.Identity == nil || !status.Identity.Encrypted {
+		t.Errorf("Identity = %+v, want a passphrase-protected identity", status.Identity)
+	}
+	if *prompts != 0 {
+		t.Errorf("GetStatus prompted %d times", *prompts)
+	}
+}
+
+func TestPassphraseCommand(t *testing.T) {
+	idPath := filepath.Join(t.TempDir(), "age-identity.txt")
+	want, err := GenerateProtectedIdentity(idPath, []byte("from command"))
+	if err != nil {
+		t.Fatalf("GenerateProtectedIdentity: %v", err)
+	}
+
+	prompts := stubPrompt(t, "unused")
+	SetPassphraseCommand("printf 'from command\\n'")
+	t.Cleanup(func() { SetPassphraseCommand("") })
+
+	id, err := FindIdentity(idPath)
+	if err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if id.PublicKey != want.PublicKey {
+		t.Errorf("PublicKey = %q, want %q", id.PublicKey, want.PublicKey)
+	}
+	if *prompts != 0 {
+		t.Errorf("prompted %d times despite the passphrase command", *prompts)
+	}
+}
+
+func TestIdentityCache(t *testing.T) {
+	idPath := filepath.Join(t.TempDir(), "age-identity.txt")
+	if _, err := GenerateProtectedIdentity(idPath, []byte("pw")); err != nil {
+		t.Fatalf("GenerateProtectedIdentity: %v", err)
+	}
+	prompts := stubPrompt(t, "pw")
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	origNow := nowFunc
+	nowFunc = func() time.Time { return now }
+	t.Cleanup(func() { nowFunc = origNow })
+
+	CacheIdentities(time.Hour)
+	t.Cleanup(func() { CacheIdentities(0) })
+
+	for i := 0; i < 3; i++ {
+		if _, err := FindIdentity(idPath); err != nil {
+			t.Fatalf("FindIdentity: %v", err)
+		}
+	}
+	if *prompts != 1 {
+		t.Fatalf("prompted %d times with the cache enabled, want 1", *prompts)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := FindIdentity(idPath); err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if *prompts != 2 {
+		t.Errorf("prompted %d times after the cache expired, want 2", *prompts)
+	}
+
+	CacheIdentities(0)
+	if _, err := FindIdentity(idPath); err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if *prompts != 3 {
+		t.Errorf("prompted %d times with the cache disabled, want 3", *prompts)
+	}
+}
+
+func TestRotateKeepsPassphraseProtection(t *testing.T) {
+	t.Setenv(PassphraseEnv, "old")
+	repoRoot := t.TempDir()
+	idPath := filepath.Join(t.TempDir(), "age-identity.txt")
+	if _, err := Init(repoRoot, InitOptions{IdentityPath: idPath, Passphrase: true}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	result, err := Rotate(repoRoot, RotateOptions{IdentityPath: idPath})
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if !result.NewIdentity.Encrypted {
+		t.Error("rotated identity is not passphrase-protected")
+	}
+	data, _ := os.ReadFile(idPath)
+	if strings.Contains(string(data), "AGE-SECRET-KEY") {
+		t.Error("rotated identity file holds the key in plaintext")
+	}
+}
@@ -0,0 +1,315 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recipientFileHeader opens every recipient file dotctl writes. The file stays
+// a plain age recipients file, usable with `age -R`.
+const recipientFileHeader = "# age recipients for dotctl secrets, one age or SSH public key per line.\n" +
+	"# A comment directly above a key labels it.\n"
+
+// legacyRecipientComment is the header of single-key recipient files written
+// by older versions; it is not a label.
+const legacyRecipientComment = "age public key for dotctl secrets"
+
+// ReadRecipients parses .age-recipient.txt in the repo root. A comment line
+// directly above a key, with no blank line in between, becomes its Comment.
+func ReadRecipients(repoRoot string) ([]Recipient, error) {
+	path := filepath.Join(repoRoot, DefaultRecipientFile)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading recipient file: %w", err)
+	}
+
+	var recipients []Recipient
+	var comment string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			comment = ""
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		default:
+			key, keyComment, err := normalizeRecipient(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient in %q: %w", path, err)
+			}
+			if comment == legacyRecipientComment || comment == "" {
+				comment = keyComment
+			}
+			recipients = append(recipients, Recipient{PublicKey: key, Comment: comment})
+			comment = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading recipient file: %w", err)
+	}
+	return recipients, nil
+}
+
+// FindRecipients returns the public keys in .age-recipient.txt in the repo
+// root, in file order. It fails if the file lists none.
+func FindRecipients(repoRoot string) ([]string, error) {
+	recipients, err := ReadRecipients(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipient found in %q", filepath.Join(repoRoot, DefaultRecipientFile))
+	}
+	return recipientKeys(recipients), nil
+}
+
+// WriteRecipients replaces .age-recipient.txt in the repo root.
+func WriteRecipients(repoRoot string, recipients []Recipient) error {
+	var b strings.Builder
+	b.WriteString(recipientFileHeader)
+	for _, r := range recipients {
+		b.WriteString("\n")
+		if r.Comment != "" {
+			fmt.Fprintf(&b, "# %s\n", r.Comment)
+		}
+		fmt.Fprintf(&b, "%s\n", r.PublicKey)
+	}
+
+	path := filepath.Join(repoRoot, DefaultRecipientFile)
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("writing recipient file: %w", err)
+	}
+	return nil
+}
+
+// AddRecipient adds an age or SSH public key to the recipient file and
+// re-encrypts every encrypted file in the repo for the new set. Adding a key
+// that is already listed updates its comment and re-encrypts all the same.
+// An SSH key's own comment (user@host) is the default label.
+func AddRecipient(repoRoot, publicKey string, opts RecipientOptions) (*RecipientsResult, error) {
+	publicKey, keyComment, err := normalizeRecipient(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	recipients, err := ReadRecipients(repoRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for i := range recipients {
+		if recipients[i].PublicKey == publicKey && opts.Comment != "" {
+			recipients[i].Comment = opts.Comment
+		}
+	}
+	if !containsRecipient(recipients, publicKey) {
+		comment := opts.Comment
+		if comment == "" {
+			comment = keyComment
+		}
+		recipients = append(recipients, Recipient{PublicKey: publicKey, Comment: comment})
+	}
+
+	return updateRecipients(repoRoot, recipients, opts.IdentityPath, nil)
+}
+
+// RemoveRecipient removes the recipient whose public key or comment is name
+// and re-encrypts every encrypted file in the repo for the remaining set. The
+// last recipient cannot be removed, nor the local identity's own key unless
+// opts.Force is set.
+func RemoveRecipient(repoRoot, name string, opts RecipientOptions) (*RecipientsResult, error) {
+	recipients, err := ReadRecipients(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if key, _, err := normalizeRecipient(name); err == nil {
+		name = key
+	}
+	match := -1
+	for i, r := range recipients {
+		if name == "" || (r.PublicKey != name && r.Comment != name) {
+			continue
+		}
+		if match >= 0 {
+			return nil, fmt.Errorf("%q matches more than one recipient; use the public key", name)
+		}
+		match = i
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("no recipient matches %q", name)
+	}
+	if len(recipients) == 1 {
+		return nil, fmt.Errorf("cannot remove the last recipient")
+	}
+
+	var id *Identity
+	if !opts.Force {
+		removed := recipients[match].PublicKey
+		if id, err = FindIdentity(opts.IdentityPath); err == nil && id.PublicKey == removed {
+			return nil, fmt.Errorf("%s is this machine's own key; it could no longer decrypt (use --force to remove it anyway)", removed)
+		}
+	}
+
+	remaining := append(recipients[:match:match], recipients[match+1:]...)
+	return updateRecipients(repoRoot, remaining, opts.IdentityPath, id)
+}
+
+// updateRecipients re-encrypts the repo's encrypted files for recipients and
+// then writes the recipient file. The identity, id if already loaded, is only
+// needed when there are files to re-encrypt.
+func updateRecipients(repoRoot string, recipients []Recipient, identityPath string, id *Identity) (*RecipientsResult, error) {
+	encFiles, err := findEncryptedFiles(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("scanning encrypted files: %w", err)
+	}
+
+	var reEncrypted []string
+	if len(encFiles) > 0 {
+		if id == nil {
+			if id, err = FindIdentity(identityPath); err != nil {
+				return nil, fmt.Errorf("loading identity: %w", err)
+			}
+		}
+		decrypted, err := decryptFiles(repoRoot, encFiles, id)
+		if err != nil {
+			return nil, err
+		}
+		reEncrypted, err = encryptFiles(repoRoot, decrypted, recipientKeys(recipients))
+		if err != nil {
+			// Every file still opens with id, so running again finishes
+			// the job.
+			return nil, fmt.Errorf("%w; %s was not updated, run the command again", err, DefaultRecipientFile)
+		}
+	}
+
+	if err := WriteRecipients(repoRoot, recipients); err != nil {
+		return nil, err
+	}
+	return &RecipientsResult{Recipients: recipients, ReEncrypted: reEncrypted}, nil
+}
+
+// decryptedFile holds the plaintext of an encrypted repo file in memory.
+type decryptedFile struct {
+	path      string // absolute path of the encrypted file
+	plaintext []byte
+	format    StructuredFormat // set when only the values were encrypted
+}
+
+// decryptFiles decrypts every file before any is rewritten, so a file the
+// identity cannot open leaves the repo untouched.
+func decryptFiles(repoRoot string, encFiles []string, id *Identity) ([]decryptedFile, error) {
+	decrypted := make([]decryptedFile, 0, len(encFiles))
+	for _, f := range encFiles {
+		absPath := filepath.Join(repoRoot, f)
+		ciphertext, err := os.ReadFile(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", f, err)
+		}
+		df := decryptedFile{path: absPath}
+		if IsStructuredCiphertext(absPath, ciphertext) {
+			df.format, _ = StructuredFormatOf(absPath)
+			df.plaintext, err = DecryptStructured(ciphertext, df.format, id)
+		} else {
+			df.plaintext, err = DecryptBytes(ciphertext, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decrypting %q: %w", f, err)
+		}
+		decrypted = append(decrypted, df)
+	}
+	return decrypted, nil
+}
+
+// encryptFiles writes each file back encrypted for keys and returns their
+// paths relative to repoRoot. Every file is encrypted before any is written,
+// and each is replaced through a temporary file, so a failure leaves every
+// file whole; the error lists the files already rewritten.
+func encryptFiles(repoRoot string, files []decryptedFile, keys []string) ([]string, error) {
+	ciphertexts := make([][]byte, len(files))
+	for i, df := range files {
+		var err error
+		if df.format != "" {
+			ciphertexts[i], err = EncryptStructured(df.plaintext, df.format, keys...)
+		} else {
+			ciphertexts[i], err = EncryptBytes(df.plaintext, keys...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("re-encrypting %q: %w", df.path, err)
+		}
+	}
+
+	var reEncrypted []string
+	for i, df := range files {
+		rel, _ := filepath.Rel(repoRoot, df.path)
+		if err := replaceFile(df.path, ciphertexts[i]); err != nil {
+			if len(reEncrypted) == 0 {
+				return nil, fmt.Errorf("writing re-encrypted %q: %w", rel, err)
+			}
+			return reEncrypted, fmt.Errorf("writing re-encrypted %q: %w (already re-encrypted: %s)", rel, err, strings.Join(reEncrypted, ", "))
+		}
+		reEncrypted = append(reEncrypted, rel)
+	}
+	return reEncrypted, nil
+}
+
+// replaceFile replaces path with data through a temporary file in the same
+// directory, keeping path's permissions.
+func replaceFile(path string, data []byte) error {
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	// The temporary name has no .enc. marker, so a leftover is never taken
+	// for an encrypted file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dotctl-reencrypt-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := renameFile(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// containsRecipient reports whether publicKey is among recipients.
+func containsRecipient(recipients []Recipient, publicKey string) bool {
+	for _, r := range recipients {
+		if r.PublicKey == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// recipientKeys returns the public keys of recipients.
+func recipientKeys(recipients []Recipient) []string {
+	keys := make([]string, len(recipients))
+	for i, r := range recipients {
+		keys[i] = r.PublicKey
+	}
+	return keys
+}
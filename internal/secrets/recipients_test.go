@@ -0,0 +1,227 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestReadRecipientsComments(t *testing.T) {
+	dir := t.TempDir()
+	laptop, _ := age.GenerateX25519Identity()
+	desktop, _ := age.GenerateX25519Identity()
+	content := "# age public key for dotctl secrets\n" + laptop.Recipient().String() + "\n" +
+		"\n# not a label\n\n# desktop\n" + desktop.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(dir, DefaultRecipientFile), []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	got, err := ReadRecipients(dir)
+	if err != nil {
+		t.Fatalf("ReadRecipients: %v", err)
+	}
+	want := []Recipient{
+		{PublicKey: laptop.Recipient().String()},
+		{PublicKey: desktop.Recipient().String(), Comment: "desktop"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadRecipients = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("recipient %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Round trip keeps keys and labels.
+	if err := WriteRecipients(dir, got); err != nil {
+		t.Fatalf("WriteRecipients: %v", err)
+	}
+	again, err := ReadRecipients(dir)
+	if err != nil {
+		t.Fatalf("ReadRecipients after write: %v", err)
+	}
+	for i := range want {
+		if again[i] != want[i] {
+			t.Errorf("round trip recipient %d = %+v, want %+v", i, again[i], want[i])
+		}
+	}
+}
+
+func TestReadRecipientsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, DefaultRecipientFile), []byte("not-a-key\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := ReadRecipients(dir); err == nil {
+		t.Error("expected error for invalid recipient")
+	}
+}
+
+func TestAddAndRemoveRecipient(t *testing.T) {
+	repoRoot, idPath, id := setupRepo(t)
+
+	envPath := filepath.Join(repoRoot, ".env")
+	if err := os.WriteFile(envPath, []byte("TOKEN=abc\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	encRel, err := Encrypt(repoRoot, ".env", EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	other, err := GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+
+	// Before adding, the other machine cannot decrypt.
+	if _, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encRel), other); err == nil {
+		t.Fatal("other identity decrypted before being added")
+	}
+
+	result, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath, Comment: "desktop"})
+	if err != nil {
+		t.Fatalf("AddRecipient: %v", err)
+	}
+	if len(result.Recipients) != 2 || len(result.ReEncrypted) != 1 {
+		t.Fatalf("AddRecipient result = %+v", result)
+	}
+	for _, who := range []*Identity{id, other} {
+		plain, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encRel), who)
+		if err != nil {
+			t.Fatalf("decrypt with %s: %v", who.PublicKey, err)
+		}
+		if string(plain) != "TOKEN=abc\n" {
+			t.Errorf("plaintext = %q", plain)
+		}
+	}
+
+	// Adding again is idempotent.
+	if result, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath}); err != nil || len(result.Recipients) != 2 {
+		t.Fatalf("AddRecipient again = %+v, %v", result, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(repoRoot, DefaultRecipientFile))
+	if !strings.Contains(string(data), "# desktop\n"+other.PublicKey) {
+		t.Errorf("recipient file lost the label:\n%s", data)
+	}
+
+	// The local key is protected unless forced.
+	if _, err := RemoveRecipient(repoRoot, id.PublicKey, RecipientOptions{IdentityPath: idPath}); err == nil {
+		t.Error("expected error removing own key")
+	}
+
+	// Remove by label.
+	result, err = RemoveRecipient(repoRoot, "desktop", RecipientOptions{IdentityPath: idPath})
+	if err != nil {
+		t.Fatalf("RemoveRecipient: %v", err)
+	}
+	if len(result.Recipients) != 1 || result.Recipients[0].PublicKey != id.PublicKey {
+		t.Errorf("recipients after remove = %+v", result.Recipients)
+	}
+	if _, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encRel), other); err == nil {
+		t.Error("removed identity can still decrypt")
+	}
+
+	// The last recipient cannot be removed.
+	if _, err := RemoveRecipient(repoRoot, id.PublicKey, RecipientOptions{IdentityPath: idPath, Force: true}); err == nil {
+		t.Error("expected error removing the last recipient")
+	}
+}
+
+func TestAddRecipientNeedsIdentityForEncryptedFiles(t *testing.T) {
+	repoRoot, _, _ := setupRepo(t)
+
+	if err := os.WriteFile(filepath.Join(repoRoot, "api.key"), []byte("k"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := Encrypt(repoRoot, "api.key", EncryptOptions{}); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	before, _ := os.ReadFile(filepath.Join(repoRoot, DefaultRecipientFile))
+
+	stranger, _ := age.GenerateX25519Identity()
+	_, err := AddRecipient(repoRoot, stranger.Recipient().String(), RecipientOptions{
+		IdentityPath: filepath.Join(t.TempDir(), "missing.txt"),
+	})
+	if err == nil {
+		t.Fatal("expected error without an identity")
+	}
+
+	after, _ := os.ReadFile(filepath.Join(repoRoot, DefaultRecipientFile))
+	if string(before) != string(after) {
+		t.Error("recipient file changed although re-encryption failed")
+	}
+}
+
+func TestAddRecipientWriteFailureIsResumable(t *testing.T) {
+	repoRoot, idPath, id := setupRepo(t)
+
+	for _, name := range []string{"a.key", "b.key"} {
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if _, err := Encrypt(repoRoot, name, EncryptOptions{}); err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+	}
+	before, _ := os.ReadFile(filepath.Join(repoRoot, DefaultRecipientFile))
+	other, _ := GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+
+	// The second rewrite fails.
+	renames := 0
+	renameFile = func(oldPath, newPath string) error {
+		if renames++; renames == 2 {
+			return os.ErrPermission
+		}
+		return os.Rename(oldPath, newPath)
+	}
+	t.Cleanup(func() { renameFile = os.Rename })
+
+	_, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath})
+	if err == nil || !strings.Contains(err.Error(), "already re-encrypted: a.enc.key") || !strings.Contains(err.Error(), "run the command again") {
+		t.Fatalf("AddRecipient error = %v, want the rewritten files listed", err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(repoRoot, DefaultRecipientFile)); string(after) != string(before) {
+		t.Error("recipient file changed although re-encryption failed")
+	}
+	entries, _ := os.ReadDir(repoRoot)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".dotctl-reencrypt-") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+
+	// Every file is whole and the run can be repeated.
+	renameFile = os.Rename
+	if _, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath}); err != nil {
+		t.Fatalf("AddRecipient again: %v", err)
+	}
+	for _, name := range []string{"a.enc.key", "b.enc.key"} {
+		for _, who := range []*Identity{id, other} {
+			if _, err := DecryptFileWithIdentity(filepath.Join(repoRoot, name), who); err != nil {
+				t.Errorf("decrypt %s with %s: %v", name, who.PublicKey, err)
+			}
+		}
+	}
+}
+
+func TestInitAppendsToExistingRecipients(t *testing.T) {
+	repoRoot, _, first := setupRepo(t)
+
+	second, err := Init(repoRoot, InitOptions{IdentityPath: filepath.Join(t.TempDir(), "age-identity.txt")})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	keys, err := FindRecipients(repoRoot)
+	if err != nil {
+		t.Fatalf("FindRecipients: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != first.PublicKey || keys[1] != second.PublicKey {
+		t.Errorf("recipients = %v, want [%s %s]", keys, first.PublicKey, second.PublicKey)
+	}
+}
@@ -1,13 +1,16 @@
 package secrets
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-// Rotate generates a new key and re-encrypts all protected files.
+// Rotate generates a new key and re-encrypts all protected files. A
+// passphrase-protected identity is replaced by one protected with a new
+// passphrase.
 func Rotate(repoRoot string, opts RotateOptions) (*RotateResult, error) {
 	idPath := opts.IdentityPath
 	if idPath == "" {
@@ -19,6 +22,9 @@ func Rotate(repoRoot string, opts RotateOptions) (*RotateResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("loading old identity: %w", err)
 	}
+	if IsSSHRecipient(oldID.PublicKey) {
+		return nil, fmt.Errorf("%q is an SSH key; replace it with ssh-keygen and update 'dotctl secrets recipients' instead", idPath)
+	}
 
 	// Find all encrypted files in repo.
 	encFiles, err := findEncryptedFiles(repoRoot)
@@ -27,18 +33,23 @@ func Rotate(repoRoot string, opts RotateOptions) (*RotateResult, error) {
 	}
 
 	// Decrypt all files with old key (in memory).
-	type decryptedFile struct {
-		path      string
-		plaintext []byte
-	}
-	var decrypted []decryptedFile
-	for _, f := range encFiles {
-		absPath := filepath.Join(repoRoot, f)
-		plain, err := DecryptFileWithIdentity(absPath, oldID)
-		if err != nil {
-			return nil, fmt.Errorf("decrypting %q with old key: %w", f, err)
+	decrypted, err := decryptFiles(repoRoot, encFiles, oldID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new key takes the old key's place among the recipients; other
+	// machines and teammates keep access.
+	recipients, err := ReadRecipients(repoRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var passphrase []byte
+	if oldID.Encrypted {
+		if passphrase, err = newPassphrase(idPath); err != nil {
+			return nil, err
 		}
-		decrypted = append(decrypted, decryptedFile{path: absPath, plaintext: plain})
 	}
 
 	// Backup old key.
@@ -48,27 +59,30 @@ func Rotate(repoRoot string, opts RotateOptions) (*RotateResult, error) {
 	}
 
 	// Generate new identity.
-	newID, err := GenerateIdentity(idPath)
+	newID, err := generateIdentity(idPath, passphrase)
 	if err != nil {
 		return nil, fmt.Errorf("generating new identity: %w", err)
 	}
 
-	// Re-encrypt all files with new key.
-	var reEncrypted []string
-	for _, df := range decrypted {
-		ciphertext, err := EncryptBytes(df.plaintext, newID.PublicKey)
-		if err != nil {
-			return nil, fmt.Errorf("re-encrypting %q: %w", df.path, err)
-		}
-		if err := os.WriteFile(df.path, ciphertext, 0o644); err != nil {
-			return nil, fmt.Errorf("writing re-encrypted %q: %w", df.path, err)
+	replaced := false
+	for i := range recipients {
+		if recipients[i].PublicKey == oldID.PublicKey {
+			recipients[i].PublicKey = newID.PublicKey
+			replaced = true
 		}
-		rel, _ := filepath.Rel(repoRoot, df.path)
-		reEncrypted = append(reEncrypted, rel)
+	}
+	if !replaced {
+		recipients = append(recipients, Recipient{PublicKey: newID.PublicKey})
+	}
+
+	// Re-encrypt all files for the new recipient set.
+	reEncrypted, err := encryptFiles(repoRoot, decrypted, recipientKeys(recipients))
+	if err != nil {
+		return nil, fmt.Errorf("%w; files not listed as re-encrypted still need the previous key, kept at %s", err, backupPath)
 	}
 
 	// Update recipient file.
-	if err := WriteRecipientFile(repoRoot, newID.PublicKey); err != nil {
+	if err := WriteRecipients(repoRoot, recipients); err != nil {
 		return nil, fmt.Errorf("updating recipient file: %w", err)
 	}
 
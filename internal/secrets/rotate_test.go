@@ -22,6 +22,15 @@ func TestRotate(t *testing.T) {
 
 	oldPubKey := id.PublicKey
 
+	// A second machine's key survives the rotation.
+	other, err := GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	if _, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath}); err != nil {
+		t.Fatalf("AddRecipient: %v", err)
+	}
+
 	// Rotate keys.
 	result, err := Rotate(repoRoot, RotateOptions{IdentityPath: idPath})
 	if err != nil {
@@ -57,6 +66,9 @@ func TestRotate(t *testing.T) {
 		if len(plaintext) == 0 {
 			t.Errorf("decrypted %q is empty", encFile)
 		}
+		if _, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encFile), other); err != nil {
+			t.Errorf("Decrypt %q with other recipient: %v", encFile, err)
+		}
 	}
 
 	// Verify recipient file was updated.
@@ -67,4 +79,11 @@ func TestRotate(t *testing.T) {
 	if recipientKey != result.NewIdentity.PublicKey {
 		t.Errorf("recipient = %q, want %q", recipientKey, result.NewIdentity.PublicKey)
 	}
+	keys, err := FindRecipients(repoRoot)
+	if err != nil {
+		t.Fatalf("FindRecipients: %v", err)
+	}
+	if len(keys) != 2 || keys[1] != other.PublicKey {
+		t.Errorf("recipients after rotate = %v", keys)
+	}
 }
@@ -5,7 +5,7 @@ import "filippo.io/age"
 const (
 	// DefaultIdentityFile is the filename for the age private key.
 	DefaultIdentityFile = "age-identity.txt"
-	// DefaultRecipientFile is the filename for the age public key in the repo.
+	// DefaultRecipientFile is the filename for the age public keys in the repo.
 	DefaultRecipientFile = ".age-recipient.txt"
 )
 
@@ -19,18 +19,21 @@ var SensitivePatterns = []string{
 	"*.credentials",
 }
 
-// Identity represents a resolved age key pair.
+// Identity represents a resolved key pair: an age X25519 identity or an SSH key.
 type Identity struct {
 	PrivatePath string // absolute path to the identity file
-	PublicKey   string // age1... public key string
-	Recipient  *age.X25519Recipient
-	identity   *age.X25519Identity
+	PublicKey   string // age1... or "ssh-ed25519 AAAA..." public key string
+	Encrypted   bool   // the key file is passphrase-protected
+	Recipient  age.Recipient
+	identity   age.Identity
 }
 
 // InitOptions configures Init behavior.
 type InitOptions struct {
 	IdentityPath string // override default identity file location
 	ImportPath   string // path to existing identity file to import
+	SSHKeyPath   string // use this SSH private key instead of an age identity
+	Passphrase   bool   // encrypt the identity file with a passphrase
 	Force        bool   // overwrite existing identity
 }
 
@@ -38,6 +41,7 @@ type InitOptions struct {
 type EncryptOptions struct {
 	RecipientKey string // override recipient public key
 	Keep         bool   // keep original plaintext file after encrypting
+	Structured   bool   // encrypt only the values of a YAML/JSON/dotenv/INI file
 }
 
 // DecryptOptions configures Decrypt behavior.
@@ -69,6 +73,26 @@ type FileStatus struct {
 type Status struct {
 	Identity         *Identity
 	RecipientFile    string       // path to .age-recipient.txt in repo (empty if missing)
+	Recipients       []Recipient  // public keys files are encrypted for
 	EncryptedFiles   []FileStatus // files with .enc. in the repo
 	UnprotectedFiles []FileStatus // sensitive files that should be encrypted
 }
+
+// Recipient is one public key in the repo's recipient file.
+type Recipient struct {
+	PublicKey string `json:"public_key"`
+	Comment   string `json:"comment,omitempty"` // label from the comment line above the key
+}
+
+// RecipientOptions configures AddRecipient and RemoveRecipient.
+type RecipientOptions struct {
+	IdentityPath string // identity used to re-encrypt existing files
+	Comment      string // label for an added recipient
+	Force        bool   // allow removing the local identity's own key
+}
+
+// RecipientsResult describes the outcome of a recipient change.
+type RecipientsResult struct {
+	Recipients  []Recipient // recipient set after the change
+	ReEncrypted []string    // files that were re-encrypted
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	sshKeysMu sync.RWMutex
+	sshKeys   []string
+)
+
+// SetSSHKeys sets the SSH private keys FindIdentity falls back to when no age
+// identity exists. Empty means DefaultSSHKeyPaths.
+func SetSSHKeys(paths []string) {
+	sshKeysMu.Lock()
+	defer sshKeysMu.Unlock()
+	sshKeys = append([]string(nil), paths...)
+}
+
+// SSHKeyPaths returns the configured SSH private keys, with ~ expanded.
+func SSHKeyPaths() []string {
+	sshKeysMu.RLock()
+	paths := sshKeys
+	sshKeysMu.RUnlock()
+	if len(paths) == 0 {
+		return DefaultSSHKeyPaths()
+	}
+
+	home, _ := os.UserHomeDir()
+	expanded := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if home != "" && (p == "~" || strings.HasPrefix(p, "~/")) {
+			p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+		expanded = append(expanded, p)
+	}
+	return expanded
+}
+
+// DefaultSSHKeyPaths returns the SSH keys searched when none are configured.
+func DefaultSSHKeyPaths() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".ssh", "id_ed25519"),
+		filepath.Join(home, ".ssh", "id_rsa"),
+	}
+}
+
+// IsSSHRecipient reports whether key looks like an SSH public key rather than
+// an age1... key.
+func IsSSHRecipient(key string) bool {
+	return strings.HasPrefix(strings.TrimSpace(key), "ssh-")
+}
+
+// isSSHPrivateKey reports whether data is a PEM-encoded (OpenSSH or PKCS#1)
+// private key rather than an age identity file.
+func isSSHPrivateKey(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) && !isProtectedIdentity(data)
+}
+
+// parseSSHIdentity loads an ssh-ed25519 or ssh-rsa private key. The passphrase
+// of a protected key is only asked for when a file is actually encrypted to
+// it; its public key comes from the key itself or the adjacent .pub file.
+func parseSSHIdentity(path string, pemBytes []byte) (*Identity, error) {
+	identity, err := agessh.ParseIdentity(pemBytes)
+	if err == nil {
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SSH key %q: %w", path, err)
+		}
+		return newSSHIdentity(path, signer.PublicKey(), identity)
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, fmt.Errorf("parsing SSH key %q: %w", path, err)
+	}
+	pubKey := missing.PublicKey
+	if pubKey == nil {
+		pubData, readErr := os.ReadFile(path + ".pub")
+		if readErr != nil {
+			return nil, fmt.Errorf("SSH key %q is passphrase-protected and its public key is not embedded: %w", path, readErr)
+		}
+		pubKey, _, _, _, err = ssh.ParseAuthorizedKey(pubData)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", path+".pub", err)
+		}
+	}
+
+	encrypted, err := agessh.NewEncryptedSSHIdentity(pubKey, pemBytes, func() ([]byte, error) {
+		return readPassphrase(fmt.Sprintf("Enter passphrase for %s: ", path))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading SSH key %q: %w", path, err)
+	}
+	id, err := newSSHIdentity(path, pubKey, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	id.Encrypted = true
+	return id, nil
+}
+
+func newSSHIdentity(path string, pubKey ssh.PublicKey, identity age.Identity) (*Identity, error) {
+	publicKey := sshPublicKeyString(pubKey)
+	recipient, err := agessh.ParseRecipient(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("SSH key %q: %w", path, err)
+	}
+	return &Identity{
+		PrivatePath: path,
+		PublicKey:   publicKey,
+		Recipient:   recipient,
+		identity:    identity,
+	}, nil
+}
+
+// findSSHKey returns the first configured SSH key that exists.
+func findSSHKey() (string, bool) {
+	for _, path := range SSHKeyPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// sshPublicKeyString formats pubKey as "<type> <base64>", without a comment.
+func sshPublicKeyString(pubKey ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+}
+
+// normalizeRecipient validates a recipient and returns it in the form stored
+// in the recipient file. An SSH public key loses its trailing comment, which
+// is returned separately.
+func normalizeRecipient(key string) (normalized, comment string, err error) {
+	key = strings.TrimSpace(key)
+	if !IsSSHRecipient(key) {
+		if _, err := parseRecipient(key); err != nil {
+			return "", "", err
+		}
+		return key, "", nil
+	}
+
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return "", "", fmt.Errorf("malformed SSH recipient %q: %w", key, err)
+	}
+	normalized = sshPublicKeyString(pubKey)
+	if _, err := parseRecipient(normalized); err != nil {
+		return "", "", err
+	}
+	return normalized, comment, nil
+}
@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeSSHKey writes an ed25519 OpenSSH private key (passphrase-protected
+// unless passphrase is empty) and returns its path and authorized_keys line.
+func writeSSHKey(t *testing.T, passphrase string) (path, authorizedKey string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "me@laptop")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "me@laptop", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("NewPublicKey: %v", err)
+	}
+
+	path = filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " me@laptop"
+}
+
+func TestSSHKeyRecipientAndIdentity(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	repoRoot := t.TempDir()
+	keyPath, authorizedKey := writeSSHKey(t, "")
+
+	id, err := Init(repoRoot, InitOptions{SSHKeyPath: keyPath})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !strings.HasPrefix(id.PublicKey, "ssh-ed25519 ") || strings.HasSuffix(id.PublicKey, "me@laptop") {
+		t.Errorf("PublicKey = %q, want ssh-ed25519 key without comment", id.PublicKey)
+	}
+	if !strings.HasPrefix(authorizedKey, id.PublicKey) {
+		t.Errorf("PublicKey = %q, want prefix of %q", id.PublicKey, authorizedKey)
+	}
+	if IdentityExists("") {
+		t.Error("Init with an SSH key should not generate an age identity")
+	}
+
+	if err := os.WriteFile(filepath.Join(repoRoot, "api.key"), []byte("key-material"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	encRel, err := Encrypt(repoRoot, "api.key", EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	plain, _, err := Decrypt(repoRoot, encRel, DecryptOptions{IdentityPath: keyPath, Stdout: true, Keep: true})
+	if err != nil {
+		t.Fatalf("Decrypt with SSH key: %v", err)
+	}
+	if string(plain) != "key-material" {
+		t.Errorf("plaintext = %q", plain)
+	}
+}
+
+func TestSSHKeyWithPassphrase(t *testing.T) {
+	repoRoot, idPath, _ := setupRepo(t)
+	keyPath, authorizedKey := writeSSHKey(t, "correct horse")
+
+	prompts := 0
+	answer := "correct horse"
+	orig := promptPassphrase
+	promptPassphrase = func(prompt string) ([]byte, error) {
+		prompts++
+		if !strings.Contains(prompt, keyPath) {
+			t.Errorf("prompt = %q, want key path", prompt)
+		}
+		return []byte(answer), nil
+	}
+	t.Cleanup(func() { promptPassphrase = orig })
+
+	// Loading the key needs no passphrase: the public key is embedded.
+	sshID, err := FindIdentity(keyPath)
+	if err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if prompts != 0 {
+		t.Fatalf("prompted %d times while loading the key", prompts)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoRoot, ".env"), []byte("A=1\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	encRel, err := Encrypt(repoRoot, ".env", EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	result, err := AddRecipient(repoRoot, authorizedKey, RecipientOptions{IdentityPath: idPath})
+	if err != nil {
+		t.Fatalf("AddRecipient: %v", err)
+	}
+	if got := result.Recipients[len(result.Recipients)-1]; got.PublicKey != sshID.PublicKey || got.Comment != "me@laptop" {
+		t.Errorf("added recipient = %+v", got)
+	}
+
+	answer = "wrong"
+	if _, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encRel), sshID); err == nil {
+		t.Fatal("decrypted with a wrong passphrase")
+	}
+
+	answer = "correct horse"
+	plain, err := DecryptFileWithIdentity(filepath.Join(repoRoot, encRel), sshID)
+	if err != nil {
+		t.Fatalf("DecryptFileWithIdentity: %v", err)
+	}
+	if string(plain) != "A=1\n" {
+		t.Errorf("plaintext = %q", plain)
+	}
+	if prompts != 2 {
+		t.Errorf("prompted %d times, want 2", prompts)
+	}
+}
+
+func TestFindIdentityFallsBackToSSHKey(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	keyPath, _ := writeSSHKey(t, "")
+
+	SetSSHKeys([]string{filepath.Join(t.TempDir(), "missing"), keyPath})
+	t.Cleanup(func() { SetSSHKeys(nil) })
+
+	id, err := FindIdentity("")
+	if err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if id.PrivatePath != keyPath {
+		t.Errorf("PrivatePath = %q, want %q", id.PrivatePath, keyPath)
+	}
+
+	// An age identity at the default path takes precedence.
+	ageID, err := GenerateIdentity(DefaultIdentityPath())
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	id, err = FindIdentity("")
+	if err != nil {
+		t.Fatalf("FindIdentity: %v", err)
+	}
+	if id.PublicKey != ageID.PublicKey {
+		t.Errorf("PublicKey = %q, want age identity %q", id.PublicKey, ageID.PublicKey)
+	}
+}
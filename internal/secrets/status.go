@@ -6,20 +6,20 @@ import "fmt"
 func GetStatus(repoRoot string, identityPath string) (*Status, error) {
 	status := &Status{}
 
-	// Check identity.
-	if identityPath == "" {
-		identityPath = DefaultIdentityPath()
-	}
-	if IdentityExists(identityPath) {
-		id, err := FindIdentity(identityPath)
-		if err == nil {
-			status.Identity = id
-		}
+	// Check identity: the age identity or, without one, a configured SSH key.
+	// A passphrase-protected identity is reported without unlocking it.
+	if id, err := findIdentity(identityPath, false); err == nil {
+		status.Identity = id
 	}
 
 	// Check recipient file.
 	if RecipientExists(repoRoot) {
 		status.RecipientFile = DefaultRecipientFile
+		recipients, err := ReadRecipients(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		status.Recipients = recipients
 	}
 
 	// Find encrypted files.
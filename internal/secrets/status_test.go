@@ -55,6 +55,8 @@ func TestGetStatus(t *testing.T) {
 
 func TestGetStatusNoSecrets(t *testing.T) {
 	repoRoot := t.TempDir()
+	SetSSHKeys([]string{filepath.Join(repoRoot, "no-such-key")})
+	t.Cleanup(func() { SetSSHKeys(nil) })
 
 	status, err := GetStatus(repoRoot, "")
 	if err != nil {
@@ -0,0 +1,525 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// StructuredFormat is a document format whose values can be encrypted
+// individually, leaving keys and layout readable.
+type StructuredFormat string
+
+// Supported structured formats.
+const (
+	FormatYAML   StructuredFormat = "yaml"
+	FormatJSON   StructuredFormat = "json"
+	FormatDotenv StructuredFormat = "dotenv"
+	FormatINI    StructuredFormat = "ini"
+)
+
+const (
+	// sopsVersion is the sops release whose file layout structured files follow.
+	sopsVersion = "3.9.0"
+	// sopsUnencryptedSuffix marks keys whose values are left in plaintext.
+	sopsUnencryptedSuffix = "_unencrypted"
+	// sopsMetadataKey is the top-level key holding the sops metadata.
+	sopsMetadataKey = "sops"
+	// dataKeySize is the length of the AES-256 key encrypting the values.
+	dataKeySize = 32
+	// valueNonceSize is the GCM nonce length sops uses for values.
+	valueNonceSize = 32
+)
+
+// sopsMetadata is the "sops" section of a structured file: the data key
+// encrypted for each age recipient, and the encrypted MAC of all values.
+type sopsMetadata struct {
+	Age               []sopsAgeKey `yaml:"age" json:"age"`
+	LastModified      string       `yaml:"lastmodified" json:"lastmodified"`
+	MAC               string       `yaml:"mac" json:"mac"`
+	UnencryptedSuffix string       `yaml:"unencrypted_suffix,omitempty" json:"unencrypted_suffix,omitempty"`
+	Version           string       `yaml:"version" json:"version"`
+}
+
+// sopsAgeKey is the data key encrypted (armored) for one age recipient.
+type sopsAgeKey struct {
+	Recipient string `yaml:"recipient" json:"recipient"`
+	Enc       string `yaml:"enc" json:"enc"`
+}
+
+// sopsComment is the text of a comment line after its marker ("#" or ";").
+// As in sops, comments are encrypted without a key binding and are not part
+// of the MAC.
+type sopsComment string
+
+// walkFunc is called for one value or comment of a structured document. path
+// is the sops key path (list indexes are not part of it) and key a readable
+// name such as "servers[0].host". It returns the value to store in its place.
+type walkFunc func(path []string, key string, value interface{}) (interface{}, error)
+
+// structuredDoc is a parsed structured file.
+type structuredDoc interface {
+	// walk calls fn for every value and comment (as a sopsComment) outside
+	// the sops metadata, in document order.
+	walk(fn walkFunc) error
+	// metadata returns the sops metadata, or nil if the file has none.
+	metadata() (*sopsMetadata, error)
+	// setMetadata replaces the sops metadata; nil removes it.
+	setMetadata(m *sopsMetadata) error
+	marshal() ([]byte, error)
+}
+
+// StructuredFormatOf returns the structured format of path from its name,
+// ignoring the .enc marker: .yaml/.yml, .json, .ini, and .env files.
+func StructuredFormatOf(path string) (StructuredFormat, bool) {
+	base := filepath.Base(DecryptedName(path))
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	case ".json":
+		return FormatJSON, true
+	case ".ini":
+		return FormatINI, true
+	case ".env":
+		return FormatDotenv, true
+	}
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return FormatDotenv, true
+	}
+	return "", false
+}
+
+// IsStructuredCiphertext reports whether data, the content of path, is a
+// structured file with values encrypted for at least one age recipient, as
+// written by EncryptStructured or by sops with age keys.
+func IsStructuredCiphertext(path string, data []byte) bool {
+	return len(StructuredRecipients(path, data)) > 0
+}
+
+// StructuredRecipients returns the age recipients listed in the sops metadata
+// of data, the content of path, or nil when it is not a structured file with
+// age-encrypted values.
+func StructuredRecipients(path string, data []byte) []string {
+	format, ok := StructuredFormatOf(path)
+	if !ok || IsAgeCiphertext(data) {
+		return nil
+	}
+	doc, err := parseStructured(format, data)
+	if err != nil {
+		return nil
+	}
+	meta, err := doc.metadata()
+	if err != nil || meta == nil {
+		return nil
+	}
+	recipients := make([]string, 0, len(meta.Age))
+	for _, key := range meta.Age {
+		recipients = append(recipients, strings.TrimSpace(key.Recipient))
+	}
+	return recipients
+}
+
+// EncryptStructured encrypts every value of a YAML, JSON, dotenv or INI
+// document with a fresh data key, in the sops layout: values become
+// ENC[AES256_GCM,...] strings bound to their key path, and a "sops" section
+// holds the data key encrypted for each recipient and a MAC over all values.
+// Comments are encrypted too. Keys ending in _unencrypted keep their values
+// in plaintext.
+func EncryptStructured(plaintext []byte, format StructuredFormat, recipientKeys ...string) ([]byte, error) {
+	if len(recipientKeys) == 0 {
+		return nil, fmt.Errorf("no recipients to encrypt for")
+	}
+	doc, err := parseStructured(format, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if meta, err := doc.metadata(); err != nil {
+		return nil, err
+	} else if meta != nil {
+		return nil, fmt.Errorf("document is already encrypted (it has a %q section)", sopsMetadataKey)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("generating data key: %w", err)
+	}
+
+	mac := sha512.New()
+	err = doc.walk(func(path []string, _ string, value interface{}) (interface{}, error) {
+		if comment, ok := value.(sopsComment); ok {
+			if !shouldEncryptPath(path) {
+				return value, nil
+			}
+			return encryptValue(comment, dataKey, "")
+		}
+		mac.Write(sopsValueBytes(value))
+		if !shouldEncryptPath(path) {
+			return value, nil
+		}
+		return encryptValue(value, dataKey, sopsAdditionalData(path))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lastModified := nowFunc().UTC().Format(time.RFC3339)
+	encryptedMAC, err := encryptValue(fmt.Sprintf("%X", mac.Sum(nil)), dataKey, lastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &sopsMetadata{
+		LastModified:      lastModified,
+		MAC:               encryptedMAC,
+		UnencryptedSuffix: sopsUnencryptedSuffix,
+		Version:           sopsVersion,
+	}
+	for _, key := range recipientKeys {
+		enc, err := encryptDataKey(dataKey, key)
+		if err != nil {
+			return nil, err
+		}
+		meta.Age = append(meta.Age, sopsAgeKey{Recipient: key, Enc: enc})
+	}
+
+	if err := doc.setMetadata(meta); err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+// DecryptStructured decrypts a document written by EncryptStructured (or by
+// sops with an age key) with id, verifying its MAC, and returns it without
+// the sops section.
+func DecryptStructured(ciphertext []byte, format StructuredFormat, id *Identity) ([]byte, error) {
+	doc, err := parseStructured(format, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := doc.metadata()
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("document has no %q section; it is not value-encrypted", sopsMetadataKey)
+	}
+
+	dataKey, err := decryptDataKey(meta, id)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := sha512.New()
+	err = doc.walk(func(path []string, key string, value interface{}) (interface{}, error) {
+		if comment, ok := value.(sopsComment); ok {
+			if !isEncryptedValue(string(comment)) {
+				return value, nil
+			}
+			plain, err := decryptValue(string(comment), dataKey, "")
+			if err != nil {
+				return nil, fmt.Errorf("decrypting comment near %q: %w", key, err)
+			}
+			return plain, nil
+		}
+		if s, ok := value.(string); ok && isEncryptedValue(s) {
+			plain, err := decryptValue(s, dataKey, sopsAdditionalData(path))
+			if err != nil {
+				return nil, fmt.Errorf("decrypting %s: %w", key, err)
+			}
+			value = plain
+		}
+		mac.Write(sopsValueBytes(value))
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wantMAC, err := decryptValue(meta.MAC, dataKey, meta.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting MAC: %w", err)
+	}
+	if got := fmt.Sprintf("%X", mac.Sum(nil)); !strings.EqualFold(got, fmt.Sprint(wantMAC)) {
+		return nil, fmt.Errorf("MAC mismatch: the file was modified without its key")
+	}
+
+	if err := doc.setMetadata(nil); err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+// StructuredChange is a value that differs between two versions of a
+// structured document.
+type StructuredChange struct {
+	Key  string `json:"key"`  // e.g. "database.password" or "servers[0].host"
+	Kind string `json:"kind"` // "added", "removed" or "changed"
+}
+
+// DiffStructured compares the values of two plaintext documents key by key.
+// Values that are still encrypted compare by ciphertext, so decrypt both
+// sides first.
+func DiffStructured(oldData, newData []byte, format StructuredFormat) ([]StructuredChange, error) {
+	oldValues, oldKeys, err := structuredValues(oldData, format)
+	if err != nil {
+		return nil, err
+	}
+	newValues, newKeys, err := structuredValues(newData, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []StructuredChange
+	for _, key := range oldKeys {
+		newValue, ok := newValues[key]
+		switch {
+		case !ok:
+			changes = append(changes, StructuredChange{Key: key, Kind: "removed"})
+		case newValue != oldValues[key]:
+			changes = append(changes, StructuredChange{Key: key, Kind: "changed"})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldValues[key]; !ok {
+			changes = append(changes, StructuredChange{Key: key, Kind: "added"})
+		}
+	}
+	return changes, nil
+}
+
+// structuredValues flattens a document into readable keys and value bytes,
+// returning the keys in document order.
+func structuredValues(data []byte, format StructuredFormat) (map[string]string, []string, error) {
+	doc, err := parseStructured(format, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string]string)
+	var keys []string
+	err = doc.walk(func(_ []string, key string, value interface{}) (interface{}, error) {
+		if _, ok := value.(sopsComment); ok {
+			return value, nil
+		}
+		if _, seen := values[key]; !seen {
+			keys = append(keys, key)
+		}
+		values[key] = string(sopsValueBytes(value))
+		return value, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, keys, nil
+}
+
+func parseStructured(format StructuredFormat, data []byte) (structuredDoc, error) {
+	switch format {
+	case FormatYAML, FormatJSON:
+		return parseTreeDoc(format, data)
+	case FormatDotenv:
+		return parseDotenvDoc(data), nil
+	case FormatINI:
+		return parseINIDoc(data)
+	default:
+		return nil, fmt.Errorf("unsupported structured format %q", format)
+	}
+}
+
+// shouldEncryptPath reports whether a value is encrypted: every value except
+// those under a key ending in _unencrypted.
+func shouldEncryptPath(path []string) bool {
+	for _, p := range path {
+		if strings.HasSuffix(p, sopsUnencryptedSuffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// sopsAdditionalData binds a value's ciphertext to its key path, so values
+// cannot be moved between keys.
+func sopsAdditionalData(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// sopsValueBytes is the byte form of a value fed to the MAC. Booleans are
+// title-cased, as in sops.
+func sopsValueBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case sopsComment:
+		return []byte(v)
+	case int:
+		return []byte(strconv.Itoa(v))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		if v {
+			return []byte("True")
+		}
+		return []byte("False")
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+var encryptedValueRe = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+func isEncryptedValue(s string) bool {
+	return strings.HasPrefix(s, "ENC[AES256_GCM,")
+}
+
+// encryptValue encrypts one value with AES-256-GCM under dataKey, recording
+// its type so decryption restores it. Empty strings and comments stay empty.
+func encryptValue(value interface{}, dataKey []byte, additionalData string) (string, error) {
+	var valueType string
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return "", nil
+		}
+		valueType = "str"
+	case sopsComment:
+		if v == "" {
+			return "", nil
+		}
+		valueType = "comment"
+	case int:
+		valueType = "int"
+	case float64:
+		valueType = "float"
+	case bool:
+		valueType = "bool"
+	default:
+		return "", fmt.Errorf("cannot encrypt value of type %T", value)
+	}
+
+	gcm, err := newValueCipher(dataKey, valueNonceSize)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, valueNonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := gcm.Seal(nil, iv, sopsValueBytes(value), []byte(additionalData))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(data), enc(iv), enc(tag), valueType), nil
+}
+
+// decryptValue reverses encryptValue.
+func decryptValue(s string, dataKey []byte, additionalData string) (interface{}, error) {
+	m := encryptedValueRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	var parts [3][]byte
+	for i := range parts {
+		b, err := base64.StdEncoding.DecodeString(m[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed encrypted value: %w", err)
+		}
+		parts[i] = b
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	gcm, err := newValueCipher(dataKey, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed (wrong key or value moved to another key)")
+	}
+
+	switch m[4] {
+	case "str", "bytes", "comment":
+		return string(plain), nil
+	case "int":
+		return strconv.Atoi(string(plain))
+	case "float":
+		return strconv.ParseFloat(string(plain), 64)
+	case "bool":
+		return strconv.ParseBool(string(plain))
+	default:
+		return nil, fmt.Errorf("unknown value type %q", m[4])
+	}
+}
+
+func newValueCipher(dataKey []byte, nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	if nonceSize == 0 {
+		return nil, fmt.Errorf("malformed encrypted value: empty nonce")
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, nonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+// encryptDataKey encrypts the data key for one recipient as an armored age
+// file, the form sops stores.
+func encryptDataKey(dataKey []byte, recipientKey string) (string, error) {
+	recipient, err := parseRecipient(recipientKey)
+	if err != nil {
+		return "", fmt.Errorf("parsing recipient key: %w", err)
+	}
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return "", fmt.Errorf("creating age writer: %w", err)
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return "", fmt.Errorf("encrypting data key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("finalizing encryption: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return "", fmt.Errorf("finalizing armor: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// decryptDataKey returns the data key from the first age entry id opens.
+func decryptDataKey(meta *sopsMetadata, id *Identity) ([]byte, error) {
+	if id.identity == nil {
+		return nil, fmt.Errorf("identity has no private key loaded")
+	}
+	for _, key := range meta.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(key.Enc))), id.identity)
+		if err != nil {
+			continue
+		}
+		dataKey, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting data key: %w", err)
+		}
+		if len(dataKey) != dataKeySize {
+			return nil, fmt.Errorf("data key has %d bytes, want %d", len(dataKey), dataKeySize)
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("none of the file's %d age recipient(s) match identity %s", len(meta.Age), id.PublicKey)
+}
@@ -0,0 +1,594 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// treeDoc is a YAML or JSON document. Both are parsed with yaml.v3, which
+// keeps key order and, for YAML, comments.
+type treeDoc struct {
+	format StructuredFormat
+	doc    *yaml.Node
+	root   *yaml.Node // top-level mapping
+}
+
+func parseTreeDoc(format StructuredFormat, data []byte) (*treeDoc, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", format, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parsing %s: the top level must be a mapping of keys to values", format)
+	}
+	return &treeDoc{format: format, doc: &doc, root: doc.Content[0]}, nil
+}
+
+func (d *treeDoc) walk(fn walkFunc) error {
+	if err := walkNodeComments(d.doc, nil, "", fn); err != nil {
+		return err
+	}
+	return walkTreeNode(d.root, nil, "", fn)
+}
+
+func walkTreeNode(n *yaml.Node, path []string, key string, fn walkFunc) error {
+	if err := walkNodeComments(n, path, key, fn); err != nil {
+		return err
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			name := n.Content[i].Value
+			if len(path) == 0 && name == sopsMetadataKey {
+				continue
+			}
+			childKey := name
+			if key != "" {
+				childKey = key + "." + name
+			}
+			childPath := append(path[:len(path):len(path)], name)
+			if err := walkNodeComments(n.Content[i], childPath, childKey, fn); err != nil {
+				return err
+			}
+			if err := walkTreeNode(n.Content[i+1], childPath, childKey, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			if err := walkTreeNode(item, path, fmt.Sprintf("%s[%d]", key, i), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		value, ok := scalarValue(n)
+		if !ok {
+			return nil
+		}
+		out, err := fn(path, key, value)
+		if err != nil {
+			return err
+		}
+		setScalar(n, out)
+	}
+	return nil
+}
+
+// walkNodeComments calls fn for each line of the head, line and foot comments
+// of n.
+func walkNodeComments(n *yaml.Node, path []string, key string, fn walkFunc) error {
+	for _, comment := range []*string{&n.HeadComment, &n.LineComment, &n.FootComment} {
+		if *comment == "" {
+			continue
+		}
+		lines := strings.Split(*comment, "\n")
+		for i, line := range lines {
+			out, err := walkCommentLine(line, "#", path, key, fn)
+			if err != nil {
+				return err
+			}
+			lines[i] = out
+		}
+		*comment = strings.Join(lines, "\n")
+	}
+	return nil
+}
+
+// walkCommentLine calls fn for the text after marker in a comment line and
+// returns the line with the result in its place. Other lines are returned
+// unchanged.
+func walkCommentLine(line, marker string, path []string, key string, fn walkFunc) (string, error) {
+	trimmed := strings.TrimLeft(line, " \t")
+	text, ok := strings.CutPrefix(trimmed, marker)
+	if !ok {
+		return line, nil
+	}
+	out, err := fn(path, key, sopsComment(text))
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-len(trimmed)] + marker + fmt.Sprint(out), nil
+}
+
+// scalarValue returns a scalar as a string, int, float64 or bool; nulls are
+// not values.
+func scalarValue(n *yaml.Node) (interface{}, bool) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, false
+	case "!!int":
+		if v, err := strconv.Atoi(n.Value); err == nil {
+			return v, true
+		}
+	case "!!float":
+		if v, err := strconv.ParseFloat(n.Value, 64); err == nil {
+			return v, true
+		}
+	case "!!bool":
+		if v, err := strconv.ParseBool(n.Value); err == nil {
+			return v, true
+		}
+	}
+	return n.Value, true
+}
+
+func setScalar(n *yaml.Node, value interface{}) {
+	n.Style = 0
+	switch v := value.(type) {
+	case int:
+		n.Tag, n.Value = "!!int", strconv.Itoa(v)
+	case float64:
+		n.Tag, n.Value = "!!float", formatFloat(v)
+	case bool:
+		n.Tag, n.Value = "!!bool", strconv.FormatBool(v)
+	default:
+		n.Tag, n.Value = "!!str", fmt.Sprint(v)
+		if strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+	}
+}
+
+// formatFloat formats a float so it still reads back as a float.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (d *treeDoc) metadataIndex() int {
+	for i := 0; i+1 < len(d.root.Content); i += 2 {
+		if d.root.Content[i].Value == sopsMetadataKey {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *treeDoc) metadata() (*sopsMetadata, error) {
+	i := d.metadataIndex()
+	if i < 0 {
+		return nil, nil
+	}
+	var meta sopsMetadata
+	if err := d.root.Content[i+1].Decode(&meta); err != nil {
+		return nil, fmt.Errorf("parsing %q section: %w", sopsMetadataKey, err)
+	}
+	return &meta, nil
+}
+
+func (d *treeDoc) setMetadata(m *sopsMetadata) error {
+	if i := d.metadataIndex(); i >= 0 {
+		d.root.Content = append(d.root.Content[:i], d.root.Content[i+2:]...)
+	}
+	if m == nil {
+		return nil
+	}
+	var value yaml.Node
+	if err := value.Encode(m); err != nil {
+		return fmt.Errorf("encoding %q section: %w", sopsMetadataKey, err)
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sopsMetadataKey}
+	d.root.Content = append(d.root.Content, key, &value)
+	return nil
+}
+
+func (d *treeDoc) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if d.format == FormatJSON {
+		if err := writeJSONNode(&buf, d.root, ""); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.doc); err != nil {
+		return nil, fmt.Errorf("encoding yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+const jsonIndent = "  "
+
+// writeJSONNode writes a node parsed from JSON back as indented JSON, keeping
+// key order.
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node, indent string) error {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			buf.WriteString(indent + jsonIndent)
+			writeJSONString(buf, n.Content[i].Value)
+			buf.WriteString(": ")
+			if err := writeJSONNode(buf, n.Content[i+1], indent+jsonIndent); err != nil {
+				return err
+			}
+			if i+2 < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range n.Content {
+			buf.WriteString(indent + jsonIndent)
+			if err := writeJSONNode(buf, item, indent+jsonIndent); err != nil {
+				return err
+			}
+			if i+1 < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!bool", "!!int", "!!float":
+			buf.WriteString(n.Value)
+		default:
+			writeJSONString(buf, n.Value)
+		}
+	case yaml.AliasNode:
+		return writeJSONNode(buf, n.Alias, indent)
+	default:
+		return fmt.Errorf("encoding json: unexpected node kind %d", n.Kind)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	var tmp bytes.Buffer
+	enc := json.NewEncoder(&tmp)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Write(bytes.TrimRight(tmp.Bytes(), "\n"))
+}
+
+// kvLine is one line of a dotenv or INI file. Key lines are split into the
+// text before the value (key, separator and spacing) and the value.
+type kvLine struct {
+	text    string // the whole line for comments, blanks and section headers; the text before the value for key lines
+	key     string // empty unless this is a key line
+	value   string
+	section string // INI section the line belongs to
+}
+
+func (l kvLine) String() string {
+	if l.key == "" {
+		return l.text
+	}
+	if strings.Contains(l.value, "\n") {
+		return l.text + `"""` + l.value + `"""`
+	}
+	return l.text + l.value
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func joinLines(lines []kvLine) []byte {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l.String())
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// splitKeyLine splits "key = value" into the prefix "key = " and "value".
+func splitKeyLine(line string) (prefix, key, value string, ok bool) {
+	i := strings.Index(line, "=")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	rest := line[i+1:]
+	value = strings.TrimLeft(rest, " \t")
+	return line[:len(line)-len(value)], strings.TrimSpace(line[:i]), strings.TrimRight(value, " \t\r"), true
+}
+
+// dotenvDoc is a KEY=value file. The sops metadata is stored in sops_*
+// keys.
+type dotenvDoc struct {
+	lines []kvLine
+}
+
+const dotenvMetadataPrefix = sopsMetadataKey + "_"
+
+func parseDotenvDoc(data []byte) *dotenvDoc {
+	d := &dotenvDoc{}
+	for _, line := range splitLines(data) {
+		trimmed := strings.TrimSpace(line)
+		prefix, key, value, ok := splitKeyLine(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || !ok {
+			d.lines = append(d.lines, kvLine{text: line})
+			continue
+		}
+		d.lines = append(d.lines, kvLine{text: prefix, key: key, value: value})
+	}
+	return d
+}
+
+func (d *dotenvDoc) walk(fn walkFunc) error {
+	for i := range d.lines {
+		l := &d.lines[i]
+		if l.key == "" {
+			text, err := walkCommentLine(l.text, "#", nil, "", fn)
+			if err != nil {
+				return err
+			}
+			l.text = text
+			continue
+		}
+		if strings.HasPrefix(l.key, dotenvMetadataPrefix) {
+			continue
+		}
+		out, err := fn([]string{l.key}, l.key, l.value)
+		if err != nil {
+			return err
+		}
+		l.value = fmt.Sprint(out)
+	}
+	return nil
+}
+
+func (d *dotenvDoc) metadata() (*sopsMetadata, error) {
+	flat := make(map[string]string)
+	for _, l := range d.lines {
+		if strings.HasPrefix(l.key, dotenvMetadataPrefix) {
+			flat[strings.TrimPrefix(l.key, dotenvMetadataPrefix)] = strings.ReplaceAll(l.value, `\n`, "\n")
+		}
+	}
+	return unflattenMetadata(flat)
+}
+
+func (d *dotenvDoc) setMetadata(m *sopsMetadata) error {
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if !strings.HasPrefix(l.key, dotenvMetadataPrefix) {
+			kept = append(kept, l)
+		}
+	}
+	d.lines = kept
+	if m == nil {
+		return nil
+	}
+	flat := flattenMetadata(m)
+	for _, k := range sortedKeys(flat) {
+		key := dotenvMetadataPrefix + k
+		d.lines = append(d.lines, kvLine{text: key + "=", key: key, value: strings.ReplaceAll(flat[k], "\n", `\n`)})
+	}
+	return nil
+}
+
+func (d *dotenvDoc) marshal() ([]byte, error) {
+	return joinLines(d.lines), nil
+}
+
+// iniDoc is an INI file. Keys before the first section belong to DEFAULT;
+// the sops metadata is stored in a [sops] section.
+type iniDoc struct {
+	lines []kvLine
+}
+
+const iniDefaultSection = "DEFAULT"
+
+func parseINIDoc(data []byte) (*iniDoc, error) {
+	d := &iniDoc{}
+	section := iniDefaultSection
+	lines := splitLines(data)
+	for n := 0; n < len(lines); n++ {
+		line := lines[n]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			d.lines = append(d.lines, kvLine{text: line, section: section})
+			continue
+		}
+		prefix, key, value, ok := splitKeyLine(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") || !ok {
+			d.lines = append(d.lines, kvLine{text: line, section: section})
+			continue
+		}
+
+		// A """-quoted value may span several lines.
+		if strings.HasPrefix(value, `"""`) {
+			value = strings.TrimPrefix(value, `"""`)
+			for !strings.HasSuffix(value, `"""`) {
+				n++
+				if n >= len(lines) {
+					return nil, fmt.Errorf("parsing ini: unterminated \"\"\" value for %s", key)
+				}
+				value += "\n" + lines[n]
+			}
+			value = strings.TrimSuffix(value, `"""`)
+		}
+		d.lines = append(d.lines, kvLine{text: prefix, key: key, value: value, section: section})
+	}
+	return d, nil
+}
+
+func (d *iniDoc) walk(fn walkFunc) error {
+	for i := range d.lines {
+		l := &d.lines[i]
+		if l.section == sopsMetadataKey {
+			continue
+		}
+		if l.key == "" {
+			marker := "#"
+			if strings.HasPrefix(strings.TrimSpace(l.text), ";") {
+				marker = ";"
+			}
+			text, err := walkCommentLine(l.text, marker, []string{l.section}, l.section, fn)
+			if err != nil {
+				return err
+			}
+			l.text = text
+			continue
+		}
+		key := l.key
+		if l.section != iniDefaultSection {
+			key = l.section + "." + l.key
+		}
+		out, err := fn([]string{l.section, l.key}, key, l.value)
+		if err != nil {
+			return err
+		}
+		l.value = fmt.Sprint(out)
+	}
+	return nil
+}
+
+func (d *iniDoc) metadata() (*sopsMetadata, error) {
+	flat := make(map[string]string)
+	for _, l := range d.lines {
+		if l.key != "" && l.section == sopsMetadataKey {
+			flat[l.key] = l.value
+		}
+	}
+	return unflattenMetadata(flat)
+}
+
+func (d *iniDoc) setMetadata(m *sopsMetadata) error {
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if l.section != sopsMetadataKey {
+			kept = append(kept, l)
+		}
+	}
+	d.lines = kept
+	for len(d.lines) > 0 && d.lines[len(d.lines)-1].key == "" && strings.TrimSpace(d.lines[len(d.lines)-1].text) == "" {
+		d.lines = d.lines[:len(d.lines)-1]
+	}
+	if m == nil {
+		return nil
+	}
+
+	if len(d.lines) > 0 {
+		d.lines = append(d.lines, kvLine{})
+	}
+	d.lines = append(d.lines, kvLine{text: "[" + sopsMetadataKey + "]", section: sopsMetadataKey})
+	flat := flattenMetadata(m)
+	for _, k := range sortedKeys(flat) {
+		d.lines = append(d.lines, kvLine{text: k + " = ", key: k, value: flat[k], section: sopsMetadataKey})
+	}
+	return nil
+}
+
+func (d *iniDoc) marshal() ([]byte, error) {
+	return joinLines(d.lines), nil
+}
+
+// flattenMetadata turns the metadata into the flat keys sops uses for dotenv
+// and INI files, such as age__list_0__map_recipient.
+func flattenMetadata(m *sopsMetadata) map[string]string {
+	flat := map[string]string{
+		"lastmodified": m.LastModified,
+		"mac":          m.MAC,
+		"version":      m.Version,
+	}
+	if m.UnencryptedSuffix != "" {
+		flat["unencrypted_suffix"] = m.UnencryptedSuffix
+	}
+	for i, k := range m.Age {
+		flat[fmt.Sprintf("age__list_%d__map_recipient", i)] = k.Recipient
+		flat[fmt.Sprintf("age__list_%d__map_enc", i)] = k.Enc
+	}
+	return flat
+}
+
+// unflattenMetadata reverses flattenMetadata; it returns nil when flat is
+// empty. Keys of other sops key types (kms, pgp, ...) are ignored.
+func unflattenMetadata(flat map[string]string) (*sopsMetadata, error) {
+	if len(flat) == 0 {
+		return nil, nil
+	}
+	m := &sopsMetadata{
+		LastModified:      flat["lastmodified"],
+		MAC:               flat["mac"],
+		UnencryptedSuffix: flat["unencrypted_suffix"],
+		Version:           flat["version"],
+	}
+	for k, v := range flat {
+		rest, ok := strings.CutPrefix(k, "age__list_")
+		if !ok {
+			continue
+		}
+		index, field, ok := strings.Cut(rest, "__map_")
+		i, err := strconv.Atoi(index)
+		if !ok || err != nil || i < 0 || i > len(flat) {
+			return nil, fmt.Errorf("malformed %s metadata key %q", sopsMetadataKey, k)
+		}
+		for len(m.Age) <= i {
+			m.Age = append(m.Age, sopsAgeKey{})
+		}
+		switch field {
+		case "recipient":
+			m.Age[i].Recipient = v
+		case "enc":
+			m.Age[i].Enc = v
+		}
+	}
+	return m, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,216 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStructuredRoundTrip(t *testing.T) {
+	id, err := GenerateIdentity(filepath.Join(t.TempDir(), "age-identity.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+
+	tests := []struct {
+		format    StructuredFormat
+		plaintext string
+		visible   []string // keys that must stay readable
+		hidden    []string // values that must not appear
+	}{
+		{
+			format:    FormatYAML,
+			plaintext: "# database settings\ndatabase:\n  host: db.internal\n  port: 5432\n  password: hunter2 # rotated monthly\n  tls: true\n  ratio: 0.5\nservers:\n  - alpha\n  - beta\nempty: null\n",
+			visible:   []string{"database:", "host:", "password:", "servers:", "#ENC[AES256_GCM,"},
+			hidden:    []string{"hunter2", "db.internal", "alpha", "5432", "database settings", "rotated monthly"},
+		},
+		{
+			format:    FormatJSON,
+			plaintext: "{\n  \"api\": {\n    \"token\": \"s3cret\",\n    \"retries\": 3,\n    \"debug\": false\n  },\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ],\n  \"note\": null\n}\n",
+			visible:   []string{`"api"`, `"token"`, `"retries"`, `"tags"`},
+			hidden:    []string{"s3cret"},
+		},
+		{
+			format:    FormatDotenv,
+			plaintext: "# tokens\nAPI_KEY=sk-test-12345\nDB_PASS = hunter2\n\nEMPTY=\n",
+			visible:   []string{"API_KEY=", "DB_PASS = ", "#ENC[AES256_GCM,", "EMPTY=\n"},
+			hidden:    []string{"sk-test-12345", "hunter2", "tokens"},
+		},
+		{
+			format:    FormatINI,
+			plaintext: "top = level\n\n[database]\nuser = admin\npassword = hunter2\n; legacy creds\n[cache]\nttl=60\n",
+			visible:   []string{"[database]", "user = ", "password = ", ";ENC[AES256_GCM,", "ttl="},
+			hidden:    []string{"hunter2", "admin", "level", "legacy creds"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.format), func(t *testing.T) {
+			ciphertext, err := EncryptStructured([]byte(tc.plaintext), tc.format, id.PublicKey)
+			if err != nil {
+				t.Fatalf("EncryptStructured: %v", err)
+			}
+			for _, s := range tc.visible {
+				if !strings.Contains(string(ciphertext), s) {
+					t.Errorf("ciphertext lost %q:\n%s", s, ciphertext)
+				}
+			}
+			for _, s := range tc.hidden {
+				if strings.Contains(string(ciphertext), s) {
+					t.Errorf("ciphertext leaks %q:\n%s", s, ciphertext)
+				}
+			}
+			if !strings.Contains(string(ciphertext), "ENC[AES256_GCM,data:") || !strings.Contains(string(ciphertext), id.PublicKey) {
+				t.Errorf("ciphertext lacks sops values or metadata:\n%s", ciphertext)
+			}
+
+			plain, err := DecryptStructured(ciphertext, tc.format, id)
+			if err != nil {
+				t.Fatalf("DecryptStructured: %v", err)
+			}
+			if string(plain) != tc.plaintext {
+				t.Errorf("round trip =\n%s\nwant\n%s", plain, tc.plaintext)
+			}
+		})
+	}
+}
+
+func TestStructuredTamperingDetected(t *testing.T) {
+	id, err := GenerateIdentity(filepath.Join(t.TempDir(), "age-identity.txt"))
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	ciphertext, err := EncryptStructured([]byte("user: admin\npassword: hunter2\n"), FormatYAML, id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+
+	// Swapping two encrypted values breaks their key binding.
+	lines := strings.Split(string(ciphertext), "\n")
+	userValue := strings.TrimPrefix(lines[0], "user: ")
+	passValue := strings.TrimPrefix(lines[1], "password: ")
+	lines[0], lines[1] = "user: "+passValue, "password: "+userValue
+	if _, err := DecryptStructured([]byte(strings.Join(lines, "\n")), FormatYAML, id); err == nil {
+		t.Error("decrypted values moved between keys")
+	}
+
+	// Dropping a key changes the MAC.
+	dropped := strings.Join(append([]string{}, strings.Split(string(ciphertext), "\n")[1:]...), "\n")
+	if _, err := DecryptStructured([]byte(dropped), FormatYAML, id); err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Errorf("DecryptStructured after removing a key: err = %v, want MAC mismatch", err)
+	}
+
+	other, _ := GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+	if _, err := DecryptStructured(ciphertext, FormatYAML, other); err == nil {
+		t.Error("decrypted with an identity that is not a recipient")
+	}
+}
+
+func TestStructuredUnencryptedSuffix(t *testing.T) {
+	id, _ := GenerateIdentity(filepath.Join(t.TempDir(), "age-identity.txt"))
+	ciphertext, err := EncryptStructured([]byte("region_unencrypted: eu-west-1\ntoken: abc\n"), FormatYAML, id.PublicKey)
+	if err != nil {
+		t.Fatalf("EncryptStructured: %v", err)
+	}
+	if !strings.Contains(string(ciphertext), "region_unencrypted: eu-west-1") {
+		t.Errorf("_unencrypted value was encrypted:\n%s", ciphertext)
+	}
+	if _, err := EncryptStructured(ciphertext, FormatYAML, id.PublicKey); err == nil {
+		t.Error("expected error encrypting an already encrypted document")
+	}
+}
+
+func TestEncryptStructuredFile(t *testing.T) {
+	repoRoot, idPath, id := setupRepo(t)
+
+	content := "db:\n  password: hunter2\n"
+	if err := os.WriteFile(filepath.Join(repoRoot, "config.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	encRel, err := Encrypt(repoRoot, "config.yaml", EncryptOptions{Structured: true})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if encRel != "config.enc.yaml" {
+		t.Errorf("encrypted path = %q", encRel)
+	}
+	encPath := filepath.Join(repoRoot, encRel)
+	data, _ := os.ReadFile(encPath)
+	if !IsStructuredCiphertext(encPath, data) || IsAgeCiphertext(data) {
+		t.Fatalf("not a structured ciphertext:\n%s", data)
+	}
+
+	plain, _, err := Decrypt(repoRoot, encRel, DecryptOptions{IdentityPath: idPath, Stdout: true, Keep: true})
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plain) != content {
+		t.Errorf("plaintext = %q, want %q", plain, content)
+	}
+
+	// Adding a recipient keeps the file value-encrypted.
+	other, _ := GenerateIdentity(filepath.Join(t.TempDir(), "other.txt"))
+	if _, err := AddRecipient(repoRoot, other.PublicKey, RecipientOptions{IdentityPath: idPath}); err != nil {
+		t.Fatalf("AddRecipient: %v", err)
+	}
+	data, _ = os.ReadFile(encPath)
+	if !IsStructuredCiphertext(encPath, data) {
+		t.Fatalf("re-encrypted file is no longer structured:\n%s", data)
+	}
+	for _, who := range []*Identity{id, other} {
+		if plain, err := DecryptFileWithIdentity(encPath, who); err != nil || string(plain) != content {
+			t.Errorf("decrypt with %s = %q, %v", who.PublicKey, plain, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(repoRoot, "api.key"), []byte("k"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := Encrypt(repoRoot, "api.key", EncryptOptions{Structured: true}); err == nil {
+		t.Error("expected error for a format without structure")
+	}
+}
+
+func TestDiffStructured(t *testing.T) {
+	oldDoc := []byte("db:\n  user: admin\n  password: one\nservers:\n  - a\n  - b\n")
+	newDoc := []byte("db:\n  user: admin\n  password: two\nservers:\n  - a\ncache: true\n")
+
+	changes, err := DiffStructured(oldDoc, newDoc, FormatYAML)
+	if err != nil {
+		t.Fatalf("DiffStructured: %v", err)
+	}
+	want := []StructuredChange{
+		{Key: "db.password", Kind: "changed"},
+		{Key: "servers[1]", Kind: "removed"},
+		{Key: "cache", Kind: "added"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestStructuredFormatOf(t *testing.T) {
+	tests := map[string]StructuredFormat{
+		"config.enc.yaml":    FormatYAML,
+		"a/b.yml":            FormatYAML,
+		"settings.enc.json":  FormatJSON,
+		".env.enc":           FormatDotenv,
+		".env.enc.local":     FormatDotenv,
+		"prod.env":           FormatDotenv,
+		"php.enc.ini":        FormatINI,
+		"api.enc.key":        "",
+		"archive.tar.enc.gz": "",
+	}
+	for name, want := range tests {
+		got, ok := StructuredFormatOf(name)
+		if got != want || ok != (want != "") {
+			t.Errorf("StructuredFormatOf(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+}
@@ -44,7 +44,9 @@ func newDotctlBridge() (*dotctlBridge, error) {
 }
 
 func (b *dotctlBridge) status(ctx context.Context) (types.StatusResponse, error) {
-	data, err := b.run(ctx, "status", "--json")
+	// Fetch so "updates available" reflects the remote, at most every
+	// statusFetchMaxAge rather than on every poll.
+	data, err := b.run(ctx, "status", "--json", "--fetch", "--fetch-max-age", statusFetchMaxAge.String())
 	if err != nil {
 		return types.StatusResponse{}, err
 	}
@@ -16,6 +16,7 @@ import (
 const (
 	pollInterval       = 60 * time.Second
 	statusTimeout      = 20 * time.Second
+	statusFetchMaxAge  = 15 * time.Minute
 	defaultCmdTimeout  = 90 * time.Second
 	syncCmdTimeout     = 10 * time.Minute
 	maxErrorLineLength = 72
@@ -231,9 +232,15 @@ func resolveState(status types.StatusResponse) (trayState, string) {
 	if len(status.Errors) > 0 || !status.Auth.OK || status.Symlinks.Broken > 0 || status.Repo.Status == "error" || status.Repo.Status == "not_git_repo" {
 		return stateError, "error"
 	}
+	if status.Repo.RebaseInProgress || status.Repo.MergeInProgress {
+		return stateWarn, "conflicts to resolve"
+	}
 	if status.Symlinks.Drift > 0 || status.Repo.Status == "dirty" {
 		return stateWarn, fmt.Sprintf("drift (%d/%d ok)", status.Symlinks.OK, status.Symlinks.Total)
 	}
+	if status.Repo.Behind > 0 {
+		return stateOK, fmt.Sprintf("%d update(s) available", status.Repo.Behind)
+	}
 	if status.Symlinks.Total == 0 {
 		return stateWarn, "no managed symlinks"
 	}
@@ -17,6 +17,11 @@ struct RepoStatus: Decodable {
     let branch: String?
     let lastCommit: String?
     let lastSync: String?
+    let ahead: Int?
+    let behind: Int?
+    let lastFetch: String?
+    let rebaseInProgress: Bool?
+    let mergeInProgress: Bool?
 
     enum CodingKeys: String, CodingKey {
         case url
@@ -24,6 +29,11 @@ struct RepoStatus: Decodable {
         case branch
         case lastCommit = "last_commit"
         case lastSync = "last_sync"
+        case ahead
+        case behind
+        case lastFetch = "last_fetch"
+        case rebaseInProgress = "rebase_in_progress"
+        case mergeInProgress = "merge_in_progress"
     }
 }
 
@@ -79,7 +89,8 @@ final class DotctlBridge {
     }
 
     func status() throws -> DotctlStatus {
-        let output = try run(["status", "--json"])
+        // Fetch at most every 15 minutes so "updates available" stays current.
+        let output = try run(["status", "--json", "--fetch", "--fetch-max-age", "15m"])
         do {
             return try decoder.decode(DotctlStatus.self, from: output)
         } catch {
@@ -115,9 +115,17 @@ final class StatusBarController: NSObject, UNUserNotificationCenterDelegate {
         let summary: String
         switch state {
         case .synced:
-            summary = "synced (\(status.symlinks.ok)/\(status.symlinks.total) ok)"
+            if let behind = status.repo.behind, behind > 0 {
+                summary = "\(behind) update(s) available"
+            } else {
+                summary = "synced (\(status.symlinks.ok)/\(status.symlinks.total) ok)"
+            }
         case .warning:
-            summary = "drift (\(status.symlinks.ok)/\(status.symlinks.total) ok)"
+            if status.repo.rebaseInProgress == true || status.repo.mergeInProgress == true {
+                summary = "conflicts to resolve"
+            } else {
+                summary = "drift (\(status.symlinks.ok)/\(status.symlinks.total) ok)"
+            }
         case .error:
             summary = "error"
         case .syncing:
@@ -133,6 +141,9 @@ final class StatusBarController: NSObject, UNUserNotificationCenterDelegate {
         if !status.errors.isEmpty || !status.auth.ok || status.symlinks.broken > 0 || status.repo.status == "error" || status.repo.status == "not_git_repo" {
             return .error
         }
+        if status.repo.rebaseInProgress == true || status.repo.mergeInProgress == true {
+            return .warning
+        }
         if status.symlinks.drift > 0 || status.repo.status == "dirty" {
             return .warning
         }
@@ -20,6 +20,18 @@ type RepoStatus struct {
 	Branch     string `json:"branch,omitempty"`
 	LastCommit string `json:"last_commit,omitempty"`
 	LastSync   string `json:"last_sync,omitempty"`
+	// Upstream is the remote branch HEAD tracks; Ahead and Behind count the
+	// commits only on HEAD and only on Upstream, as of the last fetch.
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	// Untracked counts files in the repo that git does not track yet.
+	Untracked int `json:"untracked"`
+	// LastFetch is when origin was last fetched (`status --fetch`, pull or
+	// sync), in the LastSync format.
+	LastFetch        string `json:"last_fetch,omitempty"`
+	RebaseInProgress bool   `json:"rebase_in_progress"`
+	MergeInProgress  bool   `json:"merge_in_progress"`
 }
 
 type SymlinkStatus struct {
@@ -33,7 +45,7 @@ type SymlinkStatus struct {
 type SymlinkDetail struct {
 	Source string `json:"source"`
 	Target string `json:"target"`
-	Status string `json:"status"` // "ok", "broken", "drift"
+	Status string `json:"status"` // "ok", "broken", "drift", "perm_drift"
 	Error  string `json:"error,omitempty"`
 }
 